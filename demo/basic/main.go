@@ -67,6 +67,14 @@ func Underscore(_ int, _ float32) {}
 
 func Ellipsis(p1 ...string) {}
 
+// Fragile panics on a non-positive number, the around hook recovers it.
+func Fragile(n int) int {
+	if n <= 0 {
+		panic("non-positive number")
+	}
+	return n * 2
+}
+
 // FunctionA is the parent function that calls FunctionB.
 // It receives a context as the first parameter, which will be instrumented.
 func FunctionA(ctx context.Context) {
@@ -77,6 +85,25 @@ func FunctionA(ctx context.Context) {
 // It receives a context as the first parameter, which will be instrumented.
 func FunctionB(ctx context.Context) {}
 
+// Checkout is traced by the directive, without any rule or hook code.
+//
+//otel:span name="checkout" attrs="order.id=orderID"
+func Checkout(orderID string) error {
+	fmt.Printf("Checkout: %s\n", orderID)
+	return nil
+}
+
+// Hot stands for a function on the hot path, its hooks do not let the hook
+// context escape, so that it's allocated on the stack.
+func Hot(n int) (int, error) {
+	return n + 1, nil
+}
+
+// HotEscape is the same as Hot, but its hook lets the hook context escape.
+func HotEscape(n int) (int, error) {
+	return n + 1, nil
+}
+
 func main() {
 	ctx := &traceContext{
 		traceID: "123",
@@ -111,5 +138,15 @@ func main() {
 
 	Underscore(1, 2)
 
+	fmt.Printf("Fragile: %d\n", Fragile(0))
+
 	FunctionA(context.Background())
+
+	_ = Checkout("42")
+
+	hot, _ := Hot(1)
+	fmt.Printf("Hot: %d\n", hot)
+
+	hotEscape, _ := HotEscape(1)
+	fmt.Printf("HotEscape: %d\n", hotEscape)
 }
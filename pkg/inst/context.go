@@ -5,7 +5,9 @@ package inst
 
 // !!! pkg/inst/context.go will auto-sync to tool/internal/instrument/api.tmpl
 type HookContext interface {
-	// Set the skip call flag, can be used to skip the original function call
+	// Set the skip call flag, can be used to skip the original function call.
+	// The hooks of rules with higher order are skipped as well, while the After
+	// hooks of rules with lower order see the flag set
 	SetSkipCall(bool)
 	// Get the skip call flag, can be used to skip the original function call
 	IsSkipCall() bool
@@ -13,23 +15,23 @@ type HookContext interface {
 	SetData(interface{})
 	// Get the data field, can be used to pass information between Before and After hooks
 	GetData() interface{}
-	// Get a value from the data field by key
+	// Get the value of a key, or of the key of a map[string]interface{} data field
 	GetKeyData(key string) interface{}
-	// Set a key-value pair in the data field
+	// Set the value of a key, kept apart from the data field
 	SetKeyData(key string, val interface{})
-	// Check if a key exists in the data field
+	// Check if a key has been set, or is set in a map[string]interface{} data field
 	HasKeyData(key string) bool
 	// Number of original function parameters
 	GetParamCount() int
-	// Get the original function parameter at index idx
+	// Get the original function parameter at index idx, panics if it's out of range
 	GetParam(idx int) interface{}
-	// Change the original function parameter at index idx
+	// Change the original function parameter at index idx, panics if it's out of range
 	SetParam(idx int, val interface{})
 	// Number of original function return values
 	GetReturnValCount() int
-	// Get the original function return value at index idx
+	// Get the original function return value at index idx, panics if it's out of range
 	GetReturnVal(idx int) interface{}
-	// Change the original function return value at index idx
+	// Change the original function return value at index idx, panics if it's out of range
 	SetReturnVal(idx int, val interface{})
 	// Get the original function name
 	GetFuncName() string
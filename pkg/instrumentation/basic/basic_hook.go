@@ -97,12 +97,8 @@ func MyHookGenericBefore(ictx inst.HookContext, _, _ interface{}) {
 	fmt.Printf("[Generic] Skip call: %v\n", ictx.IsSkipCall())
 	ictx.SetData("test-data")
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("[Generic] SetParam panic (expected): %v\n", r)
-		}
-	}()
-	ictx.SetParam(0, 999)
+	fmt.Printf("[Generic] Params: %v %v\n", ictx.GetParam(0), ictx.GetParam(1))
+	ictx.SetParam(1, 3)
 }
 
 func MyHookGenericAfter(ictx inst.HookContext, _ interface{}) {
@@ -110,12 +106,15 @@ func MyHookGenericAfter(ictx inst.HookContext, _ interface{}) {
 	fmt.Printf("[Generic] Data from Before: %v\n", ictx.GetData())
 	fmt.Printf("[Generic] Return value count: %d\n", ictx.GetReturnValCount())
 
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Printf("[Generic] SetReturnVal panic (expected): %v\n", r)
-		}
+	fmt.Printf("[Generic] Return value: %v\n", ictx.GetReturnVal(0))
+	ictx.SetReturnVal(0, 4)
+	fmt.Printf("[Generic] Replaced return value: %v\n", ictx.GetReturnVal(0))
+	func() {
+		defer func() {
+			fmt.Printf("[Generic] Out of range return value: %v\n", recover())
+		}()
+		ictx.SetReturnVal(1, 4)
 	}()
-	ictx.SetReturnVal(0, 999)
 }
 
 func BeforeUnderscore(ictx inst.HookContext, _ int, _ float32) {
@@ -126,6 +125,17 @@ func MyHookEllipsisBefore(ictx inst.HookContext, p1 ...string) {
 	println("Ellipsis")
 }
 
+func MyHookAround(ictx inst.HookContext, proceed func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[Around] recovered: %v\n", r)
+			ictx.SetReturnVal(0, -1)
+		}
+	}()
+	fmt.Printf("[Around] proceed with %v\n", ictx.GetParam(0))
+	proceed()
+}
+
 func FunctionABefore(ictx inst.HookContext, ctx context.Context) {
 	ctx, span := tracer.Start(ctx, "FunctionA")
 	ictx.SetParam(0, ctx)
@@ -145,3 +155,21 @@ func FunctionBBefore(ictx inst.HookContext, ctx context.Context) {
 		span.SpanContext().SpanID().String(),
 	)
 }
+
+func HotBefore(ictx inst.HookContext, _ int) {
+	ictx.SetKeyData("hot", true)
+}
+
+func HotAfter(ictx inst.HookContext, r int, _ error) {
+	if ictx.HasKeyData("hot") {
+		ictx.SetReturnVal(0, r*2)
+	}
+}
+
+// lastHotContext retains the hook context, which makes it escape to heap
+var lastHotContext inst.HookContext
+
+func HotEscapeBefore(ictx inst.HookContext, _ int) {
+	lastHotContext = ictx
+	ictx.SetKeyData("hot", true)
+}
@@ -120,12 +120,10 @@ func BeforeRoundTrip(ictx inst.HookContext, transport *http.Transport, req *http
 	ictx.SetParam(requestParamIndex, newReq)
 
 	// Store data for after hook
-	ictx.SetData(map[string]interface{}{
-		"ctx":   ctx,
-		"span":  span,
-		"req":   req,
-		"start": time.Now(),
-	})
+	ictx.SetKeyData("ctx", ctx)
+	ictx.SetKeyData("span", span)
+	ictx.SetKeyData("req", req)
+	ictx.SetKeyData("start", time.Now())
 }
 
 func AfterRoundTrip(ictx inst.HookContext, res *http.Response, err error) {
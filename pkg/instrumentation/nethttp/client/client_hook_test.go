@@ -27,6 +27,7 @@ type mockHookContext struct {
 	params      map[int]interface{}
 	returnVals  map[int]interface{}
 	data        interface{}
+	keyData     map[string]interface{}
 	funcName    string
 	packageName string
 	skipCall    bool
@@ -36,6 +37,7 @@ func newMockHookContext() *mockHookContext {
 	return &mockHookContext{
 		params:      make(map[int]interface{}),
 		returnVals:  make(map[int]interface{}),
+		keyData:     make(map[string]interface{}),
 		funcName:    "mockFunc",
 		packageName: "mock",
 	}
@@ -82,37 +84,15 @@ func (m *mockHookContext) GetData() interface{} {
 }
 
 func (m *mockHookContext) GetKeyData(key string) interface{} {
-	if m.data == nil {
-		return nil
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-	return dataMap[key]
+	return m.keyData[key]
 }
 
 func (m *mockHookContext) SetKeyData(key string, val interface{}) {
-	if m.data == nil {
-		m.data = make(map[string]interface{})
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		m.data = make(map[string]interface{})
-		dataMap = m.data.(map[string]interface{})
-	}
-	dataMap[key] = val
+	m.keyData[key] = val
 }
 
 func (m *mockHookContext) HasKeyData(key string) bool {
-	if m.data == nil {
-		return false
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		return false
-	}
-	_, exists := dataMap[key]
+	_, exists := m.keyData[key]
 	return exists
 }
 
@@ -228,11 +208,7 @@ func TestBeforeRoundTrip(t *testing.T) {
 				assert.Equal(t, 0, len(spans), "span should not be ended in Before hook")
 
 				// Check that data was stored
-				data, ok := mockCtx.GetData().(map[string]interface{})
-				require.True(t, ok, "data should be stored")
-				require.NotNil(t, data, "data should not be nil")
-
-				span, ok := data["span"].(trace.Span)
+				span, ok := mockCtx.GetKeyData("span").(trace.Span)
 				require.True(t, ok, "span should be in data")
 				require.NotNil(t, span, "span should not be nil")
 
@@ -250,8 +226,7 @@ func TestBeforeRoundTrip(t *testing.T) {
 				}
 			} else {
 				// No span should be created
-				data := mockCtx.GetData()
-				assert.Nil(t, data, "no data should be stored when instrumentation disabled")
+				assert.False(t, mockCtx.HasKeyData("span"), "no data should be stored when instrumentation disabled")
 			}
 		})
 	}
@@ -277,11 +252,9 @@ func TestAfterRoundTrip(t *testing.T) {
 				ctx, span := testTracer.Start(context.Background(), "GET", trace.WithSpanKind(trace.SpanKindClient))
 
 				mockCtx := newMockHookContext()
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-					"req":  req,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
+				mockCtx.SetKeyData("req", req)
 				return mockCtx
 			},
 			response: &http.Response{
@@ -306,11 +279,9 @@ func TestAfterRoundTrip(t *testing.T) {
 				ctx, span := testTracer.Start(context.Background(), "GET", trace.WithSpanKind(trace.SpanKindClient))
 
 				mockCtx := newMockHookContext()
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-					"req":  req,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
+				mockCtx.SetKeyData("req", req)
 				return mockCtx
 			},
 			response: nil,
@@ -338,11 +309,9 @@ func TestAfterRoundTrip(t *testing.T) {
 				ctx, span := testTracer.Start(context.Background(), "GET", trace.WithSpanKind(trace.SpanKindClient))
 
 				mockCtx := newMockHookContext()
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-					"req":  req,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
+				mockCtx.SetKeyData("req", req)
 				return mockCtx
 			},
 			response: &http.Response{
@@ -368,11 +337,9 @@ func TestAfterRoundTrip(t *testing.T) {
 				ctx, span := testTracer.Start(context.Background(), "GET", trace.WithSpanKind(trace.SpanKindClient))
 
 				mockCtx := newMockHookContext()
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-					"req":  req,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
+				mockCtx.SetKeyData("req", req)
 				return mockCtx
 			},
 			response: &http.Response{
@@ -415,11 +382,9 @@ func TestAfterRoundTrip(t *testing.T) {
 				ctx, span := testTracer.Start(context.Background(), "GET", trace.WithSpanKind(trace.SpanKindClient))
 
 				mockCtx := newMockHookContext()
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-					"req":  req,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
+				mockCtx.SetKeyData("req", req)
 				return mockCtx
 			},
 			response: &http.Response{
@@ -126,11 +126,9 @@ func BeforeServeHTTP(ictx inst.HookContext, recv interface{}, w http.ResponseWri
 	ictx.SetParam(requestIndex, newReq)
 
 	// Store data for after hook
-	ictx.SetData(map[string]interface{}{
-		"ctx":   ctx,
-		"span":  span,
-		"start": time.Now(),
-	})
+	ictx.SetKeyData("ctx", ctx)
+	ictx.SetKeyData("span", span)
+	ictx.SetKeyData("start", time.Now())
 }
 
 func AfterServeHTTP(ictx inst.HookContext) {
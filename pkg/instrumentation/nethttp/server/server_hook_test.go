@@ -26,6 +26,7 @@ type mockHookContext struct {
 	params      map[int]interface{}
 	returnVals  map[int]interface{}
 	data        interface{}
+	keyData     map[string]interface{}
 	funcName    string
 	packageName string
 	skipCall    bool
@@ -35,6 +36,7 @@ func newMockHookContext() *mockHookContext {
 	return &mockHookContext{
 		params:      make(map[int]interface{}),
 		returnVals:  make(map[int]interface{}),
+		keyData:     make(map[string]interface{}),
 		funcName:    "mockFunc",
 		packageName: "mock",
 	}
@@ -81,37 +83,15 @@ func (m *mockHookContext) GetData() interface{} {
 }
 
 func (m *mockHookContext) GetKeyData(key string) interface{} {
-	if m.data == nil {
-		return nil
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-	return dataMap[key]
+	return m.keyData[key]
 }
 
 func (m *mockHookContext) SetKeyData(key string, val interface{}) {
-	if m.data == nil {
-		m.data = make(map[string]interface{})
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		m.data = make(map[string]interface{})
-		dataMap = m.data.(map[string]interface{})
-	}
-	dataMap[key] = val
+	m.keyData[key] = val
 }
 
 func (m *mockHookContext) HasKeyData(key string) bool {
-	if m.data == nil {
-		return false
-	}
-	dataMap, ok := m.data.(map[string]interface{})
-	if !ok {
-		return false
-	}
-	_, exists := dataMap[key]
+	_, exists := m.keyData[key]
 	return exists
 }
 
@@ -231,11 +211,7 @@ func TestBeforeServeHTTP(t *testing.T) {
 				assert.Equal(t, 0, len(spans), "span should not be ended in Before hook")
 
 				// Check that data was stored
-				data, ok := mockCtx.GetData().(map[string]interface{})
-				require.True(t, ok, "data should be stored")
-				require.NotNil(t, data, "data should not be nil")
-
-				span, ok := data["span"].(trace.Span)
+				span, ok := mockCtx.GetKeyData("span").(trace.Span)
 				require.True(t, ok, "span should be in data")
 				require.NotNil(t, span, "span should not be nil")
 
@@ -260,8 +236,7 @@ func TestBeforeServeHTTP(t *testing.T) {
 				}
 			} else {
 				// No span should be created
-				data := mockCtx.GetData()
-				assert.Nil(t, data, "no data should be stored when instrumentation disabled")
+				assert.False(t, mockCtx.HasKeyData("span"), "no data should be stored when instrumentation disabled")
 			}
 		})
 	}
@@ -294,10 +269,8 @@ func TestAfterServeHTTP(t *testing.T) {
 					statusCode:     200,
 				}
 				mockCtx.SetParam(1, wrapper)
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
 				return mockCtx
 			},
 			statusCode: 200,
@@ -326,10 +299,8 @@ func TestAfterServeHTTP(t *testing.T) {
 					statusCode:     404,
 				}
 				mockCtx.SetParam(1, wrapper)
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
 				return mockCtx
 			},
 			statusCode: 404,
@@ -359,10 +330,8 @@ func TestAfterServeHTTP(t *testing.T) {
 					statusCode:     500,
 				}
 				mockCtx.SetParam(1, wrapper)
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
 				return mockCtx
 			},
 			statusCode: 500,
@@ -405,10 +374,8 @@ func TestAfterServeHTTP(t *testing.T) {
 					statusCode:     200,
 				}
 				mockCtx.SetParam(1, wrapper)
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
 				return mockCtx
 			},
 			statusCode: 200,
@@ -432,10 +399,8 @@ func TestAfterServeHTTP(t *testing.T) {
 
 				mockCtx := newMockHookContext()
 				// Don't set param 1, defaults to 200
-				mockCtx.SetData(map[string]interface{}{
-					"ctx":  ctx,
-					"span": span,
-				})
+				mockCtx.SetKeyData("ctx", ctx)
+				mockCtx.SetKeyData("span", span)
 				return mockCtx
 			},
 			statusCode: 200,
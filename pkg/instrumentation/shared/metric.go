@@ -0,0 +1,118 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package shared
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MetricInstrumentationName is the scoped name of the instruments created by
+// the metric rules, whose code is generated by the tool instead of written as
+// hooks.
+const MetricInstrumentationName = "go.opentelemetry.io/compile-instrumentation/metric"
+
+// metricInstruments holds the instruments of a metric, see StartMetric.
+type metricInstruments struct {
+	calls    metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+	scale    time.Duration // The unit of the durations
+}
+
+// instruments caches the instruments by metric name and unit.
+//
+//nolint:gochecknoglobals // instruments are created once per metric
+var instruments sync.Map
+
+// metricScales maps the units of durations to their scales.
+//
+//nolint:gochecknoglobals // read-only, a map can not be a constant
+var metricScales = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+}
+
+// newMetricInstruments creates the instruments of the metric on the global
+// MeterProvider. The instruments failing to be created are no-ops.
+func newMetricInstruments(name, unit string) *metricInstruments {
+	scale, ok := metricScales[unit]
+	if !ok {
+		unit, scale = "s", time.Second
+	}
+	meter := otel.Meter(MetricInstrumentationName)
+	calls, err := meter.Int64Counter(name+".calls",
+		metric.WithDescription("The number of calls"), metric.WithUnit("{call}"))
+	if err != nil {
+		Logger().Error("failed to create counter", "name", name+".calls", "error", err)
+	}
+	errors, err := meter.Int64Counter(name+".errors",
+		metric.WithDescription("The number of calls returning an error"), metric.WithUnit("{call}"))
+	if err != nil {
+		Logger().Error("failed to create counter", "name", name+".errors", "error", err)
+	}
+	duration, err := meter.Float64Histogram(name+".duration",
+		metric.WithDescription("The duration of calls"), metric.WithUnit(unit))
+	if err != nil {
+		Logger().Error("failed to create histogram", "name", name+".duration", "error", err)
+	}
+	return &metricInstruments{calls: calls, errors: errors, duration: duration, scale: scale}
+}
+
+// Measurement is a call being measured, see StartMetric.
+type Measurement struct {
+	instruments *metricInstruments
+	attrs       attribute.Set
+	start       time.Time
+}
+
+// StartMetric starts measuring a call for the metric of the given name, whose
+// durations are recorded in the given unit, s or ms, with the attributes given
+// as alternating keys and values. The calls are counted by the name.calls
+// counter, the durations by the name.duration histogram and the errors by the
+// name.errors counter. It returns nil if the metric instrumentation is
+// disabled, see Instrumented.
+func StartMetric(name, unit string, kvs ...interface{}) *Measurement {
+	if !Instrumented("metric") {
+		return nil
+	}
+	_ = SetupOTelSDK(MetricInstrumentationName, "")
+	key := name + "\x00" + unit
+	ins, ok := instruments.Load(key)
+	if !ok {
+		ins, _ = instruments.LoadOrStore(key, newMetricInstruments(name, unit))
+	}
+	return &Measurement{
+		instruments: ins.(*metricInstruments),
+		attrs:       attribute.NewSet(SpanAttributes(kvs...)...),
+		start:       time.Now(),
+	}
+}
+
+// EndMetric ends measuring the call started by StartMetric. The call is counted
+// as an error if err is not nil.
+func EndMetric(m *Measurement, err error) {
+	if m == nil {
+		return
+	}
+	ctx := context.Background()
+	ins := m.instruments
+	elapsed := float64(time.Since(m.start)) / float64(ins.scale)
+	if ins.calls != nil {
+		ins.calls.Add(ctx, 1, metric.WithAttributeSet(m.attrs))
+	}
+	if ins.duration != nil {
+		ins.duration.Record(ctx, elapsed, metric.WithAttributeSet(m.attrs))
+	}
+	if err != nil && ins.errors != nil {
+		errType := attribute.String("error.type", fmt.Sprintf("%T", err))
+		ins.errors.Add(ctx, 1, metric.WithAttributeSet(m.attrs), metric.WithAttributes(errType))
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package shared
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestStartEndMetric(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	// Set up the SDK first, so that it does not replace the provider below
+	require.NoError(t, SetupOTelSDK(MetricInstrumentationName, ""))
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	EndMetric(StartMetric("test.repo.get", "ms", "repo.table", "users"), nil)
+	EndMetric(StartMetric("test.repo.get", "ms", "repo.table", "users"), errors.New("not found"))
+	EndMetric(nil, errors.New("ignored"))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, MetricInstrumentationName, rm.ScopeMetrics[0].Scope.Name)
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	table := attribute.String("repo.table", "users")
+
+	calls := metrics["test.repo.get.calls"].Data.(metricdata.Sum[int64])
+	require.Len(t, calls.DataPoints, 1)
+	assert.Equal(t, int64(2), calls.DataPoints[0].Value)
+	assert.Equal(t, attribute.NewSet(table), calls.DataPoints[0].Attributes)
+
+	errs := metrics["test.repo.get.errors"].Data.(metricdata.Sum[int64])
+	require.Len(t, errs.DataPoints, 1)
+	assert.Equal(t, int64(1), errs.DataPoints[0].Value)
+	errType := attribute.String("error.type", "*errors.errorString")
+	assert.Equal(t, attribute.NewSet(table, errType), errs.DataPoints[0].Attributes)
+
+	assert.Equal(t, "ms", metrics["test.repo.get.duration"].Unit)
+	duration := metrics["test.repo.get.duration"].Data.(metricdata.Histogram[float64])
+	require.Len(t, duration.DataPoints, 1)
+	assert.Equal(t, uint64(2), duration.DataPoints[0].Count)
+}
+
+func TestStartMetricDisabled(t *testing.T) {
+	t.Setenv("OTEL_GO_DISABLED_INSTRUMENTATIONS", "metric")
+	assert.Nil(t, StartMetric("test.disabled", "s"))
+}
@@ -208,13 +208,15 @@ func setupTraceProvider(ctx context.Context, res *resource.Resource) error {
 		return err
 	}
 
-	// Create trace provider with batch span processor
+	// Create trace provider with batch span processor, which does not export
+	// the spans dropped by EndSpanAtLeast
+	batcher := sdktrace.NewBatchSpanProcessor(traceExporter,
+		sdktrace.WithBatchTimeout(defaultTraceBatchTimeout),
+		sdktrace.WithMaxExportBatchSize(defaultTraceBatchSize),
+	)
 	tracerProvider = sdktrace.NewTracerProvider(
 		sdktrace.WithResource(res),
-		sdktrace.WithBatcher(traceExporter,
-			sdktrace.WithBatchTimeout(defaultTraceBatchTimeout),
-			sdktrace.WithMaxExportBatchSize(defaultTraceBatchSize),
-		),
+		sdktrace.WithSpanProcessor(NewMinDurationSpanProcessor(batcher)),
 	)
 
 	// Set global tracer provider
@@ -0,0 +1,147 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package shared
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanInstrumentationName is the scoped name of the spans started by the span
+// rules, whose code is generated by the tool instead of written as hooks.
+const SpanInstrumentationName = "go.opentelemetry.io/compile-instrumentation/span"
+
+// spanKinds maps the span kinds of the span rules to the trace span kinds.
+//
+//nolint:gochecknoglobals // read-only, a map can not be a constant
+var spanKinds = map[string]trace.SpanKind{
+	"internal": trace.SpanKindInternal,
+	"server":   trace.SpanKindServer,
+	"client":   trace.SpanKindClient,
+	"producer": trace.SpanKindProducer,
+	"consumer": trace.SpanKindConsumer,
+}
+
+// StartSpan starts a span of the given name and kind, with the attributes given
+// as alternating keys and values. A nil context is taken as the background one,
+// i.e. the span starts a new trace. It returns the context carrying the span,
+// which is not recording if the span instrumentation is disabled, see
+// Instrumented.
+func StartSpan(ctx context.Context, name, kind string, kvs ...interface{}) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !Instrumented("span") {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	_ = SetupOTelSDK(SpanInstrumentationName, "")
+	spanKind, ok := spanKinds[kind]
+	if !ok {
+		spanKind = trace.SpanKindInternal
+	}
+	return otel.Tracer(SpanInstrumentationName).Start(ctx, name,
+		trace.WithSpanKind(spanKind),
+		trace.WithAttributes(SpanAttributes(kvs...)...),
+	)
+}
+
+// EndSpan ends the span started by StartSpan, with the attributes given as
+// alternating keys and values. The error is recorded on the span if not nil.
+func EndSpan(span trace.Span, err error, kvs ...interface{}) {
+	if !span.IsRecording() {
+		return
+	}
+	if attrs := SpanAttributes(kvs...); len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// minDurations holds the minimum durations of the spans being ended by
+// EndSpanAtLeast, by span ID, for the span processor to filter them.
+//
+//nolint:gochecknoglobals // shared between EndSpanAtLeast and the span processors
+var minDurations sync.Map
+
+// EndSpanAtLeast ends the span like EndSpan, but the span is dropped by the
+// span processor returned by NewMinDurationSpanProcessor if it lasted less than
+// minDuration and did not fail with an error. It's still ended, so that it's
+// not leaked by the SDK and by the other span processors.
+func EndSpanAtLeast(span trace.Span, minDuration time.Duration, err error, kvs ...interface{}) {
+	if !span.IsRecording() {
+		return
+	}
+	// The span processors see the span when it ends, before End returns
+	spanID := span.SpanContext().SpanID()
+	minDurations.Store(spanID, minDuration)
+	defer minDurations.Delete(spanID)
+	EndSpan(span, err, kvs...)
+}
+
+// minDurationSpanProcessor passes the ended spans to the wrapped processor,
+// except the ones dropped by EndSpanAtLeast.
+type minDurationSpanProcessor struct {
+	sdktrace.SpanProcessor
+}
+
+// NewMinDurationSpanProcessor returns a span processor passing the spans to
+// next, except the spans ended by EndSpanAtLeast that are shorter than their
+// minimum duration and did not fail. The tracer provider set up by SetupOTelSDK
+// uses it, a tracer provider set up by the application must use it as well for
+// the min_duration of the span rules to take effect.
+func NewMinDurationSpanProcessor(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return minDurationSpanProcessor{SpanProcessor: next}
+}
+
+func (p minDurationSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if d, ok := minDurations.Load(s.SpanContext().SpanID()); ok &&
+		s.Status().Code != codes.Error && s.EndTime().Sub(s.StartTime()) < d.(time.Duration) {
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// SpanAttributes converts alternating keys and values into attributes. Values
+// of basic types keep their types, and the others are formatted as strings by
+// fmt, which survives the String methods of nil pointers, as the arguments of
+// the traced functions may be. A trailing key without value is ignored.
+func SpanAttributes(kvs ...interface{}) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kvs)/2)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		key := fmt.Sprint(kvs[i])
+		switch v := kvs[i+1].(type) {
+		case string:
+			attrs = append(attrs, attribute.String(key, v))
+		case bool:
+			attrs = append(attrs, attribute.Bool(key, v))
+		case int:
+			attrs = append(attrs, attribute.Int(key, v))
+		case int32:
+			attrs = append(attrs, attribute.Int(key, int(v)))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, v))
+		case float32:
+			attrs = append(attrs, attribute.Float64(key, float64(v)))
+		case float64:
+			attrs = append(attrs, attribute.Float64(key, v))
+		case []string:
+			attrs = append(attrs, attribute.StringSlice(key, v))
+		default:
+			attrs = append(attrs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return attrs
+}
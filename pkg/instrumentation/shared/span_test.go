@@ -0,0 +1,134 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanAttributes(t *testing.T) {
+	attrs := SpanAttributes(
+		"s", "v",
+		"b", true,
+		"i", 1,
+		"i64", int64(2),
+		"f", 1.5,
+		"d", time.Second,
+		"p", struct{ A int }{1},
+		"dangling",
+	)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("s", "v"),
+		attribute.Bool("b", true),
+		attribute.Int("i", 1),
+		attribute.Int64("i64", 2),
+		attribute.Float64("f", 1.5),
+		attribute.String("d", "1s"),
+		attribute.String("p", "{1}"),
+	}, attrs)
+}
+
+// point implements fmt.Stringer on pointers, and panics on nil ones.
+type point struct{ x, y int }
+
+func (p *point) String() string { return fmt.Sprintf("(%d, %d)", p.x, p.y) }
+
+func TestSpanAttributesNilStringer(t *testing.T) {
+	var nilPoint *point
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("p", "(1, 2)"),
+		attribute.String("nil", "<nil>"),
+	}, SpanAttributes("p", &point{1, 2}, "nil", nilPoint))
+
+	recorder := tracetest.NewSpanRecorder()
+	require.NoError(t, SetupOTelSDK(SpanInstrumentationName, ""))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, span := StartSpan(context.Background(), "Move", "internal", "from", nilPoint)
+	EndSpan(span, nil, "to", nilPoint)
+	require.Len(t, recorder.Ended(), 1)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("from", "<nil>"),
+		attribute.String("to", "<nil>"),
+	}, recorder.Ended()[0].Attributes())
+}
+
+func TestStartEndSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	// Set up the SDK first, so that it does not replace the provider below
+	require.NoError(t, SetupOTelSDK(SpanInstrumentationName, ""))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	//nolint:staticcheck // nil context is taken as the background one
+	ctx, span := StartSpan(nil, "Repo.Get", "client", "repo.key", "k")
+	require.True(t, trace.SpanFromContext(ctx).SpanContext().Equal(span.SpanContext()))
+	_, child := StartSpan(ctx, "child", "unknown")
+	EndSpan(child, nil)
+	EndSpan(span, errors.New("not found"), "repo.size", 3)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, trace.SpanKindInternal, spans[0].SpanKind())
+	assert.Equal(t, span.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "Repo.Get", spans[1].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[1].SpanKind())
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("repo.key", "k"),
+		attribute.Int("repo.size", 3),
+	}, spans[1].Attributes())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "not found", spans[1].Status().Description)
+	require.Len(t, spans[1].Events(), 1)
+	assert.Equal(t, "exception", spans[1].Events()[0].Name)
+}
+
+func TestEndSpanAtLeast(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	exported := tracetest.NewSpanRecorder()
+	require.NoError(t, SetupOTelSDK(SpanInstrumentationName, ""))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+		sdktrace.WithSpanProcessor(NewMinDurationSpanProcessor(exported)),
+	))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, short := StartSpan(context.Background(), "short", "internal")
+	EndSpanAtLeast(short, time.Hour, nil)
+	_, failed := StartSpan(context.Background(), "failed", "internal")
+	EndSpanAtLeast(failed, time.Hour, errors.New("timeout"))
+	_, long := StartSpan(context.Background(), "long", "internal")
+	EndSpanAtLeast(long, 0, nil, "n", 1)
+	_, plain := StartSpan(context.Background(), "plain", "internal")
+	EndSpan(plain, nil)
+
+	// Every span is ended, only the short one is dropped
+	require.Len(t, recorder.Ended(), 4)
+	spans := exported.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "failed", spans[0].Name())
+	assert.Equal(t, "long", spans[1].Name())
+	assert.Equal(t, []attribute.KeyValue{attribute.Int("n", 1)}, spans[1].Attributes())
+	assert.Equal(t, "plain", spans[2].Name())
+}
@@ -25,7 +25,7 @@ func TestBasic(t *testing.T) {
 		"Every3",
 		"MyStruct.Example",
 		"GenericExample before hook",
-		"Hello, Generic World! 1 2",
+		"Hello, Generic World! 1 3",
 		"GenericExample after hook",
 		"traceID: 123, spanID: 456",
 		"GenericRecvExample before hook",
@@ -43,6 +43,12 @@ func TestBasic(t *testing.T) {
 		"Ellipsis",
 		"Hello from stdio",
 		"Underscore",
+		"[Around] proceed with 0",
+		"[Around] recovered: non-positive number",
+		"Fragile: -1",
+		"Checkout: 42",
+		"Hot: 4",
+		"HotEscape: 4",
 	}
 	for _, e := range expect {
 		require.Contains(t, output, e)
@@ -59,8 +65,10 @@ func verifyGenericHookContextLogs(t *testing.T, output string) {
 		"[Generic] Skip call: false",
 		"[Generic] Data from Before: test-data",
 		"[Generic] Return value count: 1",
-		"[Generic] SetParam panic (expected): SetParam is unsupported for generic functions",
-		"[Generic] SetReturnVal panic (expected): SetReturnVal is unsupported for generic functions",
+		"[Generic] Params: 1 2",
+		"[Generic] Return value: 3",
+		"[Generic] Replaced return value: 4",
+		"[Generic] Out of range return value: runtime error: index out of range [1] with length 1",
 	}
 	for _, log := range expectedGenericLogs {
 		require.Contains(t, output, log, "Expected generic HookContext log: %s", log)
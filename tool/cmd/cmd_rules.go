@@ -0,0 +1,41 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+//nolint:gochecknoglobals // Implementation of a CLI command
+var commandRules = cli.Command{
+	Name:        "rules",
+	Description: "Inspect instrumentation rules",
+	Commands: []*cli.Command{
+		&commandRulesSchema,
+	},
+}
+
+//nolint:gochecknoglobals // Implementation of a CLI command
+var commandRulesSchema = cli.Command{
+	Name:        "schema",
+	Description: "Print the JSON Schema of rule files for editors",
+	Before:      addLoggerPhaseAttribute,
+	Action: func(_ context.Context, cmd *cli.Command) error {
+		schema, err := rule.JSONSchema()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.Writer, "%s\n", schema)
+		if err != nil {
+			return ex.Wrapf(err, "failed to print schema")
+		}
+		return nil
+	},
+}
@@ -45,11 +45,28 @@ func main() {
 				TakesFile: true,
 				Value:     "",
 			},
+			&cli.StringSliceFlag{
+				Name:  "trace-packages",
+				Usage: "Trace every function of the packages matching the patterns, e.g. ./internal/...",
+			},
+			&cli.StringFlag{
+				Name:  "trace-include",
+				Usage: "Only trace the functions whose qualified names, e.g. (*Repo).Get or Open, match the regular expression",
+			},
+			&cli.StringFlag{
+				Name:  "trace-exclude",
+				Usage: "Do not trace the functions whose qualified names, e.g. (*Repo).Get or Open, match the regular expression",
+			},
+			&cli.DurationFlag{
+				Name:  "trace-min-duration",
+				Usage: "Drop the spans of traced functions shorter than the duration, unless they fail",
+			},
 		},
 		Commands: []*cli.Command{
 			&commandSetup,
 			&commandGo,
 			&commandToolexec,
+			&commandRules,
 			&commandVersion,
 		},
 		Before: initLogger,
@@ -13,3 +13,29 @@ func TestParseAst(t *testing.T) {
 	_, err := ParseFile("ast_test.go")
 	require.NoError(t, err)
 }
+
+func TestFindUnkeyedLits(t *testing.T) {
+	const source = `package p
+
+type T struct{ a, b int }
+
+var (
+	keyed   = T{a: 1, b: 2}
+	empty   = T{}
+	unkeyed = T{1, 2}
+	ptr     = &T{1, 2}
+	slice   = []T{{1, 2}, {a: 1}}
+	ptrs    = []*T{{1, 2}}
+	nested  = [][]T{{{1, 2}}}
+	keys    = map[T]T{{1, 2}: {3, 4}}
+	generic = G[int]{1}
+	other   = U{1, 2}
+	inner   = func() T { return T{1, 2} }
+)
+`
+	root, err := NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	require.Len(t, FindUnkeyedLits(root, "T"), 8)
+	require.Len(t, FindUnkeyedLits(root, "G"), 1)
+	require.Empty(t, FindUnkeyedLits(root, "V"))
+}
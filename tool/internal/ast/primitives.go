@@ -244,6 +244,14 @@ func DereferenceOf(expr dst.Expr) *dst.StarExpr {
 	return &dst.StarExpr{X: expr}
 }
 
+// ZeroValue returns the zero value of the type, i.e. [1]T{}[0], which is valid
+// for any type unlike the literal zero values. Unlike *new(T), it does not refer
+// to predeclared functions that the file may redeclare.
+func ZeroValue(t dst.Expr) *dst.IndexExpr {
+	arr := &dst.ArrayType{Len: IntLit(1), Elt: t}
+	return IndexExpr(CompositeLit(arr, nil), IntLit(0))
+}
+
 func Field(name string, t dst.Expr) *dst.Field {
 	newField := &dst.Field{
 		Names: []*dst.Ident{Ident(name)},
@@ -101,15 +101,7 @@ func FindFuncDecl(root *dst.File, funcName, recv string) *dst.FuncDecl {
 
 		// Receiver type is specified, and target function has receiver
 		// Match both func name and receiver type
-		recvTypeExpr := funcDecl.Recv.List[0].Type
-		baseType := stripGenericTypes(recvTypeExpr)
-
-		if baseType == "" {
-			msg := fmt.Sprintf("unexpected receiver type: %T", recvTypeExpr)
-			util.Unimplemented(msg)
-		}
-
-		return baseType == recv && name == funcName
+		return ReceiverTypeName(funcDecl) == recv && name == funcName
 	})
 
 	if len(decls) == 0 {
@@ -118,6 +110,22 @@ func FindFuncDecl(root *dst.File, funcName, recv string) *dst.FuncDecl {
 	return decls[0]
 }
 
+// ReceiverTypeName returns the receiver type of the method without type
+// parameters, e.g. "*GenStruct" for "func (g *GenStruct[T]) M()". It returns
+// an empty string if the function has no receiver.
+func ReceiverTypeName(funcDecl *dst.FuncDecl) string {
+	if !HasReceiver(funcDecl) {
+		return ""
+	}
+	recvTypeExpr := funcDecl.Recv.List[0].Type
+	baseType := stripGenericTypes(recvTypeExpr)
+	if baseType == "" {
+		msg := fmt.Sprintf("unexpected receiver type: %T", recvTypeExpr)
+		util.Unimplemented(msg)
+	}
+	return baseType
+}
+
 func ListFuncDecls(root *dst.File) []*dst.FuncDecl {
 	funcDecls := make([]*dst.FuncDecl, 0)
 	for _, decl := range root.Decls {
@@ -130,19 +138,43 @@ func ListFuncDecls(root *dst.File) []*dst.FuncDecl {
 	return funcDecls
 }
 
-func FindStructDecl(root *dst.File, structName string) *dst.GenDecl {
+// FindTypeSpec finds the declaration of the named type, including the ones in
+// grouped declarations such as "type ( A int; B string )".
+func FindTypeSpec(root *dst.File, typeName string) *dst.TypeSpec {
 	for _, decl := range root.Decls {
-		if genDecl, ok := decl.(*dst.GenDecl); ok && genDecl.Tok == token.TYPE {
-			if typeSpec, ok1 := genDecl.Specs[0].(*dst.TypeSpec); ok1 {
-				if typeSpec.Name.Name == structName {
-					return genDecl
-				}
+		genDecl, ok := decl.(*dst.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if typeSpec, ok1 := spec.(*dst.TypeSpec); ok1 && typeSpec.Name.Name == typeName {
+				return typeSpec
 			}
 		}
 	}
 	return nil
 }
 
+// FindValueSpec finds the declaration of the named package-level variable or
+// constant, along with the var or const declaration it belongs to.
+func FindValueSpec(root *dst.File, name string) (*dst.GenDecl, *dst.ValueSpec) {
+	for _, decl := range root.Decls {
+		genDecl, ok := decl.(*dst.GenDecl)
+		if !ok || (genDecl.Tok != token.VAR && genDecl.Tok != token.CONST) {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := util.AssertType[*dst.ValueSpec](spec)
+			for _, ident := range valueSpec.Names {
+				if ident.Name == name {
+					return genDecl, valueSpec
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
 func HasReceiver(fn *dst.FuncDecl) bool {
 	return fn.Recv != nil && len(fn.Recv.List) > 0
 }
@@ -178,14 +210,132 @@ func IsEllipsis(t dst.Expr) bool {
 	return ok
 }
 
-func AddStructField(decl dst.Decl, name, t string) {
-	gen := util.AssertType[*dst.GenDecl](decl)
-	fd := Field(name, Ident(t))
-	ty := util.AssertType[*dst.TypeSpec](gen.Specs[0])
-	st := util.AssertType[*dst.StructType](ty.Type)
+// AddStructField appends the field to the struct type. The field is embedded
+// if the name is empty, and the tag is omitted if empty.
+func AddStructField(spec *dst.TypeSpec, name, t, tag string) {
+	st := util.AssertType[*dst.StructType](spec.Type)
+	fd := &dst.Field{Type: Ident(t)}
+	if name != "" {
+		fd.Names = []*dst.Ident{Ident(name)}
+	}
+	if tag != "" {
+		value := "`" + tag + "`"
+		if !strconv.CanBackquote(tag) {
+			value = strconv.Quote(tag)
+		}
+		fd.Tag = &dst.BasicLit{Kind: token.STRING, Value: value}
+	}
 	st.Fields.List = append(st.Fields.List, fd)
 }
 
+// namesType reports whether the type expression denotes the named type of the
+// package, possibly instantiated or by pointer, e.g. T, *T and T[int].
+func namesType(t dst.Expr, typeName string) bool {
+	switch expr := t.(type) {
+	case *dst.Ident:
+		return expr.Name == typeName
+	case *dst.StarExpr:
+		return namesType(expr.X, typeName)
+	case *dst.ParenExpr:
+		return namesType(expr.X, typeName)
+	case *dst.IndexExpr:
+		return namesType(expr.X, typeName)
+	case *dst.IndexListExpr:
+		return namesType(expr.X, typeName)
+	default:
+		return false
+	}
+}
+
+// elidedLit returns the composite literal whose type is elided, such as the
+// elements of []T{{1, 2}} and []*T{{1, 2}}, or nil.
+func elidedLit(expr dst.Expr) *dst.CompositeLit {
+	if unary, ok := expr.(*dst.UnaryExpr); ok && unary.Op == token.AND {
+		expr = unary.X
+	}
+	if lit, ok := expr.(*dst.CompositeLit); ok && lit.Type == nil {
+		return lit
+	}
+	return nil
+}
+
+// findUnkeyedLits collects the unkeyed literals of the struct within the
+// literal of the given type, including the literals whose type is elided.
+func findUnkeyedLits(
+	lit *dst.CompositeLit,
+	t dst.Expr,
+	structName string,
+	found []*dst.CompositeLit,
+) []*dst.CompositeLit {
+	for {
+		paren, ok := t.(*dst.ParenExpr)
+		if !ok {
+			break
+		}
+		t = paren.X
+	}
+	if namesType(t, structName) {
+		if len(lit.Elts) > 0 {
+			if _, keyed := lit.Elts[0].(*dst.KeyValueExpr); !keyed {
+				found = append(found, lit)
+			}
+		}
+		return found
+	}
+	var keyType, elemType dst.Expr
+	switch expr := t.(type) {
+	case *dst.ArrayType:
+		elemType = expr.Elt
+	case *dst.MapType:
+		keyType, elemType = expr.Key, expr.Value
+	default:
+		return found
+	}
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*dst.KeyValueExpr); ok {
+			if key := elidedLit(kv.Key); key != nil && keyType != nil {
+				found = findUnkeyedLits(key, keyType, structName, found)
+			}
+			elt = kv.Value
+		}
+		if value := elidedLit(elt); value != nil {
+			found = findUnkeyedLits(value, elemType, structName, found)
+		}
+	}
+	return found
+}
+
+// FindUnkeyedLits finds the composite literals of the struct declared in the
+// package that list field values without keys, e.g. T{1, "a"}, including the
+// ones whose type is elided, e.g. the elements of []T{{1, "a"}}.
+func FindUnkeyedLits(root *dst.File, structName string) []*dst.CompositeLit {
+	found := make([]*dst.CompositeLit, 0)
+	dst.Inspect(root, func(node dst.Node) bool {
+		// Literals with elided types are reached from the enclosing literal
+		if lit, ok := node.(*dst.CompositeLit); ok && lit.Type != nil {
+			found = findUnkeyedLits(lit, lit.Type, structName, found)
+		}
+		return true
+	})
+	return found
+}
+
+// FindGoStmts finds the go statements of the function, including the ones in
+// the function literals it declares.
+func FindGoStmts(funcDecl *dst.FuncDecl) []*dst.GoStmt {
+	found := make([]*dst.GoStmt, 0)
+	if funcDecl.Body == nil {
+		return found
+	}
+	dst.Inspect(funcDecl.Body, func(node dst.Node) bool {
+		if goStmt, ok := node.(*dst.GoStmt); ok {
+			found = append(found, goStmt)
+		}
+		return true
+	})
+	return found
+}
+
 // SplitMultiNameFields splits fields that have multiple names into separate fields.
 // For example, a field like "a, b int" becomes two fields: "a int" and "b int".
 func SplitMultiNameFields(fieldList *dst.FieldList) *dst.FieldList {
@@ -0,0 +1,241 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"fmt"
+	"go/token"
+	"strconv"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Around Advice
+//
+// The around hook runs the original function in its own scope, e.g. within
+// pprof.Do, a recovered panic, retries or a swapped context. The original body
+// is moved into a synthesized closure, which the hook invokes by the proceed
+// callback it receives, i.e.
+//
+//	func Target(a int) (r0 string) {
+//	    OtelAroundTrampoline_Target_abc(&a, &r0, func() {
+//	        r0 = func() (r0 string) {
+//	            /* original body */
+//	        }()
+//	    })
+//	    return
+//	}
+//
+// The closure captures the parameters and the results, so it sees parameters
+// changed by HookContext.SetParam before proceed, and the hook sees the results
+// by HookContext.GetReturnVal after proceed. Trampoline-jump-ifs of the rules
+// applied before stay at the function entry, outside the closure, so that the
+// trampoline optimizer can still flatten and inline them. Likewise, the ones
+// of the rules applied after are inserted before the around trampoline call.
+// The around trampoline call is recorded for the trampoline optimizer as well,
+// see optimizeArounds.
+
+func makeAroundName(r *rule.InstFuncRule, funcDecl *dst.FuncDecl) string {
+	return fmt.Sprintf("%s_%s%s",
+		trampolineAroundName, funcDecl.Name.Name, util.CRC32(r.String()))
+}
+
+// createProceed creates the closure that runs the original body and stores its
+// results into the result variables of the target function.
+func createProceed(funcDecl *dst.FuncDecl, body []dst.Stmt, retVals []string) *dst.FuncLit {
+	inner := &dst.FuncLit{
+		Type: &dst.FuncType{Params: &dst.FieldList{}},
+		Body: ast.BlockStmts(body...),
+	}
+	if len(retVals) == 0 {
+		return inner
+	}
+	// The inner closure declares the same named results, so that the return
+	// statements of the original body, including the naked ones, keep working
+	inner.Type.Results = util.AssertType[*dst.FieldList](dst.Clone(funcDecl.Type.Results))
+	lhs := make([]dst.Expr, 0, len(retVals))
+	for _, retVal := range retVals {
+		lhs = append(lhs, ast.Ident(retVal))
+	}
+	assign := &dst.AssignStmt{
+		Lhs: lhs,
+		Tok: token.ASSIGN,
+		Rhs: ast.Exprs(&dst.CallExpr{Fun: inner}),
+	}
+	return &dst.FuncLit{
+		Type: &dst.FuncType{Params: &dst.FieldList{}},
+		Body: ast.BlockStmts(assign),
+	}
+}
+
+func (ip *InstrumentPhase) insertAround(t *rule.InstFuncRule, funcDecl *dst.FuncDecl) error {
+	util.Assert(funcDecl.Name.Name == t.Func, "sanity check")
+
+	// Record the target function for the whole trampoline creation process
+	ip.targetFunc = funcDecl
+	retVals := collectReturnValues(funcDecl)
+	args := collectArguments(funcDecl)
+
+	// Keep the trampoline-jump-if at the function entry, if any
+	start := 0
+	if len(funcDecl.Body.List) > 0 {
+		if ifStmt, ok := funcDecl.Body.List[0].(*dst.IfStmt); ok && findJumpPoint(ifStmt) != nil {
+			start = 1
+		}
+	}
+	body := funcDecl.Body.List[start:]
+	if start == 0 {
+		ip.tagPositions(body)
+	}
+
+	// Call the around trampoline with the addresses of the parameters and the
+	// results, followed by the closure that runs the original body
+	trampArgs := createTrampArgs(args)
+	trampArgs = append(trampArgs, createTrampArgs(retVals)...)
+	trampArgs = append(trampArgs, createProceed(funcDecl, body, retVals))
+	call := ast.ExprStmt(ast.CallTo(makeAroundName(t, funcDecl), funcDecl.Type.TypeParams, trampArgs))
+	call.Decs.Before = dst.NewLine
+	call.Decs.Start.Append("//line <generated>:1")
+
+	stmts := append([]dst.Stmt{}, funcDecl.Body.List[:start]...)
+	stmts = append(stmts, call)
+	around := &AroundCall{target: funcDecl, call: call, body: body, rule: t}
+	if len(retVals) > 0 {
+		around.ret = ast.ReturnStmt(nil)
+		stmts = append(stmts, around.ret)
+	}
+	funcDecl.Body.List = stmts
+	ip.arounds = append(ip.arounds, around)
+	// The raw code at the function entry is moved into the closure as well
+	ip.rawStmts[funcDecl] = min(ip.rawStmts[funcDecl], start)
+
+	return ip.createAroundTrampoline(t)
+}
+
+// checkAroundHookDecl checks if the around hook has the signature
+// func(HookContext, func())
+func checkAroundHookDecl(hookFunc *dst.FuncDecl) error {
+	params := ast.SplitMultiNameFields(hookFunc.Type.Params)
+	if len(params.List) != 2 {
+		return ex.Newf("hook func signature mismatch, expected 2 params, got %d",
+			len(params.List))
+	}
+	if baseTypeName(params.List[0].Type) != trampolineHookContextType {
+		return ex.Newf("hook func first param must be %s, got %s",
+			trampolineHookContextType, baseTypeName(params.List[0].Type))
+	}
+	proceed, ok := params.List[1].Type.(*dst.FuncType)
+	if !ok || len(proceed.Params.List) != 0 || proceed.Results != nil {
+		return ex.Newf("hook func second param must be func()")
+	}
+	if hookFunc.Type.Results != nil {
+		return ex.Newf("hook func must not return values")
+	}
+	return nil
+}
+
+func (ip *InstrumentPhase) buildAroundTrampSignature() {
+	// TargetFunc: func A(a int) (ret string)
+	// AroundTramp: func B(a *int, ret *string, body func())
+	aroundTramp := ip.aroundTrampFunc
+	params := findTargetParamType(ip.targetFunc)
+	params.List = append(params.List, findTargetResultType(ip.targetFunc).List...)
+	for _, field := range params.List {
+		field.Type = ast.DereferenceOf(desugarType(field))
+	}
+	params.List = append(params.List, aroundTramp.Type.Params.List...)
+	aroundTramp.Type.Params = params
+	aroundTramp.Type.TypeParams = findTargetGenericType(ip.targetFunc)
+}
+
+// populateAroundContext populates the hook context with the addresses of the
+// parameters and the results before the around hook invocation
+func (ip *InstrumentPhase) populateAroundContext() {
+	targetParams := len(findTargetParamType(ip.targetFunc).List)
+	names := getNames(ip.aroundTrampFunc.Type.Params)
+	names = names[:len(names)-1] // The body closure
+	// hookContext := &HookContextImpl{param0: param0, ..., returnVal0: arg0, ...}
+	define := util.AssertType[*dst.AssignStmt](ip.aroundTrampFunc.Body.List[0])
+	lit := util.AssertType[*dst.UnaryExpr](define.Rhs[0])
+	compositeLit := util.AssertType[*dst.CompositeLit](lit.X)
+	for i, name := range names {
+		field := hookContextField(trampolineParamFieldPrefix, i)
+		if i >= targetParams {
+			field = hookContextField(trampolineReturnValFieldPrefix, i-targetParams)
+		}
+		compositeLit.Elts = append(compositeLit.Elts, ast.KeyValueExpr(field, ast.Ident(name)))
+	}
+}
+
+// proceedArg returns the proceed callback passed to the around hook function.
+// Like the hook context, it's hidden from escape analysis unless the hook lets
+// it escape, see proceedEscapes.
+func proceedArg(hookFunc *dst.FuncDecl) dst.Expr {
+	proceed := ast.Ident(trampolineProceedName)
+	if proceedEscapes(hookFunc) {
+		return proceed
+	}
+	return ast.CallTo(trampolineNoEscapeProceedName, nil, ast.Exprs(proceed))
+}
+
+func (ip *InstrumentPhase) callAroundHook(t *rule.InstFuncRule, hookFunc *dst.FuncDecl) {
+	// if hook != nil { hook(hookContext, proceed) } else { proceed() }
+	args := ast.Exprs(hookContextArg(hookFunc), proceedArg(hookFunc))
+	call := ast.ExprStmt(ast.CallTo(t.Around, nil, args))
+	proceed := ast.ExprStmt(ast.CallTo(trampolineProceedName, nil, nil))
+	iff := ast.IfNotNilStmt(ast.Ident(t.Around), ast.Block(call), ast.Block(proceed))
+	insertAtEnd(ip.aroundTrampFunc, iff)
+}
+
+func (ip *InstrumentPhase) createAroundTrampoline(t *rule.InstFuncRule) error {
+	// Ensure unsafe package is imported since we use //go:linkname directives
+	ip.ensureUnsafeImport()
+	err := ip.materializeTemplate()
+	if err != nil {
+		return err
+	}
+	ip.addDecl(ip.aroundTrampFunc)
+	ip.implementHookContext(t)
+	ip.rewriteHookContextMethods()
+
+	// Rename template function to trampoline function
+	ip.aroundTrampFunc.Name.Name = makeAroundName(t, ip.targetFunc)
+	dst.Inspect(ip.aroundTrampFunc, func(node dst.Node) bool {
+		if basicLit, ok := node.(*dst.BasicLit); ok {
+			if basicLit.Value == trampolineAroundNamePlaceholder {
+				basicLit.Value = strconv.Quote(t.Around)
+			}
+		}
+		return true
+	})
+	ip.buildAroundTrampSignature()
+
+	// Check the hook signature and declare it, it will be linked to the real
+	// hook function
+	hookFunc, err := getHookFunc(t, trampolineBefore)
+	if err != nil {
+		return err
+	}
+	err = checkAroundHookDecl(hookFunc)
+	if err != nil {
+		return err
+	}
+	paramTypes := &dst.FieldList{List: []*dst.Field{
+		ast.Field(trampolineHookContextName, ast.Ident(trampolineHookContextType)),
+		ast.Field(trampolineProceedName, &dst.FuncType{Func: true, Params: &dst.FieldList{}}),
+	}}
+	err = ip.addHookDecl(t, t.Around, paramTypes)
+	if err != nil {
+		return err
+	}
+	ip.callAroundHook(t, hookFunc)
+	ip.populateAroundContext()
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"fmt"
+	"go/token"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Call Site Instrumentation
+//
+// Call rules leave the callee untouched. Instead, every matched call expression
+// in the target file is redirected to a wrapper function generated in the same
+// file, e.g.
+//
+//	rows, err := db.Query(q, args...)
+//
+// becomes
+//
+//	rows, err := OtelCallSite_Query1234(db, q, args...)
+//
+//	func OtelCallSite_Query1234(recv *sql.DB, arg0 string, arg1 ...any) (*sql.Rows, error) {
+//		return recv.Query(arg0, arg1...)
+//	}
+//
+// The wrapper is then instrumented exactly like the target function of a func
+// rule, so hooks of call rules look the same as hooks of func rules, with the
+// receiver as the first parameter if the callee is a method.
+
+const (
+	callSiteWrapperName = "OtelCallSite"
+	callSiteRecvName    = "recv"
+	callSiteArgName     = "arg"
+)
+
+// callSiteKey identifies a call expression by its position in the target file.
+func callSiteKey(line, column int) string {
+	return fmt.Sprintf("%d:%d", line, column)
+}
+
+// findCallExprs indexes all call expressions of the file by their positions.
+func (ip *InstrumentPhase) findCallExprs(root *dst.File) map[string]*dst.CallExpr {
+	calls := make(map[string]*dst.CallExpr)
+	dst.Inspect(root, func(node dst.Node) bool {
+		if call, ok := node.(*dst.CallExpr); ok {
+			pos := ip.parser.FindPosition(call)
+			if pos.IsValid() {
+				calls[callSiteKey(pos.Line, pos.Column)] = call
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// unparen strips the parentheses around the expression.
+func unparen(expr dst.Expr) dst.Expr {
+	for {
+		paren, ok := expr.(*dst.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// calleeFunName returns the name of the called function or method.
+func calleeFunName(call *dst.CallExpr) string {
+	switch f := unparen(call.Fun).(type) {
+	case *dst.Ident:
+		return f.Name
+	case *dst.SelectorExpr:
+		return f.Sel.Name
+	default:
+		return ""
+	}
+}
+
+// makeCallSiteWrapper generates the source of the wrapper function for the call
+// site. The callee is called through the receiver for methods, for functions
+// the callee expression is filled in by the caller.
+func makeCallSiteWrapper(name, fn string, site *rule.CallSite) string {
+	params := make([]string, 0, len(site.Params)+1)
+	args := make([]string, 0, len(site.Params))
+	callee := fn
+	if site.Recv != "" {
+		params = append(params, callSiteRecvName+" "+site.Recv)
+		callee = callSiteRecvName + "." + fn
+	}
+	for i, t := range site.Params {
+		arg := fmt.Sprintf("%s%d", callSiteArgName, i)
+		params = append(params, arg+" "+t)
+		if strings.HasPrefix(t, "...") {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+	call := fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	results := ""
+	if len(site.Results) > 0 {
+		call = "return " + call
+		results = fmt.Sprintf(" (%s)", strings.Join(site.Results, ", "))
+	}
+	return fmt.Sprintf("package _\nfunc %s(%s)%s {\n%s\n}",
+		name, strings.Join(params, ", "), results, call)
+}
+
+// addImports adds the imports to the file unless they are already present by
+// the same name. The wrappers refer to the packages by the given names, so a
+// path imported by another name, or as _ or ., is imported once more.
+func addImports(root *dst.File, imports map[string]string) {
+	for _, path := range slices.Sorted(maps.Keys(imports)) {
+		name := imports[path]
+		found := false
+		for _, spec := range root.Imports {
+			if spec.Path.Value == strconv.Quote(path) && importName(spec) == name {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		decl := ast.ImportDecl(name, path)
+		root.Decls = append([]dst.Decl{decl}, root.Decls...)
+		root.Imports = append(root.Imports, util.AssertType[*dst.ImportSpec](decl.Specs[0]))
+	}
+}
+
+// redirectCall replaces the callee of the call expression with the wrapper and
+// passes the receiver, if any, as the first argument.
+func redirectCall(call *dst.CallExpr, wrapper string, site *rule.CallSite) {
+	if site.Recv != "" {
+		sel := util.AssertType[*dst.SelectorExpr](unparen(call.Fun))
+		var recv dst.Expr = sel.X
+		if site.AddrOf {
+			recv = &dst.UnaryExpr{Op: token.AND, X: sel.X}
+		}
+		call.Args = append([]dst.Expr{recv}, call.Args...)
+	}
+	call.Fun = ast.Ident(wrapper)
+}
+
+// applyCallRule redirects the matched call sites in the file to instrumented
+// wrapper functions.
+func (ip *InstrumentPhase) applyCallRule(r *rule.InstCallRule, root *dst.File) error {
+	calls := ip.findCallExprs(root)
+	// Call sites of the same signature share one wrapper
+	wrappers := make(map[string]string)
+	for _, site := range r.Sites {
+		call, ok := calls[callSiteKey(site.Line, site.Column)]
+		if !ok {
+			return ex.Newf("can not find call %s at %d:%d", r.Call, site.Line, site.Column)
+		}
+		fn := calleeFunName(call)
+		util.Assert(fn != "", "sanity check")
+		// The wrapper without name tells the signature
+		signature := makeCallSiteWrapper("", fn, site)
+		wrapper, ok := wrappers[signature]
+		if !ok {
+			wrapper = fmt.Sprintf("%s_%s%s", callSiteWrapperName, fn, util.CRC32(r.String()+signature))
+			err := ip.addCallSiteWrapper(r, wrapper, makeCallSiteWrapper(wrapper, fn, site), call)
+			if err != nil {
+				return err
+			}
+			addImports(root, site.Imports)
+			for path := range site.Imports {
+				ip.addImport(path)
+			}
+			wrappers[signature] = wrapper
+		}
+		redirectCall(call, wrapper, site)
+	}
+	ip.Info("Apply call rule", "rule", r, "sites", len(r.Sites))
+	return nil
+}
+
+// addCallSiteWrapper adds the wrapper function to the target file and injects
+// the hooks of the rule into it.
+func (ip *InstrumentPhase) addCallSiteWrapper(r *rule.InstCallRule, wrapper, source string,
+	call *dst.CallExpr,
+) error {
+	// Parse with a separate parser, the wrapper has no position in the target
+	// file and must not be annotated with line directives of its own
+	p := ast.NewAstParser()
+	file, err := p.ParseSource(source)
+	if err != nil {
+		return err
+	}
+	funcDecl := util.AssertType[*dst.FuncDecl](file.Decls[0])
+	stmt := funcDecl.Body.List[0]
+	var inner *dst.CallExpr
+	if ret, ok := stmt.(*dst.ReturnStmt); ok {
+		inner = util.AssertType[*dst.CallExpr](ret.Results[0])
+	} else {
+		inner = util.AssertType[*dst.CallExpr](util.AssertType[*dst.ExprStmt](stmt).X)
+	}
+	if _, ok := inner.Fun.(*dst.Ident); ok {
+		// Functions are called by the original callee expression, which is
+		// valid at file scope, e.g. sql.Open
+		inner.Fun = util.AssertType[dst.Expr](dst.Clone(call.Fun))
+	}
+	funcDecl.Decs.Before = dst.EmptyLine
+	ip.addDecl(funcDecl)
+
+	err = ip.insertTJump(r.WrapperRule(wrapper), funcDecl)
+	if err != nil {
+		return ex.Wrapf(err, "failed to apply rule %s to call of %s", r, r.Call)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
@@ -16,16 +17,7 @@ import (
 )
 
 func listRuleFiles(path string) ([]string, error) {
-	// If the path is a local path, use it directly, otherwise, it's a module
-	// path, we need to convert it to a local path and find the module files
-	var p string
-	if util.PathExists(path) {
-		p = path
-	} else {
-		p = strings.TrimPrefix(path, util.OtelRoot)
-		p = filepath.Join(util.GetBuildTempDir(), p)
-	}
-	return util.ListFiles(p)
+	return util.ListFiles(util.GetRuleDir(path))
 }
 
 // applyFileRule introduces the new file to the target package at compile time.
@@ -52,6 +44,14 @@ func (ip *InstrumentPhase) applyFileRule(rule *rule.InstFileRule, pkgName string
 	}
 	// Always rename the package name to the target package name
 	root.Name.Name = pkgName
+	// The new file may import packages that the target package does not
+	for _, spec := range root.Imports {
+		path, err1 := strconv.Unquote(spec.Path.Value)
+		if err1 != nil {
+			return ex.Wrapf(err1, "invalid import %s in %s", spec.Path.Value, file)
+		}
+		ip.addImport(path)
+	}
 
 	// Write back the modified AST to a new file in the working directory
 	base := filepath.Base(rule.File)
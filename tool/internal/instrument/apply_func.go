@@ -7,6 +7,7 @@ import (
 	_ "embed"
 	"fmt"
 	"go/parser"
+	"go/token"
 	"path/filepath"
 
 	"github.com/dave/dst"
@@ -48,6 +49,57 @@ func findJumpPoint(jumpIf *dst.IfStmt) *dst.BlockStmt {
 	return nil
 }
 
+// enclosingTJumps returns the trampoline-jump-ifs that a new trampoline-jump-if
+// of the function will be nested in, outermost first.
+func (ip *InstrumentPhase) enclosingTJumps(funcDecl *dst.FuncDecl) []*TJump {
+	enclosing := make([]*TJump, 0)
+	if len(funcDecl.Body.List) == 0 {
+		return enclosing
+	}
+	ifStmt, ok := funcDecl.Body.List[0].(*dst.IfStmt)
+	for ok && findJumpPoint(ifStmt) != nil {
+		for _, tjump := range ip.tjumps {
+			if tjump.ifStmt == ifStmt {
+				enclosing = append(enclosing, tjump)
+			}
+		}
+		elseBlock := util.AssertType[*dst.BlockStmt](ifStmt.Else)
+		ifStmt, ok = elseBlock.List[len(elseBlock.List)-1].(*dst.IfStmt)
+	}
+	return enclosing
+}
+
+// propagateSkipCall makes the trampoline-jump-if request to skip the call in
+// the hook contexts of the enclosing ones when its Before hook does, so that
+// their After hooks know that the original function was not called, i.e.
+//
+//	if ctx1, skip1 := otel_trampoline_before1(&arg); skip1 {
+//	    ...
+//	} else {
+//	    defer otel_trampoline_after1(ctx1, &retval)
+//	    if ctx2, skip2 := otel_trampoline_before2(&arg); skip2 {
+//	        ctx1.SetSkipCall(true)
+//	        otel_trampoline_after2(ctx2, &retval)
+//	        return ...
+//	    } else {
+//	        ...
+//	    }
+//	}
+func propagateSkipCall(tjump *dst.IfStmt, enclosing []*TJump) {
+	for i := len(enclosing) - 1; i >= 0; i-- {
+		outer := enclosing[i]
+		// Nobody is interested in the skip call without an After hook
+		if outer.rule.After == "" {
+			continue
+		}
+		outer.observed = true
+		hookContext := ast.Ident(trampolineHookContextName + util.CRC32(outer.rule.String()))
+		setSkipCall := ast.CallTo(trampolineSetSkipCallName, nil, ast.Exprs(ast.BoolTrue()))
+		setSkipCall.Fun = ast.SelectorExpr(hookContext, trampolineSetSkipCallName)
+		tjump.Body.List = append([]dst.Stmt{ast.ExprStmt(setSkipCall)}, tjump.Body.List...)
+	}
+}
+
 func collectReturnValues(funcDecl *dst.FuncDecl) []string {
 	// Add explicit names for return values, they can be further referenced if
 	// we're willing
@@ -106,11 +158,33 @@ func createTrampArgs(names []string) []dst.Expr {
 	return exprs
 }
 
+// newHookContextImpl constructs a new HookContextImpl structure literal and
+// populates its typed fields with addresses of all arguments and results. The
+// target function owns the hook context, so that it can be allocated on stack
+// if no hook lets it escape.
+func newHookContextImpl(t *rule.InstFuncRule, funcDecl *dst.FuncDecl, args, retVals []string) dst.Expr {
+	elts := make([]dst.Expr, 0, len(args)+len(retVals))
+	for i, arg := range createTrampArgs(args) {
+		field := hookContextField(trampolineParamFieldPrefix, i)
+		elts = append(elts, ast.KeyValueExpr(field, arg))
+	}
+	for i, retVal := range createTrampArgs(retVals) {
+		field := hookContextField(trampolineReturnValFieldPrefix, i)
+		elts = append(elts, ast.KeyValueExpr(field, retVal))
+	}
+	// &HookContextImpl{param0: &arg, ..., returnVal0: &retval, ...}
+	return &dst.UnaryExpr{
+		Op: token.AND,
+		X:  ast.CompositeLit(hookContextImplType(t, funcDecl), elts),
+	}
+}
+
 func createTJumpIf(t *rule.InstFuncRule, funcDecl *dst.FuncDecl,
 	args, retVals []string,
 ) *dst.IfStmt {
 	funcSuffix := util.CRC32(t.String())
 	argsToBefore := createTrampArgs(args)
+	argsToBefore = append([]dst.Expr{newHookContextImpl(t, funcDecl, args, retVals)}, argsToBefore...)
 	argsToAfter := createTrampArgs(retVals)
 	argHookContext := ast.Ident(trampolineHookContextName + funcSuffix)
 	argsToAfter = append([]dst.Expr{argHookContext}, argsToAfter...)
@@ -160,20 +234,9 @@ func (ip *InstrumentPhase) insertToFunc(funcDecl *dst.FuncDecl, tjump *dst.IfStm
 		tjump.Decs.Start.Append("//line <generated>:1")
 		pos := ip.parser.FindPosition(funcDecl.Body)
 		if len(funcDecl.Body.List) > 0 {
-			// It does happens because we may insert raw code snippets at the
-			// function entry. These dynamically generated nodes do not have
-			// corresponding node positions. We need to keep looking downward
-			// until we find a node that contains position information, and then
-			// annotate it with a line directive.
-			for _, stmt := range funcDecl.Body.List {
-				pos = ip.parser.FindPosition(stmt)
-				if !pos.IsValid() {
-					continue
-				}
-				tag := fmt.Sprintf("//line %s", pos.String())
-				stmt.Decorations().Before = dst.NewLine
-				stmt.Decorations().Start.Append(tag)
-			}
+			// Raw code snippets may be inserted at the function entry, look for
+			// the statements from the original source and annotate them instead
+			ip.tagPositions(funcDecl.Body.List)
 		} else {
 			tag := fmt.Sprintf("//line %s", pos.String())
 			empty := ast.EmptyStmt()
@@ -185,6 +248,27 @@ func (ip *InstrumentPhase) insertToFunc(funcDecl *dst.FuncDecl, tjump *dst.IfStm
 	}
 }
 
+// tagPositions annotates the statements that come from the original source
+// with line directives, so that debugger can show their correct line numbers
+// after generated code is inserted before them. Dynamically generated nodes do
+// not have corresponding node positions, they are skipped.
+func (ip *InstrumentPhase) tagPositions(stmts []dst.Stmt) {
+	for _, stmt := range stmts {
+		pos := ip.parser.FindPosition(stmt)
+		if !pos.IsValid() {
+			continue
+		}
+		tagPosition(stmt, pos)
+	}
+}
+
+// tagPosition annotates the statement with a line directive of the position.
+func tagPosition(stmt dst.Stmt, pos token.Position) {
+	tag := fmt.Sprintf("//line %s", pos.String())
+	stmt.Decorations().Before = dst.NewLine
+	stmt.Decorations().Start.Append(tag)
+}
+
 func (ip *InstrumentPhase) insertTJump(t *rule.InstFuncRule, funcDecl *dst.FuncDecl) error {
 	util.Assert(funcDecl.Name.Name == t.Func, "sanity check")
 
@@ -200,7 +284,7 @@ func (ip *InstrumentPhase) insertTJump(t *rule.InstFuncRule, funcDecl *dst.FuncD
 	// Generate the trampoline-jump-if. The trampoline-jump-if is a conditional
 	// jump that jumps to the trampoline function, it looks something like this
 	//
-	//	if ctx, skip := otel_trampoline_before(&arg); skip {
+	//	if ctx, skip := otel_trampoline_before(&HookContextImpl{...}, &arg); skip {
 	//	    otel_trampoline_after(ctx, &retval)
 	//	    return ...
 	//	} else {
@@ -214,6 +298,10 @@ func (ip *InstrumentPhase) insertTJump(t *rule.InstFuncRule, funcDecl *dst.FuncD
 	// we can intercept the original function and execute before/after hooks.
 	tjump := createTJumpIf(t, funcDecl, args, retVals)
 
+	// Tell the enclosing trampoline-jump-ifs if the Before hook requests to
+	// skip the call, as their hooks have been called already
+	propagateSkipCall(tjump, ip.enclosingTJumps(funcDecl))
+
 	// Record the trampoline-jump-if as they can be optimized later, they are
 	// performance-critical
 	ip.tjumps = append(ip.tjumps, &TJump{target: funcDecl, ifStmt: tjump, rule: t})
@@ -225,20 +313,17 @@ func (ip *InstrumentPhase) insertTJump(t *rule.InstFuncRule, funcDecl *dst.FuncD
 	// Trampoline-jump-if ultimately jumps to the trampoline function, which
 	// typically has the following form
 	//
-	//	func otel_trampoline_before(arg) (HookContext, bool) {
+	//	func otel_trampoline_before(ctx *HookContextImpl_abc, arg) (*HookContextImpl_abc, bool) {
 	//	    defer func () { /* handle panic */ }()
-	//	    // prepare hook context for real hook code
-	//	    hookctx := &HookContextImpl_abc{}
-	//	    ...
 	//	    // Call the real hook code
-	//		realHook(ctx, arg)
-	//	    return ctx, skip
+	//		realHook(OtelNoEscape(ctx), *arg)
+	//	    return ctx, ctx.skipCall
 	//	}
 	//
-	// It catches any potential panic from the real hook code, and prepare the
-	// hook context for the real hook code. Once all preparations are done, it
-	// jumps to the real hook code. Note that each trampoline has its own hook
-	// context implementation, which is generated dynamically.
+	// It catches any potential panic from the real hook code, and jumps to the
+	// real hook code with the hook context built by the trampoline-jump-if. Note
+	// that each trampoline has its own hook context implementation, which is
+	// generated dynamically.
 	return ip.createTrampoline(t)
 }
 
@@ -249,22 +334,33 @@ func (ip *InstrumentPhase) addCompileArg(newArg string) {
 //go:embed api.tmpl
 var templateAPI string
 
-func (ip *InstrumentPhase) writeGlobals(pkgName string) error {
+func (ip *InstrumentPhase) writeGlobals(pkgName string, hasFuncRule bool) error {
 	// Prepare trampoline code header
 	p := ast.NewAstParser()
 	trampoline, err := p.ParseSource("package " + pkgName)
 	if err != nil {
 		return err
 	}
-	// Declare common variable declarations
-	trampoline.Decls = append(trampoline.Decls, ip.varDecls...)
+	if hasFuncRule {
+		// Declare common variable declarations
+		trampoline.Decls = append(trampoline.Decls, ip.varDecls...)
 
-	// Declare the hook context interface
-	api, err := p.ParseSource(templateAPI)
-	if err != nil {
-		return err
+		// Declare the hook context interface
+		api, err1 := p.ParseSource(templateAPI)
+		if err1 != nil {
+			return err1
+		}
+		trampoline.Decls = append(trampoline.Decls, api.Decls...)
+	}
+	// The hook declarations require importing unsafe for go:linkname, which the
+	// common variable declarations do if any
+	if len(ip.linkedDecls) > 0 && len(ip.varDecls) == 0 {
+		unsafeImport := ast.ImportDecl(ast.IdentIgnore, unsafePackageName)
+		trampoline.Decls = append([]dst.Decl{unsafeImport}, trampoline.Decls...)
+	}
+	for _, decl := range ip.linkedDecls {
+		trampoline.Decls = append(trampoline.Decls, decl)
 	}
-	trampoline.Decls = append(trampoline.Decls, api.Decls...)
 
 	// Write trampoline code to file
 	path := filepath.Join(ip.workDir, otelGlobalsFile)
@@ -319,6 +415,8 @@ func (ip *InstrumentPhase) parseFile(file string) (*dst.File, error) {
 	// Every time we parse a file, we need to reset the trampoline jumps
 	// because they are associated with one certain file
 	ip.tjumps = make([]*TJump, 0)
+	ip.arounds = make([]*AroundCall, 0)
+	ip.rawStmts = make(map[*dst.FuncDecl]int)
 	return root, nil
 }
 
@@ -329,9 +427,25 @@ func (ip *InstrumentPhase) applyFuncRule(rule *rule.InstFuncRule, root *dst.File
 		return ex.Newf("can not find function %s", rule.Func)
 	}
 
-	err := ip.insertTJump(rule, funcDecl)
+	var err error
+	// Functions without body are instrumented through a wrapper
+	if funcDecl.Body == nil {
+		funcDecl, err = ip.wrapBodylessFunc(funcDecl)
+		if err != nil {
+			return ex.Wrapf(err, "failed to apply rule %s to function %s",
+				rule, rule.QualifiedFuncName())
+		}
+	}
+	if rule.Around != "" {
+		err = ip.insertAround(rule, funcDecl)
+	} else {
+		err = ip.insertTJump(rule, funcDecl)
+	}
 	if err != nil {
-		return err
+		// The rule may be instantiated from a selector, tell which function
+		// the hook signature does not fit
+		return ex.Wrapf(err, "failed to apply rule %s to function %s",
+			rule, rule.QualifiedFuncName())
 	}
 	ip.Info("Apply func rule", "rule", rule)
 	return nil
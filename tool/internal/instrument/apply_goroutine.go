@@ -0,0 +1,375 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"maps"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// -----------------------------------------------------------------------------
+// Goroutine Context Propagation
+//
+// The goroutine rule propagates a context, typically the trace context of the
+// current goroutine, into the goroutines started by the go statements of the
+// selected functions. The capture hook runs in the parent goroutine when the go
+// statement executes, and the restore hook runs first thing in the new one, i.e.
+//
+//	go worker(ch, next())
+//
+// becomes
+//
+//	{
+//	    _otelArg1 := next()
+//	    go func(_otelContext interface{}) {
+//	        Restore(_otelContext)
+//	        worker(ch, _otelArg1)
+//	    }(Capture())
+//	}
+//
+// The function value and the arguments that call functions, receive from
+// channels or read variables are evaluated beforehand, in the parent goroutine,
+// just like the go statement does. Function literals started directly receive
+// the captured context as an extra parameter instead of being wrapped.
+
+const (
+	goroutineContextName = "_otelContext"
+	goroutineFuncName    = "_otelFunc"
+	goroutineArgName     = "_otelArg"
+)
+
+// localVars returns the names of the variables declared in the function,
+// including the parameters and the results of the function literals within,
+// and the names of the constants and types declared in it.
+func localVars(funcDecl *dst.FuncDecl) (vars, others map[string]bool) {
+	vars, others = make(map[string]bool), make(map[string]bool)
+	declare := func(exprs ...dst.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*dst.Ident); ok {
+				vars[ident.Name] = true
+			}
+		}
+	}
+	dst.Inspect(funcDecl, func(node dst.Node) bool {
+		switch n := node.(type) {
+		case *dst.Field:
+			for _, name := range n.Names {
+				declare(name)
+			}
+		case *dst.AssignStmt:
+			if n.Tok == token.DEFINE {
+				declare(n.Lhs...)
+			}
+		case *dst.RangeStmt:
+			if n.Tok == token.DEFINE {
+				declare(n.Key, n.Value)
+			}
+		case *dst.GenDecl:
+			if n.Tok != token.VAR {
+				maps.Copy(others, declaredNames(n))
+				return false
+			}
+			for _, spec := range n.Specs {
+				for _, name := range spec.(*dst.ValueSpec).Names {
+					declare(name)
+				}
+			}
+		}
+		return true
+	})
+	return vars, others
+}
+
+// declaredNames returns the names declared by the constant or type declaration.
+func declaredNames(decl *dst.GenDecl) map[string]bool {
+	names := make(map[string]bool)
+	for _, spec := range decl.Specs {
+		switch s := spec.(type) {
+		case *dst.ValueSpec:
+			for _, name := range s.Names {
+				names[name.Name] = true
+			}
+		case *dst.TypeSpec:
+			names[s.Name.Name] = true
+		}
+	}
+	return names
+}
+
+// nonVarNames returns the package-level names that are not variables, i.e. the
+// constants, types and functions declared by the files of the package, and the
+// names of the packages imported by the target file.
+func (ip *InstrumentPhase) nonVarNames(root *dst.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, spec := range root.Imports {
+		names[importName(spec)] = true
+	}
+	for _, decl := range root.Decls {
+		switch d := decl.(type) {
+		case *dst.FuncDecl:
+			if d.Recv == nil {
+				names[d.Name.Name] = true
+			}
+		case *dst.GenDecl:
+			if d.Tok == token.CONST || d.Tok == token.TYPE {
+				maps.Copy(names, declaredNames(d))
+			}
+		}
+	}
+	// Find the declarations of the other files in the compile command as well
+	fset := token.NewFileSet()
+	for _, arg := range ip.compileArgs {
+		if !strings.HasSuffix(arg, ".go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, arg, nil, parser.SkipObjectResolution)
+		if err != nil {
+			ip.Warn("Skip unparsable file", "file", arg, "error", err)
+			continue
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *goast.FuncDecl:
+				if d.Recv == nil {
+					names[d.Name.Name] = true
+				}
+			case *goast.GenDecl:
+				if d.Tok != token.CONST && d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *goast.ValueSpec:
+						for _, name := range s.Names {
+							names[name.Name] = true
+						}
+					case *goast.TypeSpec:
+						names[s.Name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// evaluatedEarly reports whether the expression must be evaluated before the
+// goroutine starts, i.e. it calls a function, receives from a channel or reads
+// a variable that may change afterwards. Every identifier is taken for a variable
+// unless it's known to be a constant, a type, a function or a package name, as
+// given by nonVars, or predeclared, and it's not shadowed by a local variable.
+// The bodies of function literals are not evaluated. Other expressions are kept
+// as is, so that the untyped constants are still converted to the types of the
+// parameters.
+func evaluatedEarly(expr dst.Expr, locals, nonVars map[string]bool) bool {
+	found := false
+	dst.Inspect(expr, func(node dst.Node) bool {
+		switch n := node.(type) {
+		case *dst.FuncLit:
+			return false
+		case *dst.CallExpr:
+			found = true
+		case *dst.UnaryExpr:
+			found = found || n.Op == token.ARROW
+		case *dst.SelectorExpr:
+			// Only the operand may refer to a variable
+			found = found || evaluatedEarly(n.X, locals, nonVars)
+			return false
+		case *dst.KeyValueExpr:
+			// The keys of struct literals are field names
+			found = found || evaluatedEarly(n.Value, locals, nonVars)
+			if _, ok := n.Key.(*dst.Ident); !ok {
+				found = found || evaluatedEarly(n.Key, locals, nonVars)
+			}
+			return false
+		case *dst.Ident:
+			if locals[n.Name] {
+				found = true
+			} else if !nonVars[n.Name] && types.Universe.Lookup(n.Name) == nil {
+				found = n.Name != ast.IdentIgnore
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// rewriteGoStmt rewrites the go statement to propagate the context into the
+// goroutine it starts. It returns the statement replacing the go statement, or
+// nil if the go statement can not be rewritten.
+func (ip *InstrumentPhase) rewriteGoStmt(r *rule.InstGoroutineRule, goStmt *dst.GoStmt,
+	locals, nonVars map[string]bool,
+) dst.Stmt {
+	call := goStmt.Call
+	pos := ip.parser.FindPosition(goStmt)
+	capture := ast.CallTo(r.Capture, nil, nil)
+	restore := ast.ExprStmt(ast.CallTo(r.Restore, nil, ast.Exprs(ast.Ident(goroutineContextName))))
+	param := ast.Field(goroutineContextName, ast.InterfaceType())
+
+	// go func(a int) { ... }(x) ->
+	// go func(_otelContext interface{}, a int) { Restore(_otelContext); ... }(Capture(), x)
+	if lit, ok := unparen(call.Fun).(*dst.FuncLit); ok {
+		lit.Type.Params.List = append([]*dst.Field{param}, lit.Type.Params.List...)
+		lit.Body.List = append([]dst.Stmt{restore}, lit.Body.List...)
+		call.Args = append([]dst.Expr{capture}, call.Args...)
+		ip.tagPositions(lit.Body.List[1:])
+		ip.tagPositions(ast.Stmts(goStmt))
+		return goStmt
+	}
+	// The only argument may be a call returning multiple values, which can not
+	// be evaluated beforehand without type information, e.g. go f(g())
+	if len(call.Args) == 1 && !call.Ellipsis {
+		if _, ok := unparen(call.Args[0]).(*dst.CallExpr); ok {
+			return nil
+		}
+	}
+
+	// Evaluate the function value and the arguments before the goroutine starts,
+	// in the order the go statement evaluates them
+	lhs, rhs := make([]dst.Expr, 0), make([]dst.Expr, 0)
+	hoist := func(expr dst.Expr, name string) dst.Expr {
+		if !evaluatedEarly(expr, locals, nonVars) {
+			return expr
+		}
+		lhs = append(lhs, ast.Ident(name))
+		rhs = append(rhs, expr)
+		return ast.Ident(name)
+	}
+	call.Fun = hoist(call.Fun, goroutineFuncName)
+	for i, arg := range call.Args {
+		call.Args[i] = hoist(arg, fmt.Sprintf("%s%d", goroutineArgName, i))
+	}
+
+	callStmt := ast.ExprStmt(call)
+	wrapper := &dst.FuncLit{
+		Type: &dst.FuncType{Params: &dst.FieldList{List: []*dst.Field{param}}},
+		Body: ast.BlockStmts(restore, callStmt),
+	}
+	goStmt.Call = &dst.CallExpr{Fun: wrapper, Args: ast.Exprs(capture)}
+	var replaced dst.Stmt = goStmt
+	tagged := ast.Stmts(goStmt, callStmt)
+	if len(lhs) > 0 {
+		define := ast.DefineStmts(lhs, rhs)
+		block := ast.BlockStmts(define, goStmt)
+		block.Decs.NodeDecs = goStmt.Decs.NodeDecs
+		goStmt.Decs.NodeDecs = dst.NodeDecs{}
+		replaced, tagged = block, append(tagged, define)
+	}
+	if pos.IsValid() {
+		for _, stmt := range tagged {
+			tagPosition(stmt, pos)
+		}
+	}
+	return replaced
+}
+
+// containsAny reports whether the statement is or contains any of the given
+// statements.
+func containsAny(stmt dst.Stmt, stmts map[dst.Stmt]bool) bool {
+	found := false
+	dst.Inspect(stmt, func(node dst.Node) bool {
+		if s, ok := node.(dst.Stmt); ok && stmts[s] {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// tagFollowing annotates the statements following the rewritten ones, and the
+// ones following the statements enclosing them, with line directives, so that
+// the rewriting does not shift the line numbers of the rest of the function.
+func (ip *InstrumentPhase) tagFollowing(body *dst.BlockStmt, rewritten map[dst.Stmt]bool) {
+	dst.Inspect(body, func(node dst.Node) bool {
+		var list []dst.Stmt
+		switch n := node.(type) {
+		case *dst.BlockStmt:
+			list = n.List
+		case *dst.CaseClause:
+			list = n.Body
+		case *dst.CommClause:
+			list = n.Body
+		default:
+			return true
+		}
+		for i := 1; i < len(list); i++ {
+			// The rewritten statements are annotated already
+			if !rewritten[list[i]] && containsAny(list[i-1], rewritten) {
+				ip.tagPositions(list[i : i+1])
+			}
+		}
+		return true
+	})
+}
+
+func (ip *InstrumentPhase) applyGoroutineRule(r *rule.InstGoroutineRule, root *dst.File) error {
+	sel, err := r.Selector()
+	if err != nil {
+		return err
+	}
+	count := 0
+	var pkgNames map[string]bool
+	for _, funcDecl := range ast.ListFuncDecls(root) {
+		name := funcDecl.Name.Name
+		if !sel.Match(name) || r.Skips(name, ast.ReceiverTypeName(funcDecl)) || funcDecl.Body == nil {
+			continue
+		}
+		if pkgNames == nil {
+			pkgNames = ip.nonVarNames(root)
+		}
+		locals, others := localVars(funcDecl)
+		// The constants and types declared in the function are not variables
+		// either, unless shadowed by local variables
+		nonVars := maps.Clone(pkgNames)
+		maps.Copy(nonVars, others)
+		rewritten := make(map[dst.Stmt]bool)
+		// Rewrite in post-order, so that the go statements within the function
+		// literals started by go statements are rewritten as well
+		dstutil.Apply(funcDecl.Body, nil, func(c *dstutil.Cursor) bool {
+			goStmt, ok := c.Node().(*dst.GoStmt)
+			if !ok {
+				return true
+			}
+			stmt := ip.rewriteGoStmt(r, goStmt, locals, nonVars)
+			if stmt == nil {
+				ip.Warn("Skip go statement with a call as the only argument",
+					"rule", r, "pos", ip.parser.FindPosition(goStmt))
+				return true
+			}
+			if stmt != goStmt {
+				c.Replace(stmt)
+			}
+			rewritten[stmt] = true
+			count++
+			return true
+		})
+		ip.tagFollowing(funcDecl.Body, rewritten)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	// Declare the hooks once per package, they will be linked to the real hook
+	// functions
+	ip.addGlobalLinkedDecl(r.Capture, r.Path, &dst.FuncType{
+		Params:  &dst.FieldList{},
+		Results: &dst.FieldList{List: []*dst.Field{{Type: ast.InterfaceType()}}},
+	})
+	ip.addGlobalLinkedDecl(r.Restore, r.Path, &dst.FuncType{
+		Params: &dst.FieldList{List: []*dst.Field{{Type: ast.InterfaceType()}}},
+	})
+	ip.Info("Apply goroutine rule", "rule", r, "stmts", count)
+	return nil
+}
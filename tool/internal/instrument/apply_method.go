@@ -0,0 +1,182 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Method Injection
+//
+// Methods are added to the target type by copying their declarations from the
+// hook code into a new file of the target package. The hook code declares them
+// on a stand-in type, whose name is replaced by the target type in receivers.
+// The new file only imports the packages that the methods refer to.
+
+// majorVersionSuffix matches the last element of the import paths of major
+// versions, e.g. v2 in gopkg.in/foo/v2.
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName returns the name the import is referred to by, which is guessed
+// from the import path if the import has no explicit name, e.g. "yaml" for
+// "gopkg.in/yaml.v3" and "otel" for "go.opentelemetry.io/otel/v2".
+func importName(spec *dst.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	p, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(p)
+	if majorVersionSuffix.MatchString(name) && path.Dir(p) != "." {
+		name = path.Base(path.Dir(p))
+	}
+	name, _, _ = strings.Cut(name, ".")
+	return strings.TrimPrefix(name, "go-")
+}
+
+// usedImports returns the imports of the file that the declaration refers to.
+func usedImports(root *dst.File, decl dst.Node) []*dst.ImportSpec {
+	used := make(map[string]bool)
+	dst.Inspect(decl, func(node dst.Node) bool {
+		if sel, ok := node.(*dst.SelectorExpr); ok {
+			if x, ok1 := sel.X.(*dst.Ident); ok1 {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	specs := make([]*dst.ImportSpec, 0)
+	for _, spec := range root.Imports {
+		if used[importName(spec)] {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// renameReceiver replaces the stand-in type of the method receiver by the
+// target type, keeping the pointer and the type parameters if any.
+func renameReceiver(funcDecl *dst.FuncDecl, typeName string) {
+	t := funcDecl.Recv.List[0].Type
+	for {
+		switch expr := t.(type) {
+		case *dst.StarExpr:
+			t = expr.X
+		case *dst.IndexExpr:
+			t = expr.X
+		case *dst.IndexListExpr:
+			t = expr.X
+		case *dst.Ident:
+			expr.Name = typeName
+			return
+		default:
+			return
+		}
+	}
+}
+
+// findMethodDecl finds the method declared on the stand-in type, either with a
+// value or a pointer receiver.
+func findMethodDecl(roots []*dst.File, name, standIn string) (*dst.File, *dst.FuncDecl) {
+	for _, root := range roots {
+		for _, recv := range []string{standIn, "*" + standIn} {
+			if funcDecl := ast.FindFuncDecl(root, name, recv); funcDecl != nil {
+				return root, funcDecl
+			}
+		}
+	}
+	return nil, nil
+}
+
+// parseHookPackage parses the Go files of the hook package at the rule path,
+// excluding the files of nested packages and tests.
+func parseHookPackage(rulePath string) ([]*dst.File, error) {
+	files, err := listRuleFiles(rulePath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Clean(util.GetRuleDir(rulePath))
+	roots := make([]*dst.File, 0)
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		if filepath.Dir(file) != dir {
+			continue
+		}
+		root, err1 := ast.ParseFile(file)
+		if err1 != nil {
+			return nil, err1
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// applyMethodRule adds the methods of the rule to the target type by writing
+// them to a new file of the target package.
+func (ip *InstrumentPhase) applyMethodRule(r *rule.InstMethodRule, pkgName string) error {
+	roots, err := parseHookPackage(r.Path)
+	if err != nil {
+		return err
+	}
+
+	decls := make([]dst.Decl, 0, len(r.Methods)+1)
+	specs := make([]dst.Spec, 0)
+	imported := make(map[string]bool)
+	for _, name := range r.Methods {
+		root, funcDecl := findMethodDecl(roots, name, r.StandIn())
+		if funcDecl == nil {
+			return ex.Newf("can not find method %s of %s in %s", name, r.StandIn(), r.Path)
+		}
+		for _, spec := range usedImports(root, funcDecl) {
+			if !imported[spec.Path.Value] {
+				imported[spec.Path.Value] = true
+				specs = append(specs, spec)
+			}
+		}
+		renameReceiver(funcDecl, r.Type)
+		decls = append(decls, funcDecl)
+	}
+	if len(specs) > 0 {
+		importDecl := &dst.GenDecl{Tok: token.IMPORT, Specs: specs, Lparen: len(specs) > 1}
+		decls = append([]dst.Decl{importDecl}, decls...)
+	}
+
+	// Rule names may contain characters that are not allowed in file names,
+	// such as the index of variants
+	name := strings.Map(func(c rune) rune {
+		if c == '_' || c == '-' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			return c
+		}
+		return '_'
+	}, r.Name)
+	newFile := filepath.Join(ip.workDir, fmt.Sprintf("otel.%s.methods.go", name))
+	root := &dst.File{Name: ast.Ident(pkgName), Decls: decls}
+	if err = ast.WriteFile(newFile, root); err != nil {
+		return err
+	}
+	ip.Info("Apply method rule", "rule", r)
+
+	// Add the new file as part of the source files to be compiled
+	ip.addCompileArg(newFile)
+	ip.keepForDebug(newFile)
+	return nil
+}
@@ -5,8 +5,13 @@ package instrument
 
 import (
 	"fmt"
+	"go/token"
+	"maps"
+	"slices"
+	"strconv"
 
 	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
@@ -17,6 +22,8 @@ import (
 const (
 	unnamedRetValName = "_unnamedRetVal"
 	ignoredParam      = "_ignoredParam"
+	eachReturnName    = "_otelEachReturn"
+	eachReturnArgName = "_otelRet"
 )
 
 func renameReturnValues(funcDecl *dst.FuncDecl) {
@@ -32,7 +39,7 @@ func renameReturnValues(funcDecl *dst.FuncDecl) {
 	}
 }
 
-func insertRaw(r *rule.InstRawRule, decl *dst.FuncDecl) error {
+func (ip *InstrumentPhase) insertRaw(r *rule.InstRawRule, decl *dst.FuncDecl) error {
 	util.Assert(decl.Name.Name == r.Func, "sanity check")
 
 	// Rename the unnamed return values so that the raw code can reference them
@@ -43,13 +50,248 @@ func insertRaw(r *rule.InstRawRule, decl *dst.FuncDecl) error {
 	if err != nil {
 		return err
 	}
-	// Insert the raw code into target function body
-	decl.Body.List = append(stmts, decl.Body.List...)
+	switch r.Position {
+	case rule.RawPositionEachReturn:
+		stmts, err = insertRawBeforeReturns(p, r, decl)
+		if err != nil {
+			return err
+		}
+	case rule.RawPositionExit:
+		// Run the raw code on exit by deferring it at the entry, so the raw
+		// code of the rules applied before runs after it
+		closure := &dst.FuncLit{
+			Type: &dst.FuncType{Params: &dst.FieldList{}},
+			Body: ast.BlockStmts(stmts...),
+		}
+		stmts = ast.Stmts(ast.DeferStmt(&dst.CallExpr{Fun: closure}))
+	}
+	// Insert the raw code into target function body, after the raw code of
+	// the rules applied before
+	at := ip.rawStmts[decl]
+	decl.Body.List = slices.Insert(decl.Body.List, at, stmts...)
+	ip.rawStmts[decl] = at + len(stmts)
+	return nil
+}
+
+// insertRawBeforeReturns inserts the raw code before every return statement of
+// the function, and at its end if it may return without one. The values to be
+// returned are assigned to the result variables first, so that the raw code can
+// read and overwrite them, i.e. "return a, b" becomes "r0, r1 = a, b; ...; return".
+//
+// The result variables can not be assigned where a result name is shadowed, e.g.
+// by "if err := f(); err != nil { return 0, err }". The raw code is then moved to
+// a closure declared at the entry, where the results are in scope, and the return
+// becomes "return closure(a, b)". The statements declaring the closure, if any,
+// are returned for the caller to insert at the entry.
+func insertRawBeforeReturns(p *ast.AstParser, r *rule.InstRawRule, decl *dst.FuncDecl) ([]dst.Stmt, error) {
+	results := collectReturnValues(decl)
+	closure := eachReturnName + util.CRC32(r.String())
+	shadowed := false
+	var err error
+	snippet := func(ret *dst.ReturnStmt) []dst.Stmt {
+		stmts, err1 := p.ParseSnippet(r.Raw)
+		if err1 != nil {
+			err = err1
+			return nil
+		}
+		if len(ret.Results) == 0 {
+			return stmts
+		}
+		lhs := make([]dst.Expr, 0, len(results))
+		for _, name := range results {
+			lhs = append(lhs, ast.Ident(name))
+		}
+		assign := &dst.AssignStmt{Lhs: lhs, Tok: token.ASSIGN, Rhs: ret.Results}
+		ret.Results = nil
+		return append([]dst.Stmt{assign}, stmts...)
+	}
+	// Track the names declared by the enclosing scopes of every statement, so
+	// as to tell whether a result name is shadowed at a return
+	scopes := []map[string]bool{}
+	declare := func(exprs ...dst.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*dst.Ident); ok && len(scopes) > 0 {
+				scopes[len(scopes)-1][ident.Name] = true
+			}
+		}
+	}
+	isShadowed := func() bool {
+		for _, scope := range scopes {
+			for _, name := range results {
+				if scope[name] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	dstutil.Apply(decl.Body, func(c *dstutil.Cursor) bool {
+		switch node := c.Node().(type) {
+		case *dst.FuncLit:
+			// Returns of closures do not return from the function
+			return false
+		case *dst.IfStmt:
+			// Neither are the returns of skipped calls in trampoline-jump-ifs
+			if len(node.Decs.If) == 1 && node.Decs.If[0] == tJumpLabel {
+				return false
+			}
+		case *dst.AssignStmt:
+			if node.Tok == token.DEFINE {
+				declare(node.Lhs...)
+			}
+		case *dst.ValueSpec:
+			for _, name := range node.Names {
+				declare(name)
+			}
+		case *dst.RangeStmt:
+			// The iteration variables are scoped to the loop
+			scopes = append(scopes, map[string]bool{})
+			if node.Tok == token.DEFINE {
+				declare(node.Key, node.Value)
+			}
+			return true
+		case *dst.ReturnStmt:
+			if len(node.Results) > 0 && isShadowed() {
+				shadowed = true
+				node.Results = []dst.Expr{ast.CallTo(closure, nil, node.Results)}
+				return false
+			}
+			stmts := snippet(node)
+			if c.Index() < 0 {
+				// The return is not in a statement list, e.g. a labeled statement
+				c.Replace(ast.BlockStmts(append(stmts, node)...))
+				return false
+			}
+			for _, stmt := range stmts {
+				c.InsertBefore(stmt)
+			}
+		}
+		if opensScope(c.Node()) {
+			scopes = append(scopes, map[string]bool{})
+		}
+		return true
+	}, func(c *dstutil.Cursor) bool {
+		if opensScope(c.Node()) {
+			scopes = scopes[:len(scopes)-1]
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var entry []dst.Stmt
+	if shadowed {
+		entry = append(entry, eachReturnClosure(p, r, decl, closure, results))
+	}
+	// Functions without results may also return by reaching the end of their
+	// body, while functions with results must end with a terminating statement
+	if len(results) > 0 {
+		return entry, nil
+	}
+	if list := decl.Body.List; len(list) > 0 {
+		if _, ok := list[len(list)-1].(*dst.ReturnStmt); ok {
+			return entry, nil
+		}
+	}
+	stmts, err := p.ParseSnippet(r.Raw)
+	if err != nil {
+		return nil, err
+	}
+	decl.Body.List = append(decl.Body.List, stmts...)
+	return entry, nil
+}
+
+// opensScope tells whether the node opens a scope that the names declared in it
+// are limited to.
+func opensScope(node dst.Node) bool {
+	switch node.(type) {
+	case *dst.BlockStmt, *dst.IfStmt, *dst.ForStmt, *dst.RangeStmt, *dst.SwitchStmt,
+		*dst.TypeSwitchStmt, *dst.SelectStmt, *dst.CaseClause, *dst.CommClause:
+		return true
+	}
+	return false
+}
+
+// eachReturnClosure builds the closure that runs the raw code where the results
+// are shadowed, i.e.
+//
+//	closure := func(_otelRet0 T0, _otelRet1 T1) (T0, T1) {
+//		r0, r1 = _otelRet0, _otelRet1
+//		...
+//		return r0, r1
+//	}
+func eachReturnClosure(p *ast.AstParser, r *rule.InstRawRule, decl *dst.FuncDecl,
+	name string, results []string,
+) dst.Stmt {
+	params := &dst.FieldList{}
+	types := &dst.FieldList{}
+	args := make([]dst.Expr, 0, len(results))
+	vars := make([]dst.Expr, 0, len(results))
+	for _, field := range decl.Type.Results.List {
+		for range field.Names {
+			arg := fmt.Sprintf("%s%d", eachReturnArgName, len(args))
+			params.List = append(params.List, &dst.Field{
+				Names: []*dst.Ident{ast.Ident(arg)},
+				Type:  util.AssertType[dst.Expr](dst.Clone(field.Type)),
+			})
+			types.List = append(types.List, &dst.Field{
+				Type: util.AssertType[dst.Expr](dst.Clone(field.Type)),
+			})
+			args = append(args, ast.Ident(arg))
+			vars = append(vars, ast.Ident(results[len(vars)]))
+		}
+	}
+	// The raw code has been parsed successfully before
+	stmts, err := p.ParseSnippet(r.Raw)
+	util.Assert(err == nil, "sanity check")
+	body := []dst.Stmt{&dst.AssignStmt{Lhs: vars, Tok: token.ASSIGN, Rhs: args}}
+	body = append(body, stmts...)
+	ret := make([]dst.Expr, 0, len(results))
+	for _, name := range results {
+		ret = append(ret, ast.Ident(name))
+	}
+	body = append(body, ast.ReturnStmt(ret))
+	closure := &dst.FuncLit{
+		Type: &dst.FuncType{Params: params, Results: types},
+		Body: ast.BlockStmts(body...),
+	}
+	return ast.DefineStmts(ast.Exprs(ast.Ident(name)), ast.Exprs(closure))
+}
+
+// addRawImports adds the imports of the raw code to the file unless the file
+// already imports the package by the same name. It fails if the name refers to
+// another package in the file.
+func addRawImports(root *dst.File, imports map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(imports)) {
+		path := imports[name]
+		found := false
+		for _, spec := range root.Imports {
+			if importName(spec) != name {
+				continue
+			}
+			if spec.Path.Value != strconv.Quote(path) {
+				return ex.Newf("import %s %q conflicts with import %s %s", name, path, name, spec.Path.Value)
+			}
+			found = true
+		}
+		if found {
+			continue
+		}
+		decl := ast.ImportDecl(name, path)
+		spec := util.AssertType[*dst.ImportSpec](decl.Specs[0])
+		// Omit the name if the package is referred to by the name anyway
+		spec.Name = nil
+		if importName(spec) != name {
+			spec.Name = ast.Ident(name)
+		}
+		root.Decls = append([]dst.Decl{decl}, root.Decls...)
+		root.Imports = append(root.Imports, spec)
+	}
 	return nil
 }
 
-// applyRawRule injects the raw code into the target function at the beginning
-// of the function.
+// applyRawRule injects the raw code into the target function at the position
+// given by the rule, i.e. its entry by default.
 func (ip *InstrumentPhase) applyRawRule(rule *rule.InstRawRule, root *dst.File) error {
 	// Find the target function to be instrumented
 	funcDecl := ast.FindFuncDecl(root, rule.Func, rule.Recv)
@@ -57,10 +299,18 @@ func (ip *InstrumentPhase) applyRawRule(rule *rule.InstRawRule, root *dst.File)
 		return ex.Newf("can not find function %s", rule.Func)
 	}
 	// Insert the raw code into the target function
-	err := insertRaw(rule, funcDecl)
+	err := ip.insertRaw(rule, funcDecl)
 	if err != nil {
 		return err
 	}
+	// Import the packages the raw code refers to, which may not be imported
+	// by the target package yet
+	if err = addRawImports(root, rule.Imports); err != nil {
+		return err
+	}
+	for _, path := range rule.Imports {
+		ip.addImport(path)
+	}
 	ip.Info("Apply raw rule", "rule", rule)
 	return nil
 }
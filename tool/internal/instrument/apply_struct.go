@@ -4,6 +4,14 @@
 package instrument
 
 import (
+	"bytes"
+	goast "go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
 	"github.com/dave/dst"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
@@ -11,14 +19,157 @@ import (
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
 )
 
+// structImportPrefix prefixes the names of the packages imported to spell the
+// types of the new fields in the files only containing unkeyed literals.
+const structImportPrefix = "_otel_"
+
+// structImports returns the quoted import paths of the file declaring the
+// struct, by the names it refers to them, which spell the qualified types of
+// the new fields. The file is searched among the files of the compile command,
+// which are parsed on first use only.
+func (ip *InstrumentPhase) structImports(structName string) map[string]string {
+	if ip.typeImports == nil {
+		ip.typeImports = ip.parseTypeImports()
+	}
+	return ip.typeImports[structName]
+}
+
+// parseTypeImports returns the imports of the files of the compile command by
+// the names of the types declared in them.
+func (ip *InstrumentPhase) parseTypeImports() map[string]map[string]string {
+	typeImports := make(map[string]map[string]string)
+	fset := token.NewFileSet()
+	for _, arg := range ip.compileArgs {
+		if !strings.HasSuffix(arg, ".go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, arg, nil, parser.SkipObjectResolution)
+		if err != nil {
+			ip.Warn("Skip unparsable file", "file", arg, "error", err)
+			continue
+		}
+		imports := make(map[string]string)
+		for _, spec := range file.Imports {
+			dstSpec := &dst.ImportSpec{Path: &dst.BasicLit{Value: spec.Path.Value}}
+			if spec.Name != nil {
+				dstSpec.Name = ast.Ident(spec.Name.Name)
+			}
+			imports[importName(dstSpec)] = spec.Path.Value
+		}
+		for _, name := range declaredTypes(file) {
+			if _, ok := typeImports[name]; !ok {
+				typeImports[name] = imports
+			}
+		}
+	}
+	return typeImports
+}
+
+// declaredTypes returns the names of the types the file declares at package
+// level.
+func declaredTypes(file *goast.File) []string {
+	names := make([]string, 0)
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*goast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			names = append(names, spec.(*goast.TypeSpec).Name.Name)
+		}
+	}
+	return names
+}
+
+// qualifyType spells the type of a new field in a file that does not declare
+// the struct. The packages qualifying the type are referred to by the imports
+// of the file if it imports them by usable names, otherwise they are imported.
+func qualifyType(t string, root *dst.File, imports map[string]string) (string, error) {
+	expr, err := parser.ParseExpr(t)
+	if err != nil {
+		return "", ex.Wrapf(err, "invalid type %q", t)
+	}
+	goast.Inspect(expr, func(node goast.Node) bool {
+		if err != nil {
+			return false
+		}
+		sel, ok := node.(*goast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*goast.Ident)
+		if !ok {
+			return true
+		}
+		quoted, found := imports[pkg.Name]
+		if !found {
+			err = ex.Newf("can not find package %s of type %q", pkg.Name, t)
+			return false
+		}
+		path, _ := strconv.Unquote(quoted)
+		for _, spec := range root.Imports {
+			name := importName(spec)
+			if spec.Path.Value == quoted && name != "_" && name != "." {
+				pkg.Name = name
+				return true
+			}
+		}
+		pkg.Name = structImportPrefix + pkg.Name
+		addImports(root, map[string]string{path: pkg.Name})
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = format.Node(&buf, token.NewFileSet(), expr); err != nil {
+		return "", ex.Wrap(err)
+	}
+	return buf.String(), nil
+}
+
 func (ip *InstrumentPhase) applyStructRule(rule *rule.InstStructRule, root *dst.File) error {
-	structDecl := ast.FindStructDecl(root, rule.Struct)
-	if structDecl == nil {
+	// The setup phase has rejected the rule if the unkeyed literals are not to
+	// be rewritten. They may also be found in files not declaring the struct
+	lits := ast.FindUnkeyedLits(root, rule.Struct)
+	typeSpec := ast.FindTypeSpec(root, rule.Struct)
+	if typeSpec == nil && len(lits) == 0 {
 		return ex.Newf("can not find struct %s", rule.Struct)
 	}
+	types := make([]string, 0, len(rule.NewField))
 	for _, field := range rule.NewField {
-		ast.AddStructField(structDecl, field.Name, field.Type)
+		types = append(types, field.Type)
+	}
+	if typeSpec != nil {
+		if _, ok := typeSpec.Type.(*dst.StructType); !ok {
+			return ex.Newf("type %s is not a struct", rule.Struct)
+		}
+		for _, field := range rule.NewField {
+			ast.AddStructField(typeSpec, field.Name, field.Type, field.Tag)
+		}
+	} else {
+		// The qualified types are spelled by the imports of the file declaring
+		// the struct, which may differ from the ones of this file
+		var imports map[string]string
+		for i, t := range types {
+			if !strings.Contains(t, ".") {
+				continue
+			}
+			if imports == nil {
+				imports = ip.structImports(rule.Struct)
+			}
+			qualified, err := qualifyType(t, root, imports)
+			if err != nil {
+				return ex.Wrapf(err, "can not rewrite unkeyed literals of struct %s", rule.Struct)
+			}
+			types[i] = qualified
+		}
+	}
+	for _, lit := range lits {
+		for _, t := range types {
+			lit.Elts = append(lit.Elts, ast.ZeroValue(ast.Ident(t)))
+		}
 	}
-	ip.Info("Apply struct rule", "rule", rule)
+	ip.Info("Apply struct rule", "rule", rule, "unkeyed", len(lits))
 	return nil
 }
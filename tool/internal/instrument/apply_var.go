@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"go/token"
+	"slices"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Variable Override
+//
+// The initializer of a package-level variable or constant is replaced by the
+// value of the rule, in which the original initializer is substituted for
+// _origValue, and then wrapped in a call to the hook if any. Like the hooks of
+// func rules, the hook is declared without body in the target file and linked
+// to the hook code by a linkname directive, so the target package does not
+// depend on the hook package, e.g.
+//
+//	//go:linkname WrapTimeout github.com/foo/bar/hook_rule.WrapTimeout
+//	func WrapTimeout(time.Duration) time.Duration
+//
+//	var DefaultTimeout time.Duration = WrapTimeout(2 * (10 * time.Second))
+
+// parseExpr parses the Go expression into AST.
+func parseExpr(p *ast.AstParser, expr string) (dst.Expr, error) {
+	stmts, err := p.ParseSnippet("_ = " + expr)
+	if err != nil {
+		return nil, err
+	}
+	return util.AssertType[*dst.AssignStmt](stmts[0]).Rhs[0], nil
+}
+
+// parseType parses the Go type into AST.
+func parseType(p *ast.AstParser, t string) (dst.Expr, error) {
+	stmts, err := p.ParseSnippet("var _ " + t)
+	if err != nil {
+		return nil, err
+	}
+	genDecl := util.AssertType[*dst.GenDecl](util.AssertType[*dst.DeclStmt](stmts[0]).Decl)
+	return util.AssertType[*dst.ValueSpec](genDecl.Specs[0]).Type, nil
+}
+
+// substituteOrig replaces the references to the original initializer in the
+// value by copies of it.
+func substituteOrig(value, orig dst.Expr) dst.Expr {
+	result := dstutil.Apply(value, func(c *dstutil.Cursor) bool {
+		if ident, ok := c.Node().(*dst.Ident); ok && ident.Name == rule.VarOrigValue {
+			// Parenthesize it so that "2 * _origValue" keeps its meaning for
+			// an initializer like "1 + 1"
+			c.Replace(&dst.ParenExpr{X: util.AssertType[dst.Expr](dst.Clone(orig))})
+		}
+		return true
+	}, nil)
+	return util.AssertType[dst.Expr](result)
+}
+
+// findInitializer returns the original initializer of the name declared by the
+// value spec, filling in the zero values of a variable declared without any.
+func findInitializer(decl *dst.GenDecl, spec *dst.ValueSpec, name string) (dst.Expr, int, error) {
+	index := slices.IndexFunc(spec.Names, func(ident *dst.Ident) bool { return ident.Name == name })
+	util.Assert(index != -1, "sanity check")
+	if decl.Tok == token.CONST {
+		if len(spec.Values) == 0 {
+			return nil, 0, ex.Newf("constant %s repeats the previous initializer implicitly", name)
+		}
+		// The following constants may repeat the initializer implicitly
+		next := slices.Index(decl.Specs, dst.Spec(spec)) + 1
+		if next < len(decl.Specs) && len(util.AssertType[*dst.ValueSpec](decl.Specs[next]).Values) == 0 {
+			return nil, 0, ex.Newf("constant %s is repeated implicitly by the following constants", name)
+		}
+	}
+	switch len(spec.Values) {
+	case len(spec.Names):
+		return spec.Values[index], index, nil
+	case 0:
+		// The variables are initialized to the zero values of their type
+		// once one of them gets an initializer
+		util.Assert(spec.Type != nil, "sanity check")
+		for range spec.Names {
+			t := util.AssertType[dst.Expr](dst.Clone(spec.Type))
+			spec.Values = append(spec.Values, ast.ZeroValue(t))
+		}
+		return spec.Values[index], index, nil
+	default:
+		return nil, 0, ex.Newf("variable %s is initialized by a multi-value expression", name)
+	}
+}
+
+// addVarHookDecl declares the hook without body in the target file and links it
+// to the hook code.
+func (ip *InstrumentPhase) addVarHookDecl(r *rule.InstVarRule, t dst.Expr, root *dst.File) {
+	param := util.AssertType[dst.Expr](dst.Clone(t))
+	result := util.AssertType[dst.Expr](dst.Clone(t))
+	ip.addLinkedDecl(root, r.Hook, r.Path, &dst.FuncType{
+		Params:  &dst.FieldList{List: []*dst.Field{{Type: param}}},
+		Results: &dst.FieldList{List: []*dst.Field{{Type: result}}},
+	})
+}
+
+// applyVarRule overrides the initializer of the variable or constant.
+func (ip *InstrumentPhase) applyVarRule(r *rule.InstVarRule, root *dst.File) error {
+	decl, spec := ast.FindValueSpec(root, r.Var)
+	if spec == nil {
+		return ex.Newf("can not find variable %s", r.Var)
+	}
+	if decl.Tok == token.CONST && r.Hook != "" {
+		return ex.Newf("constant %s can not be wrapped by hook %s", r.Var, r.Hook)
+	}
+	orig, index, err := findInitializer(decl, spec, r.Var)
+	if err != nil {
+		return err
+	}
+
+	p := ast.NewAstParser()
+	value := orig
+	if r.Value != "" {
+		value, err = parseExpr(p, r.Value)
+		if err != nil {
+			return err
+		}
+		value = substituteOrig(value, orig)
+	}
+	if r.Hook != "" {
+		t := spec.Type
+		if t == nil && r.Type != "" {
+			t, err = parseType(p, r.Type)
+			if err != nil {
+				return err
+			}
+		}
+		if t == nil {
+			return ex.Newf("variable %s is declared without type, which is required by hook %s", r.Var, r.Hook)
+		}
+		ip.addVarHookDecl(r, t, root)
+		value = ast.CallTo(r.Hook, nil, ast.Exprs(value))
+	}
+	spec.Values[index] = value
+
+	// Import the packages the value refers to
+	if err = addRawImports(root, r.Imports); err != nil {
+		return err
+	}
+	for _, path := range r.Imports {
+		ip.addImport(path)
+	}
+	ip.Info("Apply var rule", "rule", r)
+	return nil
+}
@@ -0,0 +1,241 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Body-less Functions
+//
+// Functions implemented in assembly or pulled from another package by
+// //go:linkname are declared without body, so there is nowhere to insert the
+// trampoline-jump-if. Instead, the declaration is renamed and a wrapper with the
+// original name calls it, e.g.
+//
+//	//go:noescape
+//	func _otel_orig_Sqrt(x float64) float64
+//
+//	func Sqrt(x float64) float64 {
+//		return _otel_orig_Sqrt(x)
+//	}
+//
+// and the wrapper is instrumented as usual. The implementation must follow the
+// new name: the local name of the //go:linkname directive is renamed along with
+// the declaration, and the TEXT symbols of the assembly files are renamed when
+// the assembler is run for the package, both to generate the symbol ABIs that
+// the compiler checks the declarations against and to assemble them.
+
+const (
+	bodylessFuncPrefix = "_otel_orig_"
+	asmDirName         = "otel_asm"
+	asmFileExt         = ".s"
+)
+
+// bodylessFuncName returns the name that the body-less function is renamed to.
+func bodylessFuncName(name string) string {
+	return bodylessFuncPrefix + name
+}
+
+// renameLinkname renames the local name of the //go:linkname directive of the
+// function, it reports whether the directive is found.
+func renameLinkname(root *dst.File, name, newName string) bool {
+	found := false
+	rename := func(decs dst.Decorations) {
+		for i, dec := range decs {
+			fields := strings.Fields(dec)
+			if len(fields) == 3 && fields[0] == "//go:linkname" && fields[1] == name {
+				decs[i] = fmt.Sprintf("//go:linkname %s %s", newName, fields[2])
+				found = true
+			}
+		}
+	}
+	dst.Inspect(root, func(node dst.Node) bool {
+		if node == nil {
+			return false
+		}
+		decs := node.Decorations()
+		rename(decs.Start)
+		rename(decs.End)
+		return true
+	})
+	return found
+}
+
+// definedInAsm reports whether the symbol ABIs of the package, generated from
+// its assembly files, define the function.
+func (ip *InstrumentPhase) definedInAsm(name string) (bool, error) {
+	symabis := util.FindFlagValue(ip.compileArgs, "-symabis")
+	if symabis == "" {
+		return false, nil
+	}
+	file, err := os.Open(symabis)
+	if err != nil {
+		return false, ex.Wrapf(err, "failed to open %s", symabis)
+	}
+	defer file.Close()
+	// The lines look like "def main.Add ABI0"
+	symbol := util.FindFlagValue(ip.compileArgs, "-p") + "." + name
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "def" && fields[1] == symbol {
+			return true, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, ex.Wrapf(err, "failed to read %s", symabis)
+	}
+	return false, nil
+}
+
+// newBodylessWrapper returns the wrapper of the body-less function, which has
+// its name and signature and calls it by the new name.
+func newBodylessWrapper(funcDecl *dst.FuncDecl, newName string) *dst.FuncDecl {
+	wrapper := util.AssertType[*dst.FuncDecl](dst.Clone(funcDecl))
+	// Directives such as //go:noescape only apply to the implementation
+	wrapper.Decs = dst.FuncDeclDecorations{}
+	variadic := false
+	for _, field := range wrapper.Type.Params.List {
+		if len(field.Names) == 0 {
+			// Unnamed parameters are named by collectArguments
+			field.Names = []*dst.Ident{ast.Ident(ast.IdentIgnore)}
+		}
+		_, variadic = field.Type.(*dst.Ellipsis)
+	}
+	args := make([]dst.Expr, 0)
+	for _, arg := range collectArguments(wrapper) {
+		args = append(args, ast.Ident(arg))
+	}
+	call := ast.CallTo(newName, nil, args)
+	call.Ellipsis = variadic
+	if wrapper.Type.Results != nil {
+		wrapper.Body = ast.BlockStmts(ast.ReturnStmt(ast.Exprs(call)))
+	} else {
+		wrapper.Body = ast.BlockStmts(ast.ExprStmt(call))
+	}
+	return wrapper
+}
+
+// wrapBodylessFunc renames the body-less function and returns the wrapper that
+// replaces it. It fails if the function is neither implemented in assembly nor
+// pulled by //go:linkname, e.g. if its implementation is pushed from another
+// package, which would still refer to the original name.
+func (ip *InstrumentPhase) wrapBodylessFunc(funcDecl *dst.FuncDecl) (*dst.FuncDecl, error) {
+	name := funcDecl.Name.Name
+	if ast.HasReceiver(funcDecl) {
+		return nil, ex.Newf("method %s has no body", name)
+	}
+	newName := bodylessFuncName(name)
+	if !renameLinkname(ip.target, name, newName) {
+		inAsm, err := ip.definedInAsm(newName)
+		if err != nil {
+			return nil, err
+		}
+		if !inAsm {
+			return nil, ex.Newf("function %s has no body, it is neither implemented "+
+				"in assembly nor pulled by go:linkname", name)
+		}
+	}
+	wrapper := newBodylessWrapper(funcDecl, newName)
+	funcDecl.Name.Name = newName
+	ip.addDecl(wrapper)
+	ip.Info("Wrap body-less function", "func", name, "renamed", newName)
+	return wrapper, nil
+}
+
+// renameAsmFuncs renames the TEXT symbols of the functions in the assembly
+// source of the package, which are written as ·Name or pkg·Name, where the
+// slashes and periods of the import path are written as division slashes and
+// middle dots.
+func renameAsmFuncs(source, importPath string, funcs []string) (string, bool) {
+	pkg := regexp.QuoteMeta(strings.NewReplacer("/", "∕", ".", "·").Replace(importPath))
+	changed := false
+	for _, fn := range funcs {
+		prefix := `(?m)^(\s*TEXT\s+(?:` + pkg + `)?·)`
+		re := regexp.MustCompile(prefix + regexp.QuoteMeta(fn) + `(<\w+>)?\(SB\)`)
+		renamed := re.ReplaceAllString(source, "${1}"+bodylessFuncName(fn)+"${2}(SB)")
+		changed = changed || renamed != source
+		source = renamed
+	}
+	return source, changed
+}
+
+// interceptAsm renames the assembly functions of the package that func rules
+// target, see wrapBodylessFunc. The renamed files are written to the working
+// directory and replace the original ones in the command, the directories of
+// the original ones are added to the include paths for their #include files.
+func interceptAsm(ctx context.Context, args []string) ([]string, error) {
+	target := util.FindFlagValue(args, "-o")
+	util.Assert(target != "", "missing -o flag value")
+	ip := &InstrumentPhase{
+		logger:  util.LoggerFromContext(ctx),
+		workDir: filepath.Dir(target),
+	}
+	allSet, err := ip.load()
+	if err != nil {
+		return nil, err
+	}
+	matched := ip.match(allSet, args)
+	if matched == nil {
+		return args, nil
+	}
+	funcs := make([]string, 0)
+	for _, r := range matched.GetFuncRules() {
+		if r.Recv == "" {
+			funcs = append(funcs, r.Func)
+		}
+	}
+	if len(funcs) == 0 {
+		return args, nil
+	}
+
+	importPath := util.FindFlagValue(args, "-p")
+	newArgs := make([]string, 0, len(args))
+	includes := make([]string, 0)
+	for _, arg := range args {
+		if !strings.HasSuffix(arg, asmFileExt) {
+			newArgs = append(newArgs, arg)
+			continue
+		}
+		content, err1 := os.ReadFile(arg)
+		if err1 != nil {
+			return nil, ex.Wrapf(err1, "failed to read %s", arg)
+		}
+		source, changed := renameAsmFuncs(string(content), importPath, funcs)
+		if !changed {
+			newArgs = append(newArgs, arg)
+			continue
+		}
+		renamed := filepath.Join(ip.workDir, asmDirName, filepath.Base(arg))
+		if err1 = os.MkdirAll(filepath.Dir(renamed), 0o755); err1 != nil {
+			return nil, ex.Wrap(err1)
+		}
+		if err1 = util.WriteFile(renamed, source); err1 != nil {
+			return nil, err1
+		}
+		dir, err1 := filepath.Abs(filepath.Dir(arg))
+		if err1 != nil {
+			return nil, ex.Wrap(err1)
+		}
+		includes = append(includes, "-I", dir)
+		newArgs = append(newArgs, renamed)
+		ip.Info("Rename assembly functions", "file", arg, "funcs", funcs)
+	}
+	// Flags must precede the files
+	return append(newArgs[:1:1], append(includes, newArgs[1:]...)...), nil
+}
@@ -0,0 +1,152 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package instrument
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Import Config
+//
+// The compiler only resolves the imports listed in the import config file that
+// the go command passes with -importcfg, which lists the packages the target
+// package imports. Injected code may import other packages, e.g. the imports
+// of raw rules and of the files introduced by file rules. Their export data is
+// resolved once by the setup phase with go list, which compiles them with the
+// same toolexec, and added to a copy of the import config that replaces the
+// original one. The setup phase makes sure the packages are linked into the
+// final binary as well.
+
+const importCfgFile = "otel.importcfg"
+
+// addImport records the package imported by the injected code.
+func (ip *InstrumentPhase) addImport(path string) {
+	if !slices.Contains(ip.imports, path) {
+		ip.imports = append(ip.imports, path)
+	}
+}
+
+// importCfgPaths returns the import paths that the import config resolves,
+// i.e. the ones of packagefile and importmap directives.
+func importCfgPaths(content string) map[string]bool {
+	paths := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		for _, directive := range []string{"packagefile ", "importmap "} {
+			if rest, ok := strings.CutPrefix(line, directive); ok {
+				path, _, _ := strings.Cut(rest, "=")
+				paths[strings.TrimSpace(path)] = true
+			}
+		}
+	}
+	return paths
+}
+
+// missingImports returns the imports that the import config does not resolve.
+// The pseudo packages unsafe and C never appear in the import config.
+func missingImports(content string, imports []string) []string {
+	known := importCfgPaths(content)
+	missing := make([]string, 0)
+	for _, path := range imports {
+		if known[path] || path == "unsafe" || path == "C" {
+			continue
+		}
+		missing = append(missing, path)
+	}
+	slices.Sort(missing)
+	return missing
+}
+
+// loadExports loads the export data of the packages imported by the injected
+// code, as stored by the setup phase. There is none if the setup phase did not
+// store it.
+func loadExports() (map[string]util.PackageExport, error) {
+	f := util.GetExportsFile()
+	content, err := os.ReadFile(f)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to read file %s", f)
+	}
+	exports := make(map[string]util.PackageExport)
+	err = json.Unmarshal(content, &exports)
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to unmarshal JSON")
+	}
+	return exports, nil
+}
+
+// appendImportCfg appends the directives that resolve the imports to the
+// export data of the packages to the import config.
+func appendImportCfg(content string, imports []string, exports map[string]util.PackageExport) string {
+	var sb strings.Builder
+	sb.WriteString(content)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		sb.WriteString("\n")
+	}
+	for _, path := range imports {
+		e := exports[path]
+		if e.ImportPath != path {
+			fmt.Fprintf(&sb, "importmap %s=%s\n", path, e.ImportPath)
+		}
+		fmt.Fprintf(&sb, "packagefile %s=%s\n", e.ImportPath, e.File)
+	}
+	return sb.String()
+}
+
+// updateImportConfig makes the packages imported by the injected code visible
+// to the compiler if the target package does not import them.
+func (ip *InstrumentPhase) updateImportConfig() error {
+	if len(ip.imports) == 0 {
+		return nil
+	}
+	// Start with an empty import config if the compile command has none
+	var content []byte
+	index := slices.Index(ip.compileArgs, "-importcfg")
+	if index != -1 && index+1 < len(ip.compileArgs) {
+		var err error
+		content, err = os.ReadFile(ip.compileArgs[index+1])
+		if err != nil {
+			return ex.Wrapf(err, "failed to read import config")
+		}
+	}
+	missing := missingImports(string(content), ip.imports)
+	if len(missing) == 0 {
+		return nil
+	}
+	exports, err := loadExports()
+	if err != nil {
+		return err
+	}
+	for _, path := range missing {
+		if _, ok := exports[path]; !ok {
+			return ex.Newf("no export data of %s imported by the injected code", path)
+		}
+	}
+	newCfg := filepath.Join(ip.workDir, importCfgFile)
+	err = util.WriteFile(newCfg, appendImportCfg(string(content), missing, exports))
+	if err != nil {
+		return err
+	}
+	if index != -1 && index+1 < len(ip.compileArgs) {
+		ip.compileArgs[index+1] = newCfg
+	} else {
+		ip.compileArgs = slices.Insert(ip.compileArgs, 1, "-importcfg", newCfg)
+	}
+	ip.keepForDebug(newCfg)
+	ip.Info("Update import config", "imports", missing)
+	return nil
+}
@@ -4,7 +4,10 @@
 package instrument
 
 import (
+	"cmp"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
@@ -15,6 +18,9 @@ func groupRules(workDir string, rset *rule.InstRuleSet) map[string][]rule.InstRu
 	addRulesToMap(rset.FuncRules, file2rules, rset.CgoFileMap, workDir)
 	addRulesToMap(rset.StructRules, file2rules, rset.CgoFileMap, workDir)
 	addRulesToMap(rset.RawRules, file2rules, rset.CgoFileMap, workDir)
+	addRulesToMap(rset.CallRules, file2rules, rset.CgoFileMap, workDir)
+	addRulesToMap(rset.VarRules, file2rules, rset.CgoFileMap, workDir)
+	addRulesToMap(rset.GoroutineRules, file2rules, rset.CgoFileMap, workDir)
 	return file2rules
 }
 
@@ -29,7 +35,15 @@ func addRulesToMap[T rule.InstRule](
 			// CGO file path is always relative to the working directory
 			file = filepath.Join(workDir, cgoBase)
 		}
-		for _, r := range rules {
+		// Rules applied to the same function are nested in the order they are
+		// applied, which must not depend on the order they are matched in
+		sorted := slices.SortedFunc(slices.Values(rules), func(a, b T) int {
+			return cmp.Or(
+				cmp.Compare(a.GetOrder(), b.GetOrder()),
+				strings.Compare(a.GetName(), b.GetName()),
+			)
+		})
+		for _, r := range sorted {
 			file2rules[file] = append(file2rules[file], r)
 		}
 	}
@@ -45,6 +59,12 @@ func (ip *InstrumentPhase) instrument(rset *rule.InstRuleSet) error {
 			return err
 		}
 	}
+	for _, rule := range rset.MethodRules {
+		err := ip.applyMethodRule(rule, rset.PackageName)
+		if err != nil {
+			return err
+		}
+	}
 	for file, rules := range groupRules(ip.workDir, rset) {
 		// Group rules by file, then parse the target file once
 		root, err := ip.parseFile(file)
@@ -72,6 +92,22 @@ func (ip *InstrumentPhase) instrument(rset *rule.InstRuleSet) error {
 					return err1
 				}
 				hasFuncRule = true
+			case *rule.InstCallRule:
+				err1 := ip.applyCallRule(rt, root)
+				if err1 != nil {
+					return err1
+				}
+				hasFuncRule = true
+			case *rule.InstVarRule:
+				err1 := ip.applyVarRule(rt, root)
+				if err1 != nil {
+					return err1
+				}
+			case *rule.InstGoroutineRule:
+				err1 := ip.applyGoroutineRule(rt, root)
+				if err1 != nil {
+					return err1
+				}
 			default:
 				util.ShouldNotReachHere()
 			}
@@ -81,6 +117,9 @@ func (ip *InstrumentPhase) instrument(rset *rule.InstRuleSet) error {
 		if err = ip.optimizeTJumps(); err != nil {
 			return err
 		}
+		if err = ip.optimizeArounds(); err != nil {
+			return err
+		}
 		// Once all func rules targeting this file are applied, write instrumented
 		// AST to new file and replace the original file in the compile command
 		if err = ip.writeInstrumented(root, file); err != nil {
@@ -89,9 +128,10 @@ func (ip *InstrumentPhase) instrument(rset *rule.InstRuleSet) error {
 	}
 
 	// Write globals file if any function is instrumented because injected code
-	// always requires some global variables and auxiliary declarations
-	if hasFuncRule {
-		return ip.writeGlobals(rset.PackageName)
+	// always requires some global variables and auxiliary declarations, or if
+	// any hook is declared for the whole package
+	if hasFuncRule || len(ip.linkedDecls) > 0 {
+		return ip.writeGlobals(rset.PackageName, hasFuncRule)
 	}
 	return nil
 }
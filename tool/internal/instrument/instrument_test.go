@@ -15,15 +15,22 @@
 package instrument
 
 import (
+	"bytes"
 	"encoding/json"
+	"go/parser"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
 	"github.com/stretchr/testify/assert"
@@ -44,8 +51,13 @@ const (
 	goldenExt          = ".golden"
 	invalidReceiver    = "invalid-receiver"
 	invalidReceiverMsg = "can not find function"
+	instPkgModule      = "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg"
 )
 
+// benchAllocsPattern matches the name and the allocations per operation of a
+// benchmark in the output of go test -benchmem
+var benchAllocsPattern = regexp.MustCompile(`(?m)^(Benchmark\w+?)(?:-\d+)?\s.*\s(\d+) allocs/op$`)
+
 func TestInstrumentation_Integration(t *testing.T) {
 	entries, err := os.ReadDir(filepath.Join(testdataDir, goldenDir))
 	require.NoError(t, err)
@@ -60,6 +72,21 @@ func TestInstrumentation_Integration(t *testing.T) {
 }
 
 func runTest(t *testing.T, testName string) {
+	tempDir, err := instrumentSource(t, testName)
+
+	if testName == invalidReceiver {
+		require.Error(t, err)
+		require.Contains(t, err.Error(), invalidReceiverMsg)
+		return
+	}
+
+	require.NoError(t, err)
+	verifyGoldenFiles(t, tempDir, testName)
+}
+
+// instrumentSource instruments the source of the test, i.e. its own source.go
+// if any, or the shared one, and returns the directory of the generated files
+func instrumentSource(t *testing.T, testName string) (string, error) {
 	tempDir := t.TempDir()
 	t.Setenv(util.EnvOtelWorkDir, tempDir)
 	ctx := util.ContextWithLogger(
@@ -67,23 +94,67 @@ func runTest(t *testing.T, testName string) {
 		slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
 	)
 
+	source := filepath.Join(testdataDir, goldenDir, testName, sourceFileName)
+	if !util.PathExists(source) {
+		source = filepath.Join(testdataDir, sourceFileName)
+	}
 	sourceFile := filepath.Join(tempDir, mainGoFileName)
-	util.CopyFile(filepath.Join(testdataDir, sourceFileName), sourceFile)
+	util.CopyFile(source, sourceFile)
 
 	ruleSet := loadRulesYAML(t, testName, sourceFile)
 	writeMatchedJSON(ruleSet)
 
 	args := compileArgs(tempDir, sourceFile)
-	err := Toolexec(ctx, args)
+	return tempDir, Toolexec(ctx, args)
+}
 
-	if testName == invalidReceiver {
-		require.Error(t, err)
-		require.Contains(t, err.Error(), invalidReceiverMsg)
-		return
-	}
+// TestHookContextAllocs builds the code generated for the hot-context test
+// along with its hooks, and runs its benchmarks, which report no allocation when
+// the hook context stays on the stack, and some when a hook lets it escape.
+func TestHookContextAllocs(t *testing.T) {
+	const testName = "hot-context"
+	tempDir, err := instrumentSource(t, testName)
+	require.NoError(t, err)
 
+	// The hooks are linked by their path, i.e. testdata.HotBefore
+	pkgDir, err := filepath.Abs(filepath.Join("..", "..", "..", "pkg"))
 	require.NoError(t, err)
-	verifyGoldenFiles(t, tempDir, testName)
+	dir := t.TempDir()
+	mainDir := filepath.Join(dir, mainPackage)
+	require.NoError(t, os.MkdirAll(mainDir, 0o755))
+	files := map[string]string{
+		"go.mod": "module " + testdataDir + "\n\ngo 1.24\n\n" +
+			"require " + instPkgModule + " v0.0.0\n\n" +
+			"replace " + instPkgModule + " => " + pkgDir + "\n",
+		"hook.go": filepath.Join(testdataDir, "hook.go"),
+		filepath.Join(mainPackage, mainGoFileName):    filepath.Join(tempDir, mainGoFileName),
+		filepath.Join(mainPackage, "otel.globals.go"): filepath.Join(tempDir, "otel.globals.go"),
+		filepath.Join(mainPackage, "main_test.go"):    filepath.Join(testdataDir, goldenDir, testName, "main_test.go"),
+		filepath.Join(mainPackage, "hooks.go"):        "package main\n\nimport _ \"" + testdataDir + "\"\n",
+	}
+	for name, content := range files {
+		if util.PathExists(content) {
+			data, err1 := os.ReadFile(content)
+			require.NoError(t, err1)
+			content = string(data)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	// The generated code compares the linked hooks with nil, which vet rejects
+	cmd := exec.Command("go", "test", "-vet=off", "-run=^$", "-bench=.", "-benchmem",
+		"-benchtime=1000x", "./"+mainPackage)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	allocs := make(map[string]int)
+	for _, match := range benchAllocsPattern.FindAllStringSubmatch(string(output), -1) {
+		allocs[match[1]], _ = strconv.Atoi(match[2])
+	}
+	require.Contains(t, allocs, "BenchmarkHot", string(output))
+	require.Contains(t, allocs, "BenchmarkHotEscape", string(output))
+	assert.Zero(t, allocs["BenchmarkHot"], string(output))
+	assert.Positive(t, allocs["BenchmarkHotEscape"], string(output))
 }
 
 func loadRulesYAML(t *testing.T, testName, sourceFile string) *rule.InstRuleSet {
@@ -99,7 +170,9 @@ func loadRulesYAML(t *testing.T, testName, sourceFile string) *rule.InstRuleSet
 		FuncRules:   make(map[string][]*rule.InstFuncRule),
 		StructRules: make(map[string][]*rule.InstStructRule),
 		RawRules:    make(map[string][]*rule.InstRawRule),
+		CallRules:   make(map[string][]*rule.InstCallRule),
 		FileRules:   make([]*rule.InstFileRule, 0),
+		MethodRules: make([]*rule.InstMethodRule, 0),
 	}
 
 	// Sort rule names to ensure deterministic order in tests
@@ -112,6 +185,9 @@ func loadRulesYAML(t *testing.T, testName, sourceFile string) *rule.InstRuleSet
 	for _, name := range ruleNames {
 		props := rawRules[name]
 		props["name"] = name
+		// Call sites are found by the setup phase rather than declared by rules
+		sites := props["sites"]
+		delete(props, "sites")
 		ruleData, _ := yaml.Marshal(props)
 
 		switch {
@@ -121,6 +197,15 @@ func loadRulesYAML(t *testing.T, testName, sourceFile string) *rule.InstRuleSet
 		case props["file"] != nil:
 			r, _ := rule.NewInstFileRule(ruleData, name)
 			ruleSet.FileRules = append(ruleSet.FileRules, r)
+		case props["methods"] != nil:
+			r, _ := rule.NewInstMethodRule(ruleData, name)
+			ruleSet.MethodRules = append(ruleSet.MethodRules, r)
+		case props["call"] != nil:
+			r, _ := rule.NewInstCallRule(ruleData, name)
+			// Specify the call sites directly
+			sitesData, _ := json.Marshal(sites)
+			json.Unmarshal(sitesData, &r.Sites)
+			ruleSet.CallRules[sourceFile] = append(ruleSet.CallRules[sourceFile], r)
 		case props["raw"] != nil:
 			r, _ := rule.NewInstRawRule(ruleData, name)
 			ruleSet.RawRules[sourceFile] = append(ruleSet.RawRules[sourceFile], r)
@@ -287,6 +372,33 @@ func TestGroupRules(t *testing.T) {
 				assert.Len(t, grouped["file1.go"], 3)
 			},
 		},
+		{
+			name: "rules ordered by kind then order then name",
+			ruleSet: &rule.InstRuleSet{
+				FuncRules: map[string][]*rule.InstFuncRule{
+					"file1.go": {
+						{InstBaseRule: rule.InstBaseRule{Name: "func_b"}},
+						{InstBaseRule: rule.InstBaseRule{Name: "func_late", Order: 10}},
+						{InstBaseRule: rule.InstBaseRule{Name: "func_a"}},
+					},
+				},
+				StructRules: make(map[string][]*rule.InstStructRule),
+				RawRules: map[string][]*rule.InstRawRule{
+					"file1.go": {
+						{InstBaseRule: rule.InstBaseRule{Name: "raw_early", Order: -1}},
+						{InstBaseRule: rule.InstBaseRule{Name: "raw"}},
+					},
+				},
+			},
+			expectedFiles: []string{"file1.go"},
+			validate: func(t *testing.T, grouped map[string][]rule.InstRule) {
+				names := make([]string, 0)
+				for _, r := range grouped["file1.go"] {
+					names = append(names, r.GetName())
+				}
+				assert.Equal(t, []string{"func_a", "func_b", "func_late", "raw_early", "raw"}, names)
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -308,3 +420,641 @@ func TestGroupRules(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyStructRuleUnkeyedLits(t *testing.T) {
+	const source = `package main
+
+type T struct{ a int }
+
+var (
+	t1 = T{1}
+	t2 = []*T{{2}, {a: 3}}
+)
+
+// The zero values of the new fields must not depend on the builtin new
+func new() {}
+`
+	const expected = `package main
+
+type T struct {
+	a int
+	B string
+	*GenStruct[int]
+}
+
+var (
+	t1 = T{1, [1]string{}[0], [1]*GenStruct[int]{}[0]}
+	t2 = []*T{{2, [1]string{}[0], [1]*GenStruct[int]{}[0]}, {a: 3}}
+)
+
+// The zero values of the new fields must not depend on the builtin new
+func new() {}
+`
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	ip := &InstrumentPhase{logger: slog.Default()}
+	r := &rule.InstStructRule{
+		InstBaseRule: rule.InstBaseRule{Name: "r", Target: "main"},
+		Struct:       "T",
+		NewField:     []*rule.InstStructField{{Name: "B", Type: "string"}, {Type: "*GenStruct[int]"}},
+	}
+	require.NoError(t, ip.applyStructRule(r, root))
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+
+	// Files not declaring the struct only have their literals rewritten
+	other, err := ast.NewAstParser().ParseSource("package main\n\nvar t3 = T{4}\n")
+	require.NoError(t, err)
+	require.NoError(t, ip.applyStructRule(r, other))
+	buf.Reset()
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, other))
+	assert.Equal(t, "package main\n\nvar t3 = T{4, [1]string{}[0], [1]*GenStruct[int]{}[0]}\n", buf.String())
+
+	none, err := ast.NewAstParser().ParseSource("package main\n\nvar t4 = T{a: 5}\n")
+	require.NoError(t, err)
+	require.ErrorContains(t, ip.applyStructRule(r, none), "can not find struct T")
+}
+
+func TestInsertRawBeforeReturns(t *testing.T) {
+	const source = `package main
+
+func pair() (int, error) { return 1, nil }
+
+func f(x int) (_ int, err error) {
+	g := func() int { return 0 }
+	if x > 0 {
+		return pair()
+	}
+	switch {
+	case x < 0:
+	L:
+		return g(), nil
+	}
+	return
+}
+
+func h() {
+	if true {
+		return
+	}
+}
+
+func s(x int) (n int, err error) {
+	if err := check(x); err != nil {
+		return 0, err
+	}
+	for _, n := range []int{x} {
+		return n, nil
+	}
+	return x, nil
+}
+`
+	const expected = `package main
+
+func pair() (int, error) { return 1, nil }
+
+func f(x int) (_ignoredParam0 int, err error) {
+	g := func() int { return 0 }
+	if x > 0 {
+		_ignoredParam0, err = pair()
+		println(err)
+		return
+	}
+	switch {
+	case x < 0:
+	L:
+		{
+			_ignoredParam0, err = g(), nil
+			println(err)
+			return
+		}
+	}
+	println(err)
+	return
+}
+
+func h() {
+	if true {
+		println(err)
+		return
+	}
+	println(err)
+}
+
+func s(x int) (n int, err error) {
+	_otelEachReturn0 := func(_otelRet0 int, _otelRet1 error) (int, error) {
+		n, err = _otelRet0, _otelRet1
+		println(err)
+		return n, err
+	}
+	if err := check(x); err != nil {
+		return _otelEachReturn0(0, err)
+	}
+	for _, n := range []int{x} {
+		return _otelEachReturn0(n, nil)
+	}
+	n, err = x, nil
+	println(err)
+	return
+}
+`
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	ip := &InstrumentPhase{logger: slog.Default(), rawStmts: make(map[*dst.FuncDecl]int)}
+	for _, fn := range []string{"f", "h", "s"} {
+		r := &rule.InstRawRule{Func: fn, Raw: "println(err)", Position: rule.RawPositionEachReturn}
+		require.NoError(t, ip.applyRawRule(r, root))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestAddRawImports(t *testing.T) {
+	const source = `package main
+
+import (
+	"sync/atomic"
+	tm "time"
+)
+`
+	const expected = `package main
+
+import "hash/crc32"
+
+import (
+	"sync/atomic"
+	tm "time"
+)
+`
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	imports := map[string]string{"atomic": "sync/atomic", "tm": "time", "crc32": "hash/crc32"}
+	require.NoError(t, addRawImports(root, imports))
+	// Adding the imports again is a no-op
+	require.NoError(t, addRawImports(root, imports))
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+
+	err = addRawImports(root, map[string]string{"tm": "github.com/foo/tm"})
+	require.ErrorContains(t, err, `import tm "github.com/foo/tm" conflicts with import tm "time"`)
+}
+
+func TestAddImports(t *testing.T) {
+	const source = `package main
+
+import (
+	_ "net/http/pprof"
+	. "strings"
+	_otel_time "time"
+)
+`
+	const expected = `package main
+
+import _otel_strings "strings"
+import _otel_pprof "net/http/pprof"
+
+import (
+	_ "net/http/pprof"
+	. "strings"
+	_otel_time "time"
+)
+`
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	// The blank and dot imports do not provide the names used by the wrappers
+	imports := map[string]string{
+		"net/http/pprof": "_otel_pprof",
+		"strings":        "_otel_strings",
+		"time":           "_otel_time",
+	}
+	addImports(root, imports)
+	// Adding the imports again is a no-op
+	addImports(root, imports)
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestAppendImportCfg(t *testing.T) {
+	const content = `# import config
+packagefile fmt=/work/b002/_pkg_.a
+importmap golang.org/x/net/dns/dnsmessage=vendor/golang.org/x/net/dns/dnsmessage
+packagefile vendor/golang.org/x/net/dns/dnsmessage=/work/b003/_pkg_.a`
+
+	imports := []string{"unsafe", "time", "fmt", "golang.org/x/net/dns/dnsmessage", "golang.org/x/net/http2/hpack"}
+	missing := missingImports(content, imports)
+	assert.Equal(t, []string{"golang.org/x/net/http2/hpack", "time"}, missing)
+
+	exports := map[string]util.PackageExport{
+		"time":                         {ImportPath: "time", File: "/cache/time-d"},
+		"golang.org/x/net/http2/hpack": {ImportPath: "vendor/golang.org/x/net/http2/hpack", File: "/cache/hpack-d"},
+	}
+	expected := content + `
+importmap golang.org/x/net/http2/hpack=vendor/golang.org/x/net/http2/hpack
+packagefile vendor/golang.org/x/net/http2/hpack=/cache/hpack-d
+packagefile time=/cache/time-d
+`
+	assert.Equal(t, expected, appendImportCfg(content, missing, exports))
+}
+
+func TestApplyVarRule(t *testing.T) {
+	const source = `package main
+
+import "time"
+
+const Size = 1 << 10
+
+const (
+	A = iota
+	B
+)
+
+var Timeout = 1 + time.Second
+
+var (
+	Transport RoundTripper = &Transport{}
+	x, y      int
+	pair, err = f()
+)
+`
+	const expected = `package main
+
+import "os"
+import _ "unsafe"
+
+import "time"
+
+const Size = 2 * (1 << 10)
+
+const (
+	A = iota
+	B
+)
+
+var Timeout = 3 * (1 + time.Second)
+
+var (
+	Transport RoundTripper = WrapTransport(&Transport{})
+	x, y      int          = [1]int{}[0], WrapInt(int(len(os.Args)))
+	pair, err              = f()
+)
+
+//go:linkname WrapTransport example.com/hooks.WrapTransport
+func WrapTransport(RoundTripper) RoundTripper
+
+//go:linkname WrapInt example.com/hooks.WrapInt
+func WrapInt(int) int
+`
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	ip := &InstrumentPhase{logger: slog.Default(), target: root}
+	rules := []*rule.InstVarRule{
+		{Var: "Size", Value: "2 * _origValue"},
+		{Var: "Timeout", Value: "3 * _origValue"},
+		{Var: "Transport", Hook: "WrapTransport", Path: "example.com/hooks"},
+		{Var: "y", Value: "int(len(os.Args))", Imports: map[string]string{"os": "os"}},
+		{Var: "y", Hook: "WrapInt", Path: "example.com/hooks"},
+	}
+	for _, r := range rules {
+		require.NoError(t, ip.applyVarRule(r, root))
+	}
+	assert.Equal(t, []string{"os"}, ip.imports)
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+
+	failures := []struct {
+		r      *rule.InstVarRule
+		errMsg string
+	}{
+		{&rule.InstVarRule{Var: "Missing", Value: "1"}, "can not find variable Missing"},
+		{&rule.InstVarRule{Var: "A", Value: "_origValue + 1"}, "constant A is repeated implicitly"},
+		{&rule.InstVarRule{Var: "B", Value: "1"}, "constant B repeats the previous initializer"},
+		{&rule.InstVarRule{Var: "Size", Hook: "Wrap", Path: "a/b"}, "constant Size can not be wrapped by hook Wrap"},
+		{&rule.InstVarRule{Var: "err", Value: "nil"}, "variable err is initialized by a multi-value expression"},
+		{&rule.InstVarRule{Var: "Timeout", Hook: "Wrap", Path: "a/b"}, "variable Timeout is declared without type"},
+	}
+	for _, f := range failures {
+		require.ErrorContains(t, ip.applyVarRule(f.r, root), f.errMsg)
+	}
+}
+
+func TestApplyGoroutineRule(t *testing.T) {
+	const source = `package main
+
+import "time"
+
+var counter int
+
+const limit = 3
+
+func Serve(ch chan int) {
+	go worker(ch, 1)
+	// Started with a literal
+	go func(n int) {
+		println(n)
+	}(<-ch)
+	go next()(ch, compute())
+	go worker(pair())
+	go time.Sleep(time.Second)
+	go worker(counter, limit)
+	println("done")
+}
+
+func Other(ch chan int) {
+	go worker(ch, 2)
+}
+
+func worker(args ...interface{}) {}
+func next() func(chan int, int)  { return nil }
+func compute() int               { return 0 }
+func pair() (chan int, int)      { return nil, 0 }
+`
+	const expected = `package main
+
+import "time"
+
+var counter int
+
+const limit = 3
+
+func Serve(ch chan int) {
+	{
+		//line source.go:10:2
+		_otelArg0 := ch
+		//line source.go:10:2
+		go func(_otelContext interface{}) {
+			Restore(_otelContext)
+			//line source.go:10:2
+			worker(_otelArg0, 1)
+		}(Capture())
+	}
+	// Started with a literal
+	//line source.go:12:2
+	go func(_otelContext interface{}, n int) {
+		Restore(_otelContext)
+		//line source.go:13:3
+		println(n)
+	}(Capture(), <-ch)
+	{
+		//line source.go:15:2
+		_otelFunc, _otelArg0, _otelArg1 := next(), ch, compute()
+		//line source.go:15:2
+		go func(_otelContext interface{}) {
+			Restore(_otelContext)
+			//line source.go:15:2
+			_otelFunc(_otelArg0, _otelArg1)
+		}(Capture())
+	}
+	//line source.go:16:2
+	go worker(pair())
+	//line source.go:17:2
+	go func(_otelContext interface{}) {
+		Restore(_otelContext)
+		//line source.go:17:2
+		time.Sleep(time.Second)
+	}(Capture())
+	{
+		//line source.go:18:2
+		_otelArg0 := counter
+		//line source.go:18:2
+		go func(_otelContext interface{}) {
+			Restore(_otelContext)
+			//line source.go:18:2
+			worker(_otelArg0, limit)
+		}(Capture())
+	}
+	//line source.go:19:2
+	println("done")
+}
+
+func Other(ch chan int) {
+	go worker(ch, 2)
+}
+
+func worker(args ...interface{}) {}
+func next() func(chan int, int)  { return nil }
+func compute() int               { return 0 }
+func pair() (chan int, int)      { return nil, 0 }
+`
+	// The hooks are declared once for all files of the package
+	const globals = `package main
+
+import _ "unsafe"
+
+//go:linkname Capture example.com/hooks.Capture
+func Capture() interface{}
+
+//go:linkname Restore example.com/hooks.Restore
+func Restore(interface{})
+`
+	dir := t.TempDir()
+	t.Setenv(util.EnvOtelWorkDir, dir)
+	r := &rule.InstGoroutineRule{
+		Goroutine: "Serve*",
+		Capture:   "Capture",
+		Restore:   "Restore",
+		Path:      "example.com/hooks",
+	}
+	ip := &InstrumentPhase{logger: slog.Default(), workDir: dir}
+	sources := map[string]string{
+		"source.go": source,
+		"more.go":   "package main\n\nfunc ServeMore(ch chan int) {\n\tgo worker(ch, 3)\n}\n",
+	}
+	for _, name := range []string{"source.go", "more.go"} {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(sources[name]), 0o600))
+		p := ast.NewAstParser()
+		root, err := p.Parse(file, parser.ParseComments)
+		require.NoError(t, err)
+		ip.target, ip.parser = root, p
+		require.NoError(t, ip.applyGoroutineRule(r, root))
+		if name == "source.go" {
+			var buf bytes.Buffer
+			require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+			assert.Equal(t, expected, buf.String())
+		}
+	}
+
+	require.NoError(t, ip.writeGlobals("main", false))
+	content, err := os.ReadFile(filepath.Join(dir, otelGlobalsFile))
+	require.NoError(t, err)
+	assert.Equal(t, globals, string(content))
+}
+
+func TestApplyStructRuleQualifiedTypes(t *testing.T) {
+	const decl = `package main
+
+import (
+	"sync"
+
+	tr "go.opentelemetry.io/otel/trace"
+)
+
+type T struct {
+	A int
+}
+`
+	// The unkeyed literals are in a file that imports the packages of the new
+	// fields differently, if at all
+	const lits = `package main
+
+import (
+	_ "sync"
+
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+var _ = T{1}
+`
+	const expected = `package main
+
+import _otel_sync "sync"
+
+import (
+	_ "sync"
+
+	otrace "go.opentelemetry.io/otel/trace"
+)
+
+var _ = T{1, [1]*_otel_sync.Mutex{}[0], [1]otrace.Span{}[0], [1]map[string]int{}[0]}
+`
+	dir := t.TempDir()
+	r := &rule.InstStructRule{
+		Struct: "T",
+		NewField: []*rule.InstStructField{
+			{Type: "*sync.Mutex"},
+			{Name: "Span", Type: "tr.Span"},
+			{Name: "Counts", Type: "map[string]int"},
+		},
+	}
+	ip := &InstrumentPhase{logger: slog.Default()}
+	for name, source := range map[string]string{"decl.go": decl, "lits.go": lits} {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(source), 0o600))
+		ip.compileArgs = append(ip.compileArgs, file)
+	}
+	root, err := ast.NewAstParser().ParseSource(lits)
+	require.NoError(t, err)
+	require.NoError(t, ip.applyStructRule(r, root))
+
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+
+	r.NewField = []*rule.InstStructField{{Name: "L", Type: "zap.Logger"}}
+	root, err = ast.NewAstParser().ParseSource(lits)
+	require.NoError(t, err)
+	require.ErrorContains(t, ip.applyStructRule(r, root), `can not find package zap of type "zap.Logger"`)
+}
+
+func TestWrapBodylessFunc(t *testing.T) {
+	const source = `package main
+
+import _ "unsafe"
+
+//go:noescape
+func Add(a, b int) int
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+func Printf(string, ...any)
+
+func (T) Method()
+`
+	const expected = `package main
+
+import _ "unsafe"
+
+//go:noescape
+func _otel_orig_Add(a, b int) int
+
+//go:linkname _otel_orig_nanotime runtime.nanotime
+func _otel_orig_nanotime() int64
+
+func Printf(string, ...any)
+
+func (T) Method()
+func Add(a, b int) int { return _otel_orig_Add(a, b) }
+func nanotime() int64  { return _otel_orig_nanotime() }
+`
+	symabis := filepath.Join(t.TempDir(), "symabis")
+	content := "def main._otel_orig_Add ABI0\nref runtime.morestack ABI0\n"
+	require.NoError(t, os.WriteFile(symabis, []byte(content), 0o600))
+	root, err := ast.NewAstParser().ParseSource(source)
+	require.NoError(t, err)
+	ip := &InstrumentPhase{
+		logger:      slog.Default(),
+		target:      root,
+		compileArgs: []string{"compile", "-p", "main", "-symabis", symabis},
+	}
+	for _, name := range []string{"Add", "nanotime"} {
+		_, err = ip.wrapBodylessFunc(ast.FindFuncDeclWithoutRecv(root, name))
+		require.NoError(t, err)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, root))
+	assert.Equal(t, expected, buf.String())
+
+	_, err = ip.wrapBodylessFunc(ast.FindFuncDeclWithoutRecv(root, "Printf"))
+	require.ErrorContains(t, err, "function Printf has no body, it is neither implemented in assembly")
+	method := root.Decls[4].(*dst.FuncDecl)
+	_, err = ip.wrapBodylessFunc(method)
+	require.ErrorContains(t, err, "method Method has no body")
+
+	// Unnamed and variadic parameters are passed through
+	wrapper := newBodylessWrapper(ast.FindFuncDeclWithoutRecv(root, "Printf"), "_otel_orig_Printf")
+	buf.Reset()
+	file := &dst.File{Name: ast.Ident("main"), Decls: []dst.Decl{wrapper}}
+	require.NoError(t, decorator.NewRestorer().Fprint(&buf, file))
+	const expectedPrintf = `package main
+
+func Printf(_ignoredParam0 string, _ignoredParam1 ...any) {
+	_otel_orig_Printf(_ignoredParam0, _ignoredParam1...)
+}
+`
+	assert.Equal(t, expectedPrintf, buf.String())
+}
+
+func TestRenameAsmFuncs(t *testing.T) {
+	const source = `#include "textflag.h"
+
+// func Add(a, b int) int
+TEXT ·Add(SB),NOSPLIT,$0-24
+	JMP	example·com∕calc·AddSlow(SB)
+
+TEXT example·com∕calc·AddSlow<ABIInternal>(SB),NOSPLIT,$0-24
+	RET
+
+TEXT ·Addition(SB),NOSPLIT,$0
+	RET
+`
+	const expected = `#include "textflag.h"
+
+// func Add(a, b int) int
+TEXT ·_otel_orig_Add(SB),NOSPLIT,$0-24
+	JMP	example·com∕calc·AddSlow(SB)
+
+TEXT example·com∕calc·_otel_orig_AddSlow<ABIInternal>(SB),NOSPLIT,$0-24
+	RET
+
+TEXT ·Addition(SB),NOSPLIT,$0
+	RET
+`
+	renamed, changed := renameAsmFuncs(source, "example.com/calc", []string{"Add", "AddSlow", "Sub"})
+	assert.True(t, changed)
+	assert.Equal(t, expected, renamed)
+
+	renamed, changed = renameAsmFuncs(source, "example.com/calc", []string{"Sub"})
+	assert.False(t, changed)
+	assert.Equal(t, source, renamed)
+}
@@ -4,6 +4,7 @@
 package instrument
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/dave/dst"
@@ -78,12 +79,31 @@ import (
 // Note that this optimization pass is fragile as it really heavily depends on
 // the structure of trampoline-jump-if and trampoline functions. Any change in
 // tjump should be carefully examined.
+//
+// The around trampoline call can not be flattened in the same way, as the hook
+// decides when the original body runs. But the common hooks are trivial, i.e.
+// the ones that only call proceed, whose call is replaced by the original body
+// as is, and the empty ones, whose call is simply removed. For the others, the
+// closure running the original body stays on the stack unless the hook lets the
+// proceed callback escape, see proceedArg.
 
 // TJump describes a trampoline-jump-if optimization candidate
 type TJump struct {
 	target *dst.FuncDecl      // Target function we are hooking on
 	ifStmt *dst.IfStmt        // Trampoline-jump-if statement
 	rule   *rule.InstFuncRule // Rule associated with the trampoline-jump-if
+	// observed tells that nested trampoline-jump-ifs refer to the hook context
+	// to propagate the skip call, see propagateSkipCall
+	observed bool
+}
+
+// AroundCall describes an around trampoline call optimization candidate
+type AroundCall struct {
+	target *dst.FuncDecl      // Target function we are hooking on
+	call   *dst.ExprStmt      // Around trampoline call statement
+	ret    *dst.ReturnStmt    // Return statement following the call, if any
+	body   []dst.Stmt         // Original body moved into the proceed closure
+	rule   *rule.InstFuncRule // Rule associated with the around trampoline
 }
 
 func mustTJump(ifStmt *dst.IfStmt) {
@@ -109,44 +129,20 @@ func removeAfterTrampolineCall(tjump *TJump) error {
 	return nil
 }
 
-// newHookContextImpl constructs a new HookContextImpl structure literal and
-// populates its Params && ReturnValues field with addresses of all arguments.
-// The HookContextImpl structure is used to pass arguments to the exit trampoline
-func newHookContextImpl(tjump *TJump) dst.Expr {
-	targetFunc := tjump.target
-	structName := trampolineHookContextImplType + util.CRC32(tjump.rule.String())
-
-	// Build params slice: []interface{}{&param1, &param2, ...}
-	// Use createHookArgs to handle underscore parameters correctly
-	paramNames := collectArguments(targetFunc)
-	paramExprs := createTrampArgs(paramNames)
-	paramsSlice := ast.CompositeLit(
-		ast.ArrayType(ast.InterfaceType()),
-		paramExprs,
-	)
-
-	// Build returnVals slice: []interface{}{&retval1, &retval2, ...}
-	returnExprs := make([]dst.Expr, 0)
-	if targetFunc.Type.Results != nil {
-		returnNames := collectReturnValues(targetFunc)
-		returnExprs = createTrampArgs(returnNames)
-	}
-	returnValsSlice := ast.CompositeLit(
-		ast.ArrayType(ast.InterfaceType()),
-		returnExprs,
-	)
-
-	// Build the struct literal: &HookContextImpl{params:..., returnVals:...}
-	return ast.StructLit(
-		structName,
-		ast.KeyValueExpr(trampolineParamsIdentifier, paramsSlice),
-		ast.KeyValueExpr(trampolineReturnValsIdentifier, returnValsSlice),
-	)
-}
-
 func removeBeforeTrampolineCall(targetFile *dst.File, tjump *TJump) error {
-	// Construct HookContext on the fly and pass to After trampoline defer call
-	hookContextExpr := newHookContextImpl(tjump)
+	// Take over HookContext built for Before trampoline and pass it to After
+	// trampoline defer call
+	initStmt := util.AssertType[*dst.AssignStmt](tjump.ifStmt.Init)
+	beforeCall := util.AssertType[*dst.CallExpr](initStmt.Rhs[0])
+	hookContextExpr := beforeCall.Args[0]
+	// Nested trampoline-jump-ifs refer to the hook context, keep it as variable
+	var init dst.Stmt
+	if tjump.observed {
+		hookContext := trampolineHookContextName + util.CRC32(tjump.rule.String())
+		// Composite literals must be parenthesized in if statements
+		init = ast.DefineStmts(ast.Exprs(ast.Ident(hookContext)), ast.Exprs(ast.ParenExpr(hookContextExpr)))
+		hookContextExpr = ast.Ident(hookContext)
+	}
 	// Find defer call to After and replace its call context with new one
 	found := false
 	block := util.AssertType[*dst.BlockStmt](tjump.ifStmt.Else)
@@ -163,7 +159,7 @@ func removeBeforeTrampolineCall(targetFile *dst.File, tjump *TJump) error {
 	util.Assert(found, "defer statement not found")
 	// Rewrite condition of trampoline-jump-if to always false and null out its
 	// initialization statement and then block
-	tjump.ifStmt.Init = nil
+	tjump.ifStmt.Init = init
 	tjump.ifStmt.Cond = ast.BoolFalse()
 	tjump.ifStmt.Body = ast.Block(ast.EmptyStmt())
 	// Remove generated Before trampoline function
@@ -178,48 +174,58 @@ func removeBeforeTrampolineCall(targetFile *dst.File, tjump *TJump) error {
 	return ex.Newf("can not remove Before trampoline function")
 }
 
-// canFlattenTJump checks if the tjump can be safely flattened based on
-// the hook function's usage of HookContext. Returns true if:
-// 1. SetSkipCall is never called (so skip is always false)
-// 2. The HookContext parameter is only used as a receiver for method calls
-func canFlattenTJump(hookFunc *dst.FuncDecl) bool {
-	// Check if the hook function contains any "SetSkipCall" string
-	// If found, the trampoline-jump-if cannot be flattened
+// refersTo checks if the identifier is referred anywhere in the node
+func refersTo(node dst.Node, name string) bool {
 	found := false
-	dst.Inspect(hookFunc, func(node dst.Node) bool {
-		if ident, ok := node.(*dst.Ident); ok {
-			if strings.Contains(ident.Name, trampolineSetSkipCallName) {
-				found = true
-				return false
-			}
-		}
-		if found {
-			return false
+	dst.Inspect(node, func(n dst.Node) bool {
+		if ident, ok := n.(*dst.Ident); ok && ident.Name == name {
+			found = true
 		}
-		return true
+		return !found
 	})
-	if found {
+	return found
+}
+
+// hookContextEscapes checks if the hook function lets the HookContext parameter
+// escape, i.e. it's used for purposes other than the receiver of method calls,
+// such as being assigned, passed as argument, captured by closure, etc. The
+// hook context can be allocated on stack only if it does not escape. The check
+// is syntactic, so it's conservative: any other use of the parameter escapes,
+// even the ones the compiler would prove harmless, e.g. in a closure called in
+// place or in a conversion to interface{} whose result is only called.
+func hookContextEscapes(hookFunc *dst.FuncDecl) bool {
+	params := hookFunc.Type.Params.List
+	if len(params) == 0 || len(params[0].Names) == 0 {
 		return false
 	}
-
-	// Check if the hook context parameter escapes (used for non-method calls)
-	escape := false
-	hookContextParam := hookFunc.Type.Params.List[0].Names[0].Name
+	hookContextParam := params[0].Names[0].Name
 	if hookContextParam == ast.IdentIgnore {
 		// If the parameter is ignored, it doesn't escape because it is not used
-		return true
+		return false
 	}
-	dst.Inspect(hookFunc.Body, func(n dst.Node) bool {
+	escape := false
+	var visit func(n dst.Node) bool
+	visit = func(n dst.Node) bool {
 		if escape {
 			return false
 		}
 		switch n := n.(type) {
-		case *dst.SelectorExpr:
+		case *dst.FuncLit, *dst.GoStmt:
+			// Closures and goroutines may outlive the hook call
+			escape = refersTo(n, hookContextParam)
+			return false
+		case *dst.CallExpr:
 			// Check if ictx is used as method receiver: ictx.Method()
-			if id, ok := n.X.(*dst.Ident); ok && id.Name == hookContextParam {
-				// Valid usage.
-				// Return false to stop visiting children, so we don't visit
-				// the Ident "ictx", which would be caught by the case below.
+			sel, ok := n.Fun.(*dst.SelectorExpr)
+			if !ok {
+				break
+			}
+			if id, ok1 := sel.X.(*dst.Ident); ok1 && id.Name == hookContextParam {
+				// Valid usage. Visit the arguments only, so we don't visit the
+				// Ident "ictx", which would be caught by the case below.
+				for _, arg := range n.Args {
+					dst.Inspect(arg, visit)
+				}
 				return false
 			}
 		case *dst.Ident:
@@ -232,8 +238,137 @@ func canFlattenTJump(hookFunc *dst.FuncDecl) bool {
 			}
 		}
 		return true
+	}
+	dst.Inspect(hookFunc.Body, visit)
+	return escape
+}
+
+// proceedEscapes checks if the around hook function lets the proceed callback
+// escape, i.e. it's used for purposes other than being called, such as being
+// assigned, passed as argument, captured by closure, etc. It's as conservative
+// as hookContextEscapes.
+func proceedEscapes(hookFunc *dst.FuncDecl) bool {
+	params := ast.SplitMultiNameFields(hookFunc.Type.Params).List
+	if len(params) < 2 || len(params[1].Names) == 0 {
+		return false
+	}
+	proceed := params[1].Names[0].Name
+	if proceed == ast.IdentIgnore {
+		return false
+	}
+	escape := false
+	var visit func(n dst.Node) bool
+	visit = func(n dst.Node) bool {
+		if escape {
+			return false
+		}
+		switch n := n.(type) {
+		case *dst.FuncLit, *dst.GoStmt:
+			// Closures and goroutines may outlive the hook call
+			escape = refersTo(n, proceed)
+			return false
+		case *dst.CallExpr:
+			// Valid usage, visit the arguments only
+			if id, ok := n.Fun.(*dst.Ident); ok && id.Name == proceed {
+				for _, arg := range n.Args {
+					dst.Inspect(arg, visit)
+				}
+				return false
+			}
+		case *dst.Ident:
+			if n.Name == proceed {
+				escape = true
+				return false
+			}
+		}
+		return true
+	}
+	dst.Inspect(hookFunc.Body, visit)
+	return escape
+}
+
+// onlyProceeds checks if the body of the around hook function consists of the
+// call to proceed only.
+func onlyProceeds(hookFunc *dst.FuncDecl) bool {
+	params := ast.SplitMultiNameFields(hookFunc.Type.Params).List
+	if hookFunc.Body == nil || len(hookFunc.Body.List) != 1 || len(params) < 2 || len(params[1].Names) == 0 {
+		return false
+	}
+	stmt, ok := hookFunc.Body.List[0].(*dst.ExprStmt)
+	if !ok {
+		return false
+	}
+	call, ok := stmt.X.(*dst.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := call.Fun.(*dst.Ident)
+	return ok && id.Name == params[1].Names[0].Name && id.Name != ast.IdentIgnore
+}
+
+// inlineAround replaces the around trampoline call with the statements, i.e.
+// the original body if the hook only calls proceed, or nothing if the hook is
+// empty. The return statement following the call goes along with the original
+// body, which returns on its own. It reports whether the call is replaced,
+// which it's not if other code is inserted between the call and the return.
+func inlineAround(targetFile *dst.File, around *AroundCall, stmts []dst.Stmt) bool {
+	inlined := false
+	dst.Inspect(around.target.Body, func(node dst.Node) bool {
+		block, ok := node.(*dst.BlockStmt)
+		if inlined || !ok {
+			return !inlined
+		}
+		start := slices.Index(block.List, dst.Stmt(around.call))
+		if start < 0 {
+			return true
+		}
+		end := start + 1
+		if around.ret != nil && len(stmts) > 0 {
+			if end >= len(block.List) || block.List[end] != around.ret {
+				return false
+			}
+			end++
+		}
+		block.List = slices.Replace(block.List, start, end, stmts...)
+		inlined = true
+		return false
+	})
+	if !inlined {
+		return false
+	}
+	// Remove generated around trampoline function
+	name := makeAroundName(around.rule, around.target)
+	targetFile.Decls = slices.DeleteFunc(targetFile.Decls, func(decl dst.Decl) bool {
+		funcDecl, ok := decl.(*dst.FuncDecl)
+		return ok && funcDecl.Name.Name == name
 	})
-	return !escape
+	return true
+}
+
+// canFlattenTJump checks if the tjump can be safely flattened based on
+// the hook function's usage of HookContext. Returns true if:
+// 1. SetSkipCall is never called (so skip is always false)
+// 2. The HookContext parameter does not escape, see hookContextEscapes
+func canFlattenTJump(hookFunc *dst.FuncDecl) bool {
+	// Check if the hook function contains any "SetSkipCall" string
+	// If found, the trampoline-jump-if cannot be flattened
+	found := false
+	dst.Inspect(hookFunc, func(node dst.Node) bool {
+		if ident, ok := node.(*dst.Ident); ok {
+			if strings.Contains(ident.Name, trampolineSetSkipCallName) {
+				found = true
+				return false
+			}
+		}
+		if found {
+			return false
+		}
+		return true
+	})
+	if found {
+		return false
+	}
+	return !hookContextEscapes(hookFunc)
 }
 
 // flattenTJump transforms the trampoline-jump-if AST to a flattened form.
@@ -316,6 +451,22 @@ func stripTJumpLabel(tjump *TJump) {
 	ifStmt.Decs.If = nil
 }
 
+func (ip *InstrumentPhase) optimizeArounds() error {
+	for _, around := range ip.arounds {
+		hookFunc, err := getHookFunc(around.rule, trampolineBefore)
+		if err != nil {
+			return err
+		}
+		switch {
+		case onlyProceeds(hookFunc):
+			inlineAround(ip.target, around, around.body)
+		case hookFunc.Body != nil && len(hookFunc.Body.List) == 0:
+			inlineAround(ip.target, around, nil)
+		}
+	}
+	return nil
+}
+
 func (ip *InstrumentPhase) optimizeTJumps() error {
 	for _, tjump := range ip.tjumps {
 		mustTJump(tjump.ifStmt)
@@ -5,6 +5,7 @@ package instrument
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/dave/dst"
@@ -173,104 +174,80 @@ func TestRemoveAfterTrampolineCall(t *testing.T) {
 
 func TestNewHookContextImpl(t *testing.T) {
 	tests := []struct {
-		name     string
-		funcSrc  string
-		wantErr  bool
-		validate func(*testing.T, dst.Expr)
+		name       string
+		funcSrc    string
+		wantType   string
+		wantFields []string
 	}{
 		{
 			name: "creates context for function with parameters",
 			funcSrc: `package main
 			func testFunc(param1 string, param2 int) {}`,
-			wantErr: false,
-			validate: func(t *testing.T, expr dst.Expr) {
-				unaryExpr, ok := expr.(*dst.UnaryExpr)
-				require.True(t, ok, "expression should be unary expression")
-				compositeLit, ok := unaryExpr.X.(*dst.CompositeLit)
-				require.True(t, ok, "expression should contain composite literal")
-				assert.Len(t, compositeLit.Elts, 2, "should have params and return values fields")
-
-				// Verify params field has correct number of parameter addresses
-				paramsKV, ok := compositeLit.Elts[0].(*dst.KeyValueExpr)
-				require.True(t, ok, "first element should be KeyValueExpr")
-				assert.Equal(t, "params", paramsKV.Key.(*dst.Ident).Name)
-				paramsLit, ok := paramsKV.Value.(*dst.CompositeLit)
-				require.True(t, ok, "params value should be CompositeLit")
-				assert.Len(t, paramsLit.Elts, 2, "should have 2 parameter addresses")
-			},
+			wantFields: []string{"param0: &param1", "param1: &param2"},
 		},
 		{
 			name: "creates context for function with return values",
 			funcSrc: `package main
 			func testFunc(param1 string) (result1 string) { return "" }`,
-			wantErr: false,
-			validate: func(t *testing.T, expr dst.Expr) {
-				assert.NotNil(t, expr, "expression should not be nil")
-
-				// Verify returnVals field has correct number of return value addresses
-				unaryExpr, ok := expr.(*dst.UnaryExpr)
-				require.True(t, ok, "expression should be unary expression")
-				compositeLit, ok := unaryExpr.X.(*dst.CompositeLit)
-				require.True(t, ok, "expression should contain composite literal")
-
-				returnsKV, ok := compositeLit.Elts[1].(*dst.KeyValueExpr)
-				require.True(t, ok, "second element should be KeyValueExpr")
-				assert.Equal(t, "returnVals", returnsKV.Key.(*dst.Ident).Name)
-				returnsLit, ok := returnsKV.Value.(*dst.CompositeLit)
-				require.True(t, ok, "returnVals value should be CompositeLit")
-				assert.Len(t, returnsLit.Elts, 1, "should have 1 return value address")
-			},
+			wantFields: []string{"param0: &param1", "returnVal0: &result1"},
 		},
 		{
-			name: "creates context with both params and return values",
+			name: "creates context for method with unnamed results",
 			funcSrc: `package main
-			func testFunc(param1 string, param2 int) (result1 string) { return "" }`,
-			wantErr: false,
-			validate: func(t *testing.T, expr dst.Expr) {
-				unaryExpr, ok := expr.(*dst.UnaryExpr)
-				require.True(t, ok, "expression should be unary expression")
-				compositeLit, ok := unaryExpr.X.(*dst.CompositeLit)
-				require.True(t, ok, "expression should contain composite literal")
-
-				// Verify struct type name
-				typeIdent, ok := compositeLit.Type.(*dst.Ident)
-				require.True(t, ok, "type should be an Ident")
-				assert.Contains(t, typeIdent.Name, "HookContextImpl", "struct name should contain HookContextImpl")
-
-				// Verify params field
-				paramsKV, ok := compositeLit.Elts[0].(*dst.KeyValueExpr)
-				require.True(t, ok, "first element should be KeyValueExpr")
-				assert.Equal(t, "params", paramsKV.Key.(*dst.Ident).Name)
-				paramsLit, ok := paramsKV.Value.(*dst.CompositeLit)
-				require.True(t, ok, "params value should be CompositeLit")
-				assert.Len(t, paramsLit.Elts, 2, "should have 2 parameter addresses")
-
-				// Verify returnVals field
-				returnsKV, ok := compositeLit.Elts[1].(*dst.KeyValueExpr)
-				require.True(t, ok, "second element should be KeyValueExpr")
-				assert.Equal(t, "returnVals", returnsKV.Key.(*dst.Ident).Name)
-				returnsLit, ok := returnsKV.Value.(*dst.CompositeLit)
-				require.True(t, ok, "returnVals value should be CompositeLit")
-				assert.Len(t, returnsLit.Elts, 1, "should have 1 return value address")
+			func (r *T) testFunc(_ int) (string, error) { return "", nil }`,
+			wantFields: []string{
+				"param0: &r", "param1: &_ignoredParam0",
+				"returnVal0: &_unnamedRetVal0", "returnVal1: &_unnamedRetVal1",
 			},
 		},
+		{
+			name: "creates context for generic function",
+			funcSrc: `package main
+			func testFunc[K comparable, V any](m map[K]V, k K) (v V) { return }`,
+			wantType:   "[K, V]",
+			wantFields: []string{"param0: &m", "param1: &k", "returnVal0: &v"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			targetFunc := parseFunc(t, tt.funcSrc)
-			tjump := &TJump{
-				target: targetFunc,
-				rule: &rule.InstFuncRule{
-					Func: targetFunc.Name.Name,
-				},
+			r := &rule.InstFuncRule{Func: targetFunc.Name.Name}
+			retVals := collectReturnValues(targetFunc)
+			args := collectArguments(targetFunc)
+
+			expr := newHookContextImpl(r, targetFunc, args, retVals)
+			unaryExpr, ok := expr.(*dst.UnaryExpr)
+			require.True(t, ok, "expression should be unary expression")
+			compositeLit, ok := unaryExpr.X.(*dst.CompositeLit)
+			require.True(t, ok, "expression should contain composite literal")
+
+			// Verify struct type name, which is instantiated for generics
+			typ := compositeLit.Type
+			typeArgs := ""
+			if indexList, ok1 := typ.(*dst.IndexListExpr); ok1 {
+				typ = indexList.X
+				names := make([]string, 0, len(indexList.Indices))
+				for _, index := range indexList.Indices {
+					names = append(names, index.(*dst.Ident).Name)
+				}
+				typeArgs = "[" + strings.Join(names, ", ") + "]"
 			}
-
-			expr := newHookContextImpl(tjump)
-			assert.NotNil(t, expr)
-			if tt.validate != nil {
-				tt.validate(t, expr)
+			typeIdent, ok := typ.(*dst.Ident)
+			require.True(t, ok, "type should be an Ident")
+			assert.Contains(t, typeIdent.Name, "HookContextImpl", "struct name should contain HookContextImpl")
+			assert.Equal(t, tt.wantType, typeArgs)
+
+			// Verify typed fields point to parameters and return values
+			fields := make([]string, 0, len(compositeLit.Elts))
+			for _, elt := range compositeLit.Elts {
+				kv, ok1 := elt.(*dst.KeyValueExpr)
+				require.True(t, ok1, "element should be KeyValueExpr")
+				addr, ok1 := kv.Value.(*dst.UnaryExpr)
+				require.True(t, ok1, "value should be address")
+				fields = append(fields, fmt.Sprintf("%s: &%s", kv.Key.(*dst.Ident).Name, addr.X.(*dst.Ident).Name))
 			}
+			assert.Equal(t, tt.wantFields, fields)
 		})
 	}
 }
@@ -344,11 +321,11 @@ func TestRemoveBeforeTrampolineCall(t *testing.T) {
 	funcSrc := `package main
 	func testFunc(param1 string) {}`
 
-	ifSrc := `if ctx, skip := otel_trampoline_before(&arg); skip {
-		otel_trampoline_after(ctx, &retval)
+	ifSrc := `if ctx, skip := otel_trampoline_before(&HookContextImpl{param0: &param1}, &param1); skip {
+		otel_trampoline_after(ctx)
 		return
 	} else {
-		defer otel_trampoline_after(ctx, &retval)
+		defer otel_trampoline_after(ctx)
 	}`
 
 	targetFunc := parseFunc(t, funcSrc)
@@ -382,6 +359,13 @@ func TestRemoveBeforeTrampolineCall(t *testing.T) {
 	// Verify init statement was nulled out
 	assert.Nil(t, tjump.ifStmt.Init)
 
+	// Verify hook context built for Before trampoline is passed to After
+	deferStmt, ok := tjump.ifStmt.Else.(*dst.BlockStmt).List[0].(*dst.DeferStmt)
+	require.True(t, ok)
+	hookContext, ok := deferStmt.Call.Args[0].(*dst.UnaryExpr)
+	require.True(t, ok)
+	assert.IsType(t, &dst.CompositeLit{}, hookContext.X)
+
 	// Verify body contains empty statement
 	assert.Len(t, tjump.ifStmt.Body.List, 1)
 }
@@ -510,3 +494,245 @@ func TestFlattenTJump(t *testing.T) {
 		})
 	}
 }
+
+func TestHookContextEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		hookSrc string
+		escapes bool
+	}{
+		{
+			name: "unused",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {}`,
+		},
+		{
+			name: "ignored",
+			hookSrc: `package main
+			func hookFunc(_ HookContext, arg1 string) {}`,
+		},
+		{
+			name: "method calls",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				ctx.SetKeyData("start", ctx.GetParam(0))
+				if v, ok := ctx.GetKeyData("start").(string); ok {
+					ctx.SetReturnVal(0, v)
+				}
+				defer ctx.SetSkipCall(false)
+			}`,
+		},
+		{
+			name: "assigned",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				_ = ctx
+			}`,
+			escapes: true,
+		},
+		{
+			name: "passed as argument",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				passTo(ctx)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "passed to its own method",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				ctx.SetData(ctx)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "method value",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				get := ctx.GetParam
+				get(0)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "captured by closure",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				ctx.SetData(func() { ctx.SetSkipCall(true) })
+			}`,
+			escapes: true,
+		},
+		{
+			name: "captured by immediately called closure",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				func() { ctx.SetSkipCall(true) }()
+			}`,
+			escapes: true,
+		},
+		{
+			name: "method value passed as argument",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				apply(ctx.SetSkipCall)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "method expression",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				HookContext.SetSkipCall(ctx, true)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "converted to interface",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				var v interface{} = ctx
+				_ = v
+			}`,
+			escapes: true,
+		},
+		{
+			name: "converted to interface in place",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				interface{}(ctx).(HookContext).SetSkipCall(true)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "type asserted",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				if s, ok := ctx.(fmt.Stringer); ok {
+					_ = s.String()
+				}
+			}`,
+			escapes: true,
+		},
+		{
+			name: "used by goroutine",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, arg1 string) {
+				go ctx.GetParam(0)
+			}`,
+			escapes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hookFunc := parseFunc(t, tt.hookSrc)
+			assert.Equal(t, tt.escapes, hookContextEscapes(hookFunc))
+		})
+	}
+}
+
+func TestProceedEscapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		hookSrc  string
+		escapes  bool
+		proceeds bool
+	}{
+		{
+			name: "empty",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {}`,
+		},
+		{
+			name: "only proceeds",
+			hookSrc: `package main
+			func hookFunc(_ HookContext, proceed func()) {
+				proceed()
+			}`,
+			proceeds: true,
+		},
+		{
+			name: "called in place",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				defer func() { _ = recover() }()
+				ctx.SetParam(0, "around")
+				for i := 0; i < 3; i++ {
+					proceed()
+				}
+				defer proceed()
+			}`,
+		},
+		{
+			name: "passed as argument",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				pprof.Do(ctx, labels, func(context.Context) { proceed() })
+			}`,
+			escapes: true,
+		},
+		{
+			name: "assigned",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				next = proceed
+			}`,
+			escapes: true,
+		},
+		{
+			name: "captured by immediately called closure",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				func() { proceed() }()
+			}`,
+			escapes: true,
+		},
+		{
+			name: "captured by deferred closure",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				defer func() { proceed() }()
+			}`,
+			escapes: true,
+		},
+		{
+			name: "held by method value",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				apply(runner{f: proceed}.Run)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "converted to interface",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				ctx.SetData(proceed)
+			}`,
+			escapes: true,
+		},
+		{
+			name: "converted to interface in place",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				interface{}(proceed).(func())()
+			}`,
+			escapes: true,
+		},
+		{
+			name: "used by goroutine",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, proceed func()) {
+				go proceed()
+			}`,
+			escapes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hookFunc := parseFunc(t, tt.hookSrc)
+			assert.Equal(t, tt.escapes, proceedEscapes(hookFunc))
+			assert.Equal(t, tt.proceeds, onlyProceeds(hookFunc))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import "testing"
+
+// The benchmarks run the code generated for source.go, see TestHookContextAllocs
+
+func BenchmarkHot(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if r, _ := Hot(1); r != 4 {
+			b.Fatalf("got %d, want 4", r)
+		}
+	}
+}
+
+func BenchmarkHotEscape(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if r, _ := HotEscape(1); r != 4 {
+			b.Fatalf("got %d, want 4", r)
+		}
+	}
+}
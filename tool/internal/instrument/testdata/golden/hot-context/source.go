@@ -0,0 +1,20 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+// Hot stands for a function on the hot path, its hooks do not let the hook
+// context escape.
+func Hot(n int) (int, error) {
+	return n + 1, nil
+}
+
+// HotEscape is the same as Hot, but its hook lets the hook context escape.
+func HotEscape(n int) (int, error) {
+	return n + 1, nil
+}
+
+func main() {
+	_, _ = Hot(1)
+	_, _ = HotEscape(1)
+}
@@ -46,3 +46,33 @@ func GenericFuncAfter(ctx inst.HookContext, r1 interface{}, r2 error) {}
 func GenericMethodBefore(ctx inst.HookContext, recv interface{}, p1 interface{}, p2 string) {}
 
 func GenericMethodAfter(ctx inst.HookContext, r1 interface{}, r2 error) {}
+
+func H11Around(ctx inst.HookContext, proceed func()) {
+	defer func() { _ = recover() }()
+	ctx.SetParam(0, "around")
+	proceed()
+}
+
+func H12AroundProceed(_ inst.HookContext, proceed func()) {
+	proceed()
+}
+
+func H13AroundEmpty(_ inst.HookContext, _ func()) {}
+
+func HotBefore(ctx inst.HookContext, _ int) {
+	ctx.SetKeyData("hot", true)
+}
+
+func HotAfter(ctx inst.HookContext, r int, _ error) {
+	if ctx.HasKeyData("hot") {
+		ctx.SetReturnVal(0, r*2)
+	}
+}
+
+// lastHotContext retains the hook context, which makes it escape to heap
+var lastHotContext inst.HookContext
+
+func HotEscapeBefore(ctx inst.HookContext, _ int) {
+	lastHotContext = ctx
+	ctx.SetKeyData("hot", true)
+}
@@ -0,0 +1,31 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package testdata
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// T stands in for the type of the same name in the source.
+type T struct{}
+
+// Size returns the size of the value.
+func (t *T) Size() uintptr {
+	return unsafe.Sizeof(*t)
+}
+
+func (T) Unwrap() error { return nil }
+
+func (T) Cause() error { return errors.New("unused") }
+
+// GenStub stands in for GenStruct in the source.
+type GenStub[T any] struct {
+	value T
+}
+
+// Value returns the value.
+func (g *GenStub[T]) Value() T {
+	return g.value
+}
@@ -31,14 +31,28 @@ type InstrumentPhase struct {
 	beforeTrampFunc *dst.FuncDecl
 	// The after trampoline function
 	afterTrampFunc *dst.FuncDecl
-	// Variable declarations waiting to be inserted into target source file
+	// The around trampoline function
+	aroundTrampFunc *dst.FuncDecl
+	// Declarations waiting to be inserted into the globals file
 	varDecls []dst.Decl
+	// Hook declarations shared by the files of the package, which are inserted
+	// into the globals file as well
+	linkedDecls []*dst.FuncDecl
 	// The declaration of the hook context, it should be populated later
 	hookCtxDecl *dst.GenDecl
 	// The methods of the hook context
 	hookCtxMethods []*dst.FuncDecl
 	// The trampoline jumps to be optimized
 	tjumps []*TJump
+	// The around trampoline calls to be optimized
+	arounds []*AroundCall
+	// The number of raw code statements inserted at the function entry
+	rawStmts map[*dst.FuncDecl]int
+	// The packages imported by the injected code
+	imports []string
+	// The imports of the files of the compile by the types they declare,
+	// parsed once for all struct rules
+	typeImports map[string]map[string]string
 }
 
 func (ip *InstrumentPhase) Info(msg string, args ...any)  { ip.logger.Info(msg, args...) }
@@ -95,6 +109,11 @@ func interceptCompile(ctx context.Context, args []string) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
+		// The injected code may import packages that the package does not
+		err = ip.updateImportConfig()
+		if err != nil {
+			return nil, err
+		}
 
 		// Strip -complete flag as we may insert some hook points that are
 		// not ready yet, i.e. they don't have function body
@@ -110,13 +129,17 @@ func interceptCompile(ctx context.Context, args []string) ([]string, error) {
 // to find out the compile command we are interested in and run it with the
 // instrumented code.
 func Toolexec(ctx context.Context, args []string) error {
-	// Only interested in compile commands
-	if util.IsCompileCommand(strings.Join(args, " ")) {
-		var err error
+	// Only interested in compile commands, and the assembler commands of the
+	// packages whose assembly functions may be instrumented
+	var err error
+	switch {
+	case util.IsCompileCommand(strings.Join(args, " ")):
 		args, err = interceptCompile(ctx, args)
-		if err != nil {
-			return err
-		}
+	case util.IsAsmCommand(args):
+		args, err = interceptAsm(ctx, args)
+	}
+	if err != nil {
+		return err
 	}
 	// Just run the command as is
 	return util.RunCmd(ctx, args...)
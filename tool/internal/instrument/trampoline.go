@@ -10,6 +10,7 @@ import (
 	"strconv"
 
 	"github.com/dave/dst"
+	"github.com/dave/dst/dstutil"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
@@ -32,24 +33,31 @@ import (
 const (
 	trampolineBeforeName            = "OtelBeforeTrampoline"
 	trampolineAfterName             = "OtelAfterTrampoline"
+	trampolineAroundName            = "OtelAroundTrampoline"
+	trampolineNoEscapeName          = "OtelNoEscape"
+	trampolineNoEscapeProceedName   = "OtelNoEscapeProceed"
 	trampolineHookContextName       = "hookContext"
 	trampolineHookContextType       = "HookContext"
 	trampolineInterfaceType         = "interface{}"
 	trampolineSkipName              = "skip"
+	trampolineProceedName           = "proceed"
 	trampolineSetParamName          = "SetParam"
 	trampolineGetParamName          = "GetParam"
 	trampolineSetReturnValName      = "SetReturnVal"
 	trampolineGetReturnValName      = "GetReturnVal"
+	trampolineGetParamCountName     = "GetParamCount"
+	trampolineGetReturnValCountName = "GetReturnValCount"
+	trampolineGetFuncNameName       = "GetFuncName"
+	trampolineGetPackageNameName    = "GetPackageName"
 	trampolineSetSkipCallName       = "SetSkipCall"
 	trampolineValIdentifier         = "val"
 	trampolineCtxIdentifier         = "c"
-	trampolineParamsIdentifier      = "params"
-	trampolineFuncNameIdentifier    = "funcName"
-	trampolinePackageNameIdentifier = "packageName"
-	trampolineReturnValsIdentifier  = "returnVals"
+	trampolineParamFieldPrefix      = "param"
+	trampolineReturnValFieldPrefix  = "returnVal"
 	trampolineHookContextImplType   = "HookContextImpl"
 	trampolineBeforeNamePlaceholder = `"OtelBeforeNamePlaceholder"`
 	trampolineAfterNamePlaceholder  = `"OtelAfterNamePlaceholder"`
+	trampolineAroundNamePlaceholder = `"OtelAroundNamePlaceholder"`
 	trampolineBefore                = true
 	trampolineAfter                 = false
 	unsafePackageName               = "unsafe"
@@ -58,9 +66,12 @@ const (
 // @@ Modification on this trampoline template should be cautious, as it imposes
 // many implicit constraints on generated code, known constraints are as follows:
 // - It's performance critical, so it should be as simple as possible
-// - It should not import any package because there is no guarantee that package
-//   is existed in import config during the compilation, one practical approach
-//   is to use function variables and setup these variables in preprocess stage
+// - It should not import any package other than unsafe because there is no
+//   guarantee that package is existed in import config during the compilation,
+//   one practical approach is to use function variables and setup these
+//   variables in preprocess stage
+// - The hook context should not escape from the trampoline functions, so that
+//   it can be allocated on the stack of the target function
 // - It should not panic as this affects user application
 // - Function and variable names are coupled with the framework, any modification
 //   on them should be synced with the framework
@@ -109,10 +120,10 @@ func (ip *InstrumentPhase) materializeTemplate() error {
 			switch decl.Name.Name {
 			case trampolineBeforeName:
 				ip.beforeTrampFunc = decl
-				ip.addDecl(decl)
 			case trampolineAfterName:
 				ip.afterTrampFunc = decl
-				ip.addDecl(decl)
+			case trampolineAroundName:
+				ip.aroundTrampFunc = decl
 			default:
 				if ast.HasReceiver(decl) {
 					// We know exactly this is HookContextImpl method
@@ -121,6 +132,9 @@ func (ip *InstrumentPhase) materializeTemplate() error {
 					util.Assert(t2.Name == trampolineHookContextImplType, "sanity check")
 					ip.hookCtxMethods = append(ip.hookCtxMethods, decl)
 					ip.addDecl(decl)
+				} else {
+					// Auxiliary functions shared by all trampolines
+					ip.varDecls = append(ip.varDecls, decl)
 				}
 			}
 		}
@@ -129,7 +143,7 @@ func (ip *InstrumentPhase) materializeTemplate() error {
 			// No further processing for variable declarations, just append them
 			//nolint:exhaustive // We have too many cases to cover, but we can't exhaustively cover them all
 			switch decl.Tok {
-			case token.VAR:
+			case token.VAR, token.IMPORT:
 				ip.varDecls = append(ip.varDecls, decl)
 			case token.TYPE:
 				ip.hookCtxDecl = decl
@@ -141,7 +155,8 @@ func (ip *InstrumentPhase) materializeTemplate() error {
 	}
 	util.Assert(ip.hookCtxDecl != nil &&
 		ip.beforeTrampFunc != nil &&
-		ip.afterTrampFunc != nil, "sanity check")
+		ip.afterTrampFunc != nil &&
+		ip.aroundTrampFunc != nil, "sanity check")
 	util.Assert(len(ip.varDecls) > 0, "sanity check")
 	return nil
 }
@@ -157,6 +172,9 @@ func getNames(list *dst.FieldList) []string {
 }
 
 func getHookFuncName(t *rule.InstFuncRule, before bool) string {
+	if t.Around != "" {
+		return t.Around
+	}
 	if before {
 		return t.Before
 	}
@@ -176,6 +194,12 @@ func isHookDefined(root *dst.File, rule *rule.InstFuncRule) bool {
 			return false
 		}
 	}
+	if rule.Around != "" {
+		decl := ast.FindFuncDeclWithoutRecv(root, rule.Around)
+		if decl == nil {
+			return false
+		}
+	}
 	return true
 }
 
@@ -196,8 +220,8 @@ func findHookFile(rule *rule.InstFuncRule) (string, error) {
 			return file, nil
 		}
 	}
-	return "", ex.Newf("no hook {%s,%s} found for %s from %v",
-		rule.Before, rule.After, rule.Func, files)
+	return "", ex.Newf("no hook {%s,%s,%s} found for %s from %v",
+		rule.Before, rule.After, rule.Around, rule.Func, files)
 }
 
 func getHookFunc(t *rule.InstFuncRule, before bool) (*dst.FuncDecl, error) {
@@ -209,15 +233,10 @@ func getHookFunc(t *rule.InstFuncRule, before bool) (*dst.FuncDecl, error) {
 	if err != nil {
 		return nil, err
 	}
-	var target *dst.FuncDecl
-	if before {
-		target = ast.FindFuncDeclWithoutRecv(root, t.Before)
-	} else {
-		target = ast.FindFuncDeclWithoutRecv(root, t.After)
-	}
+	target := ast.FindFuncDeclWithoutRecv(root, getHookFuncName(t, before))
 	if target == nil {
-		return nil, ex.Newf("hook %s or %s not found from %s",
-			t.Before, t.After, file)
+		return nil, ex.Newf("hook %s not found from %s",
+			getHookFuncName(t, before), file)
 	}
 	return target, nil
 }
@@ -249,52 +268,33 @@ func baseTypeName(expr dst.Expr) string {
 // have correct signature (parameter count and types)
 func (ip *InstrumentPhase) checkHookDecl(hookFunc *dst.FuncDecl, before bool) error {
 	// TargetFunc:  func A(a int, b string) (ret string)
-	// BeforeTramp: func B(a *int, b *string) (ctx *HookContext, skip bool)
-	// BeforeHook:  func C(ctx *HookContext, a int, b string)
+	// BeforeTramp: func B(ctx *HookContextImpl, a *int, b *string) (*HookContextImpl, bool)
+	// BeforeHook:  func C(ctx HookContext, a int, b string)
+	// AfterTramp:  func D(ctx *HookContextImpl, ret *string)
+	// AfterHook:   func E(ctx HookContext, ret string)
+	trampFunc := ip.afterTrampFunc
 	if before {
-		beforeTrampParams := ast.SplitMultiNameFields(ip.beforeTrampFunc.Type.Params)
-		beforeHookParams := ast.SplitMultiNameFields(hookFunc.Type.Params)
-
-		if len(beforeHookParams.List) != len(beforeTrampParams.List)+1 {
-			return ex.Newf("hook func signature mismatch, expected %d params, got %d",
-				len(beforeTrampParams.List)+1, len(beforeHookParams.List))
-		}
-
-		// First param must be HookContext
-		if baseTypeName(beforeHookParams.List[0].Type) != trampolineHookContextType {
-			return ex.Newf("hook func first param must be %s, got %s",
-				trampolineHookContextType, baseTypeName(beforeHookParams.List[0].Type))
-		}
-
-		// Remaining params must match dereferenced trampoline params
-		// (interface{} in hook accepts any type, used for generics)
-		for i, trampField := range beforeTrampParams.List {
-			trampBase := baseTypeName(trampField.Type)
-			hookBase := baseTypeName(beforeHookParams.List[i+1].Type)
-			if hookBase != trampolineInterfaceType && trampBase != hookBase {
-				return ex.Newf("hook func param %d type mismatch, expected %s, got %s",
-					i+1, trampBase, hookBase)
-			}
-		}
-		return nil
+		trampFunc = ip.beforeTrampFunc
 	}
+	trampParams := ast.SplitMultiNameFields(trampFunc.Type.Params)
+	hookParams := ast.SplitMultiNameFields(hookFunc.Type.Params)
 
-	// TargetFunc:  func A(a int, b string) (ret string)
-	// AfterTramp:  func B(ctx *HookContext, ret *string)
-	// AfterHook:   func C(ctx *HookContext, ret string)
-	afterTrampParams := ast.SplitMultiNameFields(ip.afterTrampFunc.Type.Params)
-	afterHookParams := ast.SplitMultiNameFields(hookFunc.Type.Params)
-
-	if len(afterHookParams.List) != len(afterTrampParams.List) {
+	if len(hookParams.List) != len(trampParams.List) {
 		return ex.Newf("hook func signature mismatch, expected %d params, got %d",
-			len(afterTrampParams.List), len(afterHookParams.List))
+			len(trampParams.List), len(hookParams.List))
 	}
 
-	// All params must match (first is HookContext, rest are dereferenced)
+	// First param must be HookContext
+	if baseTypeName(hookParams.List[0].Type) != trampolineHookContextType {
+		return ex.Newf("hook func first param must be %s, got %s",
+			trampolineHookContextType, baseTypeName(hookParams.List[0].Type))
+	}
+
+	// Remaining params must match dereferenced trampoline params
 	// (interface{} in hook accepts any type, used for generics)
-	for i, trampField := range afterTrampParams.List {
-		trampBase := baseTypeName(trampField.Type)
-		hookBase := baseTypeName(afterHookParams.List[i].Type)
+	for i := 1; i < len(trampParams.List); i++ {
+		trampBase := baseTypeName(trampParams.List[i].Type)
+		hookBase := baseTypeName(hookParams.List[i].Type)
 		if hookBase != trampolineInterfaceType && trampBase != hookBase {
 			return ex.Newf("hook func param %d type mismatch, expected %s, got %s",
 				i, trampBase, hookBase)
@@ -303,17 +303,32 @@ func (ip *InstrumentPhase) checkHookDecl(hookFunc *dst.FuncDecl, before bool) er
 	return nil
 }
 
-func (ip *InstrumentPhase) callBeforeHook(t *rule.InstFuncRule) {
+// hookContextArg returns the hook context argument passed to the hook function.
+// The hook context is hidden from escape analysis unless the hook function lets
+// it escape, so that it can stay on the stack of the target function.
+func hookContextArg(hookFunc *dst.FuncDecl) dst.Expr {
+	hookContext := ast.Ident(trampolineHookContextName)
+	if hookContextEscapes(hookFunc) {
+		return hookContext
+	}
+	return ast.CallTo(trampolineNoEscapeName, nil, ast.Exprs(hookContext))
+}
+
+func (ip *InstrumentPhase) callBeforeHook(t *rule.InstFuncRule, hookFunc *dst.FuncDecl) {
 	// Query whether the parameter is a variadic parameter in the target function
 	targetParams := findTargetParamType(ip.targetFunc)
 	isEllipsis := func(i int) bool { return ast.IsEllipsis(targetParams.List[i].Type) }
 
-	args := []dst.Expr{ast.Ident(trampolineHookContextName)}
+	args := []dst.Expr{hookContextArg(hookFunc)}
 	for i, field := range ip.beforeTrampFunc.Type.Params.List {
+		// Skip the first HookContext parameter, it's passed above
+		if i == 0 {
+			continue
+		}
 		for _, name := range field.Names {
 			// If the parameter is a variadic parameter, pass "*param..." to the
 			// hook function, otherwise pass "*param"
-			if isEllipsis(i) {
+			if isEllipsis(i - 1) {
 				args = append(args, ast.DereferenceOf(ast.Ident(name.Name+"...")))
 			} else {
 				args = append(args, ast.DereferenceOf(ast.Ident(name.Name)))
@@ -330,12 +345,11 @@ func (ip *InstrumentPhase) callBeforeHook(t *rule.InstFuncRule) {
 	insertAt(ip.beforeTrampFunc, iff, len(ip.beforeTrampFunc.Body.List)-1)
 }
 
-func (ip *InstrumentPhase) callAfterHook(t *rule.InstFuncRule) {
-	var args []dst.Expr
+func (ip *InstrumentPhase) callAfterHook(t *rule.InstFuncRule, hookFunc *dst.FuncDecl) {
+	args := []dst.Expr{hookContextArg(hookFunc)}
 	for i, field := range ip.afterTrampFunc.Type.Params.List {
-		// If it's the first HookContext parameter, pass it directly
+		// Skip the first HookContext parameter, it's passed above
 		if i == 0 {
-			args = append(args, ast.Ident(trampolineHookContextName))
 			continue
 		}
 		for _, name := range field.Names {
@@ -355,8 +369,7 @@ func (ip *InstrumentPhase) callAfterHook(t *rule.InstFuncRule) {
 	insertAtEnd(ip.afterTrampFunc, iff)
 }
 
-func (ip *InstrumentPhase) addHookDecl(t *rule.InstFuncRule, paramTypes *dst.FieldList, before bool) error {
-	fnName := getHookFuncName(t, before)
+func (ip *InstrumentPhase) addHookDecl(t *rule.InstFuncRule, fnName string, paramTypes *dst.FieldList) error {
 	funcDecl := &dst.FuncDecl{
 		Name: ast.Ident(fnName),
 		Type: &dst.FuncType{
@@ -376,6 +389,41 @@ func (ip *InstrumentPhase) addHookDecl(t *rule.InstFuncRule, paramTypes *dst.Fie
 	return nil
 }
 
+// addLinkedDecl declares the hook function without body in the target file
+// unless it's declared already, and links it to the hook code in path.
+func (ip *InstrumentPhase) addLinkedDecl(root *dst.File, name, path string, funcType *dst.FuncType) {
+	if ast.FindFuncDeclWithoutRecv(root, name) != nil {
+		return
+	}
+	funcDecl := &dst.FuncDecl{
+		Name: ast.Ident(name),
+		Type: funcType,
+		Decs: dst.FuncDeclDecorations{
+			NodeDecs: ast.LineComments(fmt.Sprintf("//go:linkname %s %s.%s", name, path, name)),
+		},
+	}
+	root.Decls = append(root.Decls, funcDecl)
+	ip.ensureUnsafeImport()
+}
+
+// addGlobalLinkedDecl is like addLinkedDecl, but declares the hook function in
+// the globals file, so that the files of the package using the same hook do not
+// declare it repeatedly. The function type must not refer to imported packages.
+func (ip *InstrumentPhase) addGlobalLinkedDecl(name, path string, funcType *dst.FuncType) {
+	for _, decl := range ip.linkedDecls {
+		if decl.Name.Name == name {
+			return
+		}
+	}
+	ip.linkedDecls = append(ip.linkedDecls, &dst.FuncDecl{
+		Name: ast.Ident(name),
+		Type: funcType,
+		Decs: dst.FuncDeclDecorations{
+			NodeDecs: ast.LineComments(fmt.Sprintf("//go:linkname %s %s.%s", name, path, name)),
+		},
+	})
+}
+
 func insertAt(funcDecl *dst.FuncDecl, stmt dst.Stmt, index int) {
 	stmts := funcDecl.Body.List
 	newStmts := make([]dst.Stmt, 0, len(stmts)+1)
@@ -504,17 +552,11 @@ func findTargetGenericType(targetFunc *dst.FuncDecl) *dst.FieldList {
 }
 
 func (ip *InstrumentPhase) buildTrampSignature(before bool) {
-	var fields *dst.FieldList
+	tramp := ip.afterTrampFunc
+	fields := findTargetResultType(ip.targetFunc)
 	if before {
-		beforeTramp := ip.beforeTrampFunc
-		beforeTramp.Type.Params = findTargetParamType(ip.targetFunc)
-		beforeTramp.Type.TypeParams = findTargetGenericType(ip.targetFunc)
-		fields = beforeTramp.Type.Params
-	} else {
-		afterTramp := ip.afterTrampFunc
-		afterTramp.Type.Params = findTargetResultType(ip.targetFunc)
-		afterTramp.Type.TypeParams = findTargetGenericType(ip.targetFunc)
-		fields = afterTramp.Type.Params
+		tramp = ip.beforeTrampFunc
+		fields = findTargetParamType(ip.targetFunc)
 	}
 	// All types should be replaced with dereferenced types, so that the trampoline
 	// function can modify the target function's parameters.
@@ -523,14 +565,14 @@ func (ip *InstrumentPhase) buildTrampSignature(before bool) {
 		paramFieldType := desugarType(paramField)
 		paramField.Type = ast.DereferenceOf(paramFieldType)
 	}
-
-	// If it's after trampoline, add hook context as the first parameter
-	if !before {
-		addHookContext(fields)
-	}
+	// Keep the hook context as the first parameter
+	hookContext := tramp.Type.Params.List[0]
+	fields.List = append([]*dst.Field{hookContext}, fields.List...)
+	tramp.Type.Params = fields
+	tramp.Type.TypeParams = findTargetGenericType(ip.targetFunc)
 }
 
-func (ip *InstrumentPhase) buildHookSignature(t *rule.InstFuncRule, before bool) (*dst.FieldList, error) {
+func (ip *InstrumentPhase) buildHookSignature(hookFunc *dst.FuncDecl, before bool) (*dst.FieldList, error) {
 	// TargetFunc: func A(a int, b string) (ret string)
 	// BeforeHook: func B(ctx *HookContext, a int, b string)
 	// AfterHook:  func C(ctx *HookContext, ret string)
@@ -547,13 +589,8 @@ func (ip *InstrumentPhase) buildHookSignature(t *rule.InstFuncRule, before bool)
 	for _, field := range paramTypes.List {
 		field.Type = replaceTypeParamsWithAny(field.Type, genericTypes)
 	}
-	// Get the hook function declaration
-	hookFunc, err := getHookFunc(t, before)
-	if err != nil {
-		return nil, err
-	}
 	// Check if the hook function declaration is correct
-	err = ip.checkHookDecl(hookFunc, before)
+	err := ip.checkHookDecl(hookFunc, before)
 	if err != nil {
 		return nil, err
 	}
@@ -573,76 +610,6 @@ func (ip *InstrumentPhase) buildHookSignature(t *rule.InstFuncRule, before bool)
 	return paramTypes, nil
 }
 
-func assignString(assignStmt *dst.AssignStmt, val string) bool {
-	rhs := assignStmt.Rhs
-	if len(rhs) == 1 {
-		rhsExpr := rhs[0]
-		if basicLit, ok := rhsExpr.(*dst.BasicLit); ok {
-			if basicLit.Kind == token.STRING {
-				basicLit.Value = strconv.Quote(val)
-				return true
-			}
-		}
-	}
-	return false
-}
-
-func assignSliceLiteral(assignStmt *dst.AssignStmt, vals []dst.Expr) bool {
-	rhs := assignStmt.Rhs
-	if len(rhs) == 1 {
-		rhsExpr := rhs[0]
-		if compositeLit, ok := rhsExpr.(*dst.CompositeLit); ok {
-			elems := compositeLit.Elts
-			elems = append(elems, vals...)
-			compositeLit.Elts = elems
-			return true
-		}
-	}
-	return false
-}
-
-// populateHookContext populates the hook context before hook invocation
-func (ip *InstrumentPhase) populateHookContext(before bool) bool {
-	funcDecl := ip.beforeTrampFunc
-	if !before {
-		funcDecl = ip.afterTrampFunc
-	}
-	for _, stmt := range funcDecl.Body.List {
-		if assignStmt, ok := stmt.(*dst.AssignStmt); ok {
-			lhs := assignStmt.Lhs
-			if sel, ok1 := lhs[0].(*dst.SelectorExpr); ok1 {
-				switch sel.Sel.Name {
-				case trampolineFuncNameIdentifier:
-					util.Assert(before, "sanity check")
-					// hookContext.FuncName = "..."
-					assigned := assignString(assignStmt, ip.targetFunc.Name.Name)
-					util.Assert(assigned, "sanity check")
-				case trampolinePackageNameIdentifier:
-					util.Assert(before, "sanity check")
-					// hookContext.PackageName = "..."
-					assigned := assignString(assignStmt, ip.target.Name.Name)
-					util.Assert(assigned, "sanity check")
-				default:
-					// hookContext.Params = []interface{}{...} or
-					// hookContext.(*HookContextImpl).Params[0] = &int
-					names := getNames(funcDecl.Type.Params)
-					vals := make([]dst.Expr, 0, len(names))
-					for i, name := range names {
-						if i == 0 && !before {
-							// SKip first hookContext parameter for after
-							continue
-						}
-						vals = append(vals, ast.Ident(name))
-					}
-					assigned := assignSliceLiteral(assignStmt, vals)
-					util.Assert(assigned, "sanity check")
-				}
-			}
-		}
-	}
-	return true
-}
-
 // -----------------------------------------------------------------------------
 // Dynamic HookContext API Generation
 //
@@ -652,7 +619,38 @@ func (ip *InstrumentPhase) populateHookContext(before bool) bool {
 // different types of parameters, all of them should have their own HookContext
 // implementation, thus we need to generate a bunch of HookContextImpl{suffix}
 // types and methods to handle them. The suffix is generated based on the rule
-// suffix, so that we can distinguish them from each other.
+// suffix, so that we can distinguish them from each other. Each implementation
+// holds typed pointers to the parameters and results of the RawFunc, i.e.
+//
+//	type HookContextImpl_abc struct {
+//	    ...
+//	    param0     *int
+//	    returnVal0 *string
+//	}
+//
+// so that neither the hook context nor the values need to be boxed until the
+// hook code asks for them. The implementation of a generic RawFunc is generic
+// as well, it's instantiated with the type parameters of the RawFunc.
+
+// hookContextImplType returns the HookContextImpl{suffix} type of the rule, it's
+// instantiated with the type parameters of the target function if any.
+func hookContextImplType(t *rule.InstFuncRule, targetFunc *dst.FuncDecl) dst.Expr {
+	name := ast.Ident(trampolineHookContextImplType + util.CRC32(t.String()))
+	typeParams := findTargetGenericType(targetFunc)
+	if typeParams == nil {
+		return name
+	}
+	indices := make([]dst.Expr, 0)
+	for _, field := range typeParams.List {
+		for _, ident := range field.Names {
+			indices = append(indices, ast.Ident(ident.Name))
+		}
+	}
+	if len(indices) == 1 {
+		return ast.IndexExpr(name, indices[0])
+	}
+	return ast.IndexListExpr(name, indices)
+}
 
 // implementHookContext effectively "implements" the HookContext interface by
 // renaming occurrences of HookContextImpl to HookContextImpl{suffix} in the
@@ -662,78 +660,68 @@ func (ip *InstrumentPhase) implementHookContext(t *rule.InstFuncRule) {
 	structType := util.AssertType[*dst.TypeSpec](ip.hookCtxDecl.Specs[0])
 	util.Assert(structType.Name.Name == trampolineHookContextImplType,
 		"sanity check")
-	structType.Name.Name += suffix             // type declaration
+	structType.Name.Name += suffix // type declaration
+	structType.TypeParams = findTargetGenericType(ip.targetFunc)
 	for _, method := range ip.hookCtxMethods { // method declaration
-		t1 := util.AssertType[*dst.StarExpr](method.Recv.List[0].Type)
-		t2 := util.AssertType[*dst.Ident](t1.X)
-		t2.Name += suffix
+		method.Recv.List[0].Type = ast.DereferenceOf(hookContextImplType(t, ip.targetFunc))
 	}
-	for _, node := range []dst.Node{ip.beforeTrampFunc, ip.afterTrampFunc} {
-		dst.Inspect(node, func(node dst.Node) bool {
-			if ident, ok1 := node.(*dst.Ident); ok1 {
+	for _, node := range []dst.Node{ip.beforeTrampFunc, ip.afterTrampFunc, ip.aroundTrampFunc} {
+		dstutil.Apply(node, func(c *dstutil.Cursor) bool {
+			if ident, ok := c.Node().(*dst.Ident); ok {
 				if ident.Name == trampolineHookContextImplType {
-					ident.Name += suffix
-					return false
+					c.Replace(hookContextImplType(t, ip.targetFunc))
 				}
 			}
 			return true
-		})
+		}, nil)
 	}
 }
 
-func setValue(field string, idx int, t dst.Expr) *dst.CaseClause {
-	// *(c.Params[idx].(*int)) = val.(int)
-	// c.Params[idx] = val iff type is interface{}
-	se := ast.SelectorExpr(ast.Ident(trampolineCtxIdentifier), field)
-	ie := ast.IndexExpr(se, ast.IntLit(idx))
-	te := ast.TypeAssertExpr(ie, ast.DereferenceOf(t))
-	pe := ast.ParenExpr(te)
-	de := ast.DereferenceOf(pe)
-	val := ast.Ident(trampolineValIdentifier)
-	assign := ast.AssignStmt(de, ast.TypeAssertExpr(val, t))
-	if ast.IsInterfaceType(t) {
-		assign = ast.AssignStmt(ie, val)
-	}
-	caseClause := ast.SwitchCase(
-		ast.Exprs(ast.IntLit(idx)),
-		ast.Stmts(assign),
-	)
-	return caseClause
+func hookContextField(prefix string, idx int) string {
+	return fmt.Sprintf("%s%d", prefix, idx)
 }
 
-func getValue(field string, idx int, t dst.Expr) *dst.CaseClause {
-	// return *(c.Params[idx].(*int))
-	// return c.Params[idx] iff type is interface{}
-	se := ast.SelectorExpr(ast.Ident(trampolineCtxIdentifier), field)
-	ie := ast.IndexExpr(se, ast.IntLit(idx))
-	te := ast.TypeAssertExpr(ie, ast.DereferenceOf(t))
-	pe := ast.ParenExpr(te)
-	de := ast.DereferenceOf(pe)
-	ret := ast.ReturnStmt(ast.Exprs(de))
-	if ast.IsInterfaceType(t) {
-		ret = ast.ReturnStmt(ast.Exprs(ie))
-	}
-	caseClause := ast.SwitchCase(
-		ast.Exprs(ast.IntLit(idx)),
-		ast.Stmts(ret),
-	)
-	return caseClause
-}
-
-func getParamClause(idx int, t dst.Expr) *dst.CaseClause {
-	return getValue(trampolineParamsIdentifier, idx, t)
+// addHookContextFields adds the typed pointers to the parameters and results of
+// the target function to the hook context
+func (ip *InstrumentPhase) addHookContextFields() {
+	structType := util.AssertType[*dst.TypeSpec](ip.hookCtxDecl.Specs[0])
+	fields := util.AssertType[*dst.StructType](structType.Type).Fields
+	params := findTargetParamType(ip.targetFunc)
+	for i, param := range params.List {
+		name := hookContextField(trampolineParamFieldPrefix, i)
+		fields.List = append(fields.List, ast.Field(name, ast.DereferenceOf(desugarType(param))))
+	}
+	results := findTargetResultType(ip.targetFunc)
+	for i, result := range results.List {
+		name := hookContextField(trampolineReturnValFieldPrefix, i)
+		fields.List = append(fields.List, ast.Field(name, ast.DereferenceOf(desugarType(result))))
+	}
 }
 
-func setParamClause(idx int, t dst.Expr) *dst.CaseClause {
-	return setValue(trampolineParamsIdentifier, idx, t)
+func getValue(field string, idx int, _ dst.Expr) *dst.CaseClause {
+	// return *c.param0
+	se := ast.SelectorExpr(ast.Ident(trampolineCtxIdentifier), field)
+	ret := ast.ReturnStmt(ast.Exprs(ast.DereferenceOf(se)))
+	return ast.SwitchCase(ast.Exprs(ast.IntLit(idx)), ast.Stmts(ret))
 }
 
-func getReturnValClause(idx int, t dst.Expr) *dst.CaseClause {
-	return getValue(trampolineReturnValsIdentifier, idx, t)
+func setValue(field string, idx int, t dst.Expr) *dst.CaseClause {
+	// if val == nil { *c.param0 = [1]int{}[0] } else { *c.param0 = val.(int) }
+	target := func() dst.Expr {
+		return ast.DereferenceOf(ast.SelectorExpr(ast.Ident(trampolineCtxIdentifier), field))
+	}
+	zero := ast.ZeroValue(cloneExpr(t))
+	val := ast.TypeAssertExpr(ast.Ident(trampolineValIdentifier), cloneExpr(t))
+	iff := &dst.IfStmt{
+		Cond: &dst.BinaryExpr{X: ast.Ident(trampolineValIdentifier), Op: token.EQL, Y: ast.Nil()},
+		Body: ast.Block(ast.AssignStmt(target(), zero)),
+		Else: ast.Block(ast.AssignStmt(target(), val)),
+	}
+	return ast.SwitchCase(ast.Exprs(ast.IntLit(idx)), ast.Stmts(iff))
 }
 
-func setReturnValClause(idx int, t dst.Expr) *dst.CaseClause {
-	return setValue(trampolineReturnValsIdentifier, idx, t)
+func cloneExpr(expr dst.Expr) dst.Expr {
+	return util.AssertType[dst.Expr](dst.Clone(expr))
 }
 
 // extractReceiverTypeParams extracts type parameters from a receiver type expression
@@ -780,97 +768,54 @@ func desugarType(param *dst.Field) dst.Expr {
 	return param.Type
 }
 
-func rewriteParamMethods(targetFunc *dst.FuncDecl, methodSetParam, methodGetParam *dst.BlockStmt) {
-	idx := 0
-	if ast.HasReceiver(targetFunc) {
-		recvType := targetFunc.Recv.List[0].Type
-		clause := setParamClause(idx, recvType)
-		methodSetParam.List = append(methodSetParam.List, clause)
-		clause = getParamClause(idx, recvType)
-		methodGetParam.List = append(methodGetParam.List, clause)
-		idx++
-	}
-	for _, param := range targetFunc.Type.Params.List {
-		paramType := desugarType(param)
-		for range param.Names {
-			clause := setParamClause(idx, paramType)
-			methodSetParam.List = append(methodSetParam.List, clause)
-			clause = getParamClause(idx, paramType)
-			methodGetParam.List = append(methodGetParam.List, clause)
-			idx++
-		}
+// rewriteValueMethods fills the switch statement of the method with one case
+// per value, each accessing the typed field of the value, ahead of the default
+// case of the template reporting the indexes out of range
+func rewriteValueMethods(method *dst.FuncDecl, prefix string, values *dst.FieldList,
+	caseClause func(field string, idx int, t dst.Expr) *dst.CaseClause,
+) {
+	stmt := util.AssertType[*dst.SwitchStmt](method.Body.List[0])
+	util.Assert(len(stmt.Body.List) == 1, "sanity check")
+	defaultClause := stmt.Body.List[0]
+	stmt.Body.List = nil
+	for i, value := range values.List {
+		clause := caseClause(hookContextField(prefix, i), i, desugarType(value))
+		stmt.Body.List = append(stmt.Body.List, clause)
 	}
+	stmt.Body.List = append(stmt.Body.List, defaultClause)
 }
 
-func rewriteReturnValMethods(targetFunc *dst.FuncDecl, methodSetRetVal, methodGetRetVal *dst.BlockStmt) {
-	idx := 0
-	for _, retval := range targetFunc.Type.Results.List {
-		retType := desugarType(retval)
-		for range retval.Names {
-			clause := getReturnValClause(idx, retType)
-			methodGetRetVal.List = append(methodGetRetVal.List, clause)
-			clause = setReturnValClause(idx, retType)
-			methodSetRetVal.List = append(methodSetRetVal.List, clause)
-			idx++
-		}
-	}
+// rewriteReturnLit replaces the returned literal of the method
+func rewriteReturnLit(method *dst.FuncDecl, lit dst.Expr) {
+	method.Body.List = ast.Stmts(ast.ReturnStmt(ast.Exprs(lit)))
 }
 
 func (ip *InstrumentPhase) rewriteHookContextMethods() {
 	util.Assert(len(ip.hookCtxMethods) > 4, "sanity check")
-	var methodSetParam, methodGetParam, methodGetRetVal, methodSetRetVal *dst.FuncDecl
+	params := findTargetParamType(ip.targetFunc)
+	results := findTargetResultType(ip.targetFunc)
 	for _, decl := range ip.hookCtxMethods {
 		switch decl.Name.Name {
 		case trampolineSetParamName:
-			methodSetParam = decl
+			rewriteValueMethods(decl, trampolineParamFieldPrefix, params, setValue)
 		case trampolineGetParamName:
-			methodGetParam = decl
-		case trampolineGetReturnValName:
-			methodGetRetVal = decl
+			rewriteValueMethods(decl, trampolineParamFieldPrefix, params, getValue)
 		case trampolineSetReturnValName:
-			methodSetRetVal = decl
+			rewriteValueMethods(decl, trampolineReturnValFieldPrefix, results, setValue)
+		case trampolineGetReturnValName:
+			rewriteValueMethods(decl, trampolineReturnValFieldPrefix, results, getValue)
+		case trampolineGetParamCountName:
+			rewriteReturnLit(decl, ast.IntLit(len(params.List)))
+		case trampolineGetReturnValCountName:
+			rewriteReturnLit(decl, ast.IntLit(len(results.List)))
+		case trampolineGetFuncNameName:
+			rewriteReturnLit(decl, ast.StringLit(ip.targetFunc.Name.Name))
+		case trampolineGetPackageNameName:
+			rewriteReturnLit(decl, ast.StringLit(ip.target.Name.Name))
 		}
 	}
-
-	// For generic functions, we need to panic the methods that are not supported
-	if findTargetGenericType(ip.targetFunc) != nil {
-		makeMethodPanic(methodGetParam, "GetParam is unsupported for generic functions")
-		makeMethodPanic(methodGetRetVal, "GetReturnVal is unsupported for generic functions")
-		makeMethodPanic(methodSetParam, "SetParam is unsupported for generic functions")
-		makeMethodPanic(methodSetRetVal, "SetReturnVal is unsupported for generic functions")
-		return
-	}
-
-	// Rewrite SetParam and GetParam methods
-	findSwitchBlock := func(fn *dst.FuncDecl, idx int) *dst.BlockStmt {
-		stmt := util.AssertType[*dst.SwitchStmt](fn.Body.List[idx])
-		body := stmt.Body
-		body.List = nil
-		return body
-	}
-	methodSetParamBody := findSwitchBlock(methodSetParam, 1)
-	methodGetParamBody := findSwitchBlock(methodGetParam, 0)
-	rewriteParamMethods(ip.targetFunc, methodSetParamBody, methodGetParamBody)
-
-	// Rewrite SetReturnVal and GetReturnVal methods
-	if ip.targetFunc.Type.Results != nil {
-		methodSetRetValBody := findSwitchBlock(methodSetRetVal, 1)
-		methodGetRetValBody := findSwitchBlock(methodGetRetVal, 0)
-		rewriteReturnValMethods(ip.targetFunc, methodSetRetValBody, methodGetRetValBody)
-	}
-}
-
-// makeMethodPanic replaces a method's body with a panic statement
-func makeMethodPanic(method *dst.FuncDecl, message string) {
-	panicStmt := ast.ExprStmt(
-		ast.CallTo("panic", nil, []dst.Expr{
-			&dst.BasicLit{
-				Kind:  token.STRING,
-				Value: strconv.Quote(message),
-			},
-		}),
-	)
-	method.Body.List = []dst.Stmt{panicStmt}
+	// Declare the typed fields accessed by the methods above
+	ip.addHookContextFields()
 }
 
 // isTypeParameter checks if a type expression is a bare type parameter identifier
@@ -945,26 +890,27 @@ func replaceTypeParamsWithAny(t dst.Expr, typeParams *dst.FieldList) dst.Expr {
 }
 
 func (ip *InstrumentPhase) callHookFunc(t *rule.InstFuncRule, before bool) error {
+	// Get the hook function declaration
+	hookFunc, err := getHookFunc(t, before)
+	if err != nil {
+		return err
+	}
 	// Build hook function signature and check if it is correct
-	paramTypes, err := ip.buildHookSignature(t, before)
+	paramTypes, err := ip.buildHookSignature(hookFunc, before)
 	if err != nil {
 		return err
 	}
 	// Add the body-less real hook function declaration. They will be linked to
 	// the real hook function.
-	err = ip.addHookDecl(t, paramTypes, before)
+	err = ip.addHookDecl(t, getHookFuncName(t, before), paramTypes)
 	if err != nil {
 		return err
 	}
 	// Add the function call to the real hook code.
 	if before {
-		ip.callBeforeHook(t)
+		ip.callBeforeHook(t, hookFunc)
 	} else {
-		ip.callAfterHook(t)
-	}
-	// Fulfill the hook context before calling the real hook code.
-	if !ip.populateHookContext(before) {
-		return ex.New("failed to populate hook context")
+		ip.callAfterHook(t, hookFunc)
 	}
 	return nil
 }
@@ -978,6 +924,8 @@ func (ip *InstrumentPhase) createTrampoline(t *rule.InstFuncRule) error {
 	if err != nil {
 		return err
 	}
+	ip.addDecl(ip.beforeTrampFunc)
+	ip.addDecl(ip.afterTrampFunc)
 	// Implement HookContext interface methods dynamically
 	ip.implementHookContext(t)
 	// Make all HookContext methods type-aware according to the target function
@@ -4,6 +4,10 @@
 package instrument
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/dave/dst"
@@ -118,7 +122,9 @@ func TestCheckHookDecl(t *testing.T) {
 			name: "valid before hook - pointer types match value types",
 			trampSrc: `
 package main
-func OtelBeforeTrampoline(param0 *string, param1 *int) (hookContext *HookContext, skipCall bool) { return nil, false }`,
+func OtelBeforeTrampoline(hookContext *HookContextImpl, param0 *string, param1 *int) (*HookContextImpl, bool) {
+	return hookContext, false
+}`,
 			hookSrc: `
 package testdata
 import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
@@ -129,18 +135,32 @@ func H1Before(ctx inst.HookContext, p1 string, p2 int) {}`,
 			name: "valid after hook - pointer types match value types",
 			trampSrc: `
 package main
-func OtelAfterTrampoline(hookContext *HookContext, ret0 *float32, ret1 *error) {}`,
+func OtelAfterTrampoline(hookContext *HookContextImpl, ret0 *float32, ret1 *error) {}`,
 			hookSrc: `
 package testdata
 import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
 func H1After(ctx inst.HookContext, r1 float32, r2 error) {}`,
 			before: false,
 		},
+		{
+			name: "invalid - HookContext replaced in after hook",
+			trampSrc: `
+package main
+func OtelAfterTrampoline(hookContext *HookContextImpl, ret0 *float32) {}`,
+			hookSrc: `
+package testdata
+func H1After(r0 float32, r1 float32) {}`,
+			before:      false,
+			expectError: true,
+			errorMsg:    "first param must be HookContext",
+		},
 		{
 			name: "invalid - missing HookContext in hook",
 			trampSrc: `
 package main
-func OtelBeforeTrampoline(param0 *string) (hookContext *HookContext, skipCall bool) { return nil, false }`,
+func OtelBeforeTrampoline(hookContext *HookContextImpl, param0 *string) (*HookContextImpl, bool) {
+	return hookContext, false
+}`,
 			hookSrc: `
 package testdata
 func H1Before(p1 string) {}`,
@@ -152,7 +172,9 @@ func H1Before(p1 string) {}`,
 			name: "invalid - type mismatch",
 			trampSrc: `
 package main
-func OtelBeforeTrampoline(param0 *string, param1 *int) (hookContext *HookContext, skipCall bool) { return nil, false }`,
+func OtelBeforeTrampoline(hookContext *HookContextImpl, param0 *string, param1 *int) (*HookContextImpl, bool) {
+	return hookContext, false
+}`,
 			hookSrc: `
 package testdata
 import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
@@ -188,3 +210,148 @@ func H1Before(ctx inst.HookContext, p1 string, p2 string) {}`,
 		})
 	}
 }
+
+func TestCheckAroundHookDecl(t *testing.T) {
+	tests := []struct {
+		name     string
+		hookSrc  string
+		errorMsg string
+	}{
+		{
+			name: "valid around hook",
+			hookSrc: `
+package testdata
+import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
+func H(ctx inst.HookContext, proceed func()) {}`,
+		},
+		{
+			name: "invalid - missing proceed",
+			hookSrc: `
+package testdata
+import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
+func H(ctx inst.HookContext) {}`,
+			errorMsg: "expected 2 params, got 1",
+		},
+		{
+			name: "invalid - missing HookContext",
+			hookSrc: `
+package testdata
+func H(p string, proceed func()) {}`,
+			errorMsg: "first param must be HookContext",
+		},
+		{
+			name: "invalid - proceed with results",
+			hookSrc: `
+package testdata
+import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
+func H(ctx inst.HookContext, proceed func() error) {}`,
+			errorMsg: "second param must be func()",
+		},
+		{
+			name: "invalid - results",
+			hookSrc: `
+package testdata
+import "github.com/open-telemetry/opentelemetry-go-compile-instrumentation/pkg/inst"
+func H(ctx inst.HookContext, proceed func()) error { return nil }`,
+			errorMsg: "must not return values",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAroundHookDecl(parseFunc(t, tt.hookSrc))
+			if tt.errorMsg != "" {
+				require.ErrorContains(t, err, tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHookContextImpl(t *testing.T) {
+	const mainSource = `package main
+
+import "fmt"
+
+func main() {
+	c := &HookContextImpl{}
+	c.SetData(map[string]interface{}{"k0": "data", "k6": "data"})
+	fmt.Println(c.GetKeyData("k0"), c.HasKeyData("k1"))
+	for _, key := range []string{"k0", "k1", "k2", "k3", "k4", "k5"} {
+		c.SetKeyData(key, key)
+	}
+	fmt.Println(c.GetKeyData("k0"), c.GetKeyData("k4"), c.GetKeyData("k5"), c.GetKeyData("k6"))
+	fmt.Println(c.GetData())
+	defer func() { fmt.Println(recover()) }()
+	c.SetParam(1, nil)
+}
+`
+	// The trampolines of the template are only materialized by the tool
+	impl, _, found := strings.Cut(templateImpl, "// Trampoline Template")
+	require.True(t, found)
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module hookcontext\n\ngo 1.24\n",
+		"impl.go": strings.Replace(impl, "package instrument", "package main", 1),
+		"api.go":  strings.Replace(templateAPI, "package inst", "package main", 1),
+		"main.go": mainSource,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(output))
+	// The keys of a map set by SetData are found unless set as key data, which
+	// never changes the data, even beyond the fixed array. An index out of range
+	// is reported
+	assert.Equal(t, "data false\nk0 k4 k5 data\nmap[k0:data k6:data]\n"+
+		"runtime error: index out of range [1] with length 0\n", string(output))
+}
+
+func TestHookContextArg(t *testing.T) {
+	tests := []struct {
+		name     string
+		hookSrc  string
+		noEscape bool
+	}{
+		{
+			name: "method calls only",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, n int) {
+				ctx.SetKeyData("hot", true)
+			}`,
+			noEscape: true,
+		},
+		{
+			name: "retained by the hook",
+			hookSrc: `package main
+			func hookFunc(ctx HookContext, n int) {
+				lastHotContext = ctx
+				ctx.SetKeyData("hot", true)
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arg := hookContextArg(parseFunc(t, tt.hookSrc))
+			if !tt.noEscape {
+				// The hook context escapes, so it must be allocated on the heap
+				// rather than hidden from escape analysis
+				ident, ok := arg.(*dst.Ident)
+				require.True(t, ok)
+				assert.Equal(t, trampolineHookContextName, ident.Name)
+				return
+			}
+			call, ok := arg.(*dst.CallExpr)
+			require.True(t, ok)
+			fun, ok := call.Fun.(*dst.Ident)
+			require.True(t, ok)
+			assert.Equal(t, trampolineNoEscapeName, fun.Name)
+			require.Len(t, call.Args, 1)
+			assert.Equal(t, trampolineHookContextName, call.Args[0].(*dst.Ident).Name)
+		})
+	}
+}
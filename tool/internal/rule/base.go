@@ -6,35 +6,70 @@ package rule
 import (
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
 )
 
 // InstRule defines the interface for an instrumentation rule. Each rule
 // specifies a target module and version, and has a unique name. The version
-// range is optional and is used to filter rules that are applicable to the
+// constraint is optional and is used to filter rules that are applicable to the
 // target module version. If the version is not specified, the rule is applicable
-// to all versions of the target module. The left bound is inclusive, the right
-// bound is exclusive. For example, "v1.0.0,v2.0.0" means the rule is applicable
-// to the target module version range [v1.0.0, v2.0.0).
+// to all versions of the target module. For example, "v1.0.0,v2.0.0" means the
+// rule is applicable to the target module version range [v1.0.0, v2.0.0), see
+// ParseVersionConstraint for the full syntax.
 type InstRule interface {
-	String() string     // The string representation of the rule
-	GetName() string    // The unique name of the rule
-	GetTarget() string  // The target module path where the rule is applied
-	GetVersion() string // The version range of target module if available, e.g "v1.0.0,v2.0.0"
+	String() string                // The string representation of the rule
+	GetName() string               // The unique name of the rule
+	GetTarget() string             // The target module path where the rule is applied
+	GetVersion() string            // The version constraint of target module if available, e.g "v1.0.0,v2.0.0"
+	GetCondition() *BuildCondition // The builds the rule applies to
+	GetOrder() int                 // The order among rules applied to the same function
 }
 
 // InstBaseRule is the base rule for all instrumentation rules.
 type InstBaseRule struct {
+	BuildCondition `yaml:",inline"`
+
 	Name    string `json:"name,omitempty"    yaml:"name,omitempty"`
 	Target  string `json:"target"            yaml:"target"`
 	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Order decides the nesting of rules applied to the same function. Rules of
+	// lower order are applied outside of rules of higher order, so their before
+	// hooks run first and their after hooks run last. Rules of the same order
+	// are applied by name.
+	Order int `json:"order,omitempty" yaml:"order,omitempty"`
+}
+
+func (ibr *InstBaseRule) String() string                { return ibr.Name }
+func (ibr *InstBaseRule) GetName() string               { return ibr.Name }
+func (ibr *InstBaseRule) GetTarget() string             { return ibr.Target }
+func (ibr *InstBaseRule) GetVersion() string            { return ibr.Version }
+func (ibr *InstBaseRule) GetCondition() *BuildCondition { return &ibr.BuildCondition }
+func (ibr *InstBaseRule) GetOrder() int                 { return ibr.Order }
+
+// packageWildcard matches any part of import paths in package patterns.
+const packageWildcard = "..."
+
+// IsPackagePattern reports whether the target is a package pattern rather than
+// an import path, e.g. "github.com/foo/bar/...".
+func IsPackagePattern(target string) bool {
+	return strings.Contains(target, packageWildcard)
 }
 
-func (ibr *InstBaseRule) String() string     { return ibr.Name }
-func (ibr *InstBaseRule) GetName() string    { return ibr.Name }
-func (ibr *InstBaseRule) GetTarget() string  { return ibr.Target }
-func (ibr *InstBaseRule) GetVersion() string { return ibr.Version }
+// MatchPackagePattern reports whether the import path matches the package
+// pattern. As in go list, "..." matches any string, including the empty string
+// and strings containing slashes, and a trailing "/..." also matches the package
+// itself, e.g. "net/..." matches both "net" and "net/http".
+func MatchPackagePattern(pattern, importPath string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.ReplaceAll(re, regexp.QuoteMeta(packageWildcard), ".*")
+	if trimmed, ok := strings.CutSuffix(re, "/.*"); ok {
+		re = trimmed + "(/.*)?"
+	}
+	return regexp.MustCompile("^" + re + "$").MatchString(importPath)
+}
 
 // InstRuleSet represents a collection of instrumentation rules that apply to a
 // single Go package within a specific module. It acts as a container for rules,
@@ -48,7 +83,12 @@ type InstRuleSet struct {
 	RawRules    map[string][]*InstRawRule    `json:"raw_rules"`
 	FuncRules   map[string][]*InstFuncRule   `json:"func_rules"`
 	StructRules map[string][]*InstStructRule `json:"struct_rules"`
+	CallRules   map[string][]*InstCallRule   `json:"call_rules,omitempty"`
 	FileRules   []*InstFileRule              `json:"file_rules"`
+	MethodRules []*InstMethodRule            `json:"method_rules,omitempty"`
+	VarRules    map[string][]*InstVarRule    `json:"var_rules,omitempty"`
+
+	GoroutineRules map[string][]*InstGoroutineRule `json:"goroutine_rules,omitempty"`
 }
 
 func NewInstRuleSet(importPath string) *InstRuleSet {
@@ -59,17 +99,26 @@ func NewInstRuleSet(importPath string) *InstRuleSet {
 		RawRules:    make(map[string][]*InstRawRule),
 		FuncRules:   make(map[string][]*InstFuncRule),
 		StructRules: make(map[string][]*InstStructRule),
+		CallRules:   make(map[string][]*InstCallRule),
 		FileRules:   make([]*InstFileRule, 0),
+		MethodRules: make([]*InstMethodRule, 0),
+		VarRules:    make(map[string][]*InstVarRule),
+
+		GoroutineRules: make(map[string][]*InstGoroutineRule),
 	}
 }
 
 func (irs *InstRuleSet) String() string {
-	return fmt.Sprintf("{%s: %v, %v, %v, %v}",
+	return fmt.Sprintf("{%s: %v, %v, %v, %v, %v, %v, %v, %v}",
 		irs.ModulePath,
 		irs.RawRules,
 		irs.FuncRules,
 		irs.StructRules,
+		irs.CallRules,
 		irs.FileRules,
+		irs.MethodRules,
+		irs.VarRules,
+		irs.GoroutineRules,
 	)
 }
 
@@ -78,7 +127,11 @@ func (irs *InstRuleSet) IsEmpty() bool {
 		(len(irs.FuncRules) == 0 &&
 			len(irs.StructRules) == 0 &&
 			len(irs.RawRules) == 0 &&
-			len(irs.FileRules) == 0)
+			len(irs.CallRules) == 0 &&
+			len(irs.FileRules) == 0 &&
+			len(irs.MethodRules) == 0 &&
+			len(irs.VarRules) == 0 &&
+			len(irs.GoroutineRules) == 0)
 }
 
 // AddRule is a generic method that adds any type of rule to the appropriate map.
@@ -100,10 +153,26 @@ func (irs *InstRuleSet) AddStructRule(file string, rule *InstStructRule) {
 	addRule(file, rule, irs.StructRules)
 }
 
+func (irs *InstRuleSet) AddCallRule(file string, rule *InstCallRule) {
+	addRule(file, rule, irs.CallRules)
+}
+
 func (irs *InstRuleSet) AddFileRule(rule *InstFileRule) {
 	irs.FileRules = append(irs.FileRules, rule)
 }
 
+func (irs *InstRuleSet) AddVarRule(file string, rule *InstVarRule) {
+	addRule(file, rule, irs.VarRules)
+}
+
+func (irs *InstRuleSet) AddGoroutineRule(file string, rule *InstGoroutineRule) {
+	addRule(file, rule, irs.GoroutineRules)
+}
+
+func (irs *InstRuleSet) AddMethodRule(rule *InstMethodRule) {
+	irs.MethodRules = append(irs.MethodRules, rule)
+}
+
 func (irs *InstRuleSet) SetPackageName(name string) {
 	util.Assert(name != "", "package name is empty")
 	irs.PackageName = name
@@ -114,6 +183,33 @@ func (irs *InstRuleSet) SetCgoFileMap(cgoFiles map[string]string) {
 	irs.CgoFileMap = cgoFiles
 }
 
+// GetRawRules returns all raw rules from the rule set.
+func (irs *InstRuleSet) GetRawRules() []*InstRawRule {
+	rules := make([]*InstRawRule, 0)
+	for _, rs := range irs.RawRules {
+		rules = append(rules, rs...)
+	}
+	return rules
+}
+
+// GetVarRules returns all var rules from the rule set.
+func (irs *InstRuleSet) GetVarRules() []*InstVarRule {
+	rules := make([]*InstVarRule, 0)
+	for _, rs := range irs.VarRules {
+		rules = append(rules, rs...)
+	}
+	return rules
+}
+
+// GetGoroutineRules returns all goroutine rules from the rule set.
+func (irs *InstRuleSet) GetGoroutineRules() []*InstGoroutineRule {
+	rules := make([]*InstGoroutineRule, 0)
+	for _, rs := range irs.GoroutineRules {
+		rules = append(rules, rs...)
+	}
+	return rules
+}
+
 // GetFuncRules returns all function rules from the rule set.
 func (irs *InstRuleSet) GetFuncRules() []*InstFuncRule {
 	rules := make([]*InstFuncRule, 0)
@@ -131,3 +227,12 @@ func (irs *InstRuleSet) GetStructRules() []*InstStructRule {
 	}
 	return rules
 }
+
+// GetCallRules returns all call rules from the rule set.
+func (irs *InstRuleSet) GetCallRules() []*InstCallRule {
+	rules := make([]*InstCallRule, 0)
+	for _, rs := range irs.CallRules {
+		rules = append(rules, rs...)
+	}
+	return rules
+}
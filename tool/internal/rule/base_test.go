@@ -0,0 +1,33 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPackagePattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		importPath string
+		want       bool
+	}{
+		{pattern: "example.com/app/internal/...", importPath: "example.com/app/internal", want: true},
+		{pattern: "example.com/app/internal/...", importPath: "example.com/app/internal/store/sql", want: true},
+		{pattern: "example.com/app/internal/...", importPath: "example.com/app/internals", want: false},
+		{pattern: "example.com/app/.../store", importPath: "example.com/app/internal/store", want: true},
+		{pattern: "example.com/app/.../store", importPath: "example.com/app/store/sql", want: false},
+		{pattern: "example.com/app/x...", importPath: "example.com/app/xyz", want: true},
+		{pattern: "example.com/a.b/...", importPath: "example.com/aXb", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.importPath, func(t *testing.T) {
+			assert.True(t, IsPackagePattern(tt.pattern))
+			assert.Equal(t, tt.want, MatchPackagePattern(tt.pattern, tt.importPath))
+		})
+	}
+	assert.False(t, IsPackagePattern("example.com/app"))
+}
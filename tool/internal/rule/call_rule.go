@@ -0,0 +1,126 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstCallRule represents a rule that instruments call sites of a function
+// rather than the function itself. Calls to the callee found in the target
+// package are routed through a generated wrapper carrying the before and after
+// hooks, while the callee and its callers elsewhere are left untouched. For
+// example, if we want to trace the queries issued by our own store package, we
+// can define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "github.com/foo/bar/store"
+//		call: "database/sql.(*DB).Query"
+//		before: "Foo"
+//		path: "github.com/foo/bar/hook_rule"
+//
+// Calls are resolved with type information, so method calls through variables,
+// fields and embedded types all match.
+type InstCallRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Call   string `json:"call"   yaml:"call"`   // The callee, e.g. "net/http.Get" or "database/sql.(*DB).Query"
+	Before string `json:"before" yaml:"before"` // The hook before the call
+	After  string `json:"after"  yaml:"after"`  // The hook after the call
+	Path   string `json:"path"   yaml:"path"`   // The module path of the hook code
+
+	Sites []*CallSite `json:"sites,omitempty" yaml:"-"` // The matched call sites, found during setup
+}
+
+// CallSite describes one call of the callee in the target file. The types are
+// spelled as they must appear in the target file, where the wrapper of the call
+// is generated.
+type CallSite struct {
+	Line    int               `json:"line"`              // The position of the call expression
+	Column  int               `json:"column"`            // The position of the call expression
+	Recv    string            `json:"recv,omitempty"`    // The receiver type, empty for functions
+	AddrOf  bool              `json:"addr_of,omitempty"` // Whether the receiver is passed by its address
+	Params  []string          `json:"params,omitempty"`  // The parameter types, "...T" if variadic
+	Results []string          `json:"results,omitempty"` // The result types
+	Imports map[string]string `json:"imports,omitempty"` // The imports required by the types, path -> name
+}
+
+// NewInstCallRule loads and validates an InstCallRule from YAML data.
+func NewInstCallRule(data []byte, name string) (*InstCallRule, error) {
+	var r InstCallRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid call rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstCallRule) validate() error {
+	if strings.TrimSpace(r.Call) == "" {
+		return ex.Newf("call cannot be empty")
+	}
+	if _, _, fn, err := r.SplitCall(); err != nil || fn == "" {
+		return ex.Newf("call %q is not a qualified function or method", r.Call)
+	}
+	if r.Before == "" && r.After == "" {
+		return ex.Newf("before or after must be set")
+	}
+	return nil
+}
+
+// SplitCall splits the callee into its package path, receiver and name, e.g.
+// "database/sql.(*DB).Query" -> ("database/sql", "*DB", "Query") and
+// "net/http.Get" -> ("net/http", "", "Get").
+func (r *InstCallRule) SplitCall() (string, string, string, error) {
+	if idx := strings.Index(r.Call, ".("); idx != -1 {
+		pkgPath, rest := r.Call[:idx], r.Call[idx+1:]
+		end := strings.Index(rest, ").")
+		if end == -1 {
+			return "", "", "", ex.Newf("malformed receiver in %q", r.Call)
+		}
+		return pkgPath, rest[1:end], rest[end+2:], nil
+	}
+	idx := strings.LastIndex(r.Call, ".")
+	if idx == -1 {
+		return "", "", "", ex.Newf("missing package path in %q", r.Call)
+	}
+	return r.Call[:idx], "", r.Call[idx+1:], nil
+}
+
+// Instantiate returns a copy of the rule that applies to the call sites of one
+// file. The file name is part of the rule name so that the wrappers generated
+// for different files of the same package do not clash.
+func (r *InstCallRule) Instantiate(file string, sites []*CallSite) *InstCallRule {
+	c := *r
+	c.Name = fmt.Sprintf("%s#%s", r.Name, file)
+	c.Sites = sites
+	return &c
+}
+
+// WrapperRule returns the func rule that injects the hooks of the rule into the
+// wrapper function generated for its call sites.
+func (r *InstCallRule) WrapperRule(wrapper string) *InstFuncRule {
+	return &InstFuncRule{
+		InstBaseRule: InstBaseRule{
+			Name:           fmt.Sprintf("%s#%s", r.Name, wrapper),
+			Target:         r.Target,
+			Version:        r.Version,
+			Order:          r.Order,
+			BuildCondition: r.BuildCondition,
+		},
+		Func:   wrapper,
+		Before: r.Before,
+		After:  r.After,
+		Path:   r.Path,
+	}
+}
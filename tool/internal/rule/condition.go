@@ -0,0 +1,205 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"go/build/constraint"
+	"go/version"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// -----------------------------------------------------------------------------
+// Build Conditions
+//
+// Rules that depend on unexported details of their targets, such as the runtime
+// rules referencing local variables of runtime.newproc1, are only valid for some
+// toolchains and platforms. A rule may restrict itself to builds matching all of
+// the following conditions:
+//
+//	go: ">=1.23,<1.26"        # The Go toolchain version
+//	goos: "linux,darwin"      # The target operating systems
+//	goarch: "amd64,arm64"     # The target architectures
+//	tags: "cgo && !purego"    # A build constraint expression as in //go:build
+//
+// A rule may also declare variants, i.e. a list of partial rules overriding its
+// fields, typically one per range of toolchain versions. If a rule is marked as
+// required, the build fails when neither the rule nor any of its variants
+// applies, rather than silently building without the instrumentation.
+
+// BuildCondition restricts a rule to the builds it applies to.
+type BuildCondition struct {
+	Go       string `json:"go,omitempty"     yaml:"go,omitempty"`       // The toolchain version constraint
+	GOOS     string `json:"goos,omitempty"   yaml:"goos,omitempty"`     // The comma-separated GOOS list
+	GOARCH   string `json:"goarch,omitempty" yaml:"goarch,omitempty"`   // The comma-separated GOARCH list
+	Tags     string `json:"tags,omitempty"   yaml:"tags,omitempty"`     // The build constraint expression
+	Required bool   `json:"-"                yaml:"required,omitempty"` // Fail if the rule does not apply
+
+	// VariantOf is the name of the rule declaring this rule as a variant
+	VariantOf string `json:"-" yaml:"-"`
+}
+
+// BuildEnv describes the build that rules are applied to.
+type BuildEnv struct {
+	GoVersion string   // The toolchain version, e.g. "go1.24.3"
+	GOOS      string   // The target operating system
+	GOARCH    string   // The target architecture
+	CgoEnable bool     // Whether cgo is enabled
+	Tags      []string // The build tags given by -tags
+}
+
+// unixOS lists the GOOS values satisfying the "unix" build tag.
+//
+//nolint:gochecknoglobals // read-only, a slice can not be a constant
+var unixOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos",
+	"ios", "linux", "netbsd", "openbsd", "solaris",
+}
+
+// HasTag reports whether the build tag is satisfied by the build, following the
+// rules of go/build: GOOS, GOARCH, the OS implied by GOOS, "unix", "cgo", release
+// tags such as "go1.21" and custom tags given by -tags.
+func (env *BuildEnv) HasTag(tag string) bool {
+	switch {
+	case tag == env.GOOS || tag == env.GOARCH:
+		return true
+	case tag == "linux" && env.GOOS == "android",
+		tag == "darwin" && env.GOOS == "ios",
+		tag == "solaris" && env.GOOS == "illumos":
+		return true
+	case tag == "unix":
+		return slices.Contains(unixOS, env.GOOS)
+	case tag == "cgo":
+		return env.CgoEnable
+	case version.IsValid(tag) && tag == version.Lang(tag):
+		return version.Compare(env.GoVersion, tag) >= 0
+	default:
+		return slices.Contains(env.Tags, tag)
+	}
+}
+
+// goVersionConstraint is one comparison of a toolchain version constraint.
+type goVersionConstraint struct {
+	op      string
+	version string
+}
+
+// parseGoVersionConstraint parses a comma-separated list of comparisons, e.g.
+// ">=1.23,<1.26". Versions may be written with or without the "go" prefix.
+func parseGoVersionConstraint(s string) ([]goVersionConstraint, error) {
+	cons := make([]goVersionConstraint, 0)
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "="
+		for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if rest, ok := strings.CutPrefix(part, candidate); ok {
+				op, part = candidate, strings.TrimSpace(rest)
+				break
+			}
+		}
+		v := "go" + strings.TrimPrefix(part, "go")
+		if !version.IsValid(v) {
+			return nil, ex.Newf("invalid go version %q in %q", part, s)
+		}
+		cons = append(cons, goVersionConstraint{op: op, version: v})
+	}
+	return cons, nil
+}
+
+func (c goVersionConstraint) match(goVersion string) bool {
+	// A language version such as "1.24" stands for all of its releases, i.e.
+	// "<=1.24" includes go1.24.3 and "<1.24" excludes go1.24rc1
+	if c.version == version.Lang(c.version) {
+		goVersion = version.Lang(goVersion)
+	}
+	cmp := version.Compare(goVersion, c.version)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// IsUnconditional reports whether the rule applies to all builds.
+func (bc *BuildCondition) IsUnconditional() bool {
+	return bc.Go == "" && bc.GOOS == "" && bc.GOARCH == "" && bc.Tags == ""
+}
+
+// ValidateCondition checks the syntax of the conditions.
+func (bc *BuildCondition) ValidateCondition() error {
+	if bc.Go != "" {
+		if _, err := parseGoVersionConstraint(bc.Go); err != nil {
+			return err
+		}
+	}
+	if bc.Tags != "" {
+		if _, err := constraint.Parse("//go:build " + bc.Tags); err != nil {
+			return ex.Wrapf(err, "invalid tags %q", bc.Tags)
+		}
+	}
+	return nil
+}
+
+// MatchBuild reports whether the rule applies to the build.
+func (bc *BuildCondition) MatchBuild(env *BuildEnv) (bool, error) {
+	if bc.Go != "" {
+		cons, err := parseGoVersionConstraint(bc.Go)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range cons {
+			if !c.match(env.GoVersion) {
+				return false, nil
+			}
+		}
+	}
+	if bc.GOOS != "" && !slices.Contains(splitList(bc.GOOS), env.GOOS) {
+		return false, nil
+	}
+	if bc.GOARCH != "" && !slices.Contains(splitList(bc.GOARCH), env.GOARCH) {
+		return false, nil
+	}
+	if bc.Tags != "" {
+		expr, err := constraint.Parse("//go:build " + bc.Tags)
+		if err != nil {
+			return false, ex.Wrapf(err, "invalid tags %q", bc.Tags)
+		}
+		if !expr.Eval(env.HasTag) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ConditionString returns a readable form of the conditions for messages.
+func (bc *BuildCondition) ConditionString() string {
+	parts := make([]string, 0)
+	for _, kv := range [][2]string{{"go", bc.Go}, {"goos", bc.GOOS}, {"goarch", bc.GOARCH}, {"tags", bc.Tags}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+": "+kv[1])
+		}
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,90 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchBuild(t *testing.T) {
+	env := &BuildEnv{
+		GoVersion: "go1.25.3",
+		GOOS:      "linux",
+		GOARCH:    "amd64",
+		CgoEnable: true,
+		Tags:      []string{"netgo"},
+	}
+	tests := []struct {
+		name      string
+		condition BuildCondition
+		expected  bool
+	}{
+		{"unconditional", BuildCondition{}, true},
+		{"go range", BuildCondition{Go: ">=1.23,<1.26"}, true},
+		{"go range excluded", BuildCondition{Go: ">=1.23,<1.25"}, false},
+		{"go language version includes patches", BuildCondition{Go: "<=1.25"}, true},
+		{"go exact release", BuildCondition{Go: "go1.25.3"}, true},
+		{"go not equal", BuildCondition{Go: "!=1.25"}, false},
+		{"goos list", BuildCondition{GOOS: "darwin, linux"}, true},
+		{"goos excluded", BuildCondition{GOOS: "windows"}, false},
+		{"goarch excluded", BuildCondition{GOARCH: "arm64"}, false},
+		{"tags", BuildCondition{Tags: "unix && cgo && netgo"}, true},
+		{"release tags", BuildCondition{Tags: "go1.24 && !go1.26"}, true},
+		{"tags excluded", BuildCondition{Tags: "!netgo || purego"}, false},
+		{"all conditions", BuildCondition{Go: ">=1.25", GOOS: "linux", GOARCH: "amd64", Tags: "linux"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.condition.ValidateCondition())
+			ok, err := tt.condition.MatchBuild(env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ok)
+		})
+	}
+}
+
+func TestBuildEnvHasTag(t *testing.T) {
+	tests := []struct {
+		goos     string
+		tag      string
+		expected bool
+	}{
+		{"linux", "linux", true},
+		{"android", "android", true},
+		{"android", "linux", true},
+		{"linux", "android", false},
+		{"ios", "darwin", true},
+		{"darwin", "ios", false},
+		{"illumos", "solaris", true},
+		{"solaris", "illumos", false},
+		{"android", "unix", true},
+		{"windows", "unix", false},
+	}
+	for _, tt := range tests {
+		env := &BuildEnv{GOOS: tt.goos, GOARCH: "arm64"}
+		assert.Equal(t, tt.expected, env.HasTag(tt.tag), "%s on %s", tt.tag, tt.goos)
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	for _, bc := range []BuildCondition{
+		{Go: ">=1.x"},
+		{Go: ">=1.23,"},
+		{Go: "~1.23"},
+		{Tags: "linux &&"},
+		{Tags: "a b"},
+	} {
+		require.Error(t, bc.ValidateCondition(), "%+v", bc)
+	}
+}
+
+func TestConditionString(t *testing.T) {
+	bc := BuildCondition{Go: ">=1.23", GOOS: "linux", Tags: "cgo"}
+	assert.Equal(t, "{go: >=1.23, goos: linux, tags: cgo}", bc.ConditionString())
+	assert.False(t, bc.IsUnconditional())
+	assert.True(t, (&BuildCondition{Required: true}).IsUnconditional())
+}
@@ -7,7 +7,6 @@ import (
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
-	"gopkg.in/yaml.v3"
 )
 
 // InstFileRule represents a rule that allows adding a new file to the target
@@ -29,8 +28,8 @@ type InstFileRule struct {
 // NewInstFileRule loads and validates an InstFileRule from YAML data.
 func NewInstFileRule(data []byte, name string) (*InstFileRule, error) {
 	var r InstFileRule
-	if err := yaml.Unmarshal(data, &r); err != nil {
-		return nil, ex.Wrap(err)
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
 	}
 	if r.Name == "" {
 		r.Name = name
@@ -4,10 +4,10 @@
 package rule
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
-	"gopkg.in/yaml.v3"
 )
 
 // InstFuncRule represents a rule that guides hook function injection into
@@ -21,21 +21,30 @@ import (
 //		recv: "*RecvType"
 //		before: "Foo"
 //		path: "github.com/foo/bar/hook_rule"
+//
+// The around hook wraps the target function body instead, it runs the body by
+// calling the proceed callback it receives, i.e. func(ictx HookContext, proceed
+// func()), and can not be combined with the before and after hooks.
+//
+// The func and recv fields may also be glob patterns or regular expressions,
+// see FuncSelector for details.
 type InstFuncRule struct {
 	InstBaseRule `yaml:",inline"`
 
-	Func   string `json:"func"   yaml:"func"`   // The name of the target func to be instrumented
-	Recv   string `json:"recv"   yaml:"recv"`   // The name of the receiver type
-	Before string `json:"before" yaml:"before"` // The function we inject at the target function entry
-	After  string `json:"after"  yaml:"after"`  // The function we inject at the target function exit
-	Path   string `json:"path"   yaml:"path"`   // The module path where hook code is located
+	Func         string `json:"func"                    yaml:"func"`          // The target func name or selector
+	Recv         string `json:"recv"                    yaml:"recv"`          // The name of the receiver type
+	ExportedOnly bool   `json:"exported_only,omitempty" yaml:"exported_only"` // Only select exported functions
+	Before       string `json:"before"                  yaml:"before"`        // The hook at the target function entry
+	After        string `json:"after"                   yaml:"after"`         // The hook at the target function exit
+	Around       string `json:"around,omitempty"        yaml:"around"`        // The hook wrapping the target function body
+	Path         string `json:"path"                    yaml:"path"`          // The module path of the hook code
 }
 
 // NewInstFuncRule loads and validates an InstFuncRule from YAML data.
 func NewInstFuncRule(data []byte, name string) (*InstFuncRule, error) {
 	var r InstFuncRule
-	if err := yaml.Unmarshal(data, &r); err != nil {
-		return nil, ex.Wrap(err)
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
 	}
 	if r.Name == "" {
 		r.Name = name
@@ -50,8 +59,35 @@ func (r *InstFuncRule) validate() error {
 	if strings.TrimSpace(r.Func) == "" {
 		return ex.Newf("func cannot be empty")
 	}
-	if r.Before == "" && r.After == "" {
-		return ex.Newf("before or after must be set")
+	if r.Before == "" && r.After == "" && r.Around == "" {
+		return ex.Newf("before, after or around must be set")
+	}
+	if r.Around != "" && (r.Before != "" || r.After != "") {
+		return ex.Newf("around can not be combined with before or after")
+	}
+	if _, err := r.Selector(); err != nil {
+		return err
 	}
 	return nil
 }
+
+// Selector returns the selector of functions that the rule applies to.
+func (r *InstFuncRule) Selector() (*FuncSelector, error) {
+	return NewFuncSelector(r.Func, r.Recv, r.ExportedOnly)
+}
+
+// QualifiedFuncName returns the readable name of the target function.
+func (r *InstFuncRule) QualifiedFuncName() string {
+	return QualifiedFuncName(r.Func, r.Recv)
+}
+
+// Instantiate returns a copy of the rule that applies to exactly one function,
+// i.e. the function fn declared with receiver recv that is selected by the rule.
+func (r *InstFuncRule) Instantiate(fn, recv string) *InstFuncRule {
+	c := *r
+	c.Name = fmt.Sprintf("%s#%s", r.Name, QualifiedFuncName(fn, recv))
+	c.Func = fn
+	c.Recv = recv
+	c.ExportedOnly = false
+	return &c
+}
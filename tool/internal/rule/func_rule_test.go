@@ -0,0 +1,54 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstFuncRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{
+			name: "before",
+			yaml: "target: main\nfunc: Foo\nbefore: H\npath: example.com/hooks\n",
+		},
+		{
+			name: "around",
+			yaml: "target: main\nfunc: Foo\naround: H\npath: example.com/hooks\n",
+		},
+		{
+			name:   "no hook",
+			yaml:   "target: main\nfunc: Foo\npath: example.com/hooks\n",
+			errMsg: "before, after or around must be set",
+		},
+		{
+			name:   "around with before",
+			yaml:   "target: main\nfunc: Foo\nbefore: H\naround: H\npath: example.com/hooks\n",
+			errMsg: "around can not be combined with before or after",
+		},
+		{
+			name:   "around with after",
+			yaml:   "target: main\nfunc: Foo\nafter: H\naround: H\npath: example.com/hooks\n",
+			errMsg: "around can not be combined with before or after",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstFuncRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "r", r.Name)
+		})
+	}
+}
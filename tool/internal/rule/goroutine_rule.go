@@ -0,0 +1,90 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstGoroutineRule represents a rule that propagates a context into the
+// goroutines started by the go statements of the target package, without
+// patching the runtime. The capture hook is called by the goroutine executing
+// the go statement, and the restore hook is called first thing by the new
+// goroutine with the captured value. For example, if we want the goroutines
+// started by the functions of our worker package to continue the trace of
+// their parents, we can define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "github.com/foo/bar/worker"
+//		goroutine: "*"
+//		capture: "CaptureContext"
+//		restore: "RestoreContext"
+//		path: "github.com/foo/bar/hook_rule"
+//
+// The goroutine field selects the functions whose go statements are rewritten
+// by their names, including methods, see NameSelector for details.
+type InstGoroutineRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Goroutine string `json:"goroutine" yaml:"goroutine"` // The functions whose go statements are rewritten
+	Capture   string `json:"capture"   yaml:"capture"`   // The hook capturing the context, func() interface{}
+	Restore   string `json:"restore"   yaml:"restore"`   // The hook restoring the context, func(interface{})
+	Path      string `json:"path"      yaml:"path"`      // The module path of the hook code
+
+	// The functions left out, by qualified names, e.g. (*Repo).Get
+	Skip []string `json:"skip,omitempty" yaml:"-"`
+}
+
+// NewInstGoroutineRule loads and validates an InstGoroutineRule from YAML data.
+func NewInstGoroutineRule(data []byte, name string) (*InstGoroutineRule, error) {
+	var r InstGoroutineRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid goroutine rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstGoroutineRule) validate() error {
+	if strings.TrimSpace(r.Goroutine) == "" {
+		return ex.Newf("goroutine cannot be empty")
+	}
+	if _, err := r.Selector(); err != nil {
+		return err
+	}
+	for _, hook := range []string{r.Capture, r.Restore} {
+		if !token.IsIdentifier(hook) || hook == "_" {
+			return ex.Newf("hook %q is not a function name", hook)
+		}
+	}
+	if r.Capture == r.Restore {
+		return ex.Newf("capture and restore must be different hooks")
+	}
+	if strings.TrimSpace(r.Path) == "" {
+		return ex.Newf("path cannot be empty")
+	}
+	return nil
+}
+
+// Skips reports whether the function fn declared with receiver recv is left
+// out, even if it's selected.
+func (r *InstGoroutineRule) Skips(fn, recv string) bool {
+	return slices.Contains(r.Skip, QualifiedFuncName(fn, recv))
+}
+
+// Selector returns the selector of the functions whose go statements are
+// rewritten.
+func (r *InstGoroutineRule) Selector() (*NameSelector, error) {
+	return NewNameSelector(r.Goroutine)
+}
@@ -0,0 +1,78 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstGoroutineRule(t *testing.T) {
+	const hooks = "capture: Capture\nrestore: Restore\npath: example.com/hooks\n"
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{
+			name: "all functions",
+			yaml: "target: main\ngoroutine: '*'\n" + hooks,
+		},
+		{
+			name: "selected functions",
+			yaml: "target: main\ngoroutine: 'Serve*'\n" + hooks,
+		},
+		{
+			name:   "no goroutine",
+			yaml:   "target: main\n" + hooks,
+			errMsg: "goroutine cannot be empty",
+		},
+		{
+			name:   "invalid selector",
+			yaml:   "target: main\ngoroutine: '/[/'\n" + hooks,
+			errMsg: "invalid regular expression",
+		},
+		{
+			name:   "invalid capture",
+			yaml:   "target: main\ngoroutine: '*'\ncapture: '1'\nrestore: Restore\npath: example.com/hooks\n",
+			errMsg: `hook "1" is not a function name`,
+		},
+		{
+			name:   "no restore",
+			yaml:   "target: main\ngoroutine: '*'\ncapture: Capture\npath: example.com/hooks\n",
+			errMsg: `hook "" is not a function name`,
+		},
+		{
+			name:   "same hooks",
+			yaml:   "target: main\ngoroutine: '*'\ncapture: Hook\nrestore: Hook\npath: example.com/hooks\n",
+			errMsg: "capture and restore must be different hooks",
+		},
+		{
+			name:   "no path",
+			yaml:   "target: main\ngoroutine: '*'\ncapture: Capture\nrestore: Restore\n",
+			errMsg: "path cannot be empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstGoroutineRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "r", r.Name)
+		})
+	}
+}
+
+func TestGoroutineRuleSkips(t *testing.T) {
+	r := &InstGoroutineRule{Goroutine: "*", Skip: []string{"(*Repo).Get", "Open"}}
+	assert.True(t, r.Skips("Get", "*Repo"))
+	assert.True(t, r.Skips("Open", ""))
+	assert.False(t, r.Skips("Get", "Repo"))
+	assert.False(t, r.Skips("Close", ""))
+}
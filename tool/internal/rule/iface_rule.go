@@ -0,0 +1,95 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstInterfaceRule represents a rule that selects methods by the interface
+// they implement rather than by their names. Every method of the target package
+// whose receiver type implements the interface is instrumented as if it were
+// selected by a func rule. For example, if we want to inject hooks into every
+// ServeHTTP method of http.Handler implementations, we can define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "github.com/foo/bar/handlers"
+//		interface: "net/http.Handler"
+//		func: "ServeHTTP"
+//		before: "Foo"
+//		path: "github.com/foo/bar/hook_rule"
+type InstInterfaceRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Interface string `json:"interface" yaml:"interface"` // The qualified interface, e.g. "io.Reader"
+	Func      string `json:"func"      yaml:"func"`      // The interface method to be instrumented
+	Before    string `json:"before"    yaml:"before"`    // The hook at the target function entry
+	After     string `json:"after"     yaml:"after"`     // The hook at the target function exit
+	Path      string `json:"path"      yaml:"path"`      // The module path of the hook code
+}
+
+// NewInstInterfaceRule loads and validates an InstInterfaceRule from YAML data.
+func NewInstInterfaceRule(data []byte, name string) (*InstInterfaceRule, error) {
+	var r InstInterfaceRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid interface rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstInterfaceRule) validate() error {
+	if strings.TrimSpace(r.Interface) == "" {
+		return ex.Newf("interface cannot be empty")
+	}
+	if _, name := r.SplitInterface(); name == "" {
+		return ex.Newf("interface %q has no type name", r.Interface)
+	}
+	if strings.TrimSpace(r.Func) == "" {
+		return ex.Newf("func cannot be empty")
+	}
+	if r.Before == "" && r.After == "" {
+		return ex.Newf("before or after must be set")
+	}
+	return nil
+}
+
+// SplitInterface splits the qualified interface into its package path and type
+// name, e.g. "net/http.Handler" -> ("net/http", "Handler"). The package path is
+// empty for predeclared interfaces such as "error".
+func (r *InstInterfaceRule) SplitInterface() (string, string) {
+	idx := strings.LastIndex(r.Interface, ".")
+	if idx == -1 {
+		return "", r.Interface
+	}
+	return r.Interface[:idx], r.Interface[idx+1:]
+}
+
+// Instantiate returns a func rule that applies to the method fn declared with
+// receiver recv, which implements the interface method of the rule.
+func (r *InstInterfaceRule) Instantiate(fn, recv string) *InstFuncRule {
+	return &InstFuncRule{
+		InstBaseRule: InstBaseRule{
+			Name:           fmt.Sprintf("%s#%s", r.Name, QualifiedFuncName(fn, recv)),
+			Target:         r.Target,
+			Version:        r.Version,
+			Order:          r.Order,
+			BuildCondition: r.BuildCondition,
+		},
+		Func:   fn,
+		Recv:   recv,
+		Before: r.Before,
+		After:  r.After,
+		Path:   r.Path,
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"go/token"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstMethodRule represents a rule that adds new methods to a named type of
+// the target package, e.g. to make it satisfy an interface. The methods are
+// copied from the hook package, where they are declared on a stand-in type
+// of the same name, and their receivers are rewritten to the target type. For
+// example, if we want to add an Unwrap method to the target type Bar, we can
+// define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "main"
+//		type: "Bar"
+//		methods: ["Unwrap"]
+//		path: "github.com/foo/bar/hook_rule"
+//
+// The recv field names the stand-in type if it differs from the target type.
+type InstMethodRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Type    string   `json:"type"           yaml:"type"`           // The named type to add the methods to
+	Methods []string `json:"methods"        yaml:"methods"`        // The names of the methods to be added
+	Recv    string   `json:"recv,omitempty" yaml:"recv,omitempty"` // The stand-in type in the hook code
+	Path    string   `json:"path"           yaml:"path"`           // The module path of the hook code
+}
+
+// NewInstMethodRule loads and validates an InstMethodRule from YAML data.
+func NewInstMethodRule(data []byte, name string) (*InstMethodRule, error) {
+	var r InstMethodRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid method rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstMethodRule) validate() error {
+	if !token.IsIdentifier(r.Type) {
+		return ex.Newf("type %q is not a type name", r.Type)
+	}
+	if r.Recv != "" && !token.IsIdentifier(r.Recv) {
+		return ex.Newf("recv %q is not a type name", r.Recv)
+	}
+	if len(r.Methods) == 0 {
+		return ex.Newf("methods cannot be empty")
+	}
+	for i, m := range r.Methods {
+		if !token.IsIdentifier(m) || m == "_" {
+			return ex.Newf("method %q is not a method name", m)
+		}
+		if slices.Contains(r.Methods[:i], m) {
+			return ex.Newf("method %q is listed twice", m)
+		}
+	}
+	if strings.TrimSpace(r.Path) == "" {
+		return ex.Newf("path cannot be empty")
+	}
+	return nil
+}
+
+// StandIn returns the name of the type declaring the methods in the hook code.
+func (r *InstMethodRule) StandIn() string {
+	if r.Recv != "" {
+		return r.Recv
+	}
+	return r.Type
+}
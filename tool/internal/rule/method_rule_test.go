@@ -0,0 +1,68 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstMethodRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		standIn string
+		errMsg  string
+	}{
+		{
+			name:    "same stand-in",
+			yaml:    "target: main\ntype: Error\nmethods: [Unwrap]\npath: example.com/hooks\n",
+			standIn: "Error",
+		},
+		{
+			name:    "renamed stand-in",
+			yaml:    "target: main\ntype: Error\nrecv: ErrorStub\nmethods: [Unwrap, Clone]\npath: example.com/hooks\n",
+			standIn: "ErrorStub",
+		},
+		{
+			name:   "pointer type",
+			yaml:   "target: main\ntype: '*Error'\nmethods: [Unwrap]\npath: example.com/hooks\n",
+			errMsg: `type "*Error" is not a type name`,
+		},
+		{
+			name:   "no methods",
+			yaml:   "target: main\ntype: Error\npath: example.com/hooks\n",
+			errMsg: "methods cannot be empty",
+		},
+		{
+			name:   "invalid method",
+			yaml:   "target: main\ntype: Error\nmethods: [Un-wrap]\npath: example.com/hooks\n",
+			errMsg: `method "Un-wrap" is not a method name`,
+		},
+		{
+			name:   "duplicate method",
+			yaml:   "target: main\ntype: Error\nmethods: [Unwrap, Unwrap]\npath: example.com/hooks\n",
+			errMsg: `method "Unwrap" is listed twice`,
+		},
+		{
+			name:   "no path",
+			yaml:   "target: main\ntype: Error\nmethods: [Unwrap]\n",
+			errMsg: "path cannot be empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstMethodRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.standIn, r.StandIn())
+			assert.Equal(t, "r", r.GetName())
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstMetricRule represents a rule that records the RED metrics of a function,
+// i.e. the calls, the errors and the durations, without any hook code. For
+// example, if we want to measure the Get method of the Repo type, we can define
+// a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "github.com/foo/bar/store"
+//		metric: "store.repo.get"
+//		func: "Get"
+//		recv: "*Repo"
+//		unit: "ms"
+//		attributes:
+//			repo.table: "table"
+//
+// The calls are counted by the store.repo.get.calls counter, the durations are
+// recorded by the store.repo.get.duration histogram, and the calls returning a
+// non-nil error result are counted by the store.repo.get.errors counter. Like
+// span names, the metric name may refer to the function by placeholders, and
+// like func rules, the func and recv fields may be glob patterns or regular
+// expressions. Attributes take the values of the parameters by their names.
+type InstMetricRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Metric       string `json:"metric"                  yaml:"metric"`        // The prefix of the instrument names
+	Unit         string `json:"unit,omitempty"          yaml:"unit"`          // The unit of the durations, s by default
+	Func         string `json:"func"                    yaml:"func"`          // The target func name or selector
+	Recv         string `json:"recv"                    yaml:"recv"`          // The name of the receiver type
+	ExportedOnly bool   `json:"exported_only,omitempty" yaml:"exported_only"` // Only select exported functions
+
+	// The attributes of the measurements, attribute key -> parameter name
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes"`
+}
+
+// metricUnits lists the units of durations, the first one is the default.
+//
+//nolint:gochecknoglobals // read-only, its first unit is the default
+var metricUnits = []string{"s", "ms"}
+
+// NewInstMetricRule loads and validates an InstMetricRule from YAML data.
+func NewInstMetricRule(data []byte, name string) (*InstMetricRule, error) {
+	var r InstMetricRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid metric rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstMetricRule) validate() error {
+	if strings.TrimSpace(r.Metric) == "" {
+		return ex.Newf("metric cannot be empty")
+	}
+	if err := checkPlaceholders(r.Metric, "metric name"); err != nil {
+		return err
+	}
+	if r.Unit != "" && !slices.Contains(metricUnits, r.Unit) {
+		return ex.Newf("unit must be one of %s", strings.Join(metricUnits, ", "))
+	}
+	if err := checkAttributes(r.Attributes, "a parameter name"); err != nil {
+		return err
+	}
+	if _, err := r.Selector(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Selector returns the selector of functions that the rule applies to.
+func (r *InstMetricRule) Selector() (*FuncSelector, error) {
+	return NewFuncSelector(r.Func, r.Recv, r.ExportedOnly)
+}
+
+// MetricName returns the prefix of the instrument names of the function fn
+// declared with receiver recv in package pkg, see expandPlaceholders.
+func (r *InstMetricRule) MetricName(pkg, fn, recv string) string {
+	return expandPlaceholders(r.Metric, pkg, fn, recv)
+}
+
+// MetricUnit returns the unit of the durations, which is seconds by default.
+func (r *InstMetricRule) MetricUnit() string {
+	if r.Unit == "" {
+		return metricUnits[0]
+	}
+	return r.Unit
+}
@@ -0,0 +1,64 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstMetricRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		unit   string
+		errMsg string
+	}{
+		{
+			name: "function",
+			yaml: "target: main\nmetric: '{package}.{func}'\nfunc: Get\n",
+			unit: "s",
+		},
+		{
+			name: "selected methods with attributes",
+			yaml: "target: main\nmetric: store.repo\nfunc: '*'\nrecv: '*Repo'\nunit: ms\n" +
+				"attributes:\n  repo.table: table\n",
+			unit: "ms",
+		},
+		{
+			name:   "no metric",
+			yaml:   "target: main\nfunc: Get\n",
+			errMsg: "metric cannot be empty",
+		},
+		{
+			name:   "unknown placeholder",
+			yaml:   "target: main\nmetric: '{method}'\nfunc: Get\n",
+			errMsg: "unknown placeholder {method} in metric name",
+		},
+		{
+			name:   "unknown unit",
+			yaml:   "target: main\nmetric: get\nfunc: Get\nunit: us\n",
+			errMsg: "unit must be one of s, ms",
+		},
+		{
+			name:   "attribute of expression",
+			yaml:   "target: main\nmetric: get\nfunc: Get\nattributes:\n  repo.table: t.Name\n",
+			errMsg: `attribute repo.table refers to "t.Name", which is not a parameter name`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstMetricRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "r", r.Name)
+			assert.Equal(t, tt.unit, r.MetricUnit())
+		})
+	}
+}
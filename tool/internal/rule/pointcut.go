@@ -0,0 +1,391 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// -----------------------------------------------------------------------------
+// Pointcuts and Advice
+//
+// Besides the flat rules keyed by their names, a rule file may contain an
+// "instrumentation" block as described in docs/ux-design.md. Each item of the
+// block pairs a pointcut, which selects declarations, with a list of advice,
+// which is applied to every selected declaration:
+//
+//	instrumentation:
+//		trace_handlers:
+//			pointcut:
+//				all-of:
+//					- import-path: "github.com/foo/bar/..."
+//					- not:
+//						function: "init*"
+//					- directive: "otel:trace"
+//			advice:
+//				- before: "github.com/foo/bar/hooks.Before"
+//				- after: "github.com/foo/bar/hooks.After"
+//
+// Pointcuts are predicates over declarations, combined with all-of, any-of and
+// not. Each selected declaration gets ordinary func, raw or struct rules, so
+// the instrument phase does not know about pointcuts at all.
+
+// InstrumentationKey is the top-level key of the instrumentation block in rule
+// files, and MetaKey is the key of its optional metadata block.
+const (
+	InstrumentationKey = "instrumentation"
+	MetaKey            = "meta"
+)
+
+// JoinPoint describes a declaration that a pointcut may select, which is either
+// a function declaration or a struct type declaration.
+type JoinPoint struct {
+	ImportPath string   // The import path of the package
+	File       string   // The base name of the file
+	Func       string   // The function name, empty for structs
+	Recv       string   // The receiver type of the function, e.g. "*Repo"
+	Struct     string   // The struct type name, empty for functions
+	Directives []string // The directives in the doc comment, e.g. "otel:trace"
+}
+
+// Pointcut is a predicate selecting declarations. Exactly one of its fields is
+// set. Name patterns are selectors, see NameSelector for details, except for
+// import paths, which are package patterns as rule targets, see
+// MatchPackagePattern, or regular expressions.
+type Pointcut struct {
+	AllOf      []*Pointcut `yaml:"all-of"`
+	AnyOf      []*Pointcut `yaml:"any-of"`
+	Not        *Pointcut   `yaml:"not"`
+	ImportPath string      `yaml:"import-path"` // The package import path
+	Function   string      `yaml:"function"`    // The function name
+	Receiver   string      `yaml:"receiver"`    // The receiver type, "*" prefixed for pointers
+	File       string      `yaml:"file"`        // The base name of the file
+	Directive  string      `yaml:"directive"`   // A directive of the doc comment, e.g. "otel:trace"
+	Struct     string      `yaml:"struct"`      // The struct type name
+
+	selector *NameSelector
+	funcSel  *FuncSelector
+}
+
+// tristate is the result of evaluating a pointcut with partial information.
+type tristate int
+
+const (
+	matchNo tristate = iota
+	matchMaybe
+	matchYes
+)
+
+func boolToTristate(b bool) tristate {
+	if b {
+		return matchYes
+	}
+	return matchNo
+}
+
+func (pc *Pointcut) compile() error {
+	set := 0
+	for _, s := range []bool{
+		pc.AllOf != nil, pc.AnyOf != nil, pc.Not != nil, pc.ImportPath != "",
+		pc.Function != "", pc.Receiver != "", pc.File != "", pc.Directive != "",
+		pc.Struct != "",
+	} {
+		if s {
+			set++
+		}
+	}
+	if set != 1 {
+		return ex.Newf("pointcut must have exactly one predicate, got %d", set)
+	}
+	var err error
+	switch {
+	case pc.AllOf != nil || pc.AnyOf != nil:
+		operands := slices.Concat(pc.AllOf, pc.AnyOf)
+		if len(operands) == 0 {
+			return ex.Newf("all-of and any-of require at least one pointcut")
+		}
+		for _, operand := range operands {
+			if err = operand.compile(); err != nil {
+				return err
+			}
+		}
+	case pc.Not != nil:
+		return pc.Not.compile()
+	case pc.ImportPath != "":
+		if !isRegexpSelector(pc.ImportPath) && isGlobSelector(pc.ImportPath) {
+			return ex.Newf("import path %q is not a package pattern, use %q as wildcard",
+				pc.ImportPath, packageWildcard)
+		}
+		if !IsPackagePattern(pc.ImportPath) {
+			pc.selector, err = NewNameSelector(pc.ImportPath)
+		}
+	case pc.Function != "":
+		pc.selector, err = NewNameSelector(pc.Function)
+	case pc.Receiver != "":
+		pc.funcSel, err = NewFuncSelector("*", pc.Receiver, false)
+	case pc.File != "":
+		pc.selector, err = NewNameSelector(pc.File)
+	case pc.Struct != "":
+		pc.selector, err = NewNameSelector(pc.Struct)
+	}
+	return err
+}
+
+// eval evaluates the pointcut against the join point. If only the package is
+// known, i.e. jp has no declaration, predicates on declarations are unknown.
+func (pc *Pointcut) eval(jp *JoinPoint, pkgOnly bool) tristate {
+	switch {
+	case pc.AllOf != nil:
+		result := matchYes
+		for _, operand := range pc.AllOf {
+			result = min(result, operand.eval(jp, pkgOnly))
+		}
+		return result
+	case pc.AnyOf != nil:
+		result := matchNo
+		for _, operand := range pc.AnyOf {
+			result = max(result, operand.eval(jp, pkgOnly))
+		}
+		return result
+	case pc.Not != nil:
+		return matchYes - pc.Not.eval(jp, pkgOnly)
+	case pc.ImportPath != "":
+		if pc.selector == nil {
+			return boolToTristate(MatchPackagePattern(pc.ImportPath, jp.ImportPath))
+		}
+		return boolToTristate(pc.selector.Match(jp.ImportPath))
+	}
+	if pkgOnly {
+		return matchMaybe
+	}
+	switch {
+	case pc.Function != "":
+		return boolToTristate(jp.Func != "" && pc.selector.Match(jp.Func))
+	case pc.Receiver != "":
+		return boolToTristate(jp.Func != "" && pc.funcSel.Match(jp.Func, jp.Recv))
+	case pc.File != "":
+		return boolToTristate(pc.selector.Match(jp.File))
+	case pc.Directive != "":
+		return boolToTristate(slices.Contains(jp.Directives, pc.Directive))
+	case pc.Struct != "":
+		return boolToTristate(jp.Struct != "" && pc.selector.Match(jp.Struct))
+	default:
+		return matchNo
+	}
+}
+
+func (pc *Pointcut) usesDirective() bool {
+	if pc.Directive != "" {
+		return true
+	}
+	if pc.Not != nil && pc.Not.usesDirective() {
+		return true
+	}
+	return slices.ContainsFunc(slices.Concat(pc.AllOf, pc.AnyOf), (*Pointcut).usesDirective)
+}
+
+// Advice is a transformation applied to every declaration selected by the
+// pointcut. Exactly one of its fields is set. Hooks are qualified by the import
+// path of their package, e.g. "github.com/foo/bar/hooks.Before".
+type Advice struct {
+	Before   string             `yaml:"before"`    // The hook at the function entry
+	After    string             `yaml:"after"`     // The hook at the function exit
+	Raw      string             `yaml:"raw"`       // The raw code at the function entry
+	AddField []*InstStructField `yaml:"add-field"` // The fields to be added to the struct
+}
+
+func (a *Advice) validate() error {
+	set := 0
+	for _, s := range []bool{a.Before != "", a.After != "", a.Raw != "", a.AddField != nil} {
+		if s {
+			set++
+		}
+	}
+	if set != 1 {
+		return ex.Newf("advice must have exactly one of before, after, raw and add-field")
+	}
+	for _, hook := range []string{a.Before, a.After} {
+		if hook == "" {
+			continue
+		}
+		if pkgPath, name := SplitHook(hook); pkgPath == "" || name == "" {
+			return ex.Newf("hook %q is not qualified by its package path", hook)
+		}
+	}
+	for _, field := range a.AddField {
+		if err := field.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitHook splits the qualified hook into its package path and name, e.g.
+// "github.com/foo/bar/hooks.Before" -> ("github.com/foo/bar/hooks", "Before").
+func SplitHook(hook string) (string, string) {
+	idx := strings.LastIndex(hook, ".")
+	if idx == -1 || strings.LastIndex(hook, "/") > idx {
+		return "", hook
+	}
+	return hook[:idx], hook[idx+1:]
+}
+
+// InstPointcutRule represents an item of the instrumentation block, which
+// applies a list of advice to all declarations selected by a pointcut. Unlike
+// other rules, it has no target, the pointcut decides which packages are
+// instrumented.
+type InstPointcutRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Description string    `json:"description" yaml:"description"` // The description for end-users
+	Pointcut    *Pointcut `json:"-"           yaml:"pointcut"`    // The selected declarations
+	Advice      []*Advice `json:"-"           yaml:"advice"`      // The transformations of them
+}
+
+// NewInstPointcutRules loads and validates the items of an instrumentation
+// block from YAML data, sorted by their names.
+func NewInstPointcutRules(data []byte) ([]*InstPointcutRule, error) {
+	var items map[string]*InstPointcutRule
+	if err := decodeStrict(data, &items); err != nil {
+		return nil, err
+	}
+	rules := make([]*InstPointcutRule, 0, len(items))
+	for _, name := range slices.Sorted(maps.Keys(items)) {
+		r := items[name]
+		if r == nil {
+			return nil, ex.Newf("invalid instrumentation %q: empty item", name)
+		}
+		if r.Name == "" {
+			r.Name = name
+		}
+		if err := r.validate(); err != nil {
+			return nil, ex.Wrapf(err, "invalid instrumentation %q", name)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func (r *InstPointcutRule) validate() error {
+	if r.Target != "" {
+		return ex.Newf("target is not supported, use an import-path pointcut instead")
+	}
+	if r.Pointcut == nil {
+		return ex.Newf("pointcut cannot be empty")
+	}
+	if err := r.Pointcut.compile(); err != nil {
+		return err
+	}
+	if len(r.Advice) == 0 {
+		return ex.Newf("advice requires at least one item")
+	}
+	for _, a := range r.Advice {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MayMatchPackage reports whether any declaration of the package may be
+// selected by the pointcut, which is decided by the import path alone.
+func (r *InstPointcutRule) MayMatchPackage(importPath string) bool {
+	return r.Pointcut.eval(&JoinPoint{ImportPath: importPath}, true) != matchNo
+}
+
+// Match reports whether the declaration is selected by the pointcut.
+func (r *InstPointcutRule) Match(jp *JoinPoint) bool {
+	return r.Pointcut.eval(jp, false) == matchYes
+}
+
+// UsesDirectives reports whether the pointcut selects declarations by their
+// directives, which requires comments to be parsed.
+func (r *InstPointcutRule) UsesDirectives() bool {
+	return r.Pointcut.usesDirective()
+}
+
+// FuncRules instantiates the advice for the selected function. The before and
+// after hooks of the same package are merged into one func rule so that they
+// share the hook context.
+func (r *InstPointcutRule) FuncRules(jp *JoinPoint) ([]*InstFuncRule, []*InstRawRule) {
+	base := InstBaseRule{
+		Name:           fmt.Sprintf("%s#%s", r.Name, QualifiedFuncName(jp.Func, jp.Recv)),
+		Target:         jp.ImportPath,
+		Version:        r.Version,
+		Order:          r.Order,
+		BuildCondition: r.BuildCondition,
+	}
+	funcRules := make([]*InstFuncRule, 0)
+	rawRules := make([]*InstRawRule, 0)
+	byPath := make(map[string]*InstFuncRule)
+	for _, a := range r.Advice {
+		switch {
+		case a.Before != "" || a.After != "":
+			pkgPath, _ := SplitHook(a.Before + a.After)
+			fr, ok := byPath[pkgPath]
+			if !ok {
+				fr = &InstFuncRule{InstBaseRule: base, Func: jp.Func, Recv: jp.Recv, Path: pkgPath}
+				if len(funcRules) > 0 {
+					fr.Name = fmt.Sprintf("%s/%d", base.Name, len(funcRules))
+				}
+				byPath[pkgPath] = fr
+				funcRules = append(funcRules, fr)
+			}
+			if _, name := SplitHook(a.Before); a.Before != "" {
+				fr.Before = name
+			}
+			if _, name := SplitHook(a.After); a.After != "" {
+				fr.After = name
+			}
+		case a.Raw != "":
+			rr := &InstRawRule{InstBaseRule: base, Func: jp.Func, Recv: jp.Recv, Raw: a.Raw}
+			rr.Name = fmt.Sprintf("%s/raw%d", base.Name, len(rawRules))
+			rawRules = append(rawRules, rr)
+		}
+	}
+	return funcRules, rawRules
+}
+
+// StructRule instantiates the add-field advice for the selected struct, or
+// returns nil if there is none.
+func (r *InstPointcutRule) StructRule(jp *JoinPoint) *InstStructRule {
+	fields := make([]*InstStructField, 0)
+	for _, a := range r.Advice {
+		fields = append(fields, a.AddField...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &InstStructRule{
+		InstBaseRule: InstBaseRule{
+			Name:           fmt.Sprintf("%s#%s", r.Name, jp.Struct),
+			Target:         jp.ImportPath,
+			Version:        r.Version,
+			Order:          r.Order,
+			BuildCondition: r.BuildCondition,
+		},
+		Struct:   jp.Struct,
+		NewField: fields,
+	}
+}
+
+// ParseDirective returns the name of the directive in the comment line, e.g.
+// "//otel:trace span" -> "otel:trace", or "" if the line is not a directive.
+// Like Go directives, the name follows "//" immediately and contains a colon.
+func ParseDirective(comment string) string {
+	text, ok := strings.CutPrefix(comment, "//")
+	if !ok || text == "" || text[0] == ' ' || text[0] == '\t' {
+		return ""
+	}
+	name, _, _ := strings.Cut(text, " ")
+	if !strings.Contains(name, ":") {
+		return ""
+	}
+	return name
+}
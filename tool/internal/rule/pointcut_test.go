@@ -0,0 +1,131 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointcutMatch(t *testing.T) {
+	rules, err := NewInstPointcutRules([]byte(`
+trace:
+  pointcut:
+    all-of:
+      - import-path: "example.com/app/..."
+      - not:
+          import-path: "example.com/app/internal"
+      - any-of:
+          - directive: "otel:trace"
+          - all-of:
+              - receiver: "*Repo*"
+              - function: "/^(Get|Put)$/"
+  advice:
+    - before: example.com/hooks.Before
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	r := rules[0]
+	assert.Equal(t, "trace", r.GetName())
+	assert.True(t, r.UsesDirectives())
+
+	assert.True(t, r.MayMatchPackage("example.com/app"))
+	assert.True(t, r.MayMatchPackage("example.com/app/store"))
+	assert.True(t, r.MayMatchPackage("example.com/app/store/sub"))
+	assert.False(t, r.MayMatchPackage("example.com/app/internal"))
+	assert.False(t, r.MayMatchPackage("example.com/application"))
+	assert.False(t, r.MayMatchPackage("example.com/other"))
+
+	store := "example.com/app/store"
+	tests := []struct {
+		jp       JoinPoint
+		expected bool
+	}{
+		{JoinPoint{ImportPath: store, Func: "Get", Recv: "*RepoImpl"}, true},
+		{JoinPoint{ImportPath: store, Func: "Get", Recv: "RepoImpl"}, false},
+		{JoinPoint{ImportPath: store, Func: "List", Recv: "*Repo"}, false},
+		{JoinPoint{ImportPath: store, Func: "Open", Directives: []string{"otel:trace"}}, true},
+		{JoinPoint{ImportPath: store, Struct: "Repo", Directives: []string{"otel:trace"}}, true},
+		{JoinPoint{ImportPath: "example.com/app/internal", Func: "Open", Directives: []string{"otel:trace"}}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, r.Match(&tt.jp), "%+v", tt.jp)
+	}
+}
+
+func TestPointcutInvalid(t *testing.T) {
+	for _, data := range []string{
+		// Two predicates in one pointcut
+		"r: {pointcut: {function: A, file: a.go}, advice: [{raw: x}]}",
+		// No predicate
+		"r: {pointcut: {not: {}}, advice: [{raw: x}]}",
+		// Empty combinator
+		"r: {pointcut: {all-of: []}, advice: [{raw: x}]}",
+		// No advice
+		"r: {pointcut: {function: A}}",
+		// Unqualified hook
+		"r: {pointcut: {function: A}, advice: [{before: Before}]}",
+		// Two kinds of advice in one item
+		"r: {pointcut: {function: A}, advice: [{before: a/b.B, raw: x}]}",
+		// Target is replaced by import-path pointcuts
+		"r: {target: main, pointcut: {function: A}, advice: [{raw: x}]}",
+		// Malformed selector
+		"r: {pointcut: {function: \"/(/\"}, advice: [{raw: x}]}",
+		// Glob rather than package pattern
+		"r: {pointcut: {import-path: \"example.com/*\"}, advice: [{raw: x}]}",
+	} {
+		_, err := NewInstPointcutRules([]byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestPointcutAdvice(t *testing.T) {
+	rules, err := NewInstPointcutRules([]byte(`
+trace:
+  version: v1.0.0
+  pointcut:
+    import-path: example.com/app
+  advice:
+    - before: example.com/hooks.Before
+    - raw: "println()"
+    - after: example.com/hooks.After
+    - after: example.com/other.After
+    - add-field:
+        - {name: span, type: "interface{}"}
+`))
+	require.NoError(t, err)
+	r := rules[0]
+
+	jp := &JoinPoint{ImportPath: "example.com/app", Func: "Get", Recv: "*Repo"}
+	funcRules, rawRules := r.FuncRules(jp)
+	require.Len(t, funcRules, 2)
+	assert.Equal(t, "trace#(*Repo).Get", funcRules[0].GetName())
+	assert.Equal(t, "example.com/app", funcRules[0].GetTarget())
+	assert.Equal(t, "v1.0.0", funcRules[0].GetVersion())
+	assert.Equal(t, "example.com/hooks", funcRules[0].Path)
+	assert.Equal(t, "Before", funcRules[0].Before)
+	assert.Equal(t, "After", funcRules[0].After)
+	assert.Equal(t, "trace#(*Repo).Get/1", funcRules[1].GetName())
+	assert.Equal(t, "example.com/other", funcRules[1].Path)
+	assert.Empty(t, funcRules[1].Before)
+	require.Len(t, rawRules, 1)
+	assert.Equal(t, "println()", rawRules[0].Raw)
+	assert.Equal(t, "*Repo", rawRules[0].Recv)
+
+	sr := r.StructRule(&JoinPoint{ImportPath: "example.com/app", Struct: "Repo"})
+	require.NotNil(t, sr)
+	assert.Equal(t, "Repo", sr.Struct)
+	assert.Equal(t, []*InstStructField{{Name: "span", Type: "interface{}"}}, sr.NewField)
+}
+
+func TestParseDirective(t *testing.T) {
+	assert.Equal(t, "otel:trace", ParseDirective("//otel:trace"))
+	assert.Equal(t, "go:noinline", ParseDirective("//go:noinline"))
+	assert.Equal(t, "otel:span", ParseDirective("//otel:span name=foo"))
+	assert.Empty(t, ParseDirective("// otel:trace"))
+	assert.Empty(t, ParseDirective("//nolint"))
+	assert.Empty(t, ParseDirective("/* otel:trace */"))
+}
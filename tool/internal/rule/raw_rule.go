@@ -4,10 +4,15 @@
 package rule
 
 import (
+	"fmt"
+	"go/token"
+	"maps"
+	"slices"
 	"strings"
 
+	"golang.org/x/mod/module"
+
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
-	"gopkg.in/yaml.v3"
 )
 
 // InstRawRule represents a rule that allows raw Go source code injection into
@@ -20,19 +25,41 @@ import (
 //		func: "Bar"
 //		recv: "*Recv"
 //		raw: "println(\"Hello, World!\")"
+//
+// Like func rules, the func and recv fields may be glob patterns or regular
+// expressions. The raw code may refer to packages that the target file does
+// not import, as long as they are listed in the imports field by their names:
+//
+//	imports:
+//		atomic: "sync/atomic"
 type InstRawRule struct {
 	InstBaseRule `yaml:",inline"`
 
-	Func string `json:"func" yaml:"func"` // The name of the target func to be instrumented
-	Recv string `json:"recv" yaml:"recv"` // The name of the receiver type
-	Raw  string `json:"raw"  yaml:"raw"`  // The raw code to be injected
+	Func         string `json:"func"                    yaml:"func"`          // The target func name or selector
+	Recv         string `json:"recv"                    yaml:"recv"`          // The name of the receiver type
+	ExportedOnly bool   `json:"exported_only,omitempty" yaml:"exported_only"` // Only select exported functions
+	Raw          string `json:"raw"                     yaml:"raw"`           // The raw code to be injected
+	Position     string `json:"position,omitempty"      yaml:"position"`      // Where to inject, entry by default
+
+	// The packages the raw code refers to, import name -> import path
+	Imports map[string]string `json:"imports,omitempty" yaml:"imports"`
 }
 
+// The positions of the raw code in the target function. The raw code runs at
+// the function entry, on exit as a deferred function, or before every return
+// statement, where it can read and overwrite the values to be returned through
+// the result variables.
+const (
+	RawPositionEntry      = "entry"
+	RawPositionExit       = "exit"
+	RawPositionEachReturn = "each-return"
+)
+
 // NewInstRawRule loads and validates an InstRawRule from YAML data.
 func NewInstRawRule(data []byte, name string) (*InstRawRule, error) {
 	var r InstRawRule
-	if err := yaml.Unmarshal(data, &r); err != nil {
-		return nil, ex.Wrap(err)
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
 	}
 	if r.Name == "" {
 		r.Name = name
@@ -47,5 +74,47 @@ func (r *InstRawRule) validate() error {
 	if strings.TrimSpace(r.Raw) == "" {
 		return ex.Newf("raw cannot be empty")
 	}
+	switch r.Position {
+	case "", RawPositionEntry, RawPositionExit, RawPositionEachReturn:
+	default:
+		return ex.Newf("position must be %s, %s or %s",
+			RawPositionEntry, RawPositionExit, RawPositionEachReturn)
+	}
+	if err := validateImports(r.Imports); err != nil {
+		return err
+	}
+	if _, err := r.Selector(); err != nil {
+		return err
+	}
 	return nil
 }
+
+// validateImports checks the imports of injected code, which are keyed by the
+// names the code refers to the packages by.
+func validateImports(imports map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(imports)) {
+		if !token.IsIdentifier(name) || name == "_" {
+			return ex.Newf("import name %q is not an identifier", name)
+		}
+		if err := module.CheckImportPath(imports[name]); err != nil {
+			return ex.Wrapf(err, "invalid import %s", name)
+		}
+	}
+	return nil
+}
+
+// Selector returns the selector of functions that the rule applies to.
+func (r *InstRawRule) Selector() (*FuncSelector, error) {
+	return NewFuncSelector(r.Func, r.Recv, r.ExportedOnly)
+}
+
+// Instantiate returns a copy of the rule that applies to exactly one function,
+// i.e. the function fn declared with receiver recv that is selected by the rule.
+func (r *InstRawRule) Instantiate(fn, recv string) *InstRawRule {
+	c := *r
+	c.Name = fmt.Sprintf("%s#%s", r.Name, QualifiedFuncName(fn, recv))
+	c.Func = fn
+	c.Recv = recv
+	c.ExportedOnly = false
+	return &c
+}
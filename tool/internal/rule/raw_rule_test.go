@@ -0,0 +1,45 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstRawRulePosition(t *testing.T) {
+	for _, position := range []string{"", RawPositionEntry, RawPositionExit, RawPositionEachReturn} {
+		r, err := NewInstRawRule([]byte("target: main\nfunc: A\nraw: x()\nposition: '"+position+"'\n"), "r")
+		require.NoError(t, err)
+		assert.Equal(t, position, r.Position)
+	}
+	_, err := NewInstRawRule([]byte("target: main\nfunc: A\nraw: x()\nposition: return\n"), "r")
+	require.ErrorContains(t, err, "position must be entry, exit or each-return")
+}
+
+func TestNewInstRawRuleImports(t *testing.T) {
+	tests := []struct {
+		imports string
+		wantErr string
+	}{
+		{imports: "{atomic: sync/atomic, tm: time}"},
+		{imports: "{_: time}", wantErr: `import name "_" is not an identifier`},
+		{imports: "{a.b: time}", wantErr: `import name "a.b" is not an identifier`},
+		{imports: "{tm: ''}", wantErr: "invalid import tm"},
+		{imports: "{tm: '\"time\"'}", wantErr: "invalid import tm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.imports, func(t *testing.T) {
+			r, err := NewInstRawRule([]byte("target: main\nfunc: A\nraw: x()\nimports: "+tt.imports+"\n"), "r")
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"atomic": "sync/atomic", "tm": "time"}, r.Imports)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// -----------------------------------------------------------------------------
+// Rule Schema
+//
+// Rules are decoded strictly, i.e. a misspelled field such as "befor" is an
+// error rather than silently ignored. The fields of each kind of rule are taken
+// from the YAML tags of its type, which also serve to generate a JSON Schema
+// that editors can use to validate and complete rule files.
+
+// Kind describes a kind of rule, which is identified by its discriminating field.
+type Kind struct {
+	Field       string       // The field identifying the kind, e.g. "func"
+	Name        string       // The readable name, e.g. "func rule"
+	Description string       // The description for the schema
+	Type        reflect.Type // The type of the rule
+}
+
+// kinds lists the kinds of rules in the order their discriminating fields are
+// checked, e.g. a rule with both struct and func fields is a struct rule.
+//
+//nolint:gochecknoglobals // read-only registry of the rule types, see KindOf
+var kinds = []*Kind{
+	{"struct", "struct rule", "Adds fields to a struct type", reflect.TypeFor[InstStructRule]()},
+	{"file", "file rule", "Adds a file to the target package", reflect.TypeFor[InstFileRule]()},
+	{"methods", "method rule", "Adds methods to a named type", reflect.TypeFor[InstMethodRule]()},
+	{"var", "var rule", "Overrides the initializer of a package-level variable", reflect.TypeFor[InstVarRule]()},
+	{"goroutine", "goroutine rule", "Propagates a context into the goroutines of go statements",
+		reflect.TypeFor[InstGoroutineRule]()},
+	{"interface", "interface rule", "Hooks the methods implementing an interface", reflect.TypeFor[InstInterfaceRule]()},
+	{"call", "call rule", "Hooks the calls of a function in the caller package", reflect.TypeFor[InstCallRule]()},
+	{"span", "span rule", "Traces a function by a span without hook code", reflect.TypeFor[InstSpanRule]()},
+	{"metric", "metric rule", "Records the calls, errors and durations of a function without hook code",
+		reflect.TypeFor[InstMetricRule]()},
+	{"raw", "raw rule", "Injects Go code at the function entry", reflect.TypeFor[InstRawRule]()},
+	{"func", "func rule", "Hooks the entry and exit of a function", reflect.TypeFor[InstFuncRule]()},
+}
+
+// DefaultsKey is the top-level key of the fields given to the rules of a file
+// that do not set them, and TemplatesKey is the top-level key of the named
+// partial rules. A rule extends templates by the ExtendsKey field, and gives
+// the parameters substituted for their references by the ParamsKey field.
+const (
+	DefaultsKey  = "defaults"
+	TemplatesKey = "templates"
+	ExtendsKey   = "extends"
+	ParamsKey    = "params"
+)
+
+// KindOf returns the kind of the rule with the given fields, or nil if none of
+// the discriminating fields is present.
+func KindOf(fields map[string]any) *Kind {
+	for _, k := range kinds {
+		if fields[k.Field] != nil {
+			return k
+		}
+	}
+	return nil
+}
+
+// KindFields returns the discriminating fields of all kinds for messages.
+func KindFields() string {
+	fields := make([]string, 0, len(kinds))
+	for _, k := range kinds {
+		fields = append(fields, k.Field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// AllFields returns the YAML fields of all kinds.
+func AllFields() []string {
+	fields := make([]string, 0)
+	for _, k := range kinds {
+		for _, f := range k.Fields() {
+			if !slices.Contains(fields, f) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields
+}
+
+// Fields returns the YAML fields of the kind.
+func (k *Kind) Fields() []string {
+	return YAMLFields(k.Type)
+}
+
+type yamlField struct {
+	name string
+	typ  reflect.Type
+}
+
+func yamlFieldsOf(t reflect.Type) []yamlField {
+	fields := make([]yamlField, 0)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			fields = append(fields, yamlFieldsOf(f.Type)...)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{name: name, typ: f.Type})
+	}
+	return fields
+}
+
+// YAMLFields returns the names of the fields of the struct type in YAML,
+// including the fields of inlined structs.
+func YAMLFields(t reflect.Type) []string {
+	names := make([]string, 0)
+	for _, f := range yamlFieldsOf(t) {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// decodeStrict decodes the YAML data, rejecting fields that are not declared by
+// the type of v.
+func decodeStrict(data []byte, v any) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return ex.Wrap(err)
+	}
+	return nil
+}
+
+// schemaOf returns the JSON Schema of the type. Named structs other than rules
+// are defined once in defs and referenced, which also allows recursive types
+// such as Pointcut.
+func schemaOf(t reflect.Type, defs map[string]any) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = map[string]any{} // Placeholder for recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	props := make(map[string]any)
+	for _, f := range yamlFieldsOf(t) {
+		props[f.name] = schemaOf(f.typ, defs)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+}
+
+// JSONSchema returns the JSON Schema of rule files.
+func JSONSchema() ([]byte, error) {
+	defs := make(map[string]any)
+	rules := make([]any, 0, len(kinds))
+	for _, k := range kinds {
+		s := structSchema(k.Type, defs)
+		s["description"] = k.Description
+		s["required"] = []string{k.Field}
+		props, _ := s["properties"].(map[string]any)
+		props["variants"] = map[string]any{
+			"description": "Partial rules overriding the fields of the rule",
+			"type":        "array",
+			"items":       map[string]any{"type": "object"},
+		}
+		props[ExtendsKey] = map[string]any{
+			"description": "The templates whose fields the rule inherits",
+			"anyOf": []any{
+				map[string]any{"type": "string"},
+				map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+		}
+		props[ParamsKey] = map[string]any{
+			"description": "The values substituted for the ${name} references of the rule",
+			"type":        "object",
+		}
+		name := strings.ReplaceAll(k.Name, " ", "_")
+		defs[name] = s
+		rules = append(rules, map[string]any{"$ref": "#/$defs/" + name})
+	}
+	pointcutRule := structSchema(reflect.TypeFor[InstPointcutRule](), defs)
+	pointcutRule["description"] = "Applies advice to the declarations selected by a pointcut"
+	defs["pointcut_rule"] = pointcutRule
+
+	schema := map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "OpenTelemetry Go compile-time instrumentation rules",
+		"type":    "object",
+		"properties": map[string]any{
+			MetaKey: map[string]any{
+				"description": "Metadata for end-users, ignored by the tool",
+				"type":        "object",
+			},
+			DefaultsKey: map[string]any{
+				"description": "Fields given to the rules of the file that do not set them",
+				"type":        "object",
+			},
+			TemplatesKey: map[string]any{
+				"description":          "Partial rules that rules extend by name",
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "object"},
+			},
+			InstrumentationKey: map[string]any{
+				"description": "Rules selecting declarations by pointcuts",
+				"type":        "object",
+				"additionalProperties": map[string]any{
+					"$ref": "#/$defs/pointcut_rule",
+				},
+			},
+		},
+		"additionalProperties": map[string]any{"anyOf": rules},
+		"$defs":                defs,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, ex.Wrap(err)
+	}
+	return data, nil
+}
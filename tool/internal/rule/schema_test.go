@@ -0,0 +1,78 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKindOf(t *testing.T) {
+	assert.Equal(t, "func", KindOf(map[string]any{"func": "A", "before": "B"}).Field)
+	assert.Equal(t, "struct", KindOf(map[string]any{"func": "A", "struct": "T"}).Field)
+	assert.Equal(t, "raw", KindOf(map[string]any{"func": "A", "raw": "x"}).Field)
+	assert.Nil(t, KindOf(map[string]any{"target": "main", "before": "B"}))
+	assert.Equal(t, "struct, file, methods, var, goroutine, interface, call, span, metric, raw, func", KindFields())
+}
+
+func TestKindFields(t *testing.T) {
+	kind := KindOf(map[string]any{"func": "A"})
+	fields := kind.Fields()
+	for _, f := range []string{"name", "target", "version", "order", "go", "required", "func", "before", "path"} {
+		assert.Contains(t, fields, f)
+	}
+	assert.NotContains(t, fields, "VariantOf")
+
+	kind = KindOf(map[string]any{"call": "a.B"})
+	assert.NotContains(t, kind.Fields(), "sites")
+}
+
+func TestDecodeStrict(t *testing.T) {
+	_, err := NewInstFuncRule([]byte("target: main\nfunc: A\nbefor: B\n"), "r")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "befor")
+
+	_, err = NewInstPointcutRules([]byte("r: {pointcut: {fuction: A}, advice: [{raw: x}]}"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fuction")
+
+	r, err := NewInstFuncRule([]byte("target: main\nfunc: A\nbefore: B\norder: 2\n"), "r")
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.GetOrder())
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema struct {
+		Defs map[string]struct {
+			Required             []string       `json:"required"`
+			Properties           map[string]any `json:"properties"`
+			AdditionalProperties bool           `json:"additionalProperties"`
+		} `json:"$defs"`
+		Properties map[string]any `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	for _, k := range kinds {
+		def, ok := schema.Defs[strings.ReplaceAll(k.Name, " ", "_")]
+		require.True(t, ok, k.Name)
+		assert.Equal(t, []string{k.Field}, def.Required)
+		assert.False(t, def.AdditionalProperties)
+		assert.Contains(t, def.Properties, "variants")
+		assert.Contains(t, def.Properties, "target")
+		assert.Contains(t, def.Properties, ExtendsKey)
+		assert.Contains(t, def.Properties, ParamsKey)
+	}
+	assert.Contains(t, schema.Defs, "pointcut_rule")
+	assert.Contains(t, schema.Defs, "Pointcut")
+	assert.Contains(t, schema.Properties, MetaKey)
+	assert.Contains(t, schema.Properties, InstrumentationKey)
+	assert.Contains(t, schema.Properties, DefaultsKey)
+	assert.Contains(t, schema.Properties, TemplatesKey)
+}
@@ -0,0 +1,171 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"fmt"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// -----------------------------------------------------------------------------
+// Function Selectors
+//
+// The func and recv fields of func and raw rules are selectors rather than
+// plain names. A selector is one of:
+//
+//   - an exact name, e.g. "ServeHTTP"
+//   - a glob pattern as understood by path.Match, e.g. "Handle*"
+//   - a regular expression enclosed in slashes, e.g. "/^(Get|Put)$/"
+//
+// For the receiver, a leading "*" of an exact name or a glob pattern denotes a
+// pointer receiver, i.e. "*Repo" selects methods of *Repo and "*Repo*" selects
+// methods of pointer receivers whose type name starts with "Repo". A lone "*"
+// selects all methods, whatever their receivers. A regular expression is
+// matched against the whole receiver, including the "*" prefix.
+
+const (
+	globMetaChars = "*?["
+	regexpDelim   = "/"
+	pointerPrefix = "*"
+)
+
+// NameSelector matches a declaration name against an exact name, a glob
+// pattern or a regular expression.
+type NameSelector struct {
+	exact string
+	glob  string
+	re    *regexp.Regexp
+}
+
+func isRegexpSelector(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, regexpDelim) && strings.HasSuffix(s, regexpDelim)
+}
+
+func isGlobSelector(s string) bool {
+	return strings.ContainsAny(s, globMetaChars)
+}
+
+// NewNameSelector compiles the selector s.
+func NewNameSelector(s string) (*NameSelector, error) {
+	switch {
+	case isRegexpSelector(s):
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return nil, ex.Wrapf(err, "invalid regular expression %q", s)
+		}
+		return &NameSelector{re: re}, nil
+	case isGlobSelector(s):
+		// Validate the pattern eagerly, path.Match only reports a malformed
+		// pattern when it is matched against a name
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, ex.Wrapf(err, "invalid glob pattern %q", s)
+		}
+		return &NameSelector{glob: s}, nil
+	default:
+		return &NameSelector{exact: s}, nil
+	}
+}
+
+// IsExact reports whether the selector matches a single name only.
+func (ns *NameSelector) IsExact() bool {
+	return ns.re == nil && ns.glob == ""
+}
+
+// Match reports whether name is selected.
+func (ns *NameSelector) Match(name string) bool {
+	switch {
+	case ns.re != nil:
+		return ns.re.MatchString(name)
+	case ns.glob != "":
+		ok, _ := path.Match(ns.glob, name)
+		return ok
+	default:
+		return ns.exact == name
+	}
+}
+
+// FuncSelector selects function declarations by name, receiver type and
+// whether they are exported.
+type FuncSelector struct {
+	fn           *NameSelector
+	recv         *NameSelector
+	recvPointer  bool // The receiver must be a pointer, only for non-regexp recv
+	recvRegexp   bool // The recv selector is matched against the full receiver
+	recvAny      bool // The recv selector is "*", which selects any receiver
+	exportedOnly bool
+}
+
+// NewFuncSelector compiles the func and recv selectors of a rule. An empty recv
+// selects functions without receiver, and "*" selects methods of any receiver.
+func NewFuncSelector(fn, recv string, exportedOnly bool) (*FuncSelector, error) {
+	fs := &FuncSelector{exportedOnly: exportedOnly}
+	var err error
+	fs.fn, err = NewNameSelector(fn)
+	if err != nil {
+		return nil, err
+	}
+	if recv == "" {
+		return fs, nil
+	}
+	if recv == pointerPrefix {
+		fs.recvAny = true
+		return fs, nil
+	}
+	if isRegexpSelector(recv) {
+		fs.recvRegexp = true
+	} else if strings.HasPrefix(recv, pointerPrefix) {
+		fs.recvPointer = true
+		recv = strings.TrimPrefix(recv, pointerPrefix)
+	}
+	fs.recv, err = NewNameSelector(recv)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// IsExact reports whether the selector selects one function by its exact name
+// and receiver, which is how rules were matched before selectors existed.
+func (fs *FuncSelector) IsExact() bool {
+	return !fs.exportedOnly && !fs.recvAny && fs.fn.IsExact() && (fs.recv == nil || fs.recv.IsExact())
+}
+
+// Match reports whether the function named fn with receiver recv is selected.
+// The recv is the receiver type without type parameters, e.g. "*Repo" or "Repo",
+// and it's empty for functions without receiver.
+func (fs *FuncSelector) Match(fn, recv string) bool {
+	if fs.exportedOnly && !token.IsExported(fn) {
+		return false
+	}
+	if !fs.fn.Match(fn) {
+		return false
+	}
+	if fs.recvAny {
+		return recv != ""
+	}
+	if fs.recv == nil || recv == "" {
+		return fs.recv == nil && recv == ""
+	}
+	if fs.recvRegexp {
+		return fs.recv.Match(recv)
+	}
+	if strings.HasPrefix(recv, pointerPrefix) != fs.recvPointer {
+		return false
+	}
+	return fs.recv.Match(strings.TrimPrefix(recv, pointerPrefix))
+}
+
+// QualifiedFuncName returns a readable name for the function fn declared with
+// receiver recv, e.g. "(*Repo).Get" or "Get".
+func QualifiedFuncName(fn, recv string) string {
+	if recv == "" {
+		return fn
+	}
+	return fmt.Sprintf("(%s).%s", recv, fn)
+}
@@ -0,0 +1,123 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncSelector(t *testing.T) {
+	tests := []struct {
+		name         string
+		fn           string
+		recv         string
+		exportedOnly bool
+		exact        bool
+		matches      [][2]string // {func, recv}
+		mismatches   [][2]string
+	}{
+		{
+			name:       "exact function",
+			fn:         "Example",
+			exact:      true,
+			matches:    [][2]string{{"Example", ""}},
+			mismatches: [][2]string{{"Example2", ""}, {"Example", "*T"}},
+		},
+		{
+			name:       "exact method",
+			fn:         "Get",
+			recv:       "*Repo",
+			exact:      true,
+			matches:    [][2]string{{"Get", "*Repo"}},
+			mismatches: [][2]string{{"Get", "Repo"}, {"Get", ""}, {"Get", "*RepoX"}},
+		},
+		{
+			name:       "glob function",
+			fn:         "Handle*",
+			matches:    [][2]string{{"Handle", ""}, {"HandleGet", ""}},
+			mismatches: [][2]string{{"handle", ""}, {"HandleGet", "*T"}},
+		},
+		{
+			name:       "all methods of pointer receiver",
+			fn:         "*",
+			recv:       "*Repo",
+			matches:    [][2]string{{"Get", "*Repo"}, {"put", "*Repo"}},
+			mismatches: [][2]string{{"Get", "Repo"}, {"Get", ""}, {"Get", "*Repos"}},
+		},
+		{
+			name:       "all methods of any receiver",
+			fn:         "*",
+			recv:       "*",
+			matches:    [][2]string{{"Get", "*Repo"}, {"Get", "Repo"}, {"put", "T"}},
+			mismatches: [][2]string{{"Get", ""}},
+		},
+		{
+			name:       "glob receiver",
+			fn:         "Get",
+			recv:       "*Repo*",
+			matches:    [][2]string{{"Get", "*Repo"}, {"Get", "*RepoImpl"}},
+			mismatches: [][2]string{{"Get", "RepoImpl"}},
+		},
+		{
+			name:       "regexp function and receiver",
+			fn:         "/^(Get|Put)$/",
+			recv:       `/^\*?Repo$/`,
+			matches:    [][2]string{{"Get", "*Repo"}, {"Put", "Repo"}},
+			mismatches: [][2]string{{"Getter", "*Repo"}, {"Get", ""}},
+		},
+		{
+			name:         "exported only",
+			fn:           "*",
+			recv:         "*Repo",
+			exportedOnly: true,
+			matches:      [][2]string{{"Get", "*Repo"}},
+			mismatches:   [][2]string{{"get", "*Repo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel, err := NewFuncSelector(tt.fn, tt.recv, tt.exportedOnly)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exact, sel.IsExact())
+			for _, m := range tt.matches {
+				assert.True(t, sel.Match(m[0], m[1]), "expect %v to match", m)
+			}
+			for _, m := range tt.mismatches {
+				assert.False(t, sel.Match(m[0], m[1]), "expect %v not to match", m)
+			}
+		})
+	}
+}
+
+func TestFuncSelectorInvalid(t *testing.T) {
+	for _, tt := range []struct{ fn, recv string }{
+		{fn: "/(/"},
+		{fn: "Handle[", recv: ""},
+		{fn: "Get", recv: "/[/"},
+	} {
+		_, err := NewFuncSelector(tt.fn, tt.recv, false)
+		require.Error(t, err, "func %q recv %q", tt.fn, tt.recv)
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	r, err := NewInstFuncRule([]byte(`
+target: main
+func: "Handle*"
+recv: "*Server"
+before: H
+path: github.com/foo/hook
+`), "handlers")
+	require.NoError(t, err)
+
+	fr := r.Instantiate("HandleGet", "*Server")
+	assert.Equal(t, "handlers#(*Server).HandleGet", fr.GetName())
+	assert.Equal(t, "HandleGet", fr.Func)
+	assert.Equal(t, "*Server", fr.Recv)
+	assert.Equal(t, "H", fr.Before)
+	assert.Equal(t, "Handle*", r.Func, "the original rule must be untouched")
+}
@@ -0,0 +1,197 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"go/token"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// InstSpanRule represents a rule that traces a function by a span, without any
+// hook code. The span is started at the function entry and ended when the
+// function returns, recording the error result if it's not nil. For example,
+// if we want to trace the Get method of the Repo type, we can define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "github.com/foo/bar/store"
+//		span: "{recv}.{func}"
+//		func: "Get"
+//		recv: "*Repo"
+//		kind: "client"
+//		attributes:
+//			repo.key: "key"
+//
+// The span name may refer to the function name by {func}, the receiver type
+// name by {recv} and the package name by {package}. Attributes take the values
+// of the parameters or the named results by their names. Like func rules, the
+// func and recv fields may be glob patterns or regular expressions. Functions
+// whose qualified names do not match the include regular expression, or match
+// the exclude one, are not traced, and spans shorter than min_duration are
+// dropped at runtime unless they fail.
+type InstSpanRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Span         string `json:"span"                    yaml:"span"`          // The span name template
+	Func         string `json:"func"                    yaml:"func"`          // The target func name or selector
+	Recv         string `json:"recv"                    yaml:"recv"`          // The name of the receiver type
+	ExportedOnly bool   `json:"exported_only,omitempty" yaml:"exported_only"` // Only select exported functions
+	Kind         string `json:"kind,omitempty"          yaml:"kind"`          // The span kind, internal by default
+	Include      string `json:"include,omitempty"       yaml:"include"`       // The functions to trace, all by default
+	Exclude      string `json:"exclude,omitempty"       yaml:"exclude"`       // The functions not to trace
+	MinDuration  string `json:"min_duration,omitempty"  yaml:"min_duration"`  // The shortest span to keep, e.g. 1ms
+
+	// The attributes of the span, attribute key -> parameter or result name
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes"`
+}
+
+// The placeholders of span names and metric names.
+const (
+	SpanFuncPlaceholder    = "{func}"
+	SpanRecvPlaceholder    = "{recv}"
+	SpanPackagePlaceholder = "{package}"
+)
+
+// placeholderPattern matches the placeholders of span names and metric names.
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// spanKinds lists the span kinds as in the OpenTelemetry specification.
+//
+//nolint:gochecknoglobals // read-only, a slice can not be a constant
+var spanKinds = []string{"internal", "server", "client", "producer", "consumer"}
+
+// NewInstSpanRule loads and validates an InstSpanRule from YAML data.
+func NewInstSpanRule(data []byte, name string) (*InstSpanRule, error) {
+	var r InstSpanRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid span rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstSpanRule) validate() error {
+	if strings.TrimSpace(r.Span) == "" {
+		return ex.Newf("span cannot be empty")
+	}
+	if err := checkPlaceholders(r.Span, "span name"); err != nil {
+		return err
+	}
+	if r.Kind != "" && !slices.Contains(spanKinds, r.Kind) {
+		return ex.Newf("kind must be one of %s", strings.Join(spanKinds, ", "))
+	}
+	if err := checkAttributes(r.Attributes, "a parameter or result name"); err != nil {
+		return err
+	}
+	if _, err := r.Selector(); err != nil {
+		return err
+	}
+	if _, err := regexp.Compile(r.Include); err != nil {
+		return ex.Wrapf(err, "invalid include %q", r.Include)
+	}
+	if _, err := regexp.Compile(r.Exclude); err != nil {
+		return ex.Wrapf(err, "invalid exclude %q", r.Exclude)
+	}
+	if r.MinDuration != "" {
+		if d, err := time.ParseDuration(r.MinDuration); err != nil || d < 0 {
+			return ex.Newf("min_duration %q must be a non-negative duration, e.g. 1ms", r.MinDuration)
+		}
+	}
+	return nil
+}
+
+// Selector returns the selector of functions that the rule applies to.
+func (r *InstSpanRule) Selector() (*FuncSelector, error) {
+	return NewFuncSelector(r.Func, r.Recv, r.ExportedOnly)
+}
+
+// Excludes reports whether the function fn declared with receiver recv is
+// excluded from the rule by its qualified name, see QualifiedFuncName, i.e. the
+// name does not match the include regular expression or matches the exclude.
+func (r *InstSpanRule) Excludes(fn, recv string) bool {
+	// The regular expressions have been validated when the rule was loaded
+	name := QualifiedFuncName(fn, recv)
+	if r.Include != "" && !regexp.MustCompile(r.Include).MatchString(name) {
+		return true
+	}
+	return r.Exclude != "" && regexp.MustCompile(r.Exclude).MatchString(name)
+}
+
+// SpanMinDuration returns the duration of the shortest span to keep, which is
+// zero if all spans are kept.
+func (r *InstSpanRule) SpanMinDuration() time.Duration {
+	// The duration has been validated when the rule was loaded
+	d, _ := time.ParseDuration(r.MinDuration)
+	return d
+}
+
+// SpanName returns the span name of the function fn declared with receiver
+// recv in package pkg, see expandPlaceholders.
+func (r *InstSpanRule) SpanName(pkg, fn, recv string) string {
+	return expandPlaceholders(r.Span, pkg, fn, recv)
+}
+
+// SpanKind returns the span kind, which is internal by default.
+func (r *InstSpanRule) SpanKind() string {
+	if r.Kind == "" {
+		return spanKinds[0]
+	}
+	return r.Kind
+}
+
+// checkPlaceholders checks the placeholders of the name template, which names
+// what the template is in errors.
+func checkPlaceholders(template, what string) error {
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		switch p {
+		case SpanFuncPlaceholder, SpanRecvPlaceholder, SpanPackagePlaceholder:
+		default:
+			return ex.Newf("unknown placeholder %s in %s, expected %s, %s or %s",
+				p, what, SpanFuncPlaceholder, SpanRecvPlaceholder, SpanPackagePlaceholder)
+		}
+	}
+	return nil
+}
+
+// expandPlaceholders expands the placeholders of the name template for the
+// function fn declared with receiver recv in package pkg. The receiver is
+// spelled without the pointer, e.g. Repo for *Repo, and the receiver of a
+// function without one is dropped along with the dot following it, i.e.
+// {recv}.{func} is just {func} for functions.
+func expandPlaceholders(template, pkg, fn, recv string) string {
+	recv = strings.TrimPrefix(recv, pointerPrefix)
+	if recv == "" {
+		template = strings.ReplaceAll(template, SpanRecvPlaceholder+".", "")
+	}
+	return strings.NewReplacer(
+		SpanFuncPlaceholder, fn,
+		SpanRecvPlaceholder, recv,
+		SpanPackagePlaceholder, pkg,
+	).Replace(template)
+}
+
+// checkAttributes checks the attributes, which map the attribute keys to the
+// names of what the attributes take the values of.
+func checkAttributes(attributes map[string]string, what string) error {
+	for _, key := range slices.Sorted(maps.Keys(attributes)) {
+		if strings.TrimSpace(key) == "" {
+			return ex.Newf("attribute key cannot be empty")
+		}
+		if name := attributes[key]; !token.IsIdentifier(name) || name == "_" {
+			return ex.Newf("attribute %s refers to %q, which is not %s", key, name, what)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstSpanRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{
+			name: "function",
+			yaml: "target: main\nspan: '{package}.{func}'\nfunc: Get\n",
+		},
+		{
+			name: "selected methods with attributes",
+			yaml: "target: main\nspan: '{recv}.{func}'\nfunc: '*'\nrecv: '*Repo'\nkind: client\n" +
+				"attributes:\n  repo.key: key\n",
+		},
+		{
+			name:   "no span",
+			yaml:   "target: main\nfunc: Get\n",
+			errMsg: "span cannot be empty",
+		},
+		{
+			name:   "unknown placeholder",
+			yaml:   "target: main\nspan: '{method}'\nfunc: Get\n",
+			errMsg: "unknown placeholder {method} in span name",
+		},
+		{
+			name:   "unknown kind",
+			yaml:   "target: main\nspan: Get\nfunc: Get\nkind: remote\n",
+			errMsg: "kind must be one of internal, server, client, producer, consumer",
+		},
+		{
+			name:   "attribute of expression",
+			yaml:   "target: main\nspan: Get\nfunc: Get\nattributes:\n  repo.key: key.ID\n",
+			errMsg: `attribute repo.key refers to "key.ID", which is not a parameter or result name`,
+		},
+		{
+			name:   "invalid selector",
+			yaml:   "target: main\nspan: Get\nfunc: '/[/'\n",
+			errMsg: "invalid regular expression",
+		},
+		{
+			name: "exclude and min_duration",
+			yaml: "target: main\nspan: '{func}'\nfunc: '*'\nexclude: '^String$'\nmin_duration: 1ms\n",
+		},
+		{
+			name:   "invalid exclude",
+			yaml:   "target: main\nspan: Get\nfunc: Get\nexclude: '('\n",
+			errMsg: `invalid exclude "("`,
+		},
+		{
+			name:   "invalid include",
+			yaml:   "target: main\nspan: Get\nfunc: Get\ninclude: '('\n",
+			errMsg: `invalid include "("`,
+		},
+		{
+			name:   "negative min_duration",
+			yaml:   "target: main\nspan: Get\nfunc: Get\nmin_duration: -1s\n",
+			errMsg: `min_duration "-1s" must be a non-negative duration, e.g. 1ms`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstSpanRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "r", r.Name)
+		})
+	}
+}
+
+func TestSpanName(t *testing.T) {
+	tests := []struct {
+		span string
+		recv string
+		want string
+	}{
+		{span: "{recv}.{func}", recv: "*Repo", want: "Repo.Get"},
+		{span: "{recv}.{func}", recv: "", want: "Get"},
+		{span: "{package}/{recv}.{func}", recv: "Repo", want: "store/Repo.Get"},
+		{span: "fetch", recv: "Repo", want: "fetch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.span, func(t *testing.T) {
+			r := &InstSpanRule{Span: tt.span}
+			assert.Equal(t, tt.want, r.SpanName("store", "Get", tt.recv))
+		})
+	}
+}
+
+func TestSpanRuleExcludes(t *testing.T) {
+	r := &InstSpanRule{Exclude: `^\(\*cache\)\.|^String$`, MinDuration: "1.5ms"}
+	assert.True(t, r.Excludes("Get", "*cache"))
+	assert.True(t, r.Excludes("String", ""))
+	assert.False(t, r.Excludes("String", "Repo"))
+	assert.False(t, r.Excludes("Get", "cache"))
+	assert.Equal(t, 1500*time.Microsecond, r.SpanMinDuration())
+
+	r = &InstSpanRule{}
+	assert.False(t, r.Excludes("Get", ""))
+	assert.Zero(t, r.SpanMinDuration())
+}
@@ -4,10 +4,12 @@
 package rule
 
 import (
+	goast "go/ast"
+	"go/parser"
+	"go/token"
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
-	"gopkg.in/yaml.v3"
 )
 
 // InstStructRule represents a rule that guides hook struct field injection into
@@ -18,25 +20,41 @@ import (
 //		name: "rule"
 //		target: "main"
 //		struct: "Bar"
-//		field_name: "Foo"
-//		field_type: "int"
+//		new_field:
+//			- name: "Foo"
+//			  type: "int"
+//			  tag: 'json:"-"'
+//
+// A field without name is embedded, e.g. type "*sync.Mutex".
 type InstStructField struct {
-	Name string `json:"name" yaml:"name"` // The name of the field to be added
-	Type string `json:"type" yaml:"type"` // The type of the field to be added
+	Name string `json:"name,omitempty" yaml:"name,omitempty"` // The name of the field, empty for embedded fields
+	Type string `json:"type"           yaml:"type"`           // The type of the field to be added
+	Tag  string `json:"tag,omitempty"  yaml:"tag,omitempty"`  // The tag of the field, e.g. `json:"-"`
 }
 
+// Adding fields breaks unkeyed composite literals of the struct such as
+// Bar{1, "a"}, which list the values of all fields. The unkeyed literals found
+// in the target package are either rewritten to also list the zero values of
+// the new fields, or reject the rule.
+const (
+	UnkeyedLiteralsRewrite = "rewrite"
+	UnkeyedLiteralsReject  = "reject"
+)
+
 type InstStructRule struct {
 	InstBaseRule `yaml:",inline"`
 
 	Struct   string             `json:"struct"    yaml:"struct"`    // The type name of the struct to be instrumented
 	NewField []*InstStructField `json:"new_field" yaml:"new_field"` // The new fields to be added
+	// How to deal with unkeyed literals of the struct, rewrite by default
+	UnkeyedLiterals string `json:"unkeyed_literals,omitempty" yaml:"unkeyed_literals,omitempty"`
 }
 
 // NewInstStructRule loads and validates an InstStructRule from YAML data.
 func NewInstStructRule(data []byte, name string) (*InstStructRule, error) {
 	var r InstStructRule
-	if err := yaml.Unmarshal(data, &r); err != nil {
-		return nil, ex.Wrap(err)
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
 	}
 	if r.Name == "" {
 		r.Name = name
@@ -51,5 +69,48 @@ func (r *InstStructRule) validate() error {
 	if strings.TrimSpace(r.Struct) == "" {
 		return ex.Newf("struct cannot be empty")
 	}
+	for _, field := range r.NewField {
+		if err := field.validate(); err != nil {
+			return err
+		}
+	}
+	switch r.UnkeyedLiterals {
+	case "", UnkeyedLiteralsRewrite, UnkeyedLiteralsReject:
+	default:
+		return ex.Newf("unkeyed_literals must be %s or %s", UnkeyedLiteralsRewrite, UnkeyedLiteralsReject)
+	}
+	return nil
+}
+
+// isEmbeddable reports whether the type can be embedded, i.e. it's a possibly
+// qualified type name or a pointer to it, with type arguments if any.
+func isEmbeddable(t goast.Expr) bool {
+	switch expr := t.(type) {
+	case *goast.StarExpr:
+		_, ok := expr.X.(*goast.StarExpr)
+		return !ok && isEmbeddable(expr.X)
+	case *goast.IndexExpr:
+		return isEmbeddable(expr.X)
+	case *goast.IndexListExpr:
+		return isEmbeddable(expr.X)
+	case *goast.Ident, *goast.SelectorExpr:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *InstStructField) validate() error {
+	t, err := parser.ParseExpr(f.Type)
+	if err != nil {
+		return ex.Newf("invalid type %q of field %q", f.Type, f.Name)
+	}
+	if f.Name == "" {
+		if !isEmbeddable(t) {
+			return ex.Newf("type %q can not be embedded", f.Type)
+		}
+	} else if !token.IsIdentifier(f.Name) {
+		return ex.Newf("invalid field name %q", f.Name)
+	}
 	return nil
 }
@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstStructRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		errMsg string
+	}{
+		{
+			name:   "named field with tag",
+			fields: "new_field: [{name: Span, type: 'interface{}', tag: 'json:\"-\"'}]",
+		},
+		{
+			name:   "embedded fields",
+			fields: "new_field: [{type: '*sync.Mutex'}, {type: 'List[int]'}, {type: Base}]",
+		},
+		{
+			name:   "rejected unkeyed literals",
+			fields: "new_field: [{name: A, type: int}]\nunkeyed_literals: reject",
+		},
+		{
+			name:   "invalid type",
+			fields: "new_field: [{name: A, type: '[]'}]",
+			errMsg: `invalid type "[]" of field "A"`,
+		},
+		{
+			name:   "missing type",
+			fields: "new_field: [{name: A}]",
+			errMsg: `invalid type "" of field "A"`,
+		},
+		{
+			name:   "embedded slice",
+			fields: "new_field: [{type: '[]int'}]",
+			errMsg: `type "[]int" can not be embedded`,
+		},
+		{
+			name:   "embedded pointer to pointer",
+			fields: "new_field: [{type: '**T'}]",
+			errMsg: `type "**T" can not be embedded`,
+		},
+		{
+			name:   "invalid name",
+			fields: "new_field: [{name: 'a.b', type: int}]",
+			errMsg: `invalid field name "a.b"`,
+		},
+		{
+			name:   "invalid unkeyed literals",
+			fields: "new_field: [{name: A, type: int}]\nunkeyed_literals: ignore",
+			errMsg: "unkeyed_literals must be rewrite or reject",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewInstStructRule([]byte("target: main\nstruct: T\n"+tt.fields+"\n"), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// VarOrigValue is the identifier by which the value of a var rule refers to the
+// original initializer of the variable or constant.
+const VarOrigValue = "_origValue"
+
+// InstVarRule represents a rule that overrides the initializer of a package
+// level variable or constant of the target package. The value field replaces
+// the initializer with a Go expression, which may refer to the original one
+// as _origValue. For example, if we want to double the default timeout Bar of
+// the target package, we can define a rule:
+//
+//	rule:
+//		name: "newrule"
+//		target: "main"
+//		var: "Bar"
+//		value: "2 * _origValue"
+//
+// The hook field wraps the initializer, or the value if any, in a call to the
+// hook function, which takes and returns the type of the variable. The type
+// field gives the type if the variable is declared without one.
+type InstVarRule struct {
+	InstBaseRule `yaml:",inline"`
+
+	Var   string `json:"var"             yaml:"var"`   // The name of the variable or constant
+	Value string `json:"value,omitempty" yaml:"value"` // The expression replacing the initializer
+	Hook  string `json:"hook,omitempty"  yaml:"hook"`  // The hook function wrapping the initializer
+	Path  string `json:"path,omitempty"  yaml:"path"`  // The module path of the hook code
+	Type  string `json:"type,omitempty"  yaml:"type"`  // The type of the variable, if not declared
+
+	// The packages the value refers to, import name -> import path
+	Imports map[string]string `json:"imports,omitempty" yaml:"imports"`
+}
+
+// NewInstVarRule loads and validates an InstVarRule from YAML data.
+func NewInstVarRule(data []byte, name string) (*InstVarRule, error) {
+	var r InstVarRule
+	if err := decodeStrict(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Name == "" {
+		r.Name = name
+	}
+	if err := r.validate(); err != nil {
+		return nil, ex.Wrapf(err, "invalid var rule %q", name)
+	}
+	return &r, nil
+}
+
+func (r *InstVarRule) validate() error {
+	if !token.IsIdentifier(r.Var) || r.Var == "_" {
+		return ex.Newf("var %q is not a variable name", r.Var)
+	}
+	if r.Value == "" && r.Hook == "" {
+		return ex.Newf("either value or hook must be specified")
+	}
+	if r.Value != "" {
+		if _, err := parser.ParseExpr(r.Value); err != nil {
+			return ex.Newf("invalid value %q", r.Value)
+		}
+	}
+	if r.Hook != "" {
+		if !token.IsIdentifier(r.Hook) {
+			return ex.Newf("hook %q is not a function name", r.Hook)
+		}
+		if strings.TrimSpace(r.Path) == "" {
+			return ex.Newf("path cannot be empty")
+		}
+	} else if r.Path != "" {
+		return ex.Newf("path requires a hook")
+	}
+	if r.Type != "" {
+		if _, err := parser.ParseExpr(r.Type); err != nil {
+			return ex.Newf("invalid type %q", r.Type)
+		}
+	}
+	return validateImports(r.Imports)
+}
@@ -0,0 +1,78 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstVarRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		yaml   string
+		errMsg string
+	}{
+		{
+			name: "value",
+			yaml: "target: main\nvar: Timeout\nvalue: 2 * _origValue\n",
+		},
+		{
+			name: "hook",
+			yaml: "target: main\nvar: Transport\nhook: WrapTransport\npath: example.com/hooks\ntype: RoundTripper\n",
+		},
+		{
+			name: "value with imports",
+			yaml: "target: main\nvar: Timeout\nvalue: 30 * time.Second\nimports: {time: time}\n",
+		},
+		{
+			name:   "blank var",
+			yaml:   "target: main\nvar: _\nvalue: '1'\n",
+			errMsg: `var "_" is not a variable name`,
+		},
+		{
+			name:   "no value or hook",
+			yaml:   "target: main\nvar: Timeout\n",
+			errMsg: "either value or hook must be specified",
+		},
+		{
+			name:   "invalid value",
+			yaml:   "target: main\nvar: Timeout\nvalue: 2 *\n",
+			errMsg: `invalid value "2 *"`,
+		},
+		{
+			name:   "hook without path",
+			yaml:   "target: main\nvar: Transport\nhook: WrapTransport\n",
+			errMsg: "path cannot be empty",
+		},
+		{
+			name:   "path without hook",
+			yaml:   "target: main\nvar: Timeout\nvalue: '1'\npath: example.com/hooks\n",
+			errMsg: "path requires a hook",
+		},
+		{
+			name:   "invalid type",
+			yaml:   "target: main\nvar: Transport\nhook: Wrap\npath: example.com/hooks\ntype: '*'\n",
+			errMsg: `invalid type "*"`,
+		},
+		{
+			name:   "invalid import",
+			yaml:   "target: main\nvar: Timeout\nvalue: '1'\nimports: {_: time}\n",
+			errMsg: `import name "_" is not an identifier`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewInstVarRule([]byte(tt.yaml), "r")
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "r", r.Name)
+		})
+	}
+}
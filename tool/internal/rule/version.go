@@ -0,0 +1,160 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+)
+
+// -----------------------------------------------------------------------------
+// Version Constraints
+//
+// The version of a rule constrains the versions of the target module it applies
+// to. A constraint is a union of clauses separated by "||", and each clause is a
+// list of comparisons separated by spaces or commas that must all hold:
+//
+//	">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3"
+//
+// The operators are =, !=, >, >=, < and <=, spaces may separate them from their
+// version, as in ">= v1.2.0". Versions are semantic versions,
+// the "v" prefix may be omitted. Pre-releases are ordered before their release,
+// so "<v2.0.0" includes v2.0.0-rc.1 while "<v2.0.0-0" excludes all of them.
+// Build metadata is ignored.
+//
+// The legacy syntax without operators remains supported, where "v1.0.0" means
+// ">=v1.0.0" and "v1.0.0,v2.0.0" means ">=v1.0.0 <v2.0.0", whatever the spaces
+// around the comma.
+
+// versionComparison is one comparison of a version constraint.
+type versionComparison struct {
+	op      string
+	version string
+}
+
+// VersionConstraint is a parsed version constraint.
+type VersionConstraint struct {
+	raw     string
+	clauses [][]versionComparison
+}
+
+// versionOperators lists the operators, longest first for prefix matching.
+//
+//nolint:gochecknoglobals // read-only, its order matters to the parser
+var versionOperators = []string{">=", "<=", "!=", ">", "<", "="}
+
+func parseVersion(s, constraint string) (string, error) {
+	v := "v" + strings.TrimPrefix(s, "v")
+	if !semver.IsValid(v) {
+		return "", ex.Newf("invalid version %q in constraint %q", s, constraint)
+	}
+	return v, nil
+}
+
+// parseLegacyVersionConstraint parses the "min" and "min,max" forms.
+func parseLegacyVersionConstraint(s string) (*VersionConstraint, error) {
+	bounds := strings.Split(s, ",")
+	if len(bounds) > 2 {
+		return nil, ex.Newf("invalid version constraint %q", s)
+	}
+	clause := make([]versionComparison, 0, len(bounds))
+	for i, bound := range bounds {
+		v, err := parseVersion(strings.TrimSpace(bound), s)
+		if err != nil {
+			return nil, err
+		}
+		op := ">="
+		if i == 1 {
+			op = "<"
+		}
+		clause = append(clause, versionComparison{op: op, version: v})
+	}
+	return &VersionConstraint{raw: s, clauses: [][]versionComparison{clause}}, nil
+}
+
+// ParseVersionConstraint parses the version constraint of a rule.
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, ex.Newf("empty version constraint")
+	}
+	// Without operators, a comma separates the bounds of the legacy syntax
+	if !strings.ContainsAny(s, "<>=!|") && (strings.Contains(s, ",") || !strings.ContainsAny(s, " \t")) {
+		return parseLegacyVersionConstraint(s)
+	}
+	vc := &VersionConstraint{raw: s}
+	for part := range strings.SplitSeq(s, "||") {
+		clause := make([]versionComparison, 0)
+		terms := strings.FieldsFunc(part, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		for i := 0; i < len(terms); i++ {
+			op, term := "=", terms[i]
+			for _, candidate := range versionOperators {
+				if rest, ok := strings.CutPrefix(term, candidate); ok {
+					op, term = candidate, rest
+					break
+				}
+			}
+			// The operator may be separated from its version
+			if term == "" && i+1 < len(terms) {
+				i++
+				term = terms[i]
+			}
+			v, err := parseVersion(term, s)
+			if err != nil {
+				return nil, err
+			}
+			clause = append(clause, versionComparison{op: op, version: v})
+		}
+		if len(clause) == 0 {
+			return nil, ex.Newf("empty clause in version constraint %q", s)
+		}
+		vc.clauses = append(vc.clauses, clause)
+	}
+	return vc, nil
+}
+
+func (c versionComparison) check(v string) bool {
+	cmp := semver.Compare(v, c.version)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Check reports whether the version satisfies the constraint. Invalid versions
+// never do.
+func (vc *VersionConstraint) Check(v string) bool {
+	if !semver.IsValid(v) {
+		return false
+	}
+	for _, clause := range vc.clauses {
+		ok := true
+		for _, c := range clause {
+			if !c.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (vc *VersionConstraint) String() string { return vc.raw }
@@ -0,0 +1,80 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		// Legacy syntax
+		{"v1.0.0", "v1.0.0", true},
+		{"v1.0.0", "v0.9.9", false},
+		{"v1.0.0,v2.0.0", "v1.5.0-alpha", true},
+		{"v1.0.0,v2.0.0", "v2.0.0", false},
+		{"1.0.0,2.0.0", "v1.9.9", true},
+		{"v1.0.0, v2.0.0", "v1.0.0", true},
+		{"v1.0.0, v2.0.0", "v1.5.0", true},
+		{"v1.0.0, v2.0.0", "v2.0.0", false},
+		{"v1.0.0 ,v2.0.0", "v1.5.0", true},
+		// Comparisons
+		{">=v1.2.0 <v1.5.0", "v1.4.9", true},
+		{">=v1.2.0 <v1.5.0", "v1.5.0", false},
+		{">v1.2.0", "v1.2.0", false},
+		{"<=v1.2.0", "v1.2.0+meta", true},
+		{"=v1.2.0", "v1.2.0", true},
+		{">= v1.2.0", "v1.2.0", true},
+		{">= v1.2.0", "v1.1.9", false},
+		{">= v1.2.0, < v1.5.0", "v1.4.9", true},
+		{">= v1.2.0, < v1.5.0", "v1.5.0", false},
+		{"v1.2.0 || v1.3.0", "v1.3.0", true},
+		{"v1.2.0 || v1.3.0", "v1.2.5", false},
+		// Unions and exclusions
+		{">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3", "v1.3.0", true},
+		{">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3", "v1.7.0", false},
+		{">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3", "v2.1.3", false},
+		{">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3", "v2.1.4", true},
+		// Pre-releases are ordered before their release
+		{">=v2.0.0", "v2.0.0-rc.1", false},
+		{"<v2.0.0", "v2.0.0-rc.1", true},
+		{"<v2.0.0-0", "v2.0.0-rc.1", false},
+		{">=v1.2.3 <v1.2.4", "v1.2.4-0.20240101000000-abcdef123456", true},
+		// Unknown versions never match
+		{"!=v1.0.0", "", false},
+		{">=v0.0.0", "(devel)", false},
+	}
+	for _, tt := range tests {
+		vc, err := ParseVersionConstraint(tt.constraint)
+		require.NoError(t, err, tt.constraint)
+		assert.Equal(t, tt.expected, vc.Check(tt.version), "%s in %s", tt.version, tt.constraint)
+		assert.Equal(t, tt.constraint, vc.String())
+	}
+}
+
+func TestParseVersionConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{
+		"",
+		"v1.0.0,v2.0.0,v3.0.0",
+		"v1.0.0, ",
+		">= <v2.0.0",
+		">= || <v2.0.0",
+		"v1.x",
+		">=v1.0.0 ||",
+		"|| <v2.0.0",
+		">=",
+		"~v1.2.0",
+		">=v1.0.0 <latest",
+	} {
+		_, err := ParseVersionConstraint(constraint)
+		require.Error(t, err, constraint)
+	}
+}
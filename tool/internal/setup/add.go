@@ -5,14 +5,20 @@ package setup
 
 import (
 	"fmt"
+	"go/parser"
+	"go/token"
 	"maps"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/dave/dst"
 
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
 )
 
 const (
@@ -26,10 +32,17 @@ var requiredImports = map[string]string{
 	"unsafe":        "_",           // The golinkname tag depends on unsafe
 }
 
-func genImportDecl(matched []*rule.InstFuncRule) []dst.Decl {
+func genImportDecl(matched []*rule.InstFuncRule, injected []string) []dst.Decl {
 	for _, m := range matched {
 		requiredImports[m.Path] = ast.IdentIgnore
 	}
+	// The packages imported by injected code are not necessarily dependencies
+	// of the program, import them to link them into the binary
+	for _, path := range injected {
+		if _, ok := requiredImports[path]; !ok {
+			requiredImports[path] = ast.IdentIgnore
+		}
+	}
 	importDecls := make([]dst.Decl, 0, len(requiredImports))
 	// Sort the keys to ensure deterministic order
 	for _, k := range slices.Sorted(maps.Keys(requiredImports)) {
@@ -89,6 +102,97 @@ func genVarDecl(matched []*rule.InstFuncRule) []dst.Decl {
 	return decls
 }
 
+// fileRuleImports returns the import paths of the file introduced by the rule.
+func fileRuleImports(r *rule.InstFileRule) ([]string, error) {
+	files, err := util.ListFiles(util.GetRuleDir(r.Path))
+	if err != nil {
+		return nil, err
+	}
+	index := slices.IndexFunc(files, func(file string) bool {
+		return strings.HasSuffix(file, r.File)
+	})
+	if index == -1 {
+		return nil, ex.Newf("file %s not found", r.File)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), files[index], nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to parse %s", files[index])
+	}
+	paths := make([]string, 0, len(f.Imports))
+	for _, spec := range f.Imports {
+		path, err1 := strconv.Unquote(spec.Path.Value)
+		if err1 != nil {
+			return nil, ex.Wrapf(err1, "invalid import %s in %s", spec.Path.Value, files[index])
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// isLinkable reports whether the main package can import the package to link
+// it into the binary, which excludes pseudo packages and internal packages.
+func isLinkable(path string) bool {
+	if path == "unsafe" || path == "C" {
+		return false
+	}
+	return !slices.Contains(strings.Split(path, "/"), "internal")
+}
+
+// ruleImports returns the packages imported by the raw code, the variable values
+// and the files that the matched rules inject, sorted and deduplicated.
+func ruleImports(matched []*rule.InstRuleSet) ([]string, error) {
+	paths := make([]string, 0)
+	for _, m := range matched {
+		for _, r := range m.GetRawRules() {
+			paths = slices.AppendSeq(paths, maps.Values(r.Imports))
+		}
+		for _, r := range m.GetVarRules() {
+			paths = slices.AppendSeq(paths, maps.Values(r.Imports))
+		}
+		for _, r := range m.FileRules {
+			imports, err := fileRuleImports(r)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, imports...)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// injectedImports returns the packages imported by the injected code that must
+// be linked into the binary. Internal packages are left out, they can only be
+// imported by the packages that they belong to.
+func injectedImports(matched []*rule.InstRuleSet) ([]string, error) {
+	paths, err := ruleImports(matched)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(paths, func(path string) bool { return !isLinkable(path) }), nil
+}
+
+// exportedImports returns the packages whose export data the compiler may need
+// to compile the injected code, i.e. the ones imported by the injected code and
+// by the types of the call site wrappers, sorted and deduplicated.
+func exportedImports(matched []*rule.InstRuleSet) ([]string, error) {
+	paths, err := ruleImports(matched)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matched {
+		for _, r := range m.GetCallRules() {
+			for _, site := range r.Sites {
+				paths = slices.AppendSeq(paths, maps.Keys(site.Imports))
+			}
+		}
+	}
+	// The pseudo packages have no export data
+	paths = slices.DeleteFunc(paths, func(path string) bool { return path == "unsafe" || path == "C" })
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
 func buildOtelRuntimeAst(decls []dst.Decl) *dst.File {
 	const comment = "// This file is generated by the opentelemetry-go-compile-instrumentation tool. DO NOT EDIT."
 	return &dst.File{
@@ -100,27 +204,53 @@ func buildOtelRuntimeAst(decls []dst.Decl) *dst.File {
 	}
 }
 
-// addDeps generates and writes otel.runtime.go with required imports and variable
-// declarations for OpenTelemetry instrumentation based on matched rules.
-func (sp *SetupPhase) addDeps(matched []*rule.InstRuleSet, packagePath string) error {
+// hookRules returns the func rules of the matched rule sets, along with the ones
+// standing for the hooks of other rules, whose hook code must be linked and
+// requires the same runtime support.
+func hookRules(matched []*rule.InstRuleSet) []*rule.InstFuncRule {
 	rules := make([]*rule.InstFuncRule, 0)
 	for _, m := range matched {
 		funcRules := m.GetFuncRules()
 		rules = append(rules, funcRules...)
+		// Call rules inject hooks into generated wrappers of call sites
+		for _, cr := range m.GetCallRules() {
+			rules = append(rules, cr.WrapperRule(""))
+		}
+		// Var rules may wrap initializers in hooks
+		for _, vr := range m.GetVarRules() {
+			if vr.Hook != "" {
+				rules = append(rules, &rule.InstFuncRule{InstBaseRule: vr.InstBaseRule, Path: vr.Path})
+			}
+		}
+		// Goroutine rules call the capture and restore hooks
+		for _, gr := range m.GetGoroutineRules() {
+			rules = append(rules, &rule.InstFuncRule{InstBaseRule: gr.InstBaseRule, Path: gr.Path})
+		}
+	}
+	return rules
+}
+
+// addDeps generates and writes otel.runtime.go with required imports and variable
+// declarations for OpenTelemetry instrumentation based on matched rules.
+func (sp *SetupPhase) addDeps(matched []*rule.InstRuleSet, packagePath string) error {
+	rules := hookRules(matched)
+	injected, err := injectedImports(matched)
+	if err != nil {
+		return err
 	}
-	if len(rules) == 0 {
+	if len(rules) == 0 && len(injected) == 0 {
 		return nil
 	}
 
 	// Add required imports
-	importDecls := genImportDecl(rules)
+	importDecls := genImportDecl(rules, injected)
 	// Generate the variable declarations that used by otel runtime
 	varDecls := genVarDecl(rules)
 	// Build the ast
 	root := buildOtelRuntimeAst(append(importDecls, varDecls...))
 	// Write the ast to file
 	otelRuntimeFilePath := filepath.Join(packagePath, OtelRuntimeFile)
-	err := ast.WriteFile(otelRuntimeFilePath, root)
+	err = ast.WriteFile(otelRuntimeFilePath, root)
 	if err != nil {
 		return err
 	}
@@ -106,3 +106,42 @@ func TestAddDeps_FileWriteError(t *testing.T) {
 	err := sp.addDeps(matched, invalidPath)
 	assert.Error(t, err)
 }
+
+func TestInjectedImports(t *testing.T) {
+	hookDir := t.TempDir()
+	const source = `package hook
+
+import (
+	_ "unsafe"
+	"internal/abi"
+	"time"
+	"github.com/example/dep"
+)
+`
+	require.NoError(t, os.WriteFile(filepath.Join(hookDir, "hook.go"), []byte(source), 0o600))
+
+	rs := rule.NewInstRuleSet("github.com/example/pkg")
+	raw := &rule.InstRawRule{Imports: map[string]string{"atomic": "sync/atomic", "tm": "time"}}
+	rs.AddRawRule(filepath.Join(hookDir, "main.go"), raw)
+	rs.AddFileRule(&rule.InstFileRule{File: "hook.go", Path: hookDir})
+	rs.AddVarRule(filepath.Join(hookDir, "main.go"),
+		&rule.InstVarRule{Imports: map[string]string{"xnet": "golang.org/x/net/http2"}})
+	imports, err := injectedImports([]*rule.InstRuleSet{rs})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"github.com/example/dep", "golang.org/x/net/http2", "sync/atomic", "time"}, imports)
+
+	// The compiler needs the export data of internal packages and of the types
+	// of call site wrappers as well
+	rs.AddCallRule(filepath.Join(hookDir, "main.go"), &rule.InstCallRule{
+		Sites: []*rule.CallSite{{Imports: map[string]string{"net/http": "http", "time": "time"}}},
+	})
+	imports, err = exportedImports([]*rule.InstRuleSet{rs})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"github.com/example/dep", "golang.org/x/net/http2", "internal/abi", "net/http", "sync/atomic", "time",
+	}, imports)
+
+	rs.AddFileRule(&rule.InstFileRule{File: "missing.go", Path: hookDir})
+	_, err = injectedImports([]*rule.InstRuleSet{rs})
+	require.ErrorContains(t, err, "file missing.go not found")
+}
@@ -0,0 +1,268 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// -----------------------------------------------------------------------------
+// Source Annotations
+//
+// The packages of the main module may be instrumented by directives in their
+// sources instead of rule files, e.g.
+//
+//	//otel:span name="checkout" kind="server" attrs="orderID,user.id=userID"
+//	func Checkout(ctx context.Context, orderID, userID string) error
+//
+// traces the function like a span rule, and
+//
+//	//otel:ignore
+//	func Healthz(w http.ResponseWriter, r *http.Request)
+//
+// excludes the function from all rules. Before the package clause, //otel:ignore
+// excludes the file, and //otel:ignore package excludes the whole package.
+
+const (
+	spanDirective    = "otel:span"
+	ignoreDirective  = "otel:ignore"
+	ignorePackageArg = "package"
+	directivePrefix  = "//otel:"
+	defaultSpanName  = rule.SpanRecvPlaceholder + "." + rule.SpanFuncPlaceholder
+)
+
+// ignoredFunc describes a function excluded from all rules.
+type ignoredFunc struct {
+	name     string // The qualified name, e.g. (*Repo).Get
+	from, to int    // The lines of the function declaration
+}
+
+// annotations holds the directives found in the sources of a package.
+type annotations struct {
+	ignorePackage bool
+	ignoredFiles  map[string]bool
+	ignoredFuncs  map[string][]*ignoredFunc // source -> ignored functions
+	spanRules     []rule.InstRule           // The rules of the span directives
+}
+
+// directiveArgs returns the text following the directive in the comment.
+func directiveArgs(comment, directive string) string {
+	return strings.TrimSpace(strings.TrimPrefix(comment, "//"+directive))
+}
+
+// parseDirectiveArgs parses the arguments of a directive, which are given as
+// key="value" pairs separated by spaces.
+func parseDirectiveArgs(text string) (map[string]string, error) {
+	args := make(map[string]string)
+	for text = strings.TrimSpace(text); text != ""; text = strings.TrimSpace(text) {
+		key, rest, ok := strings.Cut(text, "=")
+		if !ok || !token.IsIdentifier(key) {
+			return nil, ex.Newf("invalid argument %q, expected key=\"value\"", text)
+		}
+		if _, dup := args[key]; dup {
+			return nil, ex.Newf("duplicate argument %s", key)
+		}
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, ex.Newf("value of argument %s must be quoted", key)
+		}
+		args[key], _ = strconv.Unquote(quoted)
+		text = rest[len(quoted):]
+	}
+	return args, nil
+}
+
+// newSpanDirectiveRule creates the span rule of the span directive on the
+// function fn declared with receiver recv. The attrs argument lists the
+// parameters or results, each either by its name, which is also the attribute
+// key, or as key=name.
+func newSpanDirectiveRule(target, fn, recv string, args map[string]string) (*rule.InstSpanRule, error) {
+	fields := map[string]any{"target": target, "func": fn, "span": defaultSpanName}
+	if recv != "" {
+		fields["recv"] = recv
+	}
+	for _, key := range slices.Sorted(maps.Keys(args)) {
+		value := args[key]
+		switch key {
+		case "name":
+			fields["span"] = value
+		case "kind":
+			fields["kind"] = value
+		case "attrs":
+			attrs := make(map[string]string)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				attr, name, ok := strings.Cut(item, "=")
+				if !ok {
+					name = attr
+				}
+				attrs[strings.TrimSpace(attr)] = strings.TrimSpace(name)
+			}
+			fields["attributes"] = attrs
+		default:
+			return nil, ex.Newf("unknown argument %s, expected name, kind or attrs", key)
+		}
+	}
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, ex.Wrap(err)
+	}
+	return rule.NewInstSpanRule(data, fmt.Sprintf("%s#%s", spanDirective, rule.QualifiedFuncName(fn, recv)))
+}
+
+// scanFile collects the directives of the file.
+func (ann *annotations) scanFile(p *ast.AstParser, source, target string, tree *dst.File) error {
+	for _, comment := range tree.Decs.Start {
+		switch rule.ParseDirective(comment) {
+		case ignoreDirective:
+			switch args := directiveArgs(comment, ignoreDirective); args {
+			case "":
+				ann.ignoredFiles[source] = true
+			case ignorePackageArg:
+				ann.ignorePackage = true
+			default:
+				return ex.Newf("%s: unknown argument %q of %s, expected none or %s",
+					source, args, ignoreDirective, ignorePackageArg)
+			}
+		case spanDirective:
+			return ex.Newf("%s: %s must precede a function", source, spanDirective)
+		}
+	}
+
+	for _, funcDecl := range ast.ListFuncDecls(tree) {
+		for _, comment := range funcDecl.Decs.Start {
+			directive := rule.ParseDirective(comment)
+			if directive != spanDirective && directive != ignoreDirective {
+				continue
+			}
+			pos := p.FindPosition(funcDecl)
+			where := fmt.Sprintf("%s:%d", source, pos.Line)
+			fn, recv := funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl)
+			if directive == ignoreDirective {
+				if args := directiveArgs(comment, ignoreDirective); args != "" {
+					return ex.Newf("%s: unknown argument %q of %s on a function", where, args, ignoreDirective)
+				}
+				ann.ignoredFuncs[source] = append(ann.ignoredFuncs[source], &ignoredFunc{
+					name: rule.QualifiedFuncName(fn, recv),
+					from: pos.Line,
+					to:   p.FindEndPosition(funcDecl).Line,
+				})
+				continue
+			}
+			// Functions that can not be identified by name can not be traced
+			if fn == "init" || fn == ast.IdentIgnore || funcDecl.Body == nil {
+				return ex.Newf("%s: %s can not trace function %s", where, spanDirective, fn)
+			}
+			args, err := parseDirectiveArgs(directiveArgs(comment, spanDirective))
+			if err != nil {
+				return ex.Wrapf(err, "%s: invalid %s", where, spanDirective)
+			}
+			r, err := newSpanDirectiveRule(target, fn, recv, args)
+			if err != nil {
+				return ex.Wrapf(err, "%s: invalid %s", where, spanDirective)
+			}
+			ann.spanRules = append(ann.spanRules, r)
+		}
+	}
+	return nil
+}
+
+// scanAnnotations collects the directives in the sources of the dependency,
+// which are only honored in the main module.
+func scanAnnotations(dep *Dependency) (*annotations, error) {
+	ann := &annotations{
+		ignoredFiles: make(map[string]bool),
+		ignoredFuncs: make(map[string][]*ignoredFunc),
+	}
+	if !dep.Main {
+		return ann, nil
+	}
+	for _, source := range dep.Sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return nil, ex.Wrapf(err, "failed to read %s", source)
+		}
+		// Most files have no directives, do not bother parsing them
+		if !bytes.Contains(content, []byte(directivePrefix)) {
+			continue
+		}
+		p := ast.NewAstParser()
+		tree, err := p.Parse(source, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if err = ann.scanFile(p, source, dep.ImportPath, tree); err != nil {
+			return nil, err
+		}
+	}
+	return ann, nil
+}
+
+// deleteRules deletes the rules of the file that drop reports.
+func deleteRules[T rule.InstRule](rules map[string][]T, source string, drop func(T) bool) {
+	if remaining := slices.DeleteFunc(rules[source], drop); len(remaining) > 0 {
+		rules[source] = remaining
+	} else {
+		delete(rules, source)
+	}
+}
+
+// exclude removes the rules applied to the ignored files and functions from the
+// rule set. The call sites within ignored functions are removed from the call
+// rules, which are removed once they have no call site left, and the ignored
+// functions are added to the functions skipped by the goroutine rules, so that
+// their go statements are not rewritten either.
+func (ann *annotations) exclude(set *rule.InstRuleSet) {
+	for source := range ann.ignoredFiles {
+		delete(set.RawRules, source)
+		delete(set.FuncRules, source)
+		delete(set.StructRules, source)
+		delete(set.CallRules, source)
+		delete(set.VarRules, source)
+		delete(set.GoroutineRules, source)
+	}
+	for source, funcs := range ann.ignoredFuncs {
+		names := make([]string, 0, len(funcs))
+		for _, f := range funcs {
+			names = append(names, f.name)
+		}
+		deleteRules(set.FuncRules, source, func(r *rule.InstFuncRule) bool {
+			return slices.Contains(names, rule.QualifiedFuncName(r.Func, r.Recv))
+		})
+		deleteRules(set.RawRules, source, func(r *rule.InstRawRule) bool {
+			return slices.Contains(names, rule.QualifiedFuncName(r.Func, r.Recv))
+		})
+		deleteRules(set.CallRules, source, func(r *rule.InstCallRule) bool {
+			r.Sites = slices.DeleteFunc(r.Sites, func(site *rule.CallSite) bool {
+				return slices.ContainsFunc(funcs, func(f *ignoredFunc) bool {
+					return f.from <= site.Line && site.Line <= f.to
+				})
+			})
+			return len(r.Sites) == 0
+		})
+		// Goroutine rules are shared by the files they apply to
+		for i, r := range set.GoroutineRules[source] {
+			c := *r
+			c.Skip = slices.Concat(r.Skip, names)
+			set.GoroutineRules[source][i] = &c
+		}
+	}
+}
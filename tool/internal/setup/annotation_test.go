@@ -0,0 +1,215 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+func TestParseDirectiveArgs(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected map[string]string
+		errMsg   string
+	}{
+		{text: "", expected: map[string]string{}},
+		{
+			text:     `name="checkout"  attrs="orderID, user.id=userID"`,
+			expected: map[string]string{"name": "checkout", "attrs": "orderID, user.id=userID"},
+		},
+		{text: `name="say \"hi\""`, expected: map[string]string{"name": `say "hi"`}},
+		{text: `name=checkout`, errMsg: "value of argument name must be quoted"},
+		{text: `"checkout"`, errMsg: `invalid argument "\"checkout\"", expected key="value"`},
+		{text: `name="a" name="b"`, errMsg: "duplicate argument name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			args, err := parseDirectiveArgs(tt.text)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, args)
+		})
+	}
+}
+
+const annotationTestSource = `package shop
+
+import "context"
+
+type Cart struct{}
+
+//otel:span name="checkout" kind="server" attrs="orderID,user.id=userID"
+func Checkout(ctx context.Context, orderID, userID string) error {
+	return nil
+}
+
+// Add adds an item to the cart.
+//
+//otel:span
+func (c *Cart) Add(item string) {}
+
+//otel:ignore
+func Healthz() {
+	Checkout(nil, "", "")
+}
+
+func List() {}
+`
+
+func TestScanAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "shop.go")
+	ignored := filepath.Join(dir, "ignored.go")
+	require.NoError(t, os.WriteFile(source, []byte(annotationTestSource), 0o644))
+	require.NoError(t, os.WriteFile(ignored, []byte("//otel:ignore\n\npackage shop\n\nfunc Find() {}\n"), 0o644))
+
+	dep := &Dependency{ImportPath: "example.com/shop", Sources: []string{source, ignored}, Main: true}
+	ann, err := scanAnnotations(dep)
+	require.NoError(t, err)
+	assert.False(t, ann.ignorePackage)
+	assert.Equal(t, map[string]bool{ignored: true}, ann.ignoredFiles)
+	assert.Equal(t, []*ignoredFunc{{name: "Healthz", from: 18, to: 20}}, ann.ignoredFuncs[source])
+
+	require.Len(t, ann.spanRules, 2)
+	checkout := ann.spanRules[0].(*rule.InstSpanRule)
+	assert.Equal(t, "otel:span#Checkout", checkout.Name)
+	assert.Equal(t, "example.com/shop", checkout.Target)
+	assert.Equal(t, "checkout", checkout.Span)
+	assert.Equal(t, "server", checkout.Kind)
+	assert.Equal(t, map[string]string{"orderID": "orderID", "user.id": "userID"}, checkout.Attributes)
+	add := ann.spanRules[1].(*rule.InstSpanRule)
+	assert.Equal(t, "otel:span#(*Cart).Add", add.Name)
+	assert.Equal(t, "*Cart", add.Recv)
+	assert.Equal(t, "{recv}.{func}", add.Span)
+
+	// Directives are only honored in the main module
+	dep.Main = false
+	ann, err = scanAnnotations(dep)
+	require.NoError(t, err)
+	assert.Empty(t, ann.spanRules)
+	assert.Empty(t, ann.ignoredFiles)
+}
+
+func TestScanAnnotationsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		errMsg string
+	}{
+		{
+			name:   "span on package",
+			source: "//otel:span\npackage shop\n",
+			errMsg: "otel:span must precede a function",
+		},
+		{
+			name:   "unknown ignore argument",
+			source: "//otel:ignore all\npackage shop\n",
+			errMsg: `unknown argument "all" of otel:ignore, expected none or package`,
+		},
+		{
+			name:   "unknown span argument",
+			source: "package shop\n\n//otel:span span=\"x\"\nfunc F() {}\n",
+			errMsg: "unknown argument span, expected name, kind or attrs",
+		},
+		{
+			name:   "unknown attribute",
+			source: "package shop\n\n//otel:span attrs=\"id\"\nfunc F() {}\n",
+			errMsg: `refers to "id", which is not a parameter or result of F`,
+		},
+		{
+			name:   "invalid kind",
+			source: "package shop\n\n//otel:span kind=\"remote\"\nfunc F() {}\n",
+			errMsg: "kind must be one of",
+		},
+		{
+			name:   "init function",
+			source: "package shop\n\n//otel:span\nfunc init() {}\n",
+			errMsg: "otel:span can not trace function init",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), "shop.go")
+			require.NoError(t, os.WriteFile(source, []byte(tt.source), 0o644))
+			dep := &Dependency{ImportPath: "example.com/shop", Sources: []string{source}, Main: true}
+			ann, err := scanAnnotations(dep)
+			if err == nil {
+				// Attributes are checked against the function when matched
+				set := rule.NewInstRuleSet(dep.ImportPath)
+				_, err = newTestSetupPhase().preciseMatching(dep, ann.spanRules, set)
+			}
+			require.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestRunMatchAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "shop.go")
+	require.NoError(t, os.WriteFile(source, []byte(annotationTestSource), 0o644))
+	dep := &Dependency{ImportPath: "example.com/shop", Sources: []string{source}, Main: true}
+
+	content := "target: example.com/shop\nfunc: \"*\"\nbefore: Before\npath: example.com/hooks"
+	fr, err := rule.NewInstFuncRule([]byte(content), "all")
+	require.NoError(t, err)
+	rulesByTarget := map[string][]rule.InstRule{dep.ImportPath: {fr}}
+
+	set, err := newTestSetupPhase().runMatch(dep, rulesByTarget, nil)
+	require.NoError(t, err)
+	funcRules := make([]string, 0)
+	for _, r := range set.FuncRules[source] {
+		funcRules = append(funcRules, r.GetName())
+	}
+	assert.ElementsMatch(t, []string{"all#Checkout", "all#List"}, funcRules)
+	rawRules := make([]string, 0)
+	for _, r := range set.RawRules[source] {
+		rawRules = append(rawRules, r.GetName())
+	}
+	assert.ElementsMatch(t, []string{"otel:span#Checkout", "otel:span#(*Cart).Add"}, rawRules)
+
+	// The whole package is ignored
+	require.NoError(t, os.WriteFile(source, []byte("//otel:ignore package\n"+annotationTestSource), 0o644))
+	set, err = newTestSetupPhase().runMatch(dep, rulesByTarget, nil)
+	require.NoError(t, err)
+	assert.True(t, set.IsEmpty())
+}
+
+func TestExcludeAnnotations(t *testing.T) {
+	const source = "/src/shop.go"
+	set := rule.NewInstRuleSet("example.com/shop")
+	set.AddCallRule(source, &rule.InstCallRule{
+		InstBaseRule: rule.InstBaseRule{Name: "call"},
+		Sites:        []*rule.CallSite{{Line: 3}, {Line: 12}},
+	})
+	set.AddCallRule(source, &rule.InstCallRule{
+		InstBaseRule: rule.InstBaseRule{Name: "inner"},
+		Sites:        []*rule.CallSite{{Line: 4}},
+	})
+	goroutineRule := &rule.InstGoroutineRule{InstBaseRule: rule.InstBaseRule{Name: "go"}, Goroutine: "*"}
+	set.AddGoroutineRule(source, goroutineRule)
+	set.AddVarRule("/src/vars.go", &rule.InstVarRule{InstBaseRule: rule.InstBaseRule{Name: "var"}})
+
+	ann := &annotations{
+		ignoredFiles: map[string]bool{"/src/vars.go": true},
+		ignoredFuncs: map[string][]*ignoredFunc{source: {{name: "(*Cart).Add", from: 2, to: 5}}},
+	}
+	ann.exclude(set)
+
+	require.Len(t, set.CallRules[source], 1)
+	assert.Equal(t, []*rule.CallSite{{Line: 12}}, set.CallRules[source][0].Sites)
+	require.Len(t, set.GoroutineRules[source], 1)
+	assert.Equal(t, []string{"(*Cart).Add"}, set.GoroutineRules[source][0].Skip)
+	assert.Empty(t, goroutineRule.Skip, "shared rules are not modified")
+	assert.Empty(t, set.VarRules)
+}
@@ -0,0 +1,201 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/version"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// variantsKey is the rule field listing the variants of a rule. Each variant
+// is a partial rule whose fields override the ones of the declaring rule.
+const variantsKey = "variants"
+
+type ruleVariant struct {
+	name      string
+	variantOf string
+	fields    map[string]any
+}
+
+// expandVariants expands the rule into its variants, or returns the rule itself
+// if it has none. Variants are named after their index, e.g. "foo/1".
+func expandVariants(name string, fields map[string]any) ([]*ruleVariant, error) {
+	value, ok := fields[variantsKey]
+	if !ok {
+		return []*ruleVariant{{name: name, fields: fields}}, nil
+	}
+	list, ok := value.([]any)
+	if !ok || len(list) == 0 {
+		return nil, ex.Newf("invalid rule %q: variants must be a non-empty list", name)
+	}
+	variants := make([]*ruleVariant, 0, len(list))
+	for i, item := range list {
+		override, ok1 := item.(map[string]any)
+		if !ok1 {
+			return nil, ex.Newf("invalid rule %q: variant %d is not a mapping", name, i)
+		}
+		merged := maps.Clone(fields)
+		delete(merged, variantsKey)
+		maps.Copy(merged, override)
+		variants = append(variants, &ruleVariant{
+			name:      fmt.Sprintf("%s/%d", name, i),
+			variantOf: name,
+			fields:    merged,
+		})
+	}
+	return variants, nil
+}
+
+// createRuleFromVariant creates the rule and validates when it applies.
+func createRuleFromVariant(v *ruleVariant) (rule.InstRule, error) {
+	raw, err := yaml.Marshal(v.fields)
+	if err != nil {
+		return nil, ex.Wrap(err)
+	}
+	r, err := createRuleFromFields(raw, v.name, v.fields)
+	if err != nil {
+		return nil, err
+	}
+	r.GetCondition().VariantOf = v.variantOf
+	if err = validateApplicability(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// normalizeGoVersion turns the GOVERSION of the toolchain into a version that
+// go/version understands. Development toolchains report something like
+// "devel go1.27-abcdef Tue Jan 1 00:00:00 2026 +0000", which is treated as the
+// language version it's developing.
+func normalizeGoVersion(goVersion string) string {
+	for field := range strings.FieldsSeq(goVersion) {
+		field, _, _ = strings.Cut(field, "-")
+		if version.IsValid(field) {
+			return field
+		}
+	}
+	return goVersion
+}
+
+// findBuildTags returns the tags given by -tags flags in the arguments, which
+// may be the go build command or the GOFLAGS.
+func findBuildTags(args []string) []string {
+	tags := make([]string, 0)
+	for i, arg := range args {
+		flag := "-" + strings.TrimLeft(arg, "-")
+		value := ""
+		switch {
+		case flag == "-tags" && i+1 < len(args):
+			value = args[i+1]
+		case strings.HasPrefix(flag, "-tags="):
+			value = strings.TrimPrefix(flag, "-tags=")
+		default:
+			continue
+		}
+		// Tags are comma-separated, the space-separated form is deprecated
+		for tag := range strings.FieldsFuncSeq(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// findBuildFlags returns the flags in the arguments of the go build command that
+// change how packages are built, e.g. -tags, -race and -gcflags, which must be
+// given to the other go commands building the packages as part of the build.
+func findBuildFlags(args []string) []string {
+	flags := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch name {
+		case "race", "msan", "asan", "cover", "trimpath":
+			flags = append(flags, args[i])
+		case "tags", "gcflags", "asmflags", "mod", "modfile", "pgo", "buildmode",
+			"installsuffix", "covermode", "coverpkg", "overlay":
+			flags = append(flags, args[i])
+			if !hasValue && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		}
+	}
+	return flags
+}
+
+// newBuildEnv describes the build of the go build command by querying the
+// environment of the toolchain in use.
+func newBuildEnv(ctx context.Context, args []string) (*rule.BuildEnv, error) {
+	out, err := exec.CommandContext(ctx, "go", "env", "-json",
+		"GOVERSION", "GOOS", "GOARCH", "CGO_ENABLED", "GOFLAGS").Output()
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to run go env")
+	}
+	var goEnv map[string]string
+	if err = json.Unmarshal(out, &goEnv); err != nil {
+		return nil, ex.Wrapf(err, "failed to parse go env")
+	}
+	return &rule.BuildEnv{
+		GoVersion: normalizeGoVersion(goEnv["GOVERSION"]),
+		GOOS:      goEnv["GOOS"],
+		GOARCH:    goEnv["GOARCH"],
+		CgoEnable: goEnv["CGO_ENABLED"] == "1",
+		Tags:      findBuildTags(append(strings.Fields(goEnv["GOFLAGS"]), args...)),
+	}, nil
+}
+
+// filterRulesByBuild drops the rules whose build conditions do not hold. It
+// fails if a required rule applies neither by itself nor by any variant.
+func (sp *SetupPhase) filterRulesByBuild(rules []rule.InstRule, env *rule.BuildEnv) ([]rule.InstRule, error) {
+	filtered := make([]rule.InstRule, 0, len(rules))
+	required := make(map[string][]rule.InstRule)
+	applied := make(map[string]bool)
+	for _, r := range rules {
+		cond := r.GetCondition()
+		group := cond.VariantOf
+		if group == "" {
+			group = r.GetName()
+		}
+		if cond.Required {
+			required[group] = append(required[group], r)
+		}
+		ok, err := cond.MatchBuild(env)
+		if err != nil {
+			return nil, ex.Wrapf(err, "invalid rule %q", r.GetName())
+		}
+		if !ok {
+			sp.Debug("Skip rule for build", "rule", r, "condition", cond.ConditionString())
+			continue
+		}
+		applied[group] = true
+		filtered = append(filtered, r)
+	}
+	for _, group := range slices.Sorted(maps.Keys(required)) {
+		if applied[group] {
+			continue
+		}
+		conds := make([]string, 0)
+		for _, r := range required[group] {
+			conds = append(conds, r.GetCondition().ConditionString())
+		}
+		return nil, ex.Newf("no variant of required rule %q applies to %s %s/%s with tags %v, supported: %s",
+			group, env.GoVersion, env.GOOS, env.GOARCH, env.Tags, strings.Join(conds, ", "))
+	}
+	return filtered, nil
+}
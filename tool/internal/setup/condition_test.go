@@ -0,0 +1,103 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const conditionTestRules = `
+newproc:
+  target: runtime
+  func: newproc1
+  raw: "_unused(callergp)"
+  required: true
+  variants:
+    - go: "<1.23"
+      raw: "_unused(callerg)"
+    - go: ">=1.23,<1.26"
+    - go: ">=1.26"
+      goos: linux
+      raw: "_unused(parent)"
+cgo_only:
+  target: net
+  func: Dial
+  raw: "_unused(network)"
+  tags: "cgo && !netgo"
+`
+
+func filteredRuleNames(t *testing.T, env *rule.BuildEnv) []string {
+	rules, err := parseRuleFromYaml("", []byte(conditionTestRules))
+	require.NoError(t, err)
+	filtered, err := newTestSetupPhase().filterRulesByBuild(rules, env)
+	require.NoError(t, err)
+	names := make([]string, 0)
+	for _, r := range filtered {
+		names = append(names, r.GetName())
+	}
+	return names
+}
+
+func TestFilterRulesByBuild(t *testing.T) {
+	env := &rule.BuildEnv{GoVersion: "go1.24.1", GOOS: "darwin", GOARCH: "arm64", CgoEnable: true}
+	assert.ElementsMatch(t, []string{"newproc/1", "cgo_only"}, filteredRuleNames(t, env))
+
+	env = &rule.BuildEnv{GoVersion: "go1.22.0", GOOS: "linux", GOARCH: "amd64", Tags: []string{"netgo"}}
+	assert.ElementsMatch(t, []string{"newproc/0"}, filteredRuleNames(t, env))
+
+	rules, err := parseRuleFromYaml("", []byte(conditionTestRules))
+	require.NoError(t, err)
+	for _, r := range rules {
+		if r.GetName() == "newproc/2" {
+			fr, ok := r.(*rule.InstRawRule)
+			require.True(t, ok)
+			assert.Equal(t, "_unused(parent)", fr.Raw)
+			assert.Equal(t, "newproc1", fr.Func)
+			assert.Equal(t, "newproc", fr.VariantOf)
+			assert.True(t, fr.Required)
+		}
+	}
+}
+
+func TestFilterRulesByBuildRequired(t *testing.T) {
+	rules, err := parseRuleFromYaml("", []byte(conditionTestRules))
+	require.NoError(t, err)
+	env := &rule.BuildEnv{GoVersion: "go1.26.0", GOOS: "windows", GOARCH: "amd64"}
+	_, err = newTestSetupPhase().filterRulesByBuild(rules, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `no variant of required rule "newproc" applies to go1.26.0 windows/amd64`)
+	assert.Contains(t, err.Error(), "{go: >=1.26, goos: linux}")
+}
+
+func TestParseConditionalRuleInvalid(t *testing.T) {
+	for _, data := range []string{
+		"r: {target: main, func: A, raw: x, go: \">=1.x\"}",
+		"r: {target: main, func: A, raw: x, tags: \"a &&\"}",
+		"r: {target: main, func: A, raw: x, variants: []}",
+		"r: {target: main, func: A, raw: x, variants: [1]}",
+		"r: {target: main, func: A, raw: x, version: \">=v1.0.0 ||\"}",
+		"r: {target: main, func: A, raw: x, variants: [{version: v1.x}]}",
+	} {
+		_, err := parseRuleFromYaml("", []byte(data))
+		require.Error(t, err, data)
+	}
+}
+
+func TestFindBuildTags(t *testing.T) {
+	args := []string{"go", "build", "-tags", "a,b", "--tags=c", "-tags=a d", "./..."}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, findBuildTags(args))
+	assert.Empty(t, findBuildTags([]string{"go", "build", "-o", "tags"}))
+	args = []string{
+		"build", "-o", "app", "-race", "-tags", "a b", "--gcflags=all=-N -l", "-trimpath", "-mod", "vendor", ".",
+	}
+	assert.Equal(t, []string{"-race", "-tags", "a b", "--gcflags=all=-N -l", "-trimpath", "-mod", "vendor"},
+		findBuildFlags(args))
+	assert.Equal(t, "go1.27", normalizeGoVersion("devel go1.27-abcdef Tue Jan 1 00:00:00 2026 +0000"))
+	assert.Equal(t, "go1.24.3", normalizeGoVersion("go1.24.3"))
+}
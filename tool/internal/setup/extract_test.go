@@ -0,0 +1,45 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipTar(t *testing.T, name, content string) []byte {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzWriter)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+		Typeflag: tar.TypeReg,
+	}))
+	_, err := tarWriter.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzWriter.Close())
+	return buf.Bytes()
+}
+
+func TestExtractGZipOverwrite(t *testing.T) {
+	targetDir := t.TempDir()
+	targetFile := filepath.Join(targetDir, "hook.go")
+	require.NoError(t, os.WriteFile(targetFile, []byte("package hook // a longer stale file"), 0o644))
+
+	// Extracting over a longer file must not leave its tail behind
+	require.NoError(t, extractGZip(gzipTar(t, "hook.go", "package hook"), targetDir))
+	content, err := os.ReadFile(targetFile)
+	require.NoError(t, err)
+	assert.Equal(t, "package hook", string(content))
+}
@@ -23,6 +23,7 @@ type Dependency struct {
 	Version    string
 	Sources    []string
 	CgoFiles   map[string]string
+	Main       bool // Whether the package belongs to the main module
 }
 
 func (d *Dependency) String() string {
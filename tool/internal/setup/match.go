@@ -5,12 +5,16 @@ package setup
 
 import (
 	"context"
+	"maps"
 	"os"
+	"reflect"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 
-	"golang.org/x/mod/semver"
+	"github.com/dave/dst"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 
@@ -28,46 +32,149 @@ const (
 )
 
 // createRuleFromFields creates a rule instance based on the field type present in the YAML
-//
-//nolint:nilnil // factory function
 func createRuleFromFields(raw []byte, name string, fields map[string]any) (rule.InstRule, error) {
-	switch {
-	case fields["struct"] != nil:
+	kind := rule.KindOf(fields)
+	if kind == nil {
+		return nil, ex.Newf("rule %q must have one of the fields %s", name, rule.KindFields())
+	}
+	switch kind.Field {
+	case "struct":
 		return rule.NewInstStructRule(raw, name)
-	case fields["file"] != nil:
+	case "file":
 		return rule.NewInstFileRule(raw, name)
-	case fields["raw"] != nil:
+	case "methods":
+		return rule.NewInstMethodRule(raw, name)
+	case "var":
+		return rule.NewInstVarRule(raw, name)
+	case "goroutine":
+		return rule.NewInstGoroutineRule(raw, name)
+	case "interface":
+		return rule.NewInstInterfaceRule(raw, name)
+	case "call":
+		return rule.NewInstCallRule(raw, name)
+	case "span":
+		return rule.NewInstSpanRule(raw, name)
+	case "metric":
+		return rule.NewInstMetricRule(raw, name)
+	case "raw":
 		return rule.NewInstRawRule(raw, name)
-	case fields["func"] != nil:
-		return rule.NewInstFuncRule(raw, name)
 	default:
-		util.ShouldNotReachHere()
-		return nil, nil
+		return rule.NewInstFuncRule(raw, name)
 	}
 }
 
-func parseRuleFromYaml(content []byte) ([]rule.InstRule, error) {
-	var h map[string]map[string]any
-	err := yaml.Unmarshal(content, &h)
+// parseRuleFromYaml parses the rules of the YAML file. Errors are reported with
+// the position of the offending rule or field in the file.
+func parseRuleFromYaml(file string, content []byte) ([]rule.InstRule, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(content, &doc)
 	if err != nil {
-		return nil, ex.Wrap(err)
+		return nil, ex.Wrapf(err, "failed to parse %s", file)
 	}
 	rules := make([]rule.InstRule, 0)
-	for name, fields := range h {
-		raw, err1 := yaml.Marshal(fields)
+	// Empty file
+	if len(doc.Content) == 0 {
+		return rules, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, ex.Newf("%s: rules must be a mapping from names to rules", position(file, root))
+	}
+	templates, err := parseRuleTemplates(file, root)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		// The instrumentation block holds pointcut rules, the metadata block
+		// is for end-users only, and the defaults and templates are resolved
+		// when the rules are parsed
+		switch key.Value {
+		case rule.MetaKey, rule.DefaultsKey, rule.TemplatesKey:
+			continue
+		case rule.InstrumentationKey:
+			prs, err1 := parsePointcutRules(file, value)
+			if err1 != nil {
+				return nil, err1
+			}
+			for _, pr := range prs {
+				rules = append(rules, pr)
+			}
+			continue
+		}
+
+		rs, err1 := parseRule(file, key, value, templates)
 		if err1 != nil {
-			return nil, ex.Wrap(err1)
+			return nil, err1
 		}
+		rules = append(rules, rs...)
+	}
+	return rules, nil
+}
 
-		r, err2 := createRuleFromFields(raw, name, fields)
-		if err2 != nil {
-			return nil, err2
+// parseRule parses the rule and its variants.
+func parseRule(file string, key, node *yaml.Node, templates *ruleTemplates) ([]rule.InstRule, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, ex.Newf("%s: rule %q must be a mapping", position(file, node), key.Value)
+	}
+	var fields map[string]any
+	if err := node.Decode(&fields); err != nil {
+		return nil, atPosition(ex.Wrap(err), file, key)
+	}
+	fields, err := templates.resolve(fields)
+	if err != nil {
+		return nil, atPosition(ex.Wrapf(err, "invalid rule %q", key.Value), file, key)
+	}
+	variants, err := expandVariants(key.Value, fields)
+	if err != nil {
+		return nil, atPosition(err, file, key)
+	}
+	rules := make([]rule.InstRule, 0, len(variants))
+	for i, v := range variants {
+		if err = checkRuleFields(file, node, i, v); err != nil {
+			return nil, err
+		}
+		r, err1 := createRuleFromVariant(v)
+		if err1 != nil {
+			return nil, atPosition(err1, file, key)
 		}
 		rules = append(rules, r)
 	}
 	return rules, nil
 }
 
+// parsePointcutRules parses the items of the instrumentation block one by one,
+// so that errors are reported with the position of the item.
+func parsePointcutRules(file string, node *yaml.Node) ([]*rule.InstPointcutRule, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, ex.Newf("%s: %s must be a mapping", position(file, node), rule.InstrumentationKey)
+	}
+	allowed := rule.YAMLFields(reflect.TypeFor[rule.InstPointcutRule]())
+	rules := make([]*rule.InstPointcutRule, 0)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if err := checkFields(file, value, "instrumentation "+strconv.Quote(key.Value), allowed); err != nil {
+			return nil, err
+		}
+		item := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, value}}
+		raw, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, ex.Wrap(err)
+		}
+		prs, err := rule.NewInstPointcutRules(raw)
+		if err != nil {
+			return nil, atPosition(err, file, key)
+		}
+		for _, pr := range prs {
+			if err = validateApplicability(pr); err != nil {
+				return nil, atPosition(err, file, key)
+			}
+			rules = append(rules, pr)
+		}
+	}
+	return rules, nil
+}
+
 func loadDefaultRules() ([]rule.InstRule, error) {
 	// List all YAML files in the unzipped pkg directory, i.e. $BUILD_TEMP/pkg
 	files, err := util.ListFiles(util.GetBuildTemp(unzippedPkgDir))
@@ -84,7 +191,7 @@ func loadDefaultRules() ([]rule.InstRule, error) {
 		if err1 != nil {
 			return nil, ex.Wrapf(err1, "failed to read YAML file %s", file)
 		}
-		rs, err2 := parseRuleFromYaml(content)
+		rs, err2 := parseRuleFromYaml(file, content)
 		if err2 != nil {
 			return nil, err2
 		}
@@ -93,33 +200,91 @@ func loadDefaultRules() ([]rule.InstRule, error) {
 	return parsedRules, nil
 }
 
-func matchVersion(dependency *Dependency, rule rule.InstRule) bool {
-	// No version specified, so it's always applicable
-	if rule.GetVersion() == "" {
+// validateApplicability checks the build conditions and the version constraint
+// of the rule, so that malformed rules are reported when they are loaded.
+func validateApplicability(r rule.InstRule) error {
+	if err := r.GetCondition().ValidateCondition(); err != nil {
+		return ex.Wrapf(err, "invalid rule %q", r.GetName())
+	}
+	if r.GetVersion() != "" {
+		if _, err := rule.ParseVersionConstraint(r.GetVersion()); err != nil {
+			return ex.Wrapf(err, "invalid rule %q", r.GetName())
+		}
+	}
+	return nil
+}
+
+func matchVersion(dependency *Dependency, r rule.InstRule) bool {
+	// No version specified, so it's always applicable. Neither are local
+	// sources versioned, so they are assumed to be the latest
+	if r.GetVersion() == "" || dependency.Version == develVersion {
 		return true
 	}
+	// The constraint has been validated when the rule was loaded
+	vc, err := rule.ParseVersionConstraint(r.GetVersion())
+	if err != nil {
+		return false
+	}
+	return vc.Check(dependency.Version)
+}
+
+// runMatch performs precise matching of rules against the dependency's source code.
+// It parses source files and matches rules by examining AST nodes. The rules whose
+// targets are package patterns apply to all the packages that match them, and the
+// directives in the sources of the main module add span rules and exclude the
+// ignored code.
+func (sp *SetupPhase) runMatch(
+	dep *Dependency,
+	rulesByTarget map[string][]rule.InstRule,
+	pointcutRules []*rule.InstPointcutRule,
+) (*rule.InstRuleSet, error) {
+	ann, err := scanAnnotations(dep)
+	if err != nil {
+		return nil, err
+	}
+	if ann.ignorePackage {
+		sp.Info("Ignore package by directive", "dep", dep)
+		return rule.NewInstRuleSet(dep.ImportPath), nil
+	}
+	relevantRules := slices.Concat(targetedRules(dep, rulesByTarget), ann.spanRules)
+	set, err := sp.matchRules(dep, relevantRules, pointcutRules)
+	if err != nil {
+		return nil, err
+	}
+	ann.exclude(set)
+	return set, nil
+}
 
-	// Version range? i.e. "v0.11.0,v0.12.0"
-	ruleVersion := rule.GetVersion()
-	if strings.Contains(ruleVersion, ",") {
-		commaIndex := strings.Index(ruleVersion, ",")
-		//nolint:gocritic // commaIndex is always valid
-		startInclusive := ruleVersion[:commaIndex]
-		endExclusive := ruleVersion[commaIndex+1:]
-		// Version is in the "inclusive,exclusive" range
-		if semver.Compare(dependency.Version, startInclusive) >= 0 &&
-			semver.Compare(dependency.Version, endExclusive) < 0 {
-			return true
+// targetedRules returns the rules that target the dependency, either by its
+// import path or by a pattern matching it.
+func targetedRules(dep *Dependency, rulesByTarget map[string][]rule.InstRule) []rule.InstRule {
+	targeted := slices.Clone(rulesByTarget[dep.ImportPath])
+	for _, target := range slices.Sorted(maps.Keys(rulesByTarget)) {
+		if rule.IsPackagePattern(target) && rule.MatchPackagePattern(target, dep.ImportPath) {
+			targeted = append(targeted, rulesByTarget[target]...)
 		}
+	}
+	return targeted
+}
+
+// needsTypes tells whether the rule is matched against type information rather
+// than the syntax tree.
+func needsTypes(r rule.InstRule) bool {
+	switch r.(type) {
+	case *rule.InstInterfaceRule, *rule.InstCallRule:
+		return true
+	default:
 		return false
 	}
-	// Minimal version only? i.e. "v0.11.0"
-	return semver.Compare(dependency.Version, ruleVersion) >= 0
 }
 
-// runMatch performs precise matching of rules against the dependency's source code.
-// It parses source files and matches rules by examining AST nodes
-func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.InstRule) (*rule.InstRuleSet, error) {
+// matchRules matches the rules targeting the dependency and the pointcut rules
+// against the dependency.
+func (sp *SetupPhase) matchRules(
+	dep *Dependency,
+	relevantRules []rule.InstRule,
+	pointcutRules []*rule.InstPointcutRule,
+) (*rule.InstRuleSet, error) {
 	set := rule.NewInstRuleSet(dep.ImportPath)
 
 	if len(dep.CgoFiles) > 0 {
@@ -127,8 +292,21 @@ func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.
 		sp.Debug("Set CGO file map", "dep", dep.ImportPath, "cgoFiles", dep.CgoFiles)
 	}
 
-	// Filter rules by target
-	relevantRules := rulesByTarget[dep.ImportPath]
+	// Pointcut rules have no target, filter them by what the import path
+	// tells about their pointcuts
+	relevantPointcuts := make([]*rule.InstPointcutRule, 0)
+	for _, pr := range pointcutRules {
+		if pr.MayMatchPackage(dep.ImportPath) && matchVersion(dep, pr) {
+			relevantPointcuts = append(relevantPointcuts, pr)
+		}
+	}
+	if len(relevantPointcuts) > 0 {
+		err := sp.matchPointcutRules(dep, relevantPointcuts, set)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(relevantRules) == 0 {
 		return set, nil
 	}
@@ -137,6 +315,9 @@ func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.
 	filteredRules := make([]rule.InstRule, 0)
 	for _, r := range relevantRules {
 		if !matchVersion(dep, r) {
+			if dep.Version == "" {
+				sp.Warn("Skip versioned rule for unknown version", "rule", r, "dep", dep)
+			}
 			continue
 		}
 		filteredRules = append(filteredRules, r)
@@ -144,6 +325,8 @@ func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.
 
 	// Separate file rules from rules that need precise matching
 	preciseRules := make([]rule.InstRule, 0)
+	ifaceRules := make([]*rule.InstInterfaceRule, 0)
+	callRules := make([]*rule.InstCallRule, 0)
 	for _, r := range filteredRules {
 		// If the rule is a file rule, it is always applicable
 		if fr, ok := r.(*rule.InstFileRule); ok {
@@ -151,11 +334,36 @@ func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.
 			sp.Info("Match file rule", "rule", fr, "dep", dep)
 			continue
 		}
+		// Interface rules are matched against type information rather than
+		// the syntax tree
+		if ir, ok := r.(*rule.InstInterfaceRule); ok {
+			ifaceRules = append(ifaceRules, ir)
+			continue
+		}
+		// So are call rules, whose callees are only known after type checking
+		if cr, ok := r.(*rule.InstCallRule); ok {
+			callRules = append(callRules, cr)
+			continue
+		}
 		// We can't decide whether the rule is applicable yet, add it to the
 		// precise rules list to be processed later.
 		preciseRules = append(preciseRules, r)
 	}
 
+	if len(ifaceRules) > 0 {
+		err := sp.matchInterfaceRules(dep, ifaceRules, set)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(callRules) > 0 {
+		err := sp.matchCallRules(dep, callRules, set)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(preciseRules) == 0 {
 		return set, nil
 	}
@@ -163,6 +371,71 @@ func (sp *SetupPhase) runMatch(dep *Dependency, rulesByTarget map[string][]rule.
 	return sp.preciseMatching(dep, preciseRules, set)
 }
 
+// generatedFuncPrefixes lists the name prefixes of the functions generated by
+// the tool, i.e. the trampolines and the call site wrappers of the instrument
+// phase, and the helpers of injected code.
+//
+//nolint:gochecknoglobals // read-only, a slice can not be a constant
+var generatedFuncPrefixes = []string{
+	"_otel",
+	"OtelBeforeTrampoline",
+	"OtelAfterTrampoline",
+	"OtelAroundTrampoline",
+	"OtelCallSite",
+}
+
+// isGeneratedFunc reports whether the function is generated by the tool, which
+// must never be instrumented itself.
+func isGeneratedFunc(name string) bool {
+	return slices.ContainsFunc(generatedFuncPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
+
+// findSelectedFuncDecls returns all function declarations in the tree that are
+// selected by a non-exact selector, i.e. a glob pattern, a regular expression or
+// an exported_only switch. Functions that can never be instrumented by a pattern
+// are skipped: init functions, which may be declared multiple times and thus
+// can not be identified by name, blank functions, functions without body and
+// the functions generated by the tool.
+func findSelectedFuncDecls(tree *dst.File, sel *rule.FuncSelector) []*dst.FuncDecl {
+	found := make([]*dst.FuncDecl, 0)
+	for _, funcDecl := range ast.ListFuncDecls(tree) {
+		name := funcDecl.Name.Name
+		if name == "init" || name == ast.IdentIgnore || funcDecl.Body == nil || isGeneratedFunc(name) {
+			continue
+		}
+		if sel.Match(name, ast.ReceiverTypeName(funcDecl)) {
+			found = append(found, funcDecl)
+		}
+	}
+	return found
+}
+
+// findRuleFuncDecls returns the function declarations in the tree selected by
+// the selector of a rule, whose func and recv fields are fn and recv.
+func findRuleFuncDecls(tree *dst.File, sel *rule.FuncSelector, fn, recv string) []*dst.FuncDecl {
+	if !sel.IsExact() {
+		return findSelectedFuncDecls(tree, sel)
+	}
+	if funcDecl := ast.FindFuncDecl(tree, fn, recv); funcDecl != nil {
+		return []*dst.FuncDecl{funcDecl}
+	}
+	return nil
+}
+
+// findGoStmts returns the go statements of the functions in the tree whose
+// names are selected by the goroutine rule.
+func findGoStmts(tree *dst.File, sel *rule.NameSelector) []*dst.GoStmt {
+	found := make([]*dst.GoStmt, 0)
+	for _, funcDecl := range ast.ListFuncDecls(tree) {
+		if sel.Match(funcDecl.Name.Name) {
+			found = append(found, ast.FindGoStmts(funcDecl)...)
+		}
+	}
+	return found
+}
+
 // preciseMatching performs AST-based matching of instrumentation rules against
 // the dependency's source files. It returns the rule set with the matched rules.
 func (sp *SetupPhase) preciseMatching(
@@ -182,26 +455,92 @@ func (sp *SetupPhase) preciseMatching(
 		}
 		set.SetPackageName(tree.Name.Name)
 
+		// The number of rules generating code for every function, so that the
+		// generated variables are named apart
+		generated := make(map[string]int)
 		for _, r := range rules {
 			// Let's match with the rule precisely
 			switch rt := r.(type) {
 			case *rule.InstFuncRule:
-				funcDecl := ast.FindFuncDecl(tree, rt.Func, rt.Recv)
-				if funcDecl != nil {
-					set.AddFuncRule(source, rt)
-					sp.Info("Match func rule", "rule", rt, "dep", dep)
+				sel, err1 := rt.Selector()
+				if err1 != nil {
+					return nil, err1
+				}
+				if sel.IsExact() {
+					if ast.FindFuncDecl(tree, rt.Func, rt.Recv) != nil {
+						set.AddFuncRule(source, rt)
+						sp.Info("Match func rule", "rule", rt, "dep", dep)
+					}
+					continue
+				}
+				for _, funcDecl := range findSelectedFuncDecls(tree, sel) {
+					fr := rt.Instantiate(funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl))
+					set.AddFuncRule(source, fr)
+					sp.Info("Match func rule", "rule", fr, "dep", dep)
 				}
 			case *rule.InstStructRule:
-				structDecl := ast.FindStructDecl(tree, rt.Struct)
-				if structDecl != nil {
+				typeSpec := ast.FindTypeSpec(tree, rt.Struct)
+				if typeSpec != nil {
 					set.AddStructRule(source, rt)
 					sp.Info("Match struct rule", "rule", rt, "dep", dep)
 				}
 			case *rule.InstRawRule:
-				funcDecl := ast.FindFuncDecl(tree, rt.Func, rt.Recv)
-				if funcDecl != nil {
-					set.AddRawRule(source, rt)
-					sp.Info("Match raw rule", "rule", rt, "dep", dep)
+				sel, err1 := rt.Selector()
+				if err1 != nil {
+					return nil, err1
+				}
+				if sel.IsExact() {
+					if ast.FindFuncDecl(tree, rt.Func, rt.Recv) != nil {
+						set.AddRawRule(source, rt)
+						sp.Info("Match raw rule", "rule", rt, "dep", dep)
+					}
+					continue
+				}
+				for _, funcDecl := range findSelectedFuncDecls(tree, sel) {
+					rr := rt.Instantiate(funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl))
+					set.AddRawRule(source, rr)
+					sp.Info("Match raw rule", "rule", rr, "dep", dep)
+				}
+			case *rule.InstSpanRule:
+				rawRules, err1 := matchSpanRule(tree, rt, generated)
+				if err1 != nil {
+					return nil, err1
+				}
+				for _, rr := range rawRules {
+					set.AddRawRule(source, rr)
+					sp.Info("Match span rule", "rule", rr, "dep", dep)
+				}
+			case *rule.InstMetricRule:
+				rawRules, err1 := matchMetricRule(tree, rt, generated)
+				if err1 != nil {
+					return nil, err1
+				}
+				for _, rr := range rawRules {
+					set.AddRawRule(source, rr)
+					sp.Info("Match metric rule", "rule", rr, "dep", dep)
+				}
+			case *rule.InstMethodRule:
+				matched, err1 := matchMethodRule(source, tree, rt, set)
+				if err1 != nil {
+					return nil, ex.Wrapf(err1, "invalid method rule %q for %s", rt.Name, dep.ImportPath)
+				}
+				if matched {
+					set.AddMethodRule(rt)
+					sp.Info("Match method rule", "rule", rt, "dep", dep)
+				}
+			case *rule.InstVarRule:
+				if _, spec := ast.FindValueSpec(tree, rt.Var); spec != nil {
+					set.AddVarRule(source, rt)
+					sp.Info("Match var rule", "rule", rt, "dep", dep)
+				}
+			case *rule.InstGoroutineRule:
+				sel, err1 := rt.Selector()
+				if err1 != nil {
+					return nil, err1
+				}
+				if len(findGoStmts(tree, sel)) > 0 {
+					set.AddGoroutineRule(source, rt)
+					sp.Info("Match goroutine rule", "rule", rt, "dep", dep)
 				}
 			case *rule.InstFileRule:
 				// Skip as it's already processed
@@ -223,7 +562,7 @@ func (sp *SetupPhase) loadRules() ([]rule.InstRule, error) {
 		if err != nil {
 			return nil, ex.Wrapf(err, "failed to read %s from env variable", rulePath)
 		}
-		return parseRuleFromYaml(content)
+		return parseRuleFromYaml(rulePath, content)
 	}
 
 	// Load custom rules from config file if specified
@@ -232,7 +571,7 @@ func (sp *SetupPhase) loadRules() ([]rule.InstRule, error) {
 		if err != nil {
 			return nil, ex.Wrapf(err, "failed to read %s from -rules flag", sp.ruleConfig)
 		}
-		return parseRuleFromYaml(content)
+		return parseRuleFromYaml(sp.ruleConfig, content)
 	}
 
 	// Load default rules from the unzipped pkg directory
@@ -245,18 +584,54 @@ func (sp *SetupPhase) matchDeps(ctx context.Context, deps []*Dependency) ([]*rul
 	if err != nil {
 		return nil, err
 	}
+	traceRules, err := sp.tracePackageRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allRules = append(allRules, traceRules...)
+	if sp.buildEnv == nil {
+		sp.buildEnv, err = newBuildEnv(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	allRules, err = sp.filterRulesByBuild(allRules, sp.buildEnv)
+	if err != nil {
+		return nil, err
+	}
 	sp.Info("Found available rules", "rules", allRules)
-	if len(allRules) == 0 {
+	// The directives in the main module may add rules of their own
+	if len(allRules) == 0 && !slices.ContainsFunc(deps, func(dep *Dependency) bool { return dep.Main }) {
 		return nil, nil
 	}
 
 	// Pre-index rules by target
 	rulesByTarget := make(map[string][]rule.InstRule)
+	pointcutRules := make([]*rule.InstPointcutRule, 0)
 	for _, r := range allRules {
+		if pr, ok := r.(*rule.InstPointcutRule); ok {
+			pointcutRules = append(pointcutRules, pr)
+			continue
+		}
 		target := r.GetTarget()
 		rulesByTarget[target] = append(rulesByTarget[target], r)
 	}
 
+	// Type-check all dependencies that need it at once, rather than each of
+	// them and their imports over and over again
+	typedDeps := make([]*Dependency, 0)
+	for _, dep := range deps {
+		if slices.ContainsFunc(targetedRules(dep, rulesByTarget), needsTypes) {
+			typedDeps = append(typedDeps, dep)
+		}
+	}
+	if len(typedDeps) > 0 {
+		sp.typed, err = loadTypedPackages(ctx, sp.buildFlags, typedDeps, allRules)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Match the default rules with the found dependencies
 	matched := make([]*rule.InstRuleSet, 0)
 	var mu sync.Mutex
@@ -265,7 +640,11 @@ func (sp *SetupPhase) matchDeps(ctx context.Context, deps []*Dependency) ([]*rul
 
 	for _, dep := range deps {
 		g.Go(func() error {
-			m, err1 := sp.runMatch(dep, rulesByTarget)
+			m, err1 := sp.runMatch(dep, rulesByTarget, pointcutRules)
+			if err1 != nil {
+				return err1
+			}
+			err1 = sp.matchUnkeyedLits(dep, m)
 			if err1 != nil {
 				return err1
 			}
@@ -0,0 +1,315 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Call Site Matching
+//
+// Call rules are matched against call expressions of the target package. The
+// callee of a call expression is only known after type checking, for example
+// db.Query may call a method of *sql.DB through a variable, a field or even an
+// embedded field. For every call of the callee we record its position and the
+// signature of the wrapper to be generated in the target file, with all types
+// spelled as the target file would spell them, because the instrument phase
+// works on the syntax tree alone.
+
+// callSiteImportPrefix prefixes the names of imports added to the target file
+// for the types in wrapper signatures that the file does not import itself.
+const callSiteImportPrefix = "_otel_"
+
+// calleeName returns the name of the function in call rule notation, e.g.
+// "database/sql.(*DB).Query", or "" if it's not a named function or method.
+func calleeName(fn *types.Func) string {
+	if fn.Pkg() == nil {
+		return ""
+	}
+	if fn.Signature().Recv() == nil {
+		return fn.Pkg().Path() + "." + fn.Name()
+	}
+	recv := recvTypeName(fn)
+	if recv == "" {
+		return ""
+	}
+	return fn.Pkg().Path() + "." + rule.QualifiedFuncName(fn.Name(), recv)
+}
+
+// isVisible reports whether the type can be spelled in package pkg, i.e. all
+// named types it consists of are exported or declared in pkg.
+func isVisible(t types.Type, pkg *types.Package) bool {
+	switch tt := t.(type) {
+	case *types.Basic:
+		return true
+	case *types.Named:
+		obj := tt.Obj()
+		if obj.Pkg() != nil && obj.Pkg() != pkg && !obj.Exported() {
+			return false
+		}
+		for i := range tt.TypeArgs().Len() {
+			if !isVisible(tt.TypeArgs().At(i), pkg) {
+				return false
+			}
+		}
+		return true
+	case *types.Alias:
+		return isVisible(types.Unalias(tt), pkg)
+	case *types.Pointer:
+		return isVisible(tt.Elem(), pkg)
+	case *types.Slice:
+		return isVisible(tt.Elem(), pkg)
+	case *types.Array:
+		return isVisible(tt.Elem(), pkg)
+	case *types.Chan:
+		return isVisible(tt.Elem(), pkg)
+	case *types.Map:
+		return isVisible(tt.Key(), pkg) && isVisible(tt.Elem(), pkg)
+	case *types.Signature:
+		return isVisible(tt.Params(), pkg) && isVisible(tt.Results(), pkg)
+	case *types.Tuple:
+		for v := range tt.Variables() {
+			if !isVisible(v.Type(), pkg) {
+				return false
+			}
+		}
+		return true
+	case *types.Struct:
+		for f := range tt.Fields() {
+			if !f.Exported() && f.Pkg() != pkg || !isVisible(f.Type(), pkg) {
+				return false
+			}
+		}
+		return true
+	case *types.Interface:
+		for m := range tt.Methods() {
+			if !m.Exported() && m.Pkg() != pkg || !isVisible(m.Type(), pkg) {
+				return false
+			}
+		}
+		return true
+	default:
+		// Type parameters can not appear in the signature of a non-generic
+		// callee, anything else is unexpected
+		return false
+	}
+}
+
+// needsAddress reports whether the receiver of the method call must be passed to
+// the wrapper by its address, which is the case if the method has a pointer
+// receiver and is called on an addressable value. Passing a copy would make the
+// method operate on the copy instead.
+func needsAddress(sel *types.Selection) bool {
+	method, ok := sel.Obj().(*types.Func)
+	if !ok {
+		return false
+	}
+	if _, ok = method.Signature().Recv().Type().(*types.Pointer); !ok {
+		return false
+	}
+	t := sel.Recv()
+	for _, idx := range sel.Index()[:len(sel.Index())-1] {
+		// A pointer on the path to the promoted method is shared by the copy
+		st, ok1 := t.Underlying().(*types.Struct)
+		if !ok1 {
+			return false
+		}
+		t = st.Field(idx).Type()
+	}
+	_, isPtr := t.Underlying().(*types.Pointer)
+	return !isPtr
+}
+
+// callSiteQualifier spells package-qualified types in the target file. It names
+// packages by the imports of the file and records packages that the file does
+// not import yet. Only packages imported by the target package are available
+// to the compiler, for anything else ok is set to false.
+type callSiteQualifier struct {
+	pkg     *packages.Package
+	file    *ast.File
+	imports map[string]string // path -> name
+	ok      bool
+}
+
+func (q *callSiteQualifier) qualify(p *types.Package) string {
+	if p == q.pkg.Types {
+		return ""
+	}
+	for _, spec := range q.file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != p.Path() {
+			continue
+		}
+		if spec.Name == nil {
+			return p.Name()
+		}
+		switch spec.Name.Name {
+		case ".":
+			return ""
+		case "_":
+			continue
+		default:
+			return spec.Name.Name
+		}
+	}
+	if _, ok := q.pkg.Imports[p.Path()]; !ok {
+		q.ok = false
+		return p.Name()
+	}
+	name := callSiteImportPrefix + p.Name()
+	q.imports[p.Path()] = name
+	return name
+}
+
+func (q *callSiteQualifier) typeString(t types.Type) string {
+	return types.TypeString(t, q.qualify)
+}
+
+// newCallSite describes the call site of the callee fn. The receiver is nil for
+// function calls. It returns nil if no wrapper can be generated for the call.
+func newCallSite(
+	pkg *packages.Package,
+	file *ast.File,
+	call *ast.CallExpr,
+	fn *types.Func,
+	recv *types.Selection,
+) (*rule.CallSite, string) {
+	sig := fn.Signature()
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return nil, "generic callee"
+	}
+	if !isVisible(sig.Params(), pkg.Types) || !isVisible(sig.Results(), pkg.Types) {
+		return nil, "unexported types in signature"
+	}
+	pos := pkg.Fset.Position(call.Pos())
+	site := &rule.CallSite{Line: pos.Line, Column: pos.Column}
+	q := &callSiteQualifier{pkg: pkg, file: file, imports: make(map[string]string), ok: true}
+	if recv != nil {
+		if len(call.Args) == 1 {
+			// x.M(g()) can't get an extra receiver argument if g returns
+			// multiple values
+			if _, ok := pkg.TypesInfo.TypeOf(call.Args[0]).(*types.Tuple); ok {
+				return nil, "multi-value argument"
+			}
+		}
+		if !isVisible(recv.Recv(), pkg.Types) {
+			return nil, "unexported receiver type"
+		}
+		recvType := recv.Recv()
+		if needsAddress(recv) {
+			recvType = types.NewPointer(recvType)
+			site.AddrOf = true
+		}
+		site.Recv = q.typeString(recvType)
+	}
+	for i := range sig.Params().Len() {
+		t := sig.Params().At(i).Type()
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			site.Params = append(site.Params,
+				"..."+q.typeString(util.AssertType[*types.Slice](t).Elem()))
+			continue
+		}
+		site.Params = append(site.Params, q.typeString(t))
+	}
+	for i := range sig.Results().Len() {
+		site.Results = append(site.Results, q.typeString(sig.Results().At(i).Type()))
+	}
+	if !q.ok {
+		return nil, "types of packages not imported by the target package"
+	}
+	if len(q.imports) > 0 {
+		site.Imports = q.imports
+	}
+	return site, ""
+}
+
+// findCallSites finds all calls of the callee in the file.
+func (sp *SetupPhase) findCallSites(pkg *packages.Package, file *ast.File, callee string) []*rule.CallSite {
+	sites := make([]*rule.CallSite, 0)
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		var fn *types.Func
+		var recv *types.Selection
+		switch fun := ast.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			fn, _ = pkg.TypesInfo.Uses[fun].(*types.Func)
+		case *ast.SelectorExpr:
+			if sel, found := pkg.TypesInfo.Selections[fun]; found {
+				// Method expressions such as (*T).M are not supported, their
+				// receivers are ordinary arguments
+				if sel.Kind() != types.MethodVal {
+					return true
+				}
+				recv = sel
+				fn, _ = sel.Obj().(*types.Func)
+			} else {
+				// Qualified identifier, i.e. pkg.Func
+				fn, _ = pkg.TypesInfo.Uses[fun.Sel].(*types.Func)
+			}
+		}
+		if fn == nil || calleeName(fn) != callee {
+			return true
+		}
+		site, reason := newCallSite(pkg, file, call, fn, recv)
+		if site == nil {
+			sp.Warn("Skip call site", "callee", callee, "reason", reason,
+				"position", pkg.Fset.Position(call.Pos()))
+			return true
+		}
+		sites = append(sites, site)
+		return true
+	})
+	return sites
+}
+
+// matchCallRules finds the call sites of the callees of the rules in the
+// dependency and adds one rule per file that contains any of them.
+func (sp *SetupPhase) matchCallRules(dep *Dependency, rules []*rule.InstCallRule, set *rule.InstRuleSet) error {
+	if len(dep.Sources) == 0 {
+		return nil
+	}
+	pkg, err := sp.typed.lookup(dep)
+	if err != nil {
+		return err
+	}
+	set.SetPackageName(pkg.Name)
+
+	for _, file := range pkg.Syntax {
+		source := pkg.Fset.Position(file.Package).Filename
+		// Files of the type checker that are not compiled as they are, e.g.
+		// cgo files, can not be rewritten by their positions
+		if !slices.Contains(dep.Sources, source) {
+			continue
+		}
+		for _, r := range rules {
+			pkgPath, recv, fn, err1 := r.SplitCall()
+			if err1 != nil {
+				return err1
+			}
+			callee := fmt.Sprintf("%s.%s", pkgPath, rule.QualifiedFuncName(fn, recv))
+			sites := sp.findCallSites(pkg, file, callee)
+			if len(sites) == 0 {
+				continue
+			}
+			cr := r.Instantiate(filepath.Base(source), sites)
+			set.AddCallRule(source, cr)
+			sp.Info("Match call rule", "rule", cr, "sites", len(sites), "dep", dep)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const callTestSource = `package app
+
+import (
+	"bytes"
+	"io"
+	str "strings"
+)
+
+type Wrapper struct{ str.Builder }
+
+type Holder struct{ b *str.Builder }
+
+func Run(r io.Reader, h Holder) {
+	var b str.Builder
+	b.WriteString(str.ToUpper("x"))
+	w := &Wrapper{}
+	w.WriteString("y")
+	h.b.WriteString("z")
+	r.Read(nil)
+	_ = bytes.ToUpper(nil)
+	f := str.ToUpper
+	_ = f
+}
+`
+
+func TestMatchCallRules(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.go")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"),
+		[]byte("module example.com/app\n\ngo 1.24\n"), 0o644))
+	require.NoError(t, os.WriteFile(source, []byte(callTestSource), 0o644))
+	t.Chdir(dir)
+
+	newRule := func(call string) *rule.InstCallRule {
+		return &rule.InstCallRule{
+			InstBaseRule: rule.InstBaseRule{Name: "r", Target: "example.com/app"},
+			Call:         call,
+			Before:       "H",
+		}
+	}
+	dep := &Dependency{ImportPath: "example.com/app", Sources: []string{source}}
+
+	tests := []struct {
+		name     string
+		call     string
+		expected []*rule.CallSite
+	}{
+		{
+			name: "qualified function with renamed import",
+			call: "strings.ToUpper",
+			expected: []*rule.CallSite{
+				{Line: 15, Column: 16, Params: []string{"string"}, Results: []string{"string"}},
+			},
+		},
+		{
+			name: "pointer method through value, embedded and field",
+			call: "strings.(*Builder).WriteString",
+			expected: []*rule.CallSite{
+				{
+					Line: 15, Column: 2, Recv: "*str.Builder", AddrOf: true,
+					Params: []string{"string"}, Results: []string{"int", "error"},
+				},
+				{
+					Line: 17, Column: 2, Recv: "*Wrapper",
+					Params: []string{"string"}, Results: []string{"int", "error"},
+				},
+				{
+					Line: 18, Column: 2, Recv: "*str.Builder",
+					Params: []string{"string"}, Results: []string{"int", "error"},
+				},
+			},
+		},
+		{
+			name: "interface method",
+			call: "io.(Reader).Read",
+			expected: []*rule.CallSite{
+				{
+					Line: 19, Column: 2, Recv: "io.Reader",
+					Params: []string{"[]byte"}, Results: []string{"int", "error"},
+				},
+			},
+		},
+		{
+			name: "no call site",
+			call: "strings.ToLower",
+		},
+	}
+	// The dependency is type-checked once for all the rules
+	sp := newTestSetupPhase()
+	var err error
+	sp.typed, err = loadTypedPackages(t.Context(), nil, []*Dependency{dep}, nil)
+	require.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := rule.NewInstRuleSet(dep.ImportPath)
+			err1 := sp.matchCallRules(dep, []*rule.InstCallRule{newRule(tt.call)}, set)
+			require.NoError(t, err1)
+			if tt.expected == nil {
+				require.Empty(t, set.CallRules)
+				return
+			}
+			require.Len(t, set.CallRules[source], 1)
+			cr := set.CallRules[source][0]
+			require.Equal(t, "r#app.go", cr.GetName())
+			require.Equal(t, tt.expected, cr.Sites)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"context"
+	"go/types"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// -----------------------------------------------------------------------------
+// Interface Matching
+//
+// Interface rules can not be matched syntactically, a method implements an
+// interface if its receiver type does, which requires full type information.
+// We type-check the dependency together with the packages declaring the
+// interfaces in one go, so that types of both sides are comparable, and then
+// turn every implementing method into an ordinary func rule.
+
+// typedPackages holds the packages type-checked from source for the rules that
+// need type information. All of them are loaded in one go with the flags of the
+// build and shared by every dependency, so packages imported by many of them
+// are only type-checked once. Type-checking from source is slower than reading
+// export data, but does not tie us to the export data format of the toolchain
+// in use.
+type typedPackages struct {
+	byPath map[string]*packages.Package // All loaded packages by import path
+	byFile map[string]*packages.Package // All loaded packages by Go file
+}
+
+// loadTypedPackages type-checks the dependencies together with the packages
+// declaring the interfaces of the rules.
+func loadTypedPackages(
+	ctx context.Context,
+	flags []string,
+	deps []*Dependency,
+	rules []rule.InstRule,
+) (*typedPackages, error) {
+	patterns := make([]string, 0, len(deps))
+	for _, dep := range deps {
+		// Load the dependency by one of its files rather than its import
+		// path, which is not loadable for main packages
+		if len(dep.Sources) > 0 {
+			patterns = append(patterns, "file="+dep.Sources[0])
+		}
+	}
+	for _, r := range rules {
+		ir, ok := r.(*rule.InstInterfaceRule)
+		if !ok {
+			continue
+		}
+		if pkgPath, _ := ir.SplitInterface(); pkgPath != "" && !slices.Contains(patterns, pkgPath) {
+			patterns = append(patterns, pkgPath)
+		}
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports |
+			packages.NeedDeps | packages.NeedTypes | packages.NeedSyntax |
+			packages.NeedTypesInfo,
+		BuildFlags: flags,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to load packages %v", patterns)
+	}
+	tp := &typedPackages{
+		byPath: make(map[string]*packages.Package),
+		byFile: make(map[string]*packages.Package),
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		tp.byPath[pkg.PkgPath] = pkg
+		for _, file := range pkg.GoFiles {
+			tp.byFile[file] = pkg
+		}
+	})
+	return tp, nil
+}
+
+// lookup returns the type-checked package of the dependency.
+func (tp *typedPackages) lookup(dep *Dependency) (*packages.Package, error) {
+	pkg, ok := tp.byFile[dep.Sources[0]]
+	if !ok {
+		return nil, ex.Newf("package %s not found", dep.ImportPath)
+	}
+	return pkg, checkTyped(pkg)
+}
+
+// lookupPath returns the type-checked package of the import path.
+func (tp *typedPackages) lookupPath(pkgPath string) (*packages.Package, error) {
+	pkg, ok := tp.byPath[pkgPath]
+	if !ok {
+		return nil, ex.Newf("package %s not found", pkgPath)
+	}
+	return pkg, checkTyped(pkg)
+}
+
+// checkTyped reports the errors of the package, whose types are incomplete if
+// there are any.
+func checkTyped(pkg *packages.Package) error {
+	if len(pkg.Errors) > 0 {
+		return ex.Newf("failed to type-check package %s: %v", pkg.PkgPath, pkg.Errors)
+	}
+	return nil
+}
+
+// lookupInterface finds the interface type named by the rule.
+func lookupInterface(r *rule.InstInterfaceRule, typed *typedPackages) (*types.Interface, error) {
+	pkgPath, name := r.SplitInterface()
+	var obj types.Object
+	if pkgPath == "" {
+		obj = types.Universe.Lookup(name)
+	} else {
+		pkg, err := typed.lookupPath(pkgPath)
+		if err != nil {
+			return nil, ex.Wrapf(err, "failed to find interface %s", r.Interface)
+		}
+		obj = pkg.Types.Scope().Lookup(name)
+	}
+	if obj == nil {
+		return nil, ex.Newf("interface %s not found", r.Interface)
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, ex.Newf("%s is not an interface", r.Interface)
+	}
+	for i := range iface.NumMethods() {
+		if iface.Method(i).Name() == r.Func {
+			return iface, nil
+		}
+	}
+	return nil, ex.Newf("interface %s has no method %s", r.Interface, r.Func)
+}
+
+// findImplementations returns the methods named fn that are declared in pkg
+// and whose receiver types implement the interface.
+func findImplementations(pkg *types.Package, iface *types.Interface, fn string) []*types.Func {
+	found := make([]*types.Func, 0)
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || types.IsInterface(named) || named.TypeParams().Len() > 0 {
+			// Generic types implement interfaces only when instantiated,
+			// there is no single method declaration to instrument.
+			continue
+		}
+		ptr := types.NewPointer(named)
+		if !types.Implements(named, iface) && !types.Implements(ptr, iface) {
+			continue
+		}
+		obj, _, _ := types.LookupFieldOrMethod(ptr, false, pkg, fn)
+		method, ok := obj.(*types.Func)
+		// The method may be promoted from an embedded type declared in
+		// another package, we can only instrument methods declared here.
+		// Methods promoted from types of this package are instrumented
+		// once at their declarations.
+		if !ok || method.Pkg() != pkg || slices.Contains(found, method) {
+			continue
+		}
+		found = append(found, method)
+	}
+	return found
+}
+
+// recvTypeName returns the receiver type name of the method in rule notation,
+// e.g. "*Repo" or "Repo".
+func recvTypeName(method *types.Func) string {
+	recv := method.Signature().Recv().Type()
+	prefix := ""
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+		prefix = "*"
+	}
+	named, ok := recv.(*types.Named)
+	if !ok {
+		return ""
+	}
+	return prefix + named.Obj().Name()
+}
+
+// findSourceFile finds the source file of the dependency where the method is
+// declared. The file names reported by the type checker may differ from the
+// ones in the compile command, e.g. for cgo files, so the base name is used as
+// the last resort.
+func findSourceFile(dep *Dependency, file string) string {
+	if slices.Contains(dep.Sources, file) {
+		return file
+	}
+	for _, source := range dep.Sources {
+		if filepath.Base(source) == filepath.Base(file) {
+			return source
+		}
+	}
+	return ""
+}
+
+// matchInterfaceRules instantiates func rules for all methods of the dependency
+// that implement the interfaces named by the rules.
+func (sp *SetupPhase) matchInterfaceRules(
+	dep *Dependency,
+	rules []*rule.InstInterfaceRule,
+	set *rule.InstRuleSet,
+) error {
+	if len(dep.Sources) == 0 {
+		return nil
+	}
+	pkg, err := sp.typed.lookup(dep)
+	if err != nil {
+		return err
+	}
+	set.SetPackageName(pkg.Name)
+
+	for _, r := range rules {
+		iface, err1 := lookupInterface(r, sp.typed)
+		if err1 != nil {
+			return ex.Wrapf(err1, "invalid interface rule %q", r.GetName())
+		}
+		for _, method := range findImplementations(pkg.Types, iface, r.Func) {
+			file := pkg.Fset.Position(method.Pos()).Filename
+			source := findSourceFile(dep, file)
+			if source == "" {
+				sp.Warn("Skip method declared out of the compiled files",
+					"rule", r, "method", method.FullName(), "file", file)
+				continue
+			}
+			recv := recvTypeName(method)
+			if recv == "" {
+				continue
+			}
+			fr := r.Instantiate(method.Name(), recv)
+			set.AddFuncRule(source, fr)
+			sp.Info("Match interface rule", "rule", fr, "dep", dep)
+		}
+	}
+	return nil
+}
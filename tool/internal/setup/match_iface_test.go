@@ -0,0 +1,147 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const ifaceTestSource = `package app
+
+import "io"
+
+type Reader struct{}
+
+func (r *Reader) Read(p []byte) (int, error) { return 0, io.EOF }
+
+type Value struct{}
+
+func (v Value) Read(p []byte) (int, error) { return 0, nil }
+func (v Value) Error() string             { return "" }
+
+type NotReader struct{}
+
+func (n *NotReader) Read() {}
+
+type Outer struct{ *Reader }
+
+type List[T any] struct{}
+
+func (l *List[T]) Read(p []byte) (int, error) { return 0, nil }
+`
+
+func TestMatchInterfaceRules(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.go")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"),
+		[]byte("module example.com/app\n\ngo 1.24\n"), 0o644))
+	require.NoError(t, os.WriteFile(source, []byte(ifaceTestSource), 0o644))
+	t.Chdir(dir)
+
+	newRule := func(iface, fn string) *rule.InstInterfaceRule {
+		return &rule.InstInterfaceRule{
+			InstBaseRule: rule.InstBaseRule{
+				Name:           "r",
+				Target:         "example.com/app",
+				BuildCondition: rule.BuildCondition{GOOS: "linux"},
+			},
+			Interface: iface,
+			Func:      fn,
+			Before:    "H",
+		}
+	}
+	dep := &Dependency{ImportPath: "example.com/app", Sources: []string{source}}
+
+	tests := []struct {
+		name     string
+		rule     *rule.InstInterfaceRule
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:     "io.Reader implementations",
+			rule:     newRule("io.Reader", "Read"),
+			expected: []string{"r#(*Reader).Read", "r#(Value).Read"},
+		},
+		{
+			name:     "predeclared interface",
+			rule:     newRule("error", "Error"),
+			expected: []string{"r#(Value).Error"},
+		},
+		{
+			name:   "unknown method",
+			rule:   newRule("io.Reader", "Write"),
+			errMsg: "has no method Write",
+		},
+		{
+			name:   "not an interface",
+			rule:   newRule("io.SectionReader", "Read"),
+			errMsg: "is not an interface",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSetupPhase()
+			var err error
+			sp.typed, err = loadTypedPackages(t.Context(), nil, []*Dependency{dep}, []rule.InstRule{tt.rule})
+			require.NoError(t, err)
+			set := rule.NewInstRuleSet(dep.ImportPath)
+			err = sp.matchInterfaceRules(dep, []*rule.InstInterfaceRule{tt.rule}, set)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "app", set.PackageName)
+			names := make([]string, 0)
+			for _, fr := range set.FuncRules[source] {
+				require.Equal(t, "H", fr.Before)
+				require.Equal(t, "linux", fr.GOOS, "the build condition must be kept")
+				names = append(names, fr.GetName())
+			}
+			require.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
+
+func TestMatchInterfaceRulesBuildFlags(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.go")
+	tagged := filepath.Join(dir, "tagged.go")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"),
+		[]byte("module example.com/app\n\ngo 1.24\n"), 0o644))
+	require.NoError(t, os.WriteFile(source, []byte(ifaceTestSource), 0o644))
+	require.NoError(t, os.WriteFile(tagged, []byte(`//go:build special
+
+package app
+
+type Tagged struct{}
+
+func (t Tagged) Read(p []byte) (int, error) { return 0, nil }
+`), 0o644))
+	t.Chdir(dir)
+
+	// The files of the build are only found with the tags of the build
+	r := &rule.InstInterfaceRule{
+		InstBaseRule: rule.InstBaseRule{Name: "r", Target: "example.com/app"},
+		Interface:    "io.Reader",
+		Func:         "Read",
+		Before:       "H",
+	}
+	dep := &Dependency{ImportPath: "example.com/app", Sources: []string{source, tagged}}
+	sp := newTestSetupPhase()
+	var err error
+	sp.typed, err = loadTypedPackages(t.Context(), []string{"-tags=special"}, []*Dependency{dep}, []rule.InstRule{r})
+	require.NoError(t, err)
+	set := rule.NewInstRuleSet(dep.ImportPath)
+	require.NoError(t, sp.matchInterfaceRules(dep, []*rule.InstInterfaceRule{r}, set))
+	require.Len(t, set.FuncRules[tagged], 1)
+	require.Equal(t, "r#(Tagged).Read", set.FuncRules[tagged][0].GetName())
+}
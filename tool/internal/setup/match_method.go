@@ -0,0 +1,90 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// embeddedFieldName returns the name of the embedded field of the type, e.g.
+// "Mutex" for "*sync.Mutex" and "List" for "List[T]".
+func embeddedFieldName(t dst.Expr) string {
+	switch expr := t.(type) {
+	case *dst.Ident:
+		return expr.Name
+	case *dst.StarExpr:
+		return embeddedFieldName(expr.X)
+	case *dst.SelectorExpr:
+		return expr.Sel.Name
+	case *dst.IndexExpr:
+		return embeddedFieldName(expr.X)
+	case *dst.IndexListExpr:
+		return embeddedFieldName(expr.X)
+	default:
+		return ""
+	}
+}
+
+// structFieldNames returns the names of the fields of the struct type, which
+// can not be used as method names of the type.
+func structFieldNames(st *dst.StructType) []string {
+	names := make([]string, 0)
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			names = append(names, embeddedFieldName(field.Type))
+			continue
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// matchMethodRule reports whether the file declares the type of the method
+// rule. It fails if the methods to be added clash with the methods or fields
+// the type declares, or with the methods added by other rules.
+func matchMethodRule(source string, tree *dst.File, r *rule.InstMethodRule, set *rule.InstRuleSet) (bool, error) {
+	for _, funcDecl := range ast.ListFuncDecls(tree) {
+		recv := strings.TrimPrefix(ast.ReceiverTypeName(funcDecl), "*")
+		if recv == r.Type && slices.Contains(r.Methods, funcDecl.Name.Name) {
+			return false, ex.Newf("method %s.%s already exists in %s", r.Type, funcDecl.Name.Name, source)
+		}
+	}
+	typeSpec := ast.FindTypeSpec(tree, r.Type)
+	if typeSpec == nil {
+		return false, nil
+	}
+	if typeSpec.Assign {
+		return false, ex.Newf("type %s is an alias, methods must be added to the aliased type", r.Type)
+	}
+	switch t := typeSpec.Type.(type) {
+	case *dst.InterfaceType:
+		return false, ex.Newf("type %s is an interface", r.Type)
+	case *dst.StructType:
+		for _, name := range structFieldNames(t) {
+			if slices.Contains(r.Methods, name) {
+				return false, ex.Newf("type %s already has a field %s", r.Type, name)
+			}
+		}
+	}
+	for _, other := range set.MethodRules {
+		if other.Type != r.Type {
+			continue
+		}
+		for _, m := range r.Methods {
+			if slices.Contains(other.Methods, m) {
+				return false, ex.Newf("method %s.%s is also added by rule %q", r.Type, m, other.Name)
+			}
+		}
+	}
+	return true, nil
+}
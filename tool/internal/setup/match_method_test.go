@@ -0,0 +1,130 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const methodTestSource = `package app
+
+import "sync"
+
+type Error struct {
+	sync.Mutex
+	msg, Cause string
+}
+
+func (e *Error) Error() string { return e.msg }
+
+type (
+	Code  int
+	Alias = Code
+)
+
+type Getter interface{ Get() }
+`
+
+const methodTestOtherSource = `package app
+
+func (c Code) String() string { return "" }
+`
+
+func TestMatchMethodRules(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "app.go")
+	other := filepath.Join(dir, "other.go")
+	require.NoError(t, os.WriteFile(source, []byte(methodTestSource), 0o644))
+	require.NoError(t, os.WriteFile(other, []byte(methodTestOtherSource), 0o644))
+	dep := &Dependency{ImportPath: "example.com/app", Sources: []string{source, other}}
+
+	newRule := func(name, typ string, methods ...string) rule.InstRule {
+		return &rule.InstMethodRule{
+			InstBaseRule: rule.InstBaseRule{Name: name, Target: "example.com/app"},
+			Type:         typ,
+			Methods:      methods,
+			Path:         "example.com/hooks",
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rules    []rule.InstRule
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:     "new methods",
+			rules:    []rule.InstRule{newRule("r", "Error", "Unwrap", "Clone"), newRule("s", "Code", "Valid")},
+			expected: []string{"r", "s"},
+		},
+		{
+			name:     "type in grouped declaration",
+			rules:    []rule.InstRule{newRule("r", "Code", "Valid")},
+			expected: []string{"r"},
+		},
+		{
+			name:     "unknown type",
+			rules:    []rule.InstRule{newRule("r", "Unknown", "Valid")},
+			expected: []string{},
+		},
+		{
+			name:   "existing method",
+			rules:  []rule.InstRule{newRule("r", "Error", "Unwrap", "Error")},
+			errMsg: "method Error.Error already exists",
+		},
+		{
+			name:   "existing method in another file",
+			rules:  []rule.InstRule{newRule("r", "Code", "String")},
+			errMsg: "method Code.String already exists in " + other,
+		},
+		{
+			name:   "existing field",
+			rules:  []rule.InstRule{newRule("r", "Error", "Cause")},
+			errMsg: "type Error already has a field Cause",
+		},
+		{
+			name:   "embedded field",
+			rules:  []rule.InstRule{newRule("r", "Error", "Mutex")},
+			errMsg: "type Error already has a field Mutex",
+		},
+		{
+			name:   "added twice",
+			rules:  []rule.InstRule{newRule("r", "Error", "Unwrap"), newRule("s", "Error", "Unwrap")},
+			errMsg: `method Error.Unwrap is also added by rule "r"`,
+		},
+		{
+			name:   "alias",
+			rules:  []rule.InstRule{newRule("r", "Alias", "Valid")},
+			errMsg: "type Alias is an alias",
+		},
+		{
+			name:   "interface",
+			rules:  []rule.InstRule{newRule("r", "Getter", "Set")},
+			errMsg: "type Getter is an interface",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := rule.NewInstRuleSet(dep.ImportPath)
+			_, err := newTestSetupPhase().preciseMatching(dep, tt.rules, set)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			names := make([]string, 0)
+			for _, mr := range set.MethodRules {
+				names = append(names, mr.GetName())
+			}
+			require.Equal(t, tt.expected, names)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// -----------------------------------------------------------------------------
+// Metric Rules
+//
+// Like span rules, metric rules need no hook code, the code measuring the
+// function is generated from the rule and injected at the function entry as a
+// raw rule, e.g. measuring
+//
+//	func (r *Repo) Get(table, key string) (v []byte, err error)
+//
+// by the metric store.repo.get with the attribute repo.table: table injects
+//
+//	_otelMetric0 := _otel_shared.StartMetric("store.repo.get", "s", "repo.table", table)
+//	defer func() { _otel_shared.EndMetric(_otelMetric0, err) }()
+//
+// The attributes are taken when the function is called, and the last error
+// result when it returns.
+
+const metricVarName = "_otelMetric"
+
+// compileMetricRule generates the raw rule that measures the function by the
+// metric rule. The index distinguishes the code generated for the function by
+// different rules. It fails if an attribute does not refer to a parameter of
+// the function.
+func compileMetricRule(
+	r *rule.InstMetricRule,
+	pkg string,
+	funcDecl *dst.FuncDecl,
+	index int,
+) (*rule.InstRawRule, error) {
+	fn, recv := funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl)
+	ft := newFuncTarget(funcDecl, "")
+	attrs := make([]string, 0)
+	for _, key := range slices.Sorted(maps.Keys(r.Attributes)) {
+		name := r.Attributes[key]
+		if !ft.params[name] {
+			return nil, ex.Newf("attribute %s of metric rule %q refers to %q, which is not a parameter of %s",
+				key, r.Name, name, rule.QualifiedFuncName(fn, recv))
+		}
+		attrs = append(attrs, fmt.Sprintf("%s, %s", strconv.Quote(key), name))
+	}
+
+	metric := fmt.Sprintf("%s%d", metricVarName, index)
+	errArg := "nil"
+	if ft.err != "" {
+		errArg = ft.err
+	}
+	start := slices.Concat([]string{strconv.Quote(r.MetricName(pkg, fn, recv)),
+		strconv.Quote(r.MetricUnit())}, attrs)
+	raw := fmt.Sprintf("%s := %s.StartMetric(%s)\ndefer func() { %s.EndMetric(%s, %s) }()",
+		metric, sharedImportName, strings.Join(start, ", "),
+		sharedImportName, metric, errArg)
+
+	return &rule.InstRawRule{
+		InstBaseRule: r.InstBaseRule,
+		Func:         fn,
+		Recv:         recv,
+		Raw:          raw,
+		Position:     rule.RawPositionEntry,
+		Imports:      map[string]string{sharedImportName: sharedImportPath},
+	}, nil
+}
+
+// matchMetricRule compiles the metric rule into raw rules for the functions of
+// the file that it selects. The generated counts the code generated for every
+// function so far.
+func matchMetricRule(tree *dst.File, r *rule.InstMetricRule, generated map[string]int) ([]*rule.InstRawRule, error) {
+	sel, err := r.Selector()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*rule.InstRawRule, 0)
+	for _, funcDecl := range findRuleFuncDecls(tree, sel, r.Func, r.Recv) {
+		qualified := rule.QualifiedFuncName(funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl))
+		rr, err1 := compileMetricRule(r, tree.Name.Name, funcDecl, generated[qualified])
+		if err1 != nil {
+			return nil, err1
+		}
+		if !sel.IsExact() {
+			rr.Name = fmt.Sprintf("%s#%s", r.Name, qualified)
+		}
+		generated[qualified]++
+		rules = append(rules, rr)
+	}
+	return rules, nil
+}
@@ -0,0 +1,80 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+func TestMatchMetricRule(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "store.go")
+	require.NoError(t, os.WriteFile(source, []byte(spanTestSource), 0o644))
+	tree, err := ast.ParseFileFast(source)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		rule     string
+		expected map[string]string
+		errMsg   string
+	}{
+		{
+			name: "error result and attributes",
+			rule: "func: Get\nrecv: \"*Repo\"\nmetric: \"{package}.{recv}.{func}\"\nunit: ms\n" +
+				"attributes: {repo.key: key}",
+			expected: map[string]string{
+				"r": "_otelMetric0 := _otel_shared.StartMetric(\"store.Repo.Get\", \"ms\", \"repo.key\", key)\n" +
+					"defer func() { _otel_shared.EndMetric(_otelMetric0, err) }()",
+			},
+		},
+		{
+			name: "unnamed results",
+			rule: "func: \"L*\"\nrecv: \"*Repo\"\nmetric: store.len\n",
+			expected: map[string]string{
+				"r#(*Repo).Len": "_otelMetric0 := _otel_shared.StartMetric(\"store.len\", \"s\")\n" +
+					"defer func() { _otel_shared.EndMetric(_otelMetric0, _unnamedRetVal1) }()",
+			},
+		},
+		{
+			name: "function without error",
+			rule: "func: Open\nmetric: store.open\n",
+			expected: map[string]string{
+				"r": "_otelMetric0 := _otel_shared.StartMetric(\"store.open\", \"s\")\n" +
+					"defer func() { _otel_shared.EndMetric(_otelMetric0, nil) }()",
+			},
+		},
+		{
+			name:   "attribute of result",
+			rule:   "func: Get\nrecv: \"*Repo\"\nmetric: get\nattributes: {repo.size: v}",
+			errMsg: `attribute repo.size of metric rule "r" refers to "v", which is not a parameter of (*Repo).Get`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err1 := rule.NewInstMetricRule([]byte("target: example.com/store\n"+tt.rule), "r")
+			require.NoError(t, err1)
+			rules, err1 := matchMetricRule(tree, r, make(map[string]int))
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err1, tt.errMsg)
+				return
+			}
+			require.NoError(t, err1)
+			raws := make(map[string]string)
+			for _, rr := range rules {
+				raws[rr.Name] = rr.Raw
+				assert.Equal(t, rule.RawPositionEntry, rr.Position)
+				assert.Equal(t, map[string]string{sharedImportName: sharedImportPath}, rr.Imports)
+			}
+			assert.Equal(t, tt.expected, raws)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"go/token"
+	"path/filepath"
+	"slices"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// directivesOf returns the directives found in the comments before a node.
+func directivesOf(decs dst.Decorations) []string {
+	directives := make([]string, 0)
+	for _, comment := range decs {
+		if d := rule.ParseDirective(comment); d != "" {
+			directives = append(directives, d)
+		}
+	}
+	return directives
+}
+
+// listJoinPoints lists the declarations of the file that pointcuts may select,
+// i.e. function declarations and struct type declarations. Functions that can
+// not be identified by name are skipped, just like for selectors.
+func listJoinPoints(tree *dst.File, importPath, file string) []*rule.JoinPoint {
+	jps := make([]*rule.JoinPoint, 0)
+	for _, decl := range tree.Decls {
+		switch d := decl.(type) {
+		case *dst.FuncDecl:
+			name := d.Name.Name
+			if name == "init" || name == ast.IdentIgnore || d.Body == nil {
+				continue
+			}
+			jps = append(jps, &rule.JoinPoint{
+				ImportPath: importPath,
+				File:       file,
+				Func:       name,
+				Recv:       ast.ReceiverTypeName(d),
+				Directives: directivesOf(d.Decs.Start),
+			})
+		case *dst.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*dst.TypeSpec)
+				if !ok {
+					continue
+				}
+				if _, ok = ts.Type.(*dst.StructType); !ok {
+					continue
+				}
+				jps = append(jps, &rule.JoinPoint{
+					ImportPath: importPath,
+					File:       file,
+					Struct:     ts.Name.Name,
+					Directives: slices.Concat(directivesOf(d.Decs.Start), directivesOf(ts.Decs.Start)),
+				})
+			}
+		}
+	}
+	return jps
+}
+
+// matchPointcutRules evaluates the pointcuts against all declarations of the
+// dependency and instantiates the advice for every selected one.
+func (sp *SetupPhase) matchPointcutRules(
+	dep *Dependency,
+	rules []*rule.InstPointcutRule,
+	set *rule.InstRuleSet,
+) error {
+	// Directives are comments, parse them only if they are needed
+	parseComments := slices.ContainsFunc(rules, (*rule.InstPointcutRule).UsesDirectives)
+	for _, source := range dep.Sources {
+		var tree *dst.File
+		var err error
+		if parseComments {
+			tree, err = ast.ParseFile(source)
+		} else {
+			tree, err = ast.ParseFileFast(source)
+		}
+		if err != nil {
+			return err
+		}
+		if tree == nil {
+			return ex.Newf("failed to parse file %s", source)
+		}
+		set.SetPackageName(tree.Name.Name)
+
+		for _, jp := range listJoinPoints(tree, dep.ImportPath, filepath.Base(source)) {
+			for _, r := range rules {
+				if !r.Match(jp) {
+					continue
+				}
+				if jp.Struct != "" {
+					if sr := r.StructRule(jp); sr != nil {
+						set.AddStructRule(source, sr)
+						sp.Info("Match struct rule", "rule", sr, "dep", dep)
+					}
+					continue
+				}
+				funcRules, rawRules := r.FuncRules(jp)
+				for _, fr := range funcRules {
+					set.AddFuncRule(source, fr)
+					sp.Info("Match func rule", "rule", fr, "dep", dep)
+				}
+				for _, rr := range rawRules {
+					set.AddRawRule(source, rr)
+					sp.Info("Match raw rule", "rule", rr, "dep", dep)
+				}
+			}
+		}
+	}
+	return nil
+}
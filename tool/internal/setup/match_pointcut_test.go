@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const pointcutTestSource = `package store
+
+//otel:trace
+type Repo struct{}
+
+//otel:trace
+func (r *Repo) Get() {}
+
+// otel:trace is not a directive here
+func (r *Repo) Put() {}
+
+func init() {}
+
+func Open() {}
+`
+
+func TestMatchPointcutRules(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "store.go")
+	require.NoError(t, os.WriteFile(source, []byte(pointcutTestSource), 0o644))
+
+	rules, err := parseRuleFromYaml("", []byte(`
+meta:
+  description: Trace the store
+instrumentation:
+  trace:
+    pointcut:
+      all-of:
+        - import-path: example.com/store
+        - any-of:
+            - directive: "otel:trace"
+            - function: "Open"
+    advice:
+      - before: example.com/hooks.Before
+      - add-field:
+          - {name: span, type: int}
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	pr, ok := rules[0].(*rule.InstPointcutRule)
+	require.True(t, ok)
+
+	dep := &Dependency{ImportPath: "example.com/store", Sources: []string{source}}
+	set := rule.NewInstRuleSet(dep.ImportPath)
+	err = newTestSetupPhase().matchPointcutRules(dep, []*rule.InstPointcutRule{pr}, set)
+	require.NoError(t, err)
+
+	require.Equal(t, "store", set.PackageName)
+	names := make([]string, 0)
+	for _, fr := range set.FuncRules[source] {
+		require.Equal(t, "example.com/hooks", fr.Path)
+		names = append(names, fr.GetName())
+	}
+	require.ElementsMatch(t, []string{"trace#(*Repo).Get", "trace#Open"}, names)
+	require.Len(t, set.StructRules[source], 1)
+	require.Equal(t, "Repo", set.StructRules[source][0].Struct)
+}
@@ -0,0 +1,227 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Span Rules
+//
+// Span rules need no hook code, the code tracing the function is generated from
+// the rule and injected at the function entry as a raw rule, e.g. tracing
+//
+//	func (r *Repo) Get(ctx context.Context, key string) (v []byte, err error)
+//
+// by the span {recv}.{func} with the attribute repo.key: key injects
+//
+//	ctx, _otelSpan0 := _otel_shared.StartSpan(ctx, "Repo.Get", "client", "repo.key", key)
+//	defer func() { _otel_shared.EndSpan(_otelSpan0, err) }()
+//
+// The span continues the trace of the first context.Context parameter, if any,
+// and the context carrying the span replaces it for the function body. The
+// attributes of the parameters are set at the start, and the ones of the
+// results at the end, along with the last error result. Like the raw code, the
+// generated code refers to unnamed results by _unnamedRetVal0, _unnamedRetVal1...
+
+const (
+	spanVarName       = "_otelSpan"
+	sharedImportName  = "_otel_shared"
+	sharedImportPath  = util.OtelRoot + "/pkg/instrumentation/shared"
+	unnamedResultName = "_unnamedRetVal"
+)
+
+// contextImportName returns the name the file imports the context package by,
+// or an empty string if it does not.
+func contextImportName(tree *dst.File) string {
+	for _, spec := range tree.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != "context" {
+			continue
+		}
+		if spec.Name == nil {
+			return "context"
+		}
+		if name := spec.Name.Name; name != "_" && name != "." {
+			return name
+		}
+	}
+	return ""
+}
+
+// funcTarget describes the parameters and the results of a function that the
+// code is generated for.
+type funcTarget struct {
+	ctx     string          // The context parameter, if any
+	params  map[string]bool // The named parameters
+	results map[string]bool // The results, by the names the raw code refers to them
+	err     string          // The last error result, if any
+}
+
+func newFuncTarget(funcDecl *dst.FuncDecl, contextName string) *funcTarget {
+	st := &funcTarget{params: make(map[string]bool), results: make(map[string]bool)}
+	for _, field := range funcDecl.Type.Params.List {
+		isContext := false
+		if sel, ok := field.Type.(*dst.SelectorExpr); ok && contextName != "" {
+			x, ok1 := sel.X.(*dst.Ident)
+			isContext = ok1 && x.Name == contextName && sel.Sel.Name == "Context"
+		}
+		for _, name := range field.Names {
+			if name.Name == ast.IdentIgnore {
+				continue
+			}
+			st.params[name.Name] = true
+			if isContext && st.ctx == "" {
+				st.ctx = name.Name
+			}
+		}
+	}
+	if funcDecl.Type.Results == nil {
+		return st
+	}
+	for i, field := range funcDecl.Type.Results.List {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			// Unnamed results are renamed by the raw rule, one per field
+			names = append(names, fmt.Sprintf("%s%d", unnamedResultName, i))
+		}
+		isError := false
+		if ident, ok := field.Type.(*dst.Ident); ok {
+			isError = ident.Name == "error"
+		}
+		for _, name := range names {
+			if name == ast.IdentIgnore {
+				continue
+			}
+			st.results[name] = true
+			if isError {
+				st.err = name
+			}
+		}
+	}
+	return st
+}
+
+// compileSpanRule generates the raw rule that traces the function by the span
+// rule. The index distinguishes the spans of the rules applied to the same
+// function. It fails if an attribute refers to neither a parameter nor a result
+// of the function.
+func compileSpanRule(r *rule.InstSpanRule, pkg string, funcDecl *dst.FuncDecl,
+	contextName string, index int,
+) (*rule.InstRawRule, error) {
+	fn, recv := funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl)
+	st := newFuncTarget(funcDecl, contextName)
+	startAttrs, endAttrs := make([]string, 0), make([]string, 0)
+	for _, key := range slices.Sorted(maps.Keys(r.Attributes)) {
+		name := r.Attributes[key]
+		kv := fmt.Sprintf("%s, %s", strconv.Quote(key), name)
+		switch {
+		case st.params[name]:
+			startAttrs = append(startAttrs, kv)
+		case st.results[name]:
+			endAttrs = append(endAttrs, kv)
+		default:
+			return nil, ex.Newf("attribute %s of span rule %q refers to %q, "+
+				"which is not a parameter or result of %s",
+				key, r.Name, name, rule.QualifiedFuncName(fn, recv))
+		}
+	}
+
+	span := fmt.Sprintf("%s%d", spanVarName, index)
+	// Without a context parameter, the span starts a new trace and the callees
+	// do not see it, only the code passing contexts nests spans
+	ctx, ctxArg := ast.IdentIgnore, "nil"
+	if st.ctx != "" {
+		ctx, ctxArg = st.ctx, st.ctx
+	}
+	errArg := "nil"
+	if st.err != "" {
+		errArg = st.err
+	}
+	start := slices.Concat([]string{ctxArg, strconv.Quote(r.SpanName(pkg, fn, recv)),
+		strconv.Quote(r.SpanKind())}, startAttrs)
+	endFunc, end := "EndSpan", []string{span, errArg}
+	if d := r.SpanMinDuration(); d > 0 {
+		// Short spans are dropped, the duration is given in nanoseconds
+		endFunc, end = "EndSpanAtLeast", []string{span, strconv.FormatInt(int64(d), 10), errArg}
+	}
+	end = append(end, endAttrs...)
+	raw := fmt.Sprintf("%s, %s := %s.StartSpan(%s)\ndefer func() { %s.%s(%s) }()",
+		ctx, span, sharedImportName, strings.Join(start, ", "),
+		sharedImportName, endFunc, strings.Join(end, ", "))
+
+	return &rule.InstRawRule{
+		InstBaseRule: r.InstBaseRule,
+		Func:         fn,
+		Recv:         recv,
+		Raw:          raw,
+		Position:     rule.RawPositionEntry,
+		Imports:      map[string]string{sharedImportName: sharedImportPath},
+	}, nil
+}
+
+// isContextCloner reports whether the method is Clone() interface{}, through
+// which the runtime instrumentation clones the contexts of new goroutines. It
+// is called on the system stack, where spans can not be started, so it is
+// never selected by patterns.
+func isContextCloner(funcDecl *dst.FuncDecl) bool {
+	if funcDecl.Recv == nil || funcDecl.Name.Name != "Clone" || len(funcDecl.Type.Params.List) > 0 {
+		return false
+	}
+	results := funcDecl.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 {
+		return false
+	}
+	switch t := results.List[0].Type.(type) {
+	case *dst.InterfaceType:
+		return len(t.Methods.List) == 0
+	case *dst.Ident:
+		return t.Name == "any"
+	}
+	return false
+}
+
+// matchSpanRule compiles the span rule into raw rules for the functions of the
+// file that it selects. The generated counts the code generated for every
+// function so far.
+func matchSpanRule(tree *dst.File, r *rule.InstSpanRule, generated map[string]int) ([]*rule.InstRawRule, error) {
+	sel, err := r.Selector()
+	if err != nil {
+		return nil, err
+	}
+	contextName := contextImportName(tree)
+	rules := make([]*rule.InstRawRule, 0)
+	for _, funcDecl := range findRuleFuncDecls(tree, sel, r.Func, r.Recv) {
+		fn, recv := funcDecl.Name.Name, ast.ReceiverTypeName(funcDecl)
+		if r.Excludes(fn, recv) || (!sel.IsExact() && isContextCloner(funcDecl)) {
+			continue
+		}
+		qualified := rule.QualifiedFuncName(fn, recv)
+		rr, err1 := compileSpanRule(r, tree.Name.Name, funcDecl, contextName, generated[qualified])
+		if err1 != nil {
+			return nil, err1
+		}
+		if !sel.IsExact() {
+			rr.Name = fmt.Sprintf("%s#%s", r.Name, qualified)
+		}
+		generated[qualified]++
+		rules = append(rules, rr)
+	}
+	return rules, nil
+}
@@ -0,0 +1,161 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const spanTestSource = `package store
+
+import ctxpkg "context"
+
+type Repo struct{}
+
+func (r *Repo) Get(ctx ctxpkg.Context, key string) (v []byte, err error) { return nil, nil }
+
+func (r *Repo) Len() (int, error) { return 0, nil }
+
+func Open(_ string, opts ...int) {}
+`
+
+func TestMatchSpanRule(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "store.go")
+	require.NoError(t, os.WriteFile(source, []byte(spanTestSource), 0o644))
+	tree, err := ast.ParseFileFast(source)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		rule     string
+		expected map[string]string
+		errMsg   string
+	}{
+		{
+			name: "context and error",
+			rule: "func: Get\nrecv: \"*Repo\"\nspan: \"{recv}.{func}\"\nkind: client\n" +
+				"attributes: {repo.key: key, repo.size: v}",
+			expected: map[string]string{
+				"r": "ctx, _otelSpan0 := _otel_shared.StartSpan(ctx, \"Repo.Get\", \"client\", \"repo.key\", key)\n" +
+					"defer func() { _otel_shared.EndSpan(_otelSpan0, err, \"repo.size\", v) }()",
+			},
+		},
+		{
+			name: "unnamed results",
+			rule: "func: \"L*\"\nrecv: \"*Repo\"\nspan: \"{package}.{recv}.{func}\"\n",
+			expected: map[string]string{
+				"r#(*Repo).Len": "_, _otelSpan0 := _otel_shared.StartSpan(nil, \"store.Repo.Len\", \"internal\")\n" +
+					"defer func() { _otel_shared.EndSpan(_otelSpan0, _unnamedRetVal1) }()",
+			},
+		},
+		{
+			name: "function without context",
+			rule: "func: \"O*\"\nspan: \"{package}.{recv}.{func}\"\n",
+			expected: map[string]string{
+				"r#Open": "_, _otelSpan0 := _otel_shared.StartSpan(nil, \"store.Open\", \"internal\")\n" +
+					"defer func() { _otel_shared.EndSpan(_otelSpan0, nil) }()",
+			},
+		},
+		{
+			name: "excluded functions and short spans",
+			rule: "func: \"*\"\nrecv: \"*Repo\"\nspan: \"{func}\"\nexclude: \"Len$\"\nmin_duration: 2ms",
+			expected: map[string]string{
+				"r#(*Repo).Get": "ctx, _otelSpan0 := _otel_shared.StartSpan(ctx, \"Get\", \"internal\")\n" +
+					"defer func() { _otel_shared.EndSpanAtLeast(_otelSpan0, 2000000, err) }()",
+			},
+		},
+		{
+			name: "included functions by qualified names",
+			rule: "func: \"*\"\nrecv: \"*\"\nspan: \"{func}\"\ninclude: '^\\(\\*Repo\\)\\.Get$'",
+			expected: map[string]string{
+				"r#(*Repo).Get": "ctx, _otelSpan0 := _otel_shared.StartSpan(ctx, \"Get\", \"internal\")\n" +
+					"defer func() { _otel_shared.EndSpan(_otelSpan0, err) }()",
+			},
+		},
+		{
+			name:   "unknown attribute",
+			rule:   "func: Open\nspan: open\nattributes: {store.path: path}",
+			errMsg: `attribute store.path of span rule "r" refers to "path", which is not a parameter or result of Open`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err1 := rule.NewInstSpanRule([]byte("target: example.com/store\n"+tt.rule), "r")
+			require.NoError(t, err1)
+			rules, err1 := matchSpanRule(tree, r, make(map[string]int))
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err1, tt.errMsg)
+				return
+			}
+			require.NoError(t, err1)
+			raws := make(map[string]string)
+			for _, rr := range rules {
+				raws[rr.Name] = rr.Raw
+				assert.Equal(t, rule.RawPositionEntry, rr.Position)
+				assert.Equal(t, map[string]string{sharedImportName: sharedImportPath}, rr.Imports)
+			}
+			assert.Equal(t, tt.expected, raws)
+		})
+	}
+}
+
+func TestMatchSpanRuleTwice(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "store.go")
+	require.NoError(t, os.WriteFile(source, []byte(spanTestSource), 0o644))
+	tree, err := ast.ParseFileFast(source)
+	require.NoError(t, err)
+
+	// The spans of the same function are declared by different names
+	spans := make(map[string]int)
+	for i, name := range []string{"_otelSpan0", "_otelSpan1"} {
+		r, err1 := rule.NewInstSpanRule([]byte("target: example.com/store\nfunc: Open\nspan: open\n"), "r")
+		require.NoError(t, err1)
+		rules, err1 := matchSpanRule(tree, r, spans)
+		require.NoError(t, err1)
+		require.Len(t, rules, 1, "rule %d", i)
+		assert.Contains(t, rules[0].Raw, name+" := ")
+	}
+}
+
+func TestMatchSpanRuleSkipsContextCloners(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "gls.go")
+	require.NoError(t, os.WriteFile(source, []byte(`package gls
+
+type traceContext struct{}
+
+func (tc *traceContext) Clone() interface{} { return tc }
+func (tc *traceContext) String() string { return "" }
+
+type snapshot struct{}
+
+func (s snapshot) Clone() snapshot { return s }
+`), 0o644))
+	tree, err := ast.ParseFileFast(source)
+	require.NoError(t, err)
+
+	r, err := rule.NewInstSpanRule([]byte("target: gls\nfunc: \"*\"\nrecv: \"/.*/\"\nspan: \"{func}\""), "r")
+	require.NoError(t, err)
+	rules, err := matchSpanRule(tree, r, make(map[string]int))
+	require.NoError(t, err)
+	names := make([]string, 0)
+	for _, rr := range rules {
+		names = append(names, rr.Name)
+	}
+	assert.ElementsMatch(t, []string{"r#(*traceContext).String", "r#(snapshot).Clone"}, names)
+
+	// Unless selected by name
+	r, err = rule.NewInstSpanRule([]byte("target: gls\nfunc: Clone\nrecv: \"*traceContext\"\nspan: clone"), "r")
+	require.NoError(t, err)
+	rules, err = matchSpanRule(tree, r, make(map[string]int))
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
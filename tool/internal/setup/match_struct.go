@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"go/parser"
+	"slices"
+	"strings"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/ast"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// matchUnkeyedLits finds the unkeyed literals of the structs that the matched
+// struct rules add fields to, which would no longer compile once the fields
+// are added. The files containing them get the struct rules as well so that
+// the literals are rewritten, unless the rules reject unkeyed literals.
+func (sp *SetupPhase) matchUnkeyedLits(dep *Dependency, set *rule.InstRuleSet) error {
+	rules := set.GetStructRules()
+	if len(rules) == 0 {
+		return nil
+	}
+	// Make the order of the rules deterministic for reporting
+	slices.SortFunc(rules, func(a, b *rule.InstStructRule) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	rules = slices.CompactFunc(rules, func(a, b *rule.InstStructRule) bool { return a == b })
+	for _, source := range dep.Sources {
+		p := ast.NewAstParser()
+		tree, err := p.Parse(source, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		for _, r := range rules {
+			lits := ast.FindUnkeyedLits(tree, r.Struct)
+			if len(lits) == 0 {
+				continue
+			}
+			if r.UnkeyedLiterals == rule.UnkeyedLiteralsReject {
+				pos := p.FindPosition(lits[0])
+				return ex.Newf("%s:%d:%d: unkeyed literal of struct %s prevents rule %q from adding fields",
+					source, pos.Line, pos.Column, r.Struct, r.Name)
+			}
+			if !slices.Contains(set.StructRules[source], r) {
+				set.AddStructRule(source, r)
+				sp.Info("Match unkeyed literals", "rule", r, "file", source, "count", len(lits))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+func TestMatchUnkeyedLits(t *testing.T) {
+	dir := t.TempDir()
+	decl := filepath.Join(dir, "decl.go")
+	lits := filepath.Join(dir, "lits.go")
+	keyed := filepath.Join(dir, "keyed.go")
+	require.NoError(t, os.WriteFile(decl, []byte("package app\n\ntype T struct{ a int }\n"), 0o644))
+	require.NoError(t, os.WriteFile(lits, []byte("package app\n\nvar v = []T{\n\t{1},\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile(keyed, []byte("package app\n\nvar w = T{a: 1}\n"), 0o644))
+	dep := &Dependency{ImportPath: "example.com/app", Sources: []string{decl, lits, keyed}}
+
+	tests := []struct {
+		name     string
+		unkeyed  string
+		expected []string
+		errMsg   string
+	}{
+		{
+			name:     "rewrite by default",
+			expected: []string{decl, lits},
+		},
+		{
+			name:     "rewrite",
+			unkeyed:  rule.UnkeyedLiteralsRewrite,
+			expected: []string{decl, lits},
+		},
+		{
+			name:    "reject",
+			unkeyed: rule.UnkeyedLiteralsReject,
+			errMsg:  lits + `:4:2: unkeyed literal of struct T prevents rule "r" from adding fields`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &rule.InstStructRule{
+				InstBaseRule:    rule.InstBaseRule{Name: "r", Target: dep.ImportPath},
+				Struct:          "T",
+				NewField:        []*rule.InstStructField{{Name: "B", Type: "int"}},
+				UnkeyedLiterals: tt.unkeyed,
+			}
+			sp := newTestSetupPhase()
+			set, err := sp.preciseMatching(dep, []rule.InstRule{r}, rule.NewInstRuleSet(dep.ImportPath))
+			require.NoError(t, err)
+			err = sp.matchUnkeyedLits(dep, set)
+			if tt.errMsg != "" {
+				require.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			files := make([]string, 0)
+			for file, rules := range set.StructRules {
+				require.Equal(t, []*rule.InstStructRule{r}, rules)
+				files = append(files, file)
+			}
+			require.ElementsMatch(t, tt.expected, files)
+		})
+	}
+}
@@ -135,6 +135,38 @@ func TestMatchVersion(t *testing.T) {
 			ruleVersion:    "v1.0.0,v2.0.0",
 			expectedResult: true,
 		},
+		{
+			name: "devel version in range",
+			dependency: &Dependency{
+				Version: develVersion,
+			},
+			ruleVersion:    "v1.0.0,v2.0.0",
+			expectedResult: true,
+		},
+		{
+			name: "unknown version not in range",
+			dependency: &Dependency{
+				Version: "",
+			},
+			ruleVersion:    "v1.0.0,v2.0.0",
+			expectedResult: false,
+		},
+		{
+			name: "pseudo-version after base version",
+			dependency: &Dependency{
+				Version: "v1.2.4-0.20240101000000-abcdef123456",
+			},
+			ruleVersion:    "v1.2.3,v1.2.4",
+			expectedResult: true,
+		},
+		{
+			name: "union with exclusion",
+			dependency: &Dependency{
+				Version: "v2.1.3",
+			},
+			ruleVersion:    ">=v1.2.0 <v1.5.0 || >=v2.0.0, !=v2.1.3",
+			expectedResult: false,
+		},
 		{
 			name: "minimal version only - good",
 			dependency: &Dependency{
@@ -218,6 +250,87 @@ target: github.com/example/lib
 			expectError:  false,
 			expectedType: "*rule.InstRawRule",
 		},
+		{
+			name: "var rule creation",
+			yamlContent: `
+var: DefaultTimeout
+value: 2 * _origValue
+target: github.com/example/lib
+`,
+			ruleName:     "test-var-rule",
+			expectError:  false,
+			expectedType: "*rule.InstVarRule",
+		},
+		{
+			name: "goroutine rule creation",
+			yamlContent: `
+goroutine: Serve
+capture: CaptureContext
+restore: RestoreContext
+path: github.com/example/hooks
+target: github.com/example/lib
+`,
+			ruleName:     "test-goroutine-rule",
+			expectError:  false,
+			expectedType: "*rule.InstGoroutineRule",
+		},
+		{
+			name: "span rule creation",
+			yamlContent: `
+span: "{recv}.{func}"
+func: Get
+recv: "*Repo"
+target: github.com/example/lib
+`,
+			ruleName:     "test-span-rule",
+			expectError:  false,
+			expectedType: "*rule.InstSpanRule",
+		},
+		{
+			name: "metric rule creation",
+			yamlContent: `
+metric: store.repo.get
+func: Get
+recv: "*Repo"
+target: github.com/example/lib
+`,
+			ruleName:     "test-metric-rule",
+			expectError:  false,
+			expectedType: "*rule.InstMetricRule",
+		},
+		{
+			name: "interface rule creation",
+			yamlContent: `
+interface: io.Reader
+func: Read
+target: github.com/example/lib
+before: MyHook1Before
+`,
+			ruleName:     "test-interface-rule",
+			expectError:  false,
+			expectedType: "*rule.InstInterfaceRule",
+		},
+		{
+			name: "call rule creation",
+			yamlContent: `
+call: database/sql.(*DB).Query
+target: github.com/example/lib
+before: MyHook1Before
+`,
+			ruleName:     "test-call-rule",
+			expectError:  false,
+			expectedType: "*rule.InstCallRule",
+		},
+		{
+			name: "call rule without package path",
+			yamlContent: `
+call: Query
+target: github.com/example/lib
+before: MyHook1Before
+`,
+			ruleName:    "test-invalid-call-rule",
+			expectError: true,
+		},
 		{
 			name: "rule with version",
 			yamlContent: `
@@ -357,8 +470,143 @@ func TestLoadDefaultRules(t *testing.T) {
 	require.Greater(t, len(rules), 1, "default rules should be more than 1")
 }
 
+func TestPreciseMatchingSelectors(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "repo.go")
+	err := os.WriteFile(source, []byte(`package lib
+
+type Repo struct{}
+
+func (r *Repo) Get() {}
+func (r *Repo) Put() {}
+func (r *Repo) evict() {}
+func (r Repo) Len() int { return 0 }
+
+func HandleGet() { go handleDelete() }
+func HandlePut() {}
+func handleDelete() {}
+func init() {}
+func OtelBeforeTrampoline_Get() {}
+
+var (
+	Limit, Burst = 10, 20
+)
+`), 0o644)
+	require.NoError(t, err)
+	dep := &Dependency{ImportPath: "example.com/lib", Sources: []string{source}}
+
+	tests := []struct {
+		name     string
+		rule     string
+		expected []string
+	}{
+		{
+			name:     "exact",
+			rule:     "func: Get\nrecv: \"*Repo\"\nbefore: H",
+			expected: []string{"r"},
+		},
+		{
+			name:     "all functions but init and generated ones",
+			rule:     "func: \"*\"\nbefore: H",
+			expected: []string{"r#HandleGet", "r#HandlePut", "r#handleDelete"},
+		},
+		{
+			name:     "glob functions",
+			rule:     "func: \"*andle*\"\nbefore: H",
+			expected: []string{"r#HandleGet", "r#HandlePut", "r#handleDelete"},
+		},
+		{
+			name:     "exported methods of pointer receiver",
+			rule:     "func: \"*\"\nrecv: \"*Repo\"\nexported_only: true\nafter: H",
+			expected: []string{"r#(*Repo).Get", "r#(*Repo).Put"},
+		},
+		{
+			name:     "regexp receiver",
+			rule:     "func: \"/^(Get|Len)$/\"\nrecv: \"/Repo/\"\nbefore: H",
+			expected: []string{"r#(*Repo).Get", "r#(Repo).Len"},
+		},
+		{
+			name:     "raw rule",
+			rule:     "func: \"Handle*\"\nraw: \"_ = 1\"",
+			expected: []string{"r#HandleGet", "r#HandlePut"},
+		},
+		{
+			name:     "span rule",
+			rule:     "func: \"*\"\nrecv: \"*Repo\"\nspan: \"{recv}.{func}\"",
+			expected: []string{"r#(*Repo).Get", "r#(*Repo).Put", "r#(*Repo).evict"},
+		},
+		{
+			name:     "metric rule",
+			rule:     "func: \"*\"\nrecv: \"*Repo\"\nexported_only: true\nmetric: \"{recv}.{func}\"",
+			expected: []string{"r#(*Repo).Get", "r#(*Repo).Put"},
+		},
+		{
+			name:     "var rule",
+			rule:     "var: Burst\nvalue: \"2 * _origValue\"",
+			expected: []string{"r"},
+		},
+		{
+			name:     "goroutine rule",
+			rule:     "goroutine: \"Handle*\"\ncapture: C\nrestore: R\npath: example.com/hooks",
+			expected: []string{"r"},
+		},
+		{
+			name:     "goroutine rule without go statements",
+			rule:     "goroutine: \"*Put\"\ncapture: C\nrestore: R\npath: example.com/hooks",
+			expected: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "target: example.com/lib\n" + tt.rule
+			var fields map[string]any
+			require.NoError(t, yaml.Unmarshal([]byte(content), &fields))
+			r, err1 := createRuleFromFields([]byte(content), "r", fields)
+			require.NoError(t, err1)
+
+			set := rule.NewInstRuleSet(dep.ImportPath)
+			set, err1 = newTestSetupPhase().preciseMatching(dep, []rule.InstRule{r}, set)
+			require.NoError(t, err1)
+
+			names := make([]string, 0)
+			for _, fr := range set.FuncRules[source] {
+				names = append(names, fr.GetName())
+			}
+			for _, rr := range set.RawRules[source] {
+				names = append(names, rr.GetName())
+			}
+			for _, vr := range set.VarRules[source] {
+				names = append(names, vr.GetName())
+			}
+			for _, gr := range set.GoroutineRules[source] {
+				names = append(names, gr.GetName())
+			}
+			require.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
+
 // Helper functions for constructing test data
 
+func TestRunMatchPackagePattern(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "store.go")
+	require.NoError(t, os.WriteFile(source, []byte(spanTestSource), 0o644))
+	content := "target: example.com/app/internal/...\nfunc: Open\nspan: open"
+	sr, err := rule.NewInstSpanRule([]byte(content), "r")
+	require.NoError(t, err)
+	rulesByTarget := map[string][]rule.InstRule{sr.Target: {sr}}
+
+	for path, matched := range map[string]bool{
+		"example.com/app/internal/store": true,
+		"example.com/app/internal":       true,
+		"example.com/app/cmd":            false,
+	} {
+		dep := &Dependency{ImportPath: path, Sources: []string{source}}
+		set, err1 := newTestSetupPhase().runMatch(dep, rulesByTarget, nil)
+		require.NoError(t, err1)
+		require.Equal(t, matched, !set.IsEmpty(), path)
+	}
+}
+
 func newTestSetupPhase() *SetupPhase {
 	return &SetupPhase{
 		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"context"
+	"go/version"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Module Versions
+//
+// Version-ranged rules are matched against the version of the module providing
+// the dependency, as resolved by the go command:
+//
+//   - A module replaced by another module version gets the replacement version.
+//   - A module replaced by a local directory keeps the version it replaces, as
+//     the local copy is expected to be a fork of that version.
+//   - The main module, workspace modules and other modules without a version are
+//     "(devel)", which satisfies every version range.
+//   - Standard library packages get the version of the Go toolchain, e.g.
+//     go1.24.3 becomes v1.24.3.
+//   - Pseudo-versions are compared as they are, i.e. v1.2.4-0.20240101-abcdef
+//     is ordered after v1.2.3 and before v1.2.4.
+
+// develVersion is the version of modules built from local sources.
+const develVersion = "(devel)"
+
+// goVersionToSemver converts a Go toolchain version into a semantic version,
+// e.g. "go1.24.3" to "v1.24.3" and "go1.25rc1" to "v1.25.0-rc1".
+func goVersionToSemver(goVersion string) string {
+	if !version.IsValid(goVersion) {
+		return ""
+	}
+	v := strings.TrimPrefix(goVersion, "go")
+	pre := ""
+	for _, tag := range []string{"rc", "beta"} {
+		if i := strings.Index(v, tag); i >= 0 {
+			v, pre = v[:i], "-"+v[i:]
+			break
+		}
+	}
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+	return "v" + v + pre
+}
+
+// moduleVersion returns the version of the module following the replacements.
+func moduleVersion(m *packages.Module) string {
+	if m.Replace != nil && m.Replace.Version != "" {
+		return m.Replace.Version
+	}
+	if m.Version == "" {
+		return develVersion
+	}
+	return m.Version
+}
+
+// resolveModVersions sets the version of the dependencies from the modules
+// providing them, and whether they belong to the main module, i.e. the module
+// or the workspace modules being built. The versions guessed from the source
+// paths are kept for the dependencies the go command does not know about.
+func (sp *SetupPhase) resolveModVersions(ctx context.Context, roots []*packages.Package, deps []*Dependency) error {
+	patterns := make([]string, 0, len(roots))
+	for _, pkg := range roots {
+		patterns = append(patterns, pkg.PkgPath)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedModule |
+			packages.NeedImports | packages.NeedDeps,
+	}
+	if sp.buildEnv != nil && len(sp.buildEnv.Tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(sp.buildEnv.Tags, ",")}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return ex.Wrapf(err, "failed to load modules of %v", patterns)
+	}
+
+	// Index versions by package directory, as main packages are compiled as
+	// "main" rather than by their import path
+	versions := make(map[string]string)
+	mains := make(map[string]bool)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if len(pkg.GoFiles) == 0 {
+			return
+		}
+		dir := util.NormalizePath(filepath.Dir(pkg.GoFiles[0]))
+		v := ""
+		if pkg.Module != nil {
+			v = moduleVersion(pkg.Module)
+			mains[dir] = pkg.Module.Main
+		} else if sp.buildEnv != nil {
+			v = goVersionToSemver(sp.buildEnv.GoVersion)
+		}
+		versions[dir] = v
+	})
+	for _, dep := range deps {
+		if len(dep.Sources) == 0 {
+			continue
+		}
+		dir := util.NormalizePath(filepath.Dir(dep.Sources[0]))
+		v, ok := versions[dir]
+		if !ok {
+			sp.Debug("Keep guessed module version", "dep", dep)
+			continue
+		}
+		dep.Version = v
+		dep.Main = mains[dir]
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+func TestGoVersionToSemver(t *testing.T) {
+	tests := map[string]string{
+		"go1.24.3":  "v1.24.3",
+		"go1.25":    "v1.25.0",
+		"go1.25rc1": "v1.25.0-rc1",
+		"go1.21.0":  "v1.21.0",
+		"devel":     "",
+	}
+	for goVersion, expected := range tests {
+		assert.Equal(t, expected, goVersionToSemver(goVersion), goVersion)
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   *packages.Module
+		expected string
+	}{
+		{"released", &packages.Module{Version: "v1.2.3"}, "v1.2.3"},
+		{"main module", &packages.Module{Main: true}, develVersion},
+		{"replaced by version", &packages.Module{
+			Version: "v1.2.3",
+			Replace: &packages.Module{Path: "example.com/fork", Version: "v1.2.4-fork"},
+		}, "v1.2.4-fork"},
+		{"replaced by directory", &packages.Module{
+			Version: "v1.2.3",
+			Replace: &packages.Module{Path: "../fork"},
+		}, "v1.2.3"},
+		{"workspace module", &packages.Module{Path: "example.com/lib"}, develVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, moduleVersion(tt.module))
+		})
+	}
+}
+
+func TestResolveModVersions(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.24\n",
+		"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println() }\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	t.Chdir(dir)
+
+	roots, err := packages.Load(&packages.Config{Mode: packages.NeedName}, ".")
+	require.NoError(t, err)
+	fmtDir := filepath.Join(build.Default.GOROOT, "src", "fmt")
+	deps := []*Dependency{
+		{ImportPath: "main", Sources: []string{filepath.Join(dir, "main.go")}},
+		{ImportPath: "fmt", Sources: []string{filepath.Join(fmtDir, "print.go")}},
+		{ImportPath: "example.com/gone", Version: "v1.0.0", Sources: []string{"/nonexistent/gone.go"}},
+	}
+	sp := newTestSetupPhase()
+	sp.buildEnv = &rule.BuildEnv{GoVersion: "go1.24.3"}
+	require.NoError(t, sp.resolveModVersions(t.Context(), roots, deps))
+
+	assert.Equal(t, develVersion, deps[0].Version)
+	assert.Equal(t, "v1.24.3", deps[1].Version)
+	assert.Equal(t, "v1.0.0", deps[2].Version)
+	assert.True(t, deps[0].Main)
+	assert.False(t, deps[1].Main)
+}
@@ -0,0 +1,73 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// position returns the position of the node in the YAML file for messages.
+func position(file string, node *yaml.Node) string {
+	if file == "" {
+		file = "<rules>"
+	}
+	return fmt.Sprintf("%s:%d:%d", file, node.Line, node.Column)
+}
+
+// atPosition annotates the error with the position of the node.
+func atPosition(err error, file string, node *yaml.Node) error {
+	return ex.Wrapf(err, "at %s", position(file, node))
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// checkFields reports the first field of the mapping node that is not allowed.
+func checkFields(file string, node *yaml.Node, what string, allowed []string) error {
+	if node.Kind != yaml.MappingNode {
+		return ex.Newf("%s: %s must be a mapping", position(file, node), what)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !slices.Contains(allowed, key.Value) {
+			return ex.Newf("%s: unknown field %q in %s", position(file, key), key.Value, what)
+		}
+	}
+	return nil
+}
+
+// checkRuleFields checks the fields of the i-th variant of the rule, i.e. the
+// fields of the rule itself and the ones of the variant if any. The fields
+// inherited from templates are checked when the rule is created.
+func checkRuleFields(file string, node *yaml.Node, i int, v *ruleVariant) error {
+	kind := rule.KindOf(v.fields)
+	if kind == nil {
+		return ex.Newf("%s: rule %q must have one of the fields %s",
+			position(file, node), v.name, rule.KindFields())
+	}
+	what := fmt.Sprintf("%s %q", kind.Name, v.name)
+	allowed := append(kind.Fields(), rule.ExtendsKey, rule.ParamsKey)
+	variants := mappingValue(node, variantsKey)
+	if variants == nil {
+		return checkFields(file, node, what, allowed)
+	}
+	err := checkFields(file, node, what, append(allowed, variantsKey))
+	if err != nil {
+		return err
+	}
+	return checkFields(file, variants.Content[i], what, kind.Fields())
+}
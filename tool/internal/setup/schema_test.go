@@ -0,0 +1,97 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuleFromYamlErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name: "unknown field",
+			content: `hook:
+  target: main
+  func: Foo
+  befor: Before
+`,
+			expected: `rules.yaml:4:3: unknown field "befor" in func rule "hook"`,
+		},
+		{
+			name: "missing discriminator",
+			content: `
+hook:
+  target: main
+  before: Before
+`,
+			expected: `rules.yaml:3:3: rule "hook" must have one of the fields ` +
+				`struct, file, methods, var, goroutine, interface, call`,
+		},
+		{
+			name: "unknown field of variant",
+			content: `hook:
+  target: main
+  func: Foo
+  before: Before
+  variants:
+    - go: ">=1.23"
+    - goo: "<1.23"
+`,
+			expected: `rules.yaml:7:7: unknown field "goo" in func rule "hook/1"`,
+		},
+		{
+			name: "invalid rule",
+			content: `ok:
+  target: main
+  func: Foo
+  before: Before
+broken:
+  target: main
+  func: Foo
+`,
+			expected: "at rules.yaml:5:1",
+		},
+		{
+			name: "unknown field of instrumentation",
+			content: `instrumentation:
+  trace:
+    pointcut: {function: Foo}
+    advise: [{raw: x}]
+`,
+			expected: `rules.yaml:4:5: unknown field "advise" in instrumentation "trace"`,
+		},
+		{
+			name:     "not a mapping",
+			content:  "- hook\n",
+			expected: "rules.yaml:1:1: rules must be a mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRuleFromYaml("rules.yaml", []byte(tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
+
+func TestParseRuleFromYamlOrder(t *testing.T) {
+	rules, err := parseRuleFromYaml("rules.yaml", []byte(`
+meta:
+  description: ignored
+b: {target: main, func: B, raw: x}
+a: {target: main, func: A, raw: x}
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "b", rules[0].GetName())
+	assert.Equal(t, "a", rules[1].GetName())
+}
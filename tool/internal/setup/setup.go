@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
 	"github.com/urfave/cli/v3"
 	"golang.org/x/tools/go/packages"
@@ -20,6 +21,10 @@ import (
 type SetupPhase struct {
 	logger     *slog.Logger
 	ruleConfig string
+	buildEnv   *rule.BuildEnv // The build that rules are applied to
+	trace      *traceOptions  // The packages traced by the --trace-* flags
+	buildFlags []string       // The flags of the go build command, see findBuildFlags
+	typed      *typedPackages // The dependencies matched against type information
 }
 
 func (sp *SetupPhase) Info(msg string, args ...any)  { sp.logger.Info(msg, args...) }
@@ -151,6 +156,13 @@ func Setup(ctx context.Context, cmd *cli.Command) error {
 	sp := &SetupPhase{
 		logger:     logger,
 		ruleConfig: cmd.String("rules"),
+		buildFlags: findBuildFlags(args),
+		trace: &traceOptions{
+			packages:    cmd.StringSlice("trace-packages"),
+			include:     cmd.String("trace-include"),
+			exclude:     cmd.String("trace-exclude"),
+			minDuration: cmd.Duration("trace-min-duration"),
+		},
 	}
 
 	// Introduce additional hook code by generating otel.runtime.go
@@ -166,6 +178,18 @@ func Setup(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
+	// Describe the build so that conditional rules can be evaluated
+	sp.buildEnv, err = newBuildEnv(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the module versions of dependencies for version-ranged rules
+	err = sp.resolveModVersions(ctx, pkgs, deps)
+	if err != nil {
+		return err
+	}
+
 	// Extract the embedded pkg module into local directory
 	err = sp.extract()
 	if err != nil {
@@ -205,7 +229,13 @@ func Setup(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	// Write the matched hook to matched.txt for further instrument phase
-	return sp.store(matched)
+	if err = sp.store(matched); err != nil {
+		return err
+	}
+
+	// Resolve the export data of the packages imported by the injected code
+	// once for all the packages built by the instrument phase
+	return sp.storeExports(ctx, matched)
 }
 
 // BuildWithToolexec builds the project with the toolexec mode
@@ -4,8 +4,12 @@
 package setup
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
@@ -34,3 +38,69 @@ func (sp *SetupPhase) store(matched []*rule.InstRuleSet) error {
 	sp.Info("Stored matched sets", "path", f)
 	return nil
 }
+
+// resolveExports builds the packages with the same toolexec and build flags as
+// the go build command, so that they match the packages built by the command,
+// and returns their export data by the import paths. The matched rules must be
+// stored already, the toolexec instruments the packages by them.
+func (sp *SetupPhase) resolveExports(ctx context.Context, paths []string) (map[string]util.PackageExport, error) {
+	exports := make(map[string]util.PackageExport, len(paths))
+	if len(paths) == 0 {
+		return exports, nil
+	}
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to get executable path")
+	}
+	args := []string{"list", "-export", "-toolexec=" + execPath + " toolexec"}
+	args = append(args, sp.buildFlags...)
+	args = append(args, "-f", "{{.ImportPath}} {{.Export}}")
+	cmd := exec.CommandContext(ctx, "go", append(args, paths...)...)
+	pwd := util.GetOtelWorkDir()
+	cmd.Dir = pwd
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", util.EnvOtelWorkDir, pwd))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, ex.Wrapf(err, "failed to resolve export data of %v", paths)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != len(paths) {
+		return nil, ex.Newf("unexpected export data of %v: %s", paths, out)
+	}
+	// Packages are listed in the order of the arguments
+	for i, line := range lines {
+		importPath, file, ok := strings.Cut(line, " ")
+		if !ok || file == "" {
+			return nil, ex.Newf("no export data of %s", paths[i])
+		}
+		exports[paths[i]] = util.PackageExport{ImportPath: importPath, File: file}
+	}
+	return exports, nil
+}
+
+// storeExports stores the export data of the packages that the injected code
+// may import, which the instrument phase adds to the import config of the
+// packages that do not import them. It's the pair of the loadExports of the
+// instrument phase.
+func (sp *SetupPhase) storeExports(ctx context.Context, matched []*rule.InstRuleSet) error {
+	paths, err := exportedImports(matched)
+	if err != nil {
+		return err
+	}
+	exports, err := sp.resolveExports(ctx, paths)
+	if err != nil {
+		return err
+	}
+	f := util.GetExportsFile()
+	bs, err := json.Marshal(exports)
+	if err != nil {
+		return ex.Wrapf(err, "failed to marshal export data to JSON")
+	}
+	err = util.WriteFile(f, string(bs))
+	if err != nil {
+		return err
+	}
+	sp.Info("Stored export data", "path", f, "packages", paths)
+	return nil
+}
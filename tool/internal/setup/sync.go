@@ -7,6 +7,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"golang.org/x/mod/modfile"
@@ -70,13 +71,46 @@ func addReplace(modfile *modfile.File, replace *replaceDirective) (bool, error)
 	return false, nil
 }
 
+// isStdPath reports whether the import path belongs to the standard library,
+// whose paths have no domain in their first element.
+func isStdPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// externalImports returns the paths of the hook packages and the packages
+// imported by injected code that are provided by neither the standard library,
+// the instrumentation packages nor the module itself, e.g. hooks maintained in
+// an internal repository. They are not replaced by local directories but must
+// be required by go.mod, along with the packages they import in turn.
+func externalImports(paths []string, modulePath string) []string {
+	external := make([]string, 0)
+	for _, path := range paths {
+		if isStdPath(path) || path == util.OtelRoot || strings.HasPrefix(path, util.OtelRoot+"/") ||
+			path == modulePath || strings.HasPrefix(path, modulePath+"/") {
+			continue
+		}
+		external = append(external, path)
+	}
+	slices.Sort(external)
+	return slices.Compact(external)
+}
+
 func (sp *SetupPhase) syncDeps(ctx context.Context, matched []*rule.InstRuleSet, moduleDir string) error {
-	rules := make([]*rule.InstFuncRule, 0)
-	for _, m := range matched {
-		funcRules := m.GetFuncRules()
-		rules = append(rules, funcRules...)
+	rules := hookRules(matched)
+	injected, err := injectedImports(matched)
+	if err != nil {
+		return err
 	}
-	if len(rules) == 0 {
+	// The code injected by the rules may also refer to the instrumentation
+	// packages, e.g. the code generated by span rules calls the shared module
+	usesPkg := slices.ContainsFunc(injected, func(path string) bool {
+		return strings.HasPrefix(path, util.OtelRoot+"/")
+	})
+	usesOther := slices.ContainsFunc(injected, func(path string) bool {
+		return !isStdPath(path) && !strings.HasPrefix(path, util.OtelRoot+"/")
+	})
+	if len(rules) == 0 && !usesPkg && !usesOther {
 		return nil
 	}
 
@@ -89,9 +123,14 @@ func (sp *SetupPhase) syncDeps(ctx context.Context, matched []*rule.InstRuleSet,
 	if err != nil {
 		return err
 	}
+	paths := slices.Clone(injected)
 	replaces := make([]*replaceDirective, 0)
 	for _, m := range rules {
-		util.Assert(strings.HasPrefix(m.Path, util.OtelRoot), "sanity check")
+		paths = append(paths, m.Path)
+		if !strings.HasPrefix(m.Path, util.OtelRoot+"/") {
+			// Hook packages of other modules are resolved by go.mod
+			continue
+		}
 		oldPath := m.Path
 		newPath := strings.TrimPrefix(oldPath, util.OtelRoot)
 		newPath = filepath.Join(util.GetBuildTempDir(), newPath)
@@ -103,26 +142,28 @@ func (sp *SetupPhase) syncDeps(ctx context.Context, matched []*rule.InstRuleSet,
 		})
 	}
 
-	// Add replace directive for special pkg module
-	// TODO: Since we haven't published the instrumentation packages yet,
-	// we need to add the replace directive to the local path.
-	// Once the instrumentation packages are published, we can remove this.
-	replaces = append(replaces, &replaceDirective{
-		oldPath:    util.OtelRoot + "/pkg",
-		oldVersion: "",
-		newPath:    filepath.Join(util.GetBuildTempDir(), unzippedPkgDir),
-		newVersion: "",
-	})
+	if len(rules) > 0 || usesPkg {
+		// Add replace directive for special pkg module
+		// TODO: Since we haven't published the instrumentation packages yet,
+		// we need to add the replace directive to the local path.
+		// Once the instrumentation packages are published, we can remove this.
+		replaces = append(replaces, &replaceDirective{
+			oldPath:    util.OtelRoot + "/pkg",
+			oldVersion: "",
+			newPath:    filepath.Join(util.GetBuildTempDir(), unzippedPkgDir),
+			newVersion: "",
+		})
 
-	// Add replace directive for special shared module
-	// shared module initializes the OpenTelemetry SDK. It is required by all
-	// hook code to be present.
-	replaces = append(replaces, &replaceDirective{
-		oldPath:    util.OtelRoot + "/pkg/instrumentation/shared",
-		oldVersion: "",
-		newPath:    filepath.Join(util.GetBuildTempDir(), "pkg/instrumentation/shared"),
-		newVersion: "",
-	})
+		// Add replace directive for special shared module
+		// shared module initializes the OpenTelemetry SDK. It is required by all
+		// hook code to be present.
+		replaces = append(replaces, &replaceDirective{
+			oldPath:    util.OtelRoot + "/pkg/instrumentation/shared",
+			oldVersion: "",
+			newPath:    filepath.Join(util.GetBuildTempDir(), "pkg/instrumentation/shared"),
+			newVersion: "",
+		})
+	}
 
 	// Okay, now add all the replace directives to go.mod
 	changed := false
@@ -137,9 +178,21 @@ func (sp *SetupPhase) syncDeps(ctx context.Context, matched []*rule.InstRuleSet,
 		}
 	}
 
+	// The hook packages import whatever they need, which tidy resolves into
+	// requirements of go.mod, transitively. Packages of other modules are not
+	// replaced, so go.mod must be tidied for them even if it does not change
+	modulePath := ""
+	if modfile.Module != nil {
+		modulePath = modfile.Module.Mod.Path
+	}
+	external := externalImports(paths, modulePath)
+	if len(external) > 0 {
+		sp.Info("Require external packages", "paths", external)
+	}
+
 	// Check if any replace directive is added, if so, write go.mod and run mod tidy
 	// to sync the changes to go.mod for build system to use.
-	if changed {
+	if changed || len(external) > 0 {
 		err = writeGoMod(goModFile, modfile)
 		if err != nil {
 			return err
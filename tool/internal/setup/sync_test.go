@@ -225,3 +225,47 @@ go 1.21
 	// At minimum, the pkg replace should be added
 	assert.Contains(t, string(content), "replace")
 }
+
+func TestExternalImports(t *testing.T) {
+	paths := []string{
+		"net/http",
+		"golang.org/x/net/http2",
+		util.OtelRoot + "/pkg/instrumentation/shared",
+		"example.com/app/internal/db",
+		"example.com/app",
+		"example.com/hooks/trace",
+		"golang.org/x/net/http2",
+	}
+	expected := []string{"example.com/hooks/trace", "golang.org/x/net/http2"}
+	assert.Equal(t, expected, externalImports(paths, "example.com/app"))
+	assert.Empty(t, externalImports([]string{"fmt", "example.com/app/db"}, "example.com/app"))
+}
+
+func TestSyncDeps_ExternalHooks(t *testing.T) {
+	tempDir := t.TempDir()
+	gomodPath := filepath.Join(tempDir, "go.mod")
+	require.NoError(t, os.WriteFile(gomodPath, []byte("module example.com/test\n\ngo 1.21\n"), 0o644))
+	t.Setenv(util.EnvOtelWorkDir, tempDir)
+
+	sp := &SetupPhase{
+		logger: slog.Default(),
+	}
+	// Hook packages of other modules are not replaced by local directories
+	funcRule := &rule.InstFuncRule{
+		InstBaseRule: rule.InstBaseRule{Name: "test-rule"},
+		Path:         "example.com/hooks/trace",
+	}
+	ruleSet := &rule.InstRuleSet{
+		FuncRules: map[string][]*rule.InstFuncRule{"test.go": {funcRule}},
+	}
+	err := sp.syncDeps(t.Context(), []*rule.InstRuleSet{ruleSet}, tempDir)
+	if err != nil {
+		// Tidy may fail to resolve the hook module, which does not exist
+		t.Logf("syncDeps failed (expected in test): %v", err)
+	}
+
+	content, err := os.ReadFile(gomodPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "example.com/hooks/trace =>")
+	assert.Contains(t, string(content), util.OtelRoot+"/pkg =>")
+}
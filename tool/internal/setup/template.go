@@ -0,0 +1,243 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/util"
+)
+
+// -----------------------------------------------------------------------------
+// Rule Templates
+//
+// A rule file may give defaults for the fields of its rules, and declare named
+// templates, i.e. partial rules, that its rules extend, e.g.
+//
+//	defaults:
+//		path: "github.com/foo/bar/hooks"
+//	templates:
+//		traced:
+//			target: "github.com/foo/bar/store"
+//			before: "${name}Before"
+//			after: "${name}After"
+//	get:
+//		extends: traced
+//		func: Get
+//		params: {name: Get}
+//
+// Templates and parameters are resolved before the rules are created, so the
+// rules themselves know nothing about them.
+
+// paramPattern matches the references to parameters, e.g. ${name}, and the
+// escaped ones, e.g. $${name}, which stand for the reference itself.
+var paramPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// paramEscape is the prefix of the escaped references to parameters.
+const paramEscape = "$$"
+
+// ruleTemplates holds the defaults and the templates of a rule file.
+type ruleTemplates struct {
+	defaults  map[string]any
+	templates map[string]map[string]any
+}
+
+// parseRuleTemplates parses the defaults and the templates blocks of the rule
+// file, if any.
+func parseRuleTemplates(file string, root *yaml.Node) (*ruleTemplates, error) {
+	rt := &ruleTemplates{
+		defaults:  make(map[string]any),
+		templates: make(map[string]map[string]any),
+	}
+	if node := mappingValue(root, rule.DefaultsKey); node != nil {
+		if err := checkFields(file, node, rule.DefaultsKey, rule.AllFields()); err != nil {
+			return nil, err
+		}
+		if err := node.Decode(&rt.defaults); err != nil {
+			return nil, atPosition(ex.Wrap(err), file, node)
+		}
+	}
+	node := mappingValue(root, rule.TemplatesKey)
+	if node == nil {
+		return rt, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, ex.Newf("%s: %s must be a mapping", position(file, node), rule.TemplatesKey)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.MappingNode {
+			return nil, ex.Newf("%s: template %q must be a mapping", position(file, value), key.Value)
+		}
+		var fields map[string]any
+		if err := value.Decode(&fields); err != nil {
+			return nil, atPosition(ex.Wrap(err), file, key)
+		}
+		rt.templates[key.Value] = fields
+	}
+	return rt, nil
+}
+
+// extendsOf returns the names of the templates extended by the fields, which
+// are given by either a name or a list of names.
+func extendsOf(fields map[string]any) ([]string, error) {
+	switch v := fields[rule.ExtendsKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		names := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, ex.Newf("%s must be a template name or a list of them", rule.ExtendsKey)
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	default:
+		return nil, ex.Newf("%s must be a template name or a list of them", rule.ExtendsKey)
+	}
+}
+
+// paramsOf returns the parameters given by the fields.
+func paramsOf(fields map[string]any) (map[string]any, error) {
+	switch v := fields[rule.ParamsKey].(type) {
+	case nil:
+		return map[string]any{}, nil
+	case map[string]any:
+		return v, nil
+	default:
+		return nil, ex.Newf("%s must be a mapping", rule.ParamsKey)
+	}
+}
+
+// extend merges the templates extended by the fields, in order, and then the
+// fields themselves. The parameters are merged by name instead of replaced.
+// The chain of the templates being extended is used to detect cycles.
+func (rt *ruleTemplates) extend(fields map[string]any, chain []string) (map[string]any, error) {
+	names, err := extendsOf(fields)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]any)
+	params := make(map[string]any)
+	for _, name := range append(names, "") {
+		part := fields
+		if name != "" {
+			if slices.Contains(chain, name) {
+				return nil, ex.Newf("template %q extends itself", name)
+			}
+			tmpl, ok := rt.templates[name]
+			if !ok {
+				return nil, ex.Newf("unknown template %q", name)
+			}
+			part, err = rt.extend(tmpl, append(slices.Clone(chain), name))
+			if err != nil {
+				return nil, err
+			}
+		}
+		p, err1 := paramsOf(part)
+		if err1 != nil {
+			return nil, err1
+		}
+		maps.Copy(merged, part)
+		maps.Copy(params, p)
+	}
+	delete(merged, rule.ExtendsKey)
+	if len(params) > 0 {
+		merged[rule.ParamsKey] = params
+	}
+	return merged, nil
+}
+
+// substitute replaces the references to the parameters in the string values of
+// the fields. A value that is a single reference is replaced by the value of
+// the parameter as is, e.g. a boolean, and the others by its text. An escaped
+// reference is replaced by the reference itself.
+func substitute(value any, params map[string]any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if m := paramPattern.FindStringSubmatch(v); m != nil && m[0] == v && !strings.HasPrefix(v, paramEscape) {
+			param, ok := params[m[1]]
+			if !ok {
+				return nil, ex.Newf("undefined parameter %q", m[1])
+			}
+			return param, nil
+		}
+		var err error
+		result := paramPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			if strings.HasPrefix(ref, paramEscape) {
+				return ref[1:]
+			}
+			name := paramPattern.FindStringSubmatch(ref)[1]
+			param, ok := params[name]
+			if !ok {
+				err = ex.Newf("undefined parameter %q", name)
+				return ref
+			}
+			return fmt.Sprint(param)
+		})
+		return result, err
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			s, err := substitute(item, params)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			s, err := substitute(item, params)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = s
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+// resolve resolves the fields of the rule, i.e. merges the templates it
+// extends, fills the fields it does not set with the defaults, and substitutes
+// the parameters. Defaults are only given to the fields of its kind of rule,
+// e.g. a default path is ignored by struct rules.
+func (rt *ruleTemplates) resolve(fields map[string]any) (map[string]any, error) {
+	merged, err := rt.extend(fields, nil)
+	if err != nil {
+		return nil, err
+	}
+	if kind := rule.KindOf(merged); kind != nil {
+		allowed := kind.Fields()
+		for key, value := range rt.defaults {
+			if _, ok := merged[key]; !ok && slices.Contains(allowed, key) {
+				merged[key] = value
+			}
+		}
+	}
+	// The references are substituted even if there are no parameters, so that
+	// the undefined ones are reported rather than left in the rule
+	params, _ := merged[rule.ParamsKey].(map[string]any)
+	delete(merged, rule.ParamsKey)
+	resolved, err := substitute(merged, params)
+	if err != nil {
+		return nil, err
+	}
+	return util.AssertType[map[string]any](resolved), nil
+}
@@ -0,0 +1,137 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+const templateTestRules = `
+defaults:
+  path: github.com/foo/bar/hooks
+  version: "v1.0.0"
+templates:
+  store:
+    target: github.com/foo/bar/store
+  traced:
+    extends: store
+    before: "${name}Before"
+    after: "${name}After"
+    required: "${required}"
+    params: {required: false}
+get:
+  extends: traced
+  func: Get
+  params: {name: Get}
+put:
+  extends: [traced]
+  func: Put
+  after: PutDone
+  path: github.com/foo/bar/other
+  params: {name: Put, required: true}
+field:
+  extends: store
+  struct: Store
+  new_field: [{name: span, type: "interface{}"}]
+raw:
+  target: main
+  func: main
+  raw: "println(\"$${name}\")"
+`
+
+func TestParseRuleTemplates(t *testing.T) {
+	rules, err := parseRuleFromYaml("rules.yaml", []byte(templateTestRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+
+	get, ok := rules[0].(*rule.InstFuncRule)
+	require.True(t, ok)
+	assert.Equal(t, "github.com/foo/bar/store", get.Target)
+	assert.Equal(t, "v1.0.0", get.Version)
+	assert.Equal(t, "GetBefore", get.Before)
+	assert.Equal(t, "GetAfter", get.After)
+	assert.Equal(t, "github.com/foo/bar/hooks", get.Path)
+	assert.False(t, get.Required)
+
+	put, ok := rules[1].(*rule.InstFuncRule)
+	require.True(t, ok)
+	assert.Equal(t, "PutBefore", put.Before)
+	assert.Equal(t, "PutDone", put.After)
+	assert.Equal(t, "github.com/foo/bar/other", put.Path)
+	assert.True(t, put.Required)
+
+	// Defaults are only given to the fields of the kind, and the escaped
+	// references are kept as references
+	field, ok := rules[2].(*rule.InstStructRule)
+	require.True(t, ok)
+	assert.Equal(t, "github.com/foo/bar/store", field.Target)
+	raw, ok := rules[3].(*rule.InstRawRule)
+	require.True(t, ok)
+	assert.Equal(t, `println("${name}")`, raw.Raw)
+}
+
+func TestParseRuleTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "unknown template",
+			content:  "r: {extends: missing, func: A, target: main, before: B}\n",
+			expected: `unknown template "missing"`,
+		},
+		{
+			name: "cyclic templates",
+			content: `templates:
+  a: {extends: b}
+  b: {extends: a}
+r: {extends: a, func: A, target: main, before: B}
+`,
+			expected: `template "a" extends itself`,
+		},
+		{
+			name:     "undefined parameter",
+			content:  "r: {func: A, target: main, before: '${hook}Before', params: {name: A}}\n",
+			expected: `undefined parameter "hook"`,
+		},
+		{
+			name:     "undefined parameter without params",
+			content:  "r: {func: A, target: main, raw: 'println(\"${name}\")'}\n",
+			expected: `undefined parameter "name"`,
+		},
+		{
+			name:     "invalid params",
+			content:  "r: {func: A, target: main, before: B, params: [a]}\n",
+			expected: "params must be a mapping",
+		},
+		{
+			name:     "invalid extends",
+			content:  "r: {extends: {a: b}, func: A, target: main, before: B}\n",
+			expected: "extends must be a template name or a list of them",
+		},
+		{
+			name:     "unknown default",
+			content:  "defaults: {paht: a/b}\n",
+			expected: `rules.yaml:1:12: unknown field "paht" in defaults`,
+		},
+		{
+			name:     "invalid template",
+			content:  "templates: {a: b}\n",
+			expected: `rules.yaml:1:16: template "a" must be a mapping`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRuleFromYaml("rules.yaml", []byte(tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"context"
+	"go/build"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+	"gopkg.in/yaml.v3"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+// -----------------------------------------------------------------------------
+// Package Tracing
+//
+// The --trace-packages flag traces every function and method of the packages
+// matching the given patterns, e.g.
+//
+//	otel --trace-packages ./internal/... --trace-min-duration 1ms go build
+//
+// The flags are compiled into span rules, one for the functions and one for
+// the methods of every package, so they are matched like rules from files.
+// Relative patterns are resolved to the packages they denote, the others are
+// kept as package patterns of rule targets.
+
+const (
+	tracePackagesRuleName = "trace-packages"
+	tracePackagesSpanName = "{package}.{recv}.{func}"
+	traceAllFuncs         = "*"
+	traceAllRecvs         = "*"
+)
+
+// traceOptions holds the options of the --trace-* flags.
+type traceOptions struct {
+	packages    []string      // The package patterns, e.g. ./internal/...
+	include     string        // The regular expression of the qualified names to trace
+	exclude     string        // The regular expression of the qualified names not to trace
+	minDuration time.Duration // The shortest span to keep
+}
+
+// resolveTraceTargets returns the rule targets of the package patterns. Local
+// patterns such as ./internal/... are resolved to the import paths of the
+// packages that they match, or main for main packages, which are compiled by
+// that name.
+func (sp *SetupPhase) resolveTraceTargets(ctx context.Context, patterns []string) ([]string, error) {
+	targets := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !build.IsLocalImport(pattern) {
+			targets = append(targets, pattern)
+			continue
+		}
+		cfg := &packages.Config{Context: ctx, Mode: packages.NeedName}
+		if sp.buildEnv != nil && len(sp.buildEnv.Tags) > 0 {
+			cfg.BuildFlags = []string{"-tags=" + strings.Join(sp.buildEnv.Tags, ",")}
+		}
+		pkgs, err := packages.Load(cfg, pattern)
+		if err != nil {
+			return nil, ex.Wrapf(err, "failed to load packages of %s", pattern)
+		}
+		found := false
+		for _, pkg := range pkgs {
+			if len(pkg.Errors) > 0 {
+				sp.Debug("Skip package to trace", "pattern", pattern, "errors", pkg.Errors)
+				continue
+			}
+			if pkg.Name == "main" {
+				targets = append(targets, "main")
+			} else {
+				targets = append(targets, pkg.PkgPath)
+			}
+			found = true
+		}
+		if !found {
+			return nil, ex.Newf("no packages match %s", pattern)
+		}
+	}
+	slices.Sort(targets)
+	return slices.Compact(targets), nil
+}
+
+// newTraceRule creates the span rule tracing the functions of the target, or
+// its methods if recv is not empty.
+func (opts *traceOptions) newTraceRule(target, recv string) (*rule.InstSpanRule, error) {
+	fields := map[string]any{"target": target, "func": traceAllFuncs, "span": tracePackagesSpanName}
+	if recv != "" {
+		fields["recv"] = recv
+	}
+	if opts.include != "" {
+		fields["include"] = opts.include
+	}
+	if opts.exclude != "" {
+		fields["exclude"] = opts.exclude
+	}
+	if opts.minDuration > 0 {
+		fields["min_duration"] = opts.minDuration.String()
+	}
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, ex.Wrap(err)
+	}
+	return rule.NewInstSpanRule(data, tracePackagesRuleName)
+}
+
+// tracePackageRules returns the span rules of the --trace-* flags.
+func (sp *SetupPhase) tracePackageRules(ctx context.Context) ([]rule.InstRule, error) {
+	if sp.trace == nil || len(sp.trace.packages) == 0 {
+		return nil, nil
+	}
+	targets, err := sp.resolveTraceTargets(ctx, sp.trace.packages)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]rule.InstRule, 0, 2*len(targets))
+	for _, target := range targets {
+		for _, recv := range []string{"", traceAllRecvs} {
+			r, err1 := sp.trace.newTraceRule(target, recv)
+			if err1 != nil {
+				return nil, ex.Wrapf(err1, "invalid --trace-* flags")
+			}
+			rules = append(rules, r)
+		}
+	}
+	sp.Info("Trace packages", "patterns", sp.trace.packages, "targets", targets)
+	return rules, nil
+}
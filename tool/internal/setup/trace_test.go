@@ -0,0 +1,79 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/internal/rule"
+)
+
+func TestTracePackageRules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                  "module example.com/app\n\ngo 1.24\n",
+		"main.go":                 "package main\n\nfunc main() {}\n",
+		"internal/store/store.go": "package store\n\nfunc Get() {}\n",
+		"internal/cache/cache.go": "package cache\n\nfunc Get() {}\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	t.Chdir(dir)
+
+	sp := newTestSetupPhase()
+	rules, err := sp.tracePackageRules(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, rules, "no packages are traced by default")
+
+	sp.trace = &traceOptions{
+		packages:    []string{"./internal/...", ".", "example.com/lib/..."},
+		include:     `^\(\*store\)\.|^Get$`,
+		exclude:     `^\(\*cache\)\.`,
+		minDuration: time.Millisecond,
+	}
+	rules, err = sp.tracePackageRules(t.Context())
+	require.NoError(t, err)
+	targets := make([]string, 0)
+	for i, r := range rules {
+		sr := r.(*rule.InstSpanRule)
+		targets = append(targets, sr.Target)
+		assert.Equal(t, tracePackagesRuleName, sr.Name)
+		assert.Equal(t, traceAllFuncs, sr.Func)
+		assert.Equal(t, `^\(\*store\)\.|^Get$`, sr.Include)
+		assert.Equal(t, `^\(\*cache\)\.`, sr.Exclude)
+		assert.Equal(t, time.Millisecond, sr.SpanMinDuration())
+		// Functions and methods are traced by different rules
+		if i%2 == 0 {
+			assert.Empty(t, sr.Recv)
+		} else {
+			assert.Equal(t, traceAllRecvs, sr.Recv)
+		}
+	}
+	assert.Equal(t, []string{
+		"example.com/app/internal/cache", "example.com/app/internal/cache",
+		"example.com/app/internal/store", "example.com/app/internal/store",
+		"example.com/lib/...", "example.com/lib/...",
+		"main", "main",
+	}, targets)
+
+	sp.trace = &traceOptions{packages: []string{"./missing/..."}}
+	_, err = sp.tracePackageRules(t.Context())
+	require.ErrorContains(t, err, "no packages match ./missing/...")
+
+	sp.trace = &traceOptions{packages: []string{"."}, exclude: "("}
+	_, err = sp.tracePackageRules(t.Context())
+	require.ErrorContains(t, err, `invalid exclude "("`)
+
+	sp.trace = &traceOptions{packages: []string{"."}, include: "("}
+	_, err = sp.tracePackageRules(t.Context())
+	require.ErrorContains(t, err, `invalid include "("`)
+}
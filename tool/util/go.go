@@ -6,6 +6,7 @@ package util
 import (
 	"bufio"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/open-telemetry/opentelemetry-go-compile-instrumentation/tool/ex"
@@ -36,6 +37,17 @@ func IsCompileCommand(line string) bool {
 	return true
 }
 
+// IsAsmCommand checks if the command runs the assembler for a package, which
+// gives the import path by the -p flag. Unlike the other commands, the tool is
+// told by its name, as the paths of the assembled files may contain anything.
+func IsAsmCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	name := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	return name == "asm" && FindFlagValue(args, "-p") != ""
+}
+
 // isCgoCommand checks if the line is a cgo tool invocation with -objdir and -importpath flags.
 func IsCgoCommand(line string) bool {
 	return strings.Contains(line, "cgo") &&
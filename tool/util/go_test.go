@@ -91,6 +91,53 @@ func TestIsCompileCommand(t *testing.T) {
 	}
 }
 
+func TestIsAsmCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected bool
+	}{
+		{
+			name: "assemble command",
+			args: []string{
+				"/usr/local/go/pkg/tool/linux_amd64/asm", "-p", "math", "-I", "/tmp/b001/",
+				"-o", "/tmp/b001/dim_amd64.o", "./dim_amd64.s",
+			},
+			expected: true,
+		},
+		{
+			name:     "gensymabis command",
+			args:     []string{"asm", "-p", "main", "-gensymabis", "-o", "/tmp/b001/symabis", "./a_amd64.s"},
+			expected: true,
+		},
+		{
+			name:     "windows executable",
+			args:     []string{"asm.exe", "-p", "main", "a_amd64.s"},
+			expected: true,
+		},
+		{
+			name:     "missing -p flag",
+			args:     []string{"asm", "-o", "/tmp/b001/a.o", "./a_amd64.s"},
+			expected: false,
+		},
+		{
+			name:     "compile command",
+			args:     []string{"/usr/local/go/pkg/tool/linux_amd64/compile", "-p", "main", "-o", "/tmp/b001/_pkg_.a"},
+			expected: false,
+		},
+		{
+			name:     "empty command",
+			args:     nil,
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsAsmCommand(tt.args))
+		})
+	}
+}
+
 func TestIsCgoCommand(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
@@ -21,6 +22,20 @@ func GetMatchedRuleFile() string {
 	return GetBuildTemp(matchedRuleFile)
 }
 
+// GetExportsFile returns the file recording the export data of the packages
+// imported by the injected code, by their import paths.
+func GetExportsFile() string {
+	const exportsFile = "exports.json"
+	return GetBuildTemp(exportsFile)
+}
+
+// PackageExport describes the export data of a package as built by the go build
+// command, i.e. with its flags and toolexec.
+type PackageExport struct {
+	ImportPath string `json:"import_path"` // The resolved import path, e.g. vendor/golang.org/x/net/dns/dnsmessage
+	File       string `json:"file"`        // The archive that contains the export data
+}
+
 func GetOtelWorkDir() string {
 	wd := os.Getenv(EnvOtelWorkDir)
 	if wd == "" {
@@ -40,6 +55,16 @@ func GetBuildTemp(name string) string {
 	return filepath.Join(GetOtelWorkDir(), BuildTempDir, name)
 }
 
+// GetRuleDir returns the local directory of the hook code at the rule path. The
+// path is either a local path or a module path of the extracted pkg module.
+func GetRuleDir(path string) string {
+	if PathExists(path) {
+		return path
+	}
+	p := strings.TrimPrefix(path, OtelRoot)
+	return filepath.Join(GetBuildTempDir(), p)
+}
+
 func copyBackupFiles(names []string, src, dst string) error {
 	var err error
 	for _, name := range names {